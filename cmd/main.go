@@ -3,13 +3,17 @@ package main
 import (
 	"log"
 	"net/http"
+	"os"
 
+	"go-base-web-server/internal/arena"
 	"go-base-web-server/internal/auth"
 	"go-base-web-server/internal/config"
+	"go-base-web-server/internal/generation"
 	"go-base-web-server/internal/handlers"
 	"go-base-web-server/internal/llm"
 	"go-base-web-server/internal/middleware"
 	"go-base-web-server/internal/storage"
+	"go-base-web-server/internal/uploads"
 
 	"github.com/gorilla/mux"
 )
@@ -18,18 +22,22 @@ func main() {
 	// 加载配置
 	cfg := config.Load()
 
-	// 初始化数据库
-	qaStorage, err := storage.NewQAStorage(cfg.DBPath)
-	if err != nil {
-		log.Fatalf("初始化数据库失败: %v", err)
+	// 数据库迁移子命令: migrate up | down [n] | status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(cfg.DatabaseURL, os.Args[2:]))
 	}
-	defer qaStorage.Close()
 
-	// 初始化用户存储
-	userStorage := storage.NewUserStorage(qaStorage.GetDB())
-	if err := userStorage.InitUserTables(); err != nil {
-		log.Fatalf("初始化用户表失败: %v", err)
+	// 存储一致性检查子命令: storecheck
+	if len(os.Args) > 1 && os.Args[1] == "storecheck" {
+		os.Exit(runStoreCheck())
+	}
+
+	// 初始化数据库（按DATABASE_URL选择SQLite或PostgreSQL）
+	store, err := storage.Open(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("初始化数据库失败: %v", err)
 	}
+	defer store.Close()
 
 	// 初始化LLM客户端
 	llmClient := llm.NewClient(llm.Config{
@@ -37,6 +45,20 @@ func main() {
 		APIKey:   cfg.LLMAPIKey,
 		APIURL:   cfg.LLMAPIURL,
 		Model:    cfg.LLMModel,
+
+		SystemPrompt:   cfg.LLMSystemPrompt,
+		AllowedModels:  cfg.LLMAllowedModels,
+		EmbeddingModel: cfg.LLMEmbeddingModel,
+		UtilityModel:   cfg.LLMUtilityModel,
+
+		StructuredMaxRetries: cfg.LLMStructuredRetries,
+		Cache: llm.CacheConfig{
+			Enabled:             cfg.LLMCacheEnabled,
+			TTL:                 cfg.LLMCacheTTL,
+			SimilarityThreshold: cfg.LLMCacheSimilarity,
+			Scope:               cfg.LLMCacheScope,
+			MaxEntries:          cfg.LLMCacheMaxEntries,
+		},
 	})
 	if err := llmClient.CheckConnection(); err != nil {
 		log.Printf("LLM连接检查失败: %v", err)
@@ -46,10 +68,47 @@ func main() {
 	jwtService := auth.NewJWTService(cfg.JWTSecret)
 
 	// 创建应用实例
-	app := handlers.NewApp(qaStorage, llmClient)
+	// 流式生成管理器（后台生成工作池）
+	generations := generation.NewManager(generation.Config{
+		Workers:    cfg.GenerationWorkers,
+		QueueSize:  cfg.GenerationQueueSize,
+		Background: cfg.GenerationBackground,
+		Retention:  cfg.GenerationBufferTTL,
+	})
+
+	// 上传图片的磁盘存储
+	uploadStore, err := uploads.NewStore(cfg.UploadDir, cfg.UploadMaxBytes, cfg.UploadQuotaBytes)
+	if err != nil {
+		log.Fatalf("初始化上传目录失败: %v", err)
+	}
+
+	// 模型竞技场的参赛模型（每个模型独立的LLM客户端）
+	modelArena, err := arena.New(llm.Config{
+		Provider:      cfg.LLMProvider,
+		Model:         cfg.LLMModel,
+		SystemPrompt:  cfg.LLMSystemPrompt,
+		AllowedModels: cfg.LLMAllowedModels,
+	}, cfg.ArenaModels, cfg.ArenaCredentials)
+	if err != nil {
+		log.Fatalf("初始化模型竞技场失败: %v", err)
+	}
+
+	app := handlers.NewApp(store, llmClient, generations, uploadStore, modelArena, handlers.ConversationConfig{
+		Titles:       cfg.ConversationTitles,
+		SummaryTurns: cfg.ConversationSummaryTurns,
+	}, handlers.MemoryConfig{
+		Enabled:     cfg.MemoryEnabled,
+		MaxPerUser:  cfg.MemoryMaxPerUser,
+		PromptLimit: cfg.MemoryPromptLimit,
+	}, handlers.WebSocketConfig{
+		AllowedOrigins: cfg.WSAllowedOrigins,
+	})
+
+	// 后台为历史记录补齐语义搜索向量
+	go app.BackfillEmbeddings()
 
 	// 创建认证处理器
-	authHandlers := auth.NewAuthHandlers(userStorage, jwtService)
+	authHandlers := auth.NewAuthHandlers(store, jwtService)
 
 	// 创建路由器
 	r := mux.NewRouter()
@@ -61,34 +120,93 @@ func main() {
 	// 公开路由（不需要认证）
 	r.HandleFunc("/", app.HomeHandler).Methods("GET")
 	r.HandleFunc("/api/health", app.HealthHandler).Methods("GET")
+	r.HandleFunc("/api/share/{slug}", app.GetSharedHandler).Methods("GET")
 
 	// 认证相关路由
 	r.HandleFunc("/api/auth/register", authHandlers.RegisterHandler).Methods("POST", "OPTIONS")
 	r.HandleFunc("/api/auth/login", authHandlers.LoginHandler).Methods("POST", "OPTIONS")
 	r.HandleFunc("/api/auth/logout", authHandlers.LogoutHandler).Methods("POST", "OPTIONS")
 
+	// WebSocket聊天通道（握手时认证，支持匿名）
+	r.Handle("/api/ws", auth.WebSocketAuthMiddleware(jwtService, store)(http.HandlerFunc(app.WebSocketHandler))).Methods("GET")
+
 	// 可选认证路由（支持匿名和认证用户）
 	optionalAuth := r.PathPrefix("/api").Subrouter()
-	optionalAuth.Use(auth.OptionalAuthMiddleware(jwtService, userStorage))
-	optionalAuth.HandleFunc("/ask", app.AskHandler).Methods("GET")
-	optionalAuth.HandleFunc("/ask/stream", app.AskStreamHandler).Methods("GET")
+	optionalAuth.Use(auth.OptionalAuthMiddleware(jwtService, store))
+	optionalAuth.HandleFunc("/ask", app.AskHandler).Methods("GET", "POST", "OPTIONS")
+	optionalAuth.HandleFunc("/ask/stream", app.AskStreamHandler).Methods("GET", "POST", "OPTIONS")
 	optionalAuth.HandleFunc("/records", app.GetRecordsHandler).Methods("GET")
+	optionalAuth.HandleFunc("/records/search", app.SearchRecordsHandler).Methods("GET")
 	optionalAuth.HandleFunc("/records/{id:[0-9]+}", app.GetRecordHandler).Methods("GET")
+	optionalAuth.HandleFunc("/records/{id:[0-9]+}/stream", app.RecordStreamHandler).Methods("GET")
+	optionalAuth.HandleFunc("/records/{id:[0-9]+}/cancel", app.CancelRecordHandler).Methods("POST", "OPTIONS")
+	optionalAuth.HandleFunc("/records/{id:[0-9]+}/visibility", app.UpdateRecordVisibilityHandler).Methods("PUT", "OPTIONS")
+	optionalAuth.HandleFunc("/records/{id:[0-9]+}/candidates", app.ListCandidatesHandler).Methods("GET")
+	optionalAuth.HandleFunc("/records/{id:[0-9]+}/candidates/preferred", app.SetPreferredCandidateHandler).Methods("PUT", "OPTIONS")
+	optionalAuth.HandleFunc("/records/{id:[0-9]+}/regenerate", app.RegenerateRecordHandler).Methods("POST", "OPTIONS")
+	optionalAuth.HandleFunc("/records/{id:[0-9]+}/edit", app.EditRecordHandler).Methods("POST", "OPTIONS")
+	optionalAuth.HandleFunc("/records/{id:[0-9]+}/versions", app.ListRecordVersionsHandler).Methods("GET")
+	optionalAuth.HandleFunc("/records/{id:[0-9]+}/tree", app.GetConversationTreeHandler).Methods("GET")
+	optionalAuth.HandleFunc("/conversations", app.ListConversationsHandler).Methods("GET")
+	optionalAuth.HandleFunc("/conversations/{id:[0-9]+}", app.GetConversationHandler).Methods("GET")
+	optionalAuth.HandleFunc("/conversations/{id:[0-9]+}", app.UpdateConversationHandler).Methods("PUT", "OPTIONS")
+	optionalAuth.HandleFunc("/records/{id:[0-9]+}/feedback", app.SubmitFeedbackHandler).Methods("POST", "OPTIONS")
+	optionalAuth.HandleFunc("/records/{id:[0-9]+}/feedback", app.GetFeedbackHandler).Methods("GET")
+	optionalAuth.HandleFunc("/records/{id:[0-9]+}/share", app.CreateShareHandler).Methods("POST", "OPTIONS")
+	optionalAuth.HandleFunc("/records/{id:[0-9]+}/shares", app.ListSharesHandler).Methods("GET")
+	optionalAuth.HandleFunc("/share/{slug}", app.RevokeShareHandler).Methods("DELETE", "OPTIONS")
+	optionalAuth.HandleFunc("/personas", app.ListPersonasHandler).Methods("GET")
+	optionalAuth.HandleFunc("/personas", app.CreatePersonaHandler).Methods("POST", "OPTIONS")
+	optionalAuth.HandleFunc("/personas/{id:[0-9]+}", app.GetPersonaHandler).Methods("GET")
+	optionalAuth.HandleFunc("/personas/{id:[0-9]+}", app.UpdatePersonaHandler).Methods("PUT", "OPTIONS")
+	optionalAuth.HandleFunc("/personas/{id:[0-9]+}", app.DeletePersonaHandler).Methods("DELETE")
+	optionalAuth.HandleFunc("/uploads", app.UploadHandler).Methods("POST", "OPTIONS")
+	optionalAuth.HandleFunc("/uploads/{id:[0-9]+}", app.GetUploadHandler).Methods("GET")
+	optionalAuth.HandleFunc("/uploads/{id:[0-9]+}", app.DeleteUploadHandler).Methods("DELETE")
+	optionalAuth.HandleFunc("/compare", app.CompareHandler).Methods("POST", "OPTIONS")
+	optionalAuth.HandleFunc("/compare/models", app.ListArenaModelsHandler).Methods("GET")
+	optionalAuth.HandleFunc("/compare/{id:[0-9]+}", app.GetComparisonHandler).Methods("GET")
+	optionalAuth.HandleFunc("/compare/{id:[0-9]+}/vote", app.VoteComparisonHandler).Methods("POST", "OPTIONS")
+	optionalAuth.HandleFunc("/arena/leaderboard", app.ArenaLeaderboardHandler).Methods("GET")
+	optionalAuth.HandleFunc("/feedback/stats", app.FeedbackStatsHandler).Methods("GET")
+	optionalAuth.HandleFunc("/feedback/export", app.ExportFeedbackHandler).Methods("GET")
+	optionalAuth.HandleFunc("/feedback/preferences", app.ExportCandidatePreferencesHandler).Methods("GET")
 
 	// 需要认证的路由
 	authRequired := r.PathPrefix("/api/user").Subrouter()
-	authRequired.Use(auth.AuthMiddleware(jwtService, userStorage))
+	authRequired.Use(auth.AuthMiddleware(jwtService, store))
 	authRequired.HandleFunc("/profile", authHandlers.ProfileHandler).Methods("GET", "OPTIONS")
 	authRequired.HandleFunc("/refresh-token", authHandlers.RefreshTokenHandler).Methods("POST", "OPTIONS")
 	authRequired.HandleFunc("/records", app.GetUserRecordsHandler).Methods("GET", "OPTIONS")
+	authRequired.HandleFunc("/persona", app.SetDefaultPersonaHandler).Methods("PUT", "OPTIONS")
+	authRequired.HandleFunc("/preferences", app.UpdatePreferencesHandler).Methods("PUT", "OPTIONS")
+	authRequired.HandleFunc("/memories", app.ListMemoriesHandler).Methods("GET")
+	authRequired.HandleFunc("/memories", app.CreateMemoryHandler).Methods("POST", "OPTIONS")
+	authRequired.HandleFunc("/memories", app.ClearMemoriesHandler).Methods("DELETE")
+	authRequired.HandleFunc("/memories/{id:[0-9]+}", app.UpdateMemoryHandler).Methods("PUT", "OPTIONS")
+	authRequired.HandleFunc("/memories/{id:[0-9]+}", app.DeleteMemoryHandler).Methods("DELETE")
 	authRequired.HandleFunc("/users", authHandlers.GetUsersHandler).Methods("GET", "OPTIONS") // 管理员功能
 
+	// 提示词模板（需要认证，所有者管理，被共享的用户可查看和运行）
+	templateRoutes := r.PathPrefix("/api/templates").Subrouter()
+	templateRoutes.Use(auth.AuthMiddleware(jwtService, store))
+	templateRoutes.HandleFunc("", app.ListTemplatesHandler).Methods("GET")
+	templateRoutes.HandleFunc("", app.CreateTemplateHandler).Methods("POST", "OPTIONS")
+	templateRoutes.HandleFunc("/{id:[0-9]+}", app.GetTemplateHandler).Methods("GET")
+	templateRoutes.HandleFunc("/{id:[0-9]+}", app.UpdateTemplateHandler).Methods("PUT", "OPTIONS")
+	templateRoutes.HandleFunc("/{id:[0-9]+}", app.DeleteTemplateHandler).Methods("DELETE")
+	templateRoutes.HandleFunc("/{id:[0-9]+}/versions", app.ListTemplateVersionsHandler).Methods("GET")
+	templateRoutes.HandleFunc("/{id:[0-9]+}/shares", app.ListTemplateSharesHandler).Methods("GET")
+	templateRoutes.HandleFunc("/{id:[0-9]+}/shares", app.ShareTemplateHandler).Methods("POST", "OPTIONS")
+	templateRoutes.HandleFunc("/{id:[0-9]+}/shares/{user_id:[0-9]+}", app.UnshareTemplateHandler).Methods("DELETE")
+	templateRoutes.HandleFunc("/{id:[0-9]+}/run", app.RunTemplateHandler).Methods("POST", "OPTIONS")
+
 	// 服务器配置
 	port := ":" + cfg.Port
 
 	log.Printf("🚀 LLM问答系统后端API启动成功")
 	log.Printf("📍 API服务器地址: http://localhost%s", port)
-	log.Printf("💾 数据库路径: %s", cfg.DBPath)
+	log.Printf("💾 数据库: %s (%s)", store.Dialect(), storage.RedactDSN(cfg.DatabaseURL))
 	log.Printf("🤖 LLM模式: %s", cfg.GetLLMMode())
 	log.Printf("🔐 用户认证: 已启用")
 	log.Printf("🌐 前端项目: ./frontend/ (独立运行)")
@@ -112,14 +230,69 @@ func printAPIRoutes() {
 	log.Println("     POST /api/auth/register   - 用户注册")
 	log.Println("     POST /api/auth/login      - 用户登录")
 	log.Println("     POST /api/auth/logout     - 用户登出")
+	log.Println("     GET  /api/share/{slug}    - 通过分享链接查看内容")
 	log.Println("   可选认证路由:")
 	log.Println("     GET  /api/ask             - 智能问答（支持匿名）")
-	log.Println("     GET  /api/ask/stream      - 流式智能问答（支持匿名）- SSE")
-	log.Println("     GET  /api/records         - 获取所有记录")
-	log.Println("     GET  /api/records/{id}    - 获取特定记录")
+	log.Println("     GET  /api/ask/stream      - 流式智能问答（支持匿名，background=true后台生成）- SSE")
+	log.Println("     POST /api/ask             - 智能问答（JSON请求体，Accept: text/event-stream时返回SSE）")
+	log.Println("     POST /api/ask/stream      - 流式智能问答（JSON请求体）- SSE")
+	log.Println("     GET  /api/records         - 获取自己的记录（scope=public获取公开记录，管理员获取全部）")
+	log.Println("     GET  /api/records/{id}    - 获取特定记录（所有者/管理员/shared/public）")
+	log.Println("     GET  /api/records/{id}/stream - 重新连接记录的生成流 - SSE")
+	log.Println("     GET  /api/ws              - WebSocket聊天通道（ask/continue/cancel/ping）")
+	log.Println("     POST /api/records/{id}/cancel - 取消进行中的生成（仅所有者）")
+	log.Println("     PUT  /api/records/{id}/visibility - 修改记录可见性（仅所有者）")
+	log.Println("     GET  /api/records/{id}/candidates - 获取全部候选答案（n>1）")
+	log.Println("     PUT  /api/records/{id}/candidates/preferred - 选择首选候选答案（仅所有者）")
+	log.Println("     POST /api/records/{id}/regenerate - 重新生成答案，创建该轮的新版本（仅所有者，支持SSE）")
+	log.Println("     POST /api/records/{id}/edit - 编辑问题后重新提交，创建新的分支（仅所有者，支持SSE）")
+	log.Println("     GET  /api/records/{id}/versions - 获取同一轮的全部版本")
+	log.Println("     GET  /api/records/{id}/tree - 获取记录所在会话的完整树")
+	log.Println("     GET  /api/conversations - 获取自己的会话列表（自动生成的标题和摘要）")
+	log.Println("     GET  /api/conversations/{id} - 获取会话的标题和摘要")
+	log.Println("     PUT  /api/conversations/{id} - 修改会话标题（仅所有者）")
+	log.Println("     POST /api/records/{id}/feedback - 评价答案（好评/差评、问题类型、说明，重复提交覆盖）")
+	log.Println("     GET  /api/records/{id}/feedback - 获取评价数量和自己的评价")
+	log.Println("     POST /api/records/{id}/share - 创建分享链接（仅所有者）")
+	log.Println("     GET  /api/records/{id}/shares - 获取分享链接列表（仅所有者）")
+	log.Println("     DELETE /api/share/{slug}  - 撤销分享链接（仅所有者）")
+	log.Println("     GET  /api/records/search  - 搜索问答记录（需要登录，关键词+语义）")
+	log.Println("     GET  /api/personas        - 获取角色列表")
+	log.Println("     GET  /api/personas/{id}   - 获取特定角色")
+	log.Println("     POST /api/personas        - 创建角色（管理员）")
+	log.Println("     PUT  /api/personas/{id}   - 更新角色（管理员）")
+	log.Println("     DELETE /api/personas/{id} - 删除角色（管理员）")
+	log.Println("     POST /api/uploads         - 上传图片（需要登录，multipart file字段，提问时作为image附件）")
+	log.Println("     GET  /api/uploads/{id}    - 获取上传的图片（仅所有者）")
+	log.Println("     DELETE /api/uploads/{id}  - 删除上传的图片（仅所有者）")
+	log.Println("     POST /api/compare         - 模型竞技场：同一问题并发发送给2-4个模型对比 - SSE")
+	log.Println("     GET  /api/compare/models  - 获取竞技场可选的模型")
+	log.Println("     GET  /api/compare/{id}    - 获取对比结果（所有者/管理员）")
+	log.Println("     POST /api/compare/{id}/vote - 投票选出最佳答案或平局（仅所有者）")
+	log.Println("     GET  /api/arena/leaderboard - 竞技场Elo排行榜（管理员）")
+	log.Println("     GET  /api/feedback/stats  - 评价汇总（管理员）")
+	log.Println("     GET  /api/feedback/export - 导出评价及问答，默认差评（管理员，jsonl/csv）")
+	log.Println("     GET  /api/feedback/preferences - 导出候选答案的选择记录（管理员，jsonl）")
 	log.Println("   需要认证路由:")
 	log.Println("     GET  /api/user/profile    - 获取用户资料")
 	log.Println("     POST /api/user/refresh-token - 刷新token")
 	log.Println("     GET  /api/user/records    - 获取用户记录")
+	log.Println("     PUT  /api/user/persona    - 设置默认角色")
+	log.Println("     PUT  /api/user/preferences - 更新用户偏好（是否显示思考过程）")
+	log.Println("     GET  /api/user/memories   - 获取长期记忆")
+	log.Println("     POST /api/user/memories   - 添加长期记忆")
+	log.Println("     DELETE /api/user/memories - 清空长期记忆")
+	log.Println("     PUT  /api/user/memories/{id} - 修改长期记忆")
+	log.Println("     DELETE /api/user/memories/{id} - 删除长期记忆")
 	log.Println("     GET  /api/user/users      - 获取用户列表（管理员）")
+	log.Println("     GET  /api/templates       - 获取自己的和共享给自己的模板")
+	log.Println("     POST /api/templates       - 创建提示词模板")
+	log.Println("     GET  /api/templates/{id}  - 获取模板（version参数获取历史版本）")
+	log.Println("     PUT  /api/templates/{id}  - 更新模板（内容变化时生成新版本，仅所有者）")
+	log.Println("     DELETE /api/templates/{id} - 删除模板（仅所有者）")
+	log.Println("     GET  /api/templates/{id}/versions - 获取模板版本历史")
+	log.Println("     POST /api/templates/{id}/shares - 共享模板给其他用户（仅所有者）")
+	log.Println("     GET  /api/templates/{id}/shares - 获取模板共享列表（仅所有者）")
+	log.Println("     DELETE /api/templates/{id}/shares/{user_id} - 取消共享（仅所有者）")
+	log.Println("     POST /api/templates/{id}/run - 用变量渲染模板并流式回答 - SSE")
 }
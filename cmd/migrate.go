@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"go-base-web-server/internal/storage"
+)
+
+// runMigrate 执行数据库迁移子命令，返回进程退出码
+func runMigrate(dsn string, args []string) int {
+	if len(args) == 0 {
+		printMigrateUsage()
+		return 2
+	}
+
+	db, err := storage.OpenDB(dsn)
+	if err != nil {
+		log.Printf("打开数据库失败: %v", err)
+		return 1
+	}
+	defer db.Close()
+
+	migrator, err := storage.NewMigrator(db)
+	if err != nil {
+		log.Printf("加载迁移失败: %v", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "up":
+		count, err := migrator.Up()
+		if err != nil {
+			log.Printf("迁移失败: %v", err)
+			return 1
+		}
+		fmt.Printf("已应用 %d 个迁移\n", count)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				fmt.Fprintf(os.Stderr, "无效的回滚步数: %s\n", args[1])
+				return 2
+			}
+			steps = n
+		}
+		count, err := migrator.Down(steps)
+		if err != nil {
+			log.Printf("回滚失败: %v", err)
+			return 1
+		}
+		fmt.Printf("已回滚 %d 个迁移\n", count)
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			log.Printf("查询迁移状态失败: %v", err)
+			return 1
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-30s  %s\n", s.Version, s.Name, state)
+		}
+
+	default:
+		printMigrateUsage()
+		return 2
+	}
+
+	return 0
+}
+
+// printMigrateUsage 打印迁移子命令用法
+func printMigrateUsage() {
+	fmt.Fprintln(os.Stderr, `用法: server migrate <command>
+
+  up          应用所有未执行的迁移
+  down [n]    回滚最近的n个迁移（默认1）
+  status      查看迁移状态`)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go-base-web-server/internal/storage"
+	"go-base-web-server/internal/storage/storetest"
+)
+
+// storeCheckPostgresEnv 一致性检查使用的PostgreSQL DSN（未设置或不可连接时跳过）
+const storeCheckPostgresEnv = "STORECHECK_POSTGRES_DSN"
+
+// runStoreCheck 对各存储后端执行一致性检查，返回进程退出码。
+// SQLite始终在临时数据库上执行；PostgreSQL仅在配置了可连接的DSN时执行
+func runStoreCheck() int {
+	tmpDir, err := os.MkdirTemp("", "storecheck")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "创建临时目录失败: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(tmpDir)
+
+	failed := checkStore("sqlite", filepath.Join(tmpDir, "storecheck.db"))
+
+	if dsn := os.Getenv(storeCheckPostgresEnv); dsn != "" {
+		failed += checkStore("postgres", dsn)
+	} else {
+		fmt.Printf("[postgres] 跳过: 未设置 %s\n", storeCheckPostgresEnv)
+	}
+
+	if failed > 0 {
+		fmt.Printf("共 %d 个用例失败\n", failed)
+		return 1
+	}
+	return 0
+}
+
+// checkStore 打开存储并执行全部用例，返回失败数量；PostgreSQL不可连接时跳过
+func checkStore(name, dsn string) int {
+	store, err := storage.Open(dsn)
+	if err != nil {
+		if name == "postgres" {
+			fmt.Printf("[%s] 跳过: 无法连接数据库: %v\n", name, err)
+			return 0
+		}
+		fmt.Printf("[%s] 打开存储失败: %v\n", name, err)
+		return 1
+	}
+	defer store.Close()
+
+	failed := 0
+	for _, result := range storetest.Run(store) {
+		if result.Err != nil {
+			failed++
+			fmt.Printf("[%s] FAIL %-20s %v\n", name, result.Name, result.Err)
+			continue
+		}
+		fmt.Printf("[%s] ok   %-20s %v\n", name, result.Name, result.Duration.Round(time.Microsecond))
+	}
+	return failed
+}
@@ -0,0 +1,204 @@
+// Package arena 模型竞技场：同一问题并发发送给多个Provider/模型，记录各自的延迟、token用量和费用，
+// 并根据用户投票计算Elo排名。
+package arena
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-base-web-server/internal/llm"
+)
+
+const (
+	// MinContestants 一次对比的最少模型数
+	MinContestants = 2
+	// MaxContestants 一次对比的最多模型数
+	MaxContestants = 4
+)
+
+// ErrUnknownContestant 请求的模型不在竞技场配置中
+var ErrUnknownContestant = errors.New("未配置的竞技场模型")
+
+// Contestant 参赛模型，每个模型使用独立的LLM客户端
+type Contestant struct {
+	Name     string // provider/model，对比结果、投票和排行榜中的标识
+	Provider string
+	Model    string
+
+	client *llm.Client
+}
+
+// Arena 竞技场配置的全部参赛模型
+type Arena struct {
+	contestants []*Contestant
+	byName      map[string]*Contestant
+}
+
+// Credentials 按Provider获取API密钥和地址
+type Credentials func(provider string) (apiKey, apiURL string)
+
+// New 按 provider:model 列表创建竞技场，列表为空时使用base的Provider下的默认模型和允许的模型
+func New(base llm.Config, specs []string, credentials Credentials) (*Arena, error) {
+	if len(specs) == 0 {
+		for _, model := range append([]string{base.Model}, base.AllowedModels...) {
+			if model != "" {
+				specs = append(specs, base.Provider+":"+model)
+			}
+		}
+	}
+
+	arena := &Arena{byName: make(map[string]*Contestant)}
+	for _, spec := range specs {
+		provider, model, ok := strings.Cut(spec, ":")
+		provider, model = strings.ToLower(strings.TrimSpace(provider)), strings.TrimSpace(model)
+		if !ok || provider == "" || model == "" {
+			return nil, fmt.Errorf("无效的竞技场模型配置: %q（格式为 provider:model）", spec)
+		}
+
+		name := provider + "/" + model
+		if _, exists := arena.byName[name]; exists {
+			continue
+		}
+
+		apiKey, apiURL := credentials(provider)
+		contestant := &Contestant{
+			Name:     name,
+			Provider: provider,
+			Model:    model,
+			client: llm.NewClient(llm.Config{
+				Provider:     provider,
+				APIKey:       apiKey,
+				APIURL:       apiURL,
+				Model:        model,
+				SystemPrompt: base.SystemPrompt,
+			}),
+		}
+		arena.contestants = append(arena.contestants, contestant)
+		arena.byName[name] = contestant
+	}
+	return arena, nil
+}
+
+// Contestants 全部参赛模型，按配置顺序
+func (a *Arena) Contestants() []*Contestant {
+	return a.contestants
+}
+
+// Select 按名称选择参赛模型，names为空时选择全部；返回的模型数须在MinContestants和MaxContestants之间
+func (a *Arena) Select(names []string) ([]*Contestant, error) {
+	if len(names) == 0 {
+		if len(a.contestants) < MinContestants || len(a.contestants) > MaxContestants {
+			return nil, fmt.Errorf("竞技场配置了%d个模型，请指定%d-%d个参与对比的模型", len(a.contestants), MinContestants, MaxContestants)
+		}
+		return a.contestants, nil
+	}
+
+	selected := make([]*Contestant, 0, len(names))
+	seen := make(map[string]bool)
+	for _, name := range names {
+		contestant, ok := a.byName[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownContestant, name)
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		selected = append(selected, contestant)
+	}
+	if len(selected) < MinContestants || len(selected) > MaxContestants {
+		return nil, fmt.Errorf("请指定%d-%d个不同的模型", MinContestants, MaxContestants)
+	}
+	return selected, nil
+}
+
+// SupportsStreaming 该模型的Provider是否支持流式输出
+func (c *Contestant) SupportsStreaming() bool {
+	return c.client.SupportsStreaming()
+}
+
+// ValidateParams 按该模型的参数范围校验生成参数
+func (c *Contestant) ValidateParams(prompt llm.Prompt) error {
+	return c.client.ValidateParams(c.Model, prompt.Params)
+}
+
+// Result 一个模型的生成结果，出错或取消时为已生成的部分
+type Result struct {
+	Answer           string
+	FinishReason     string
+	Latency          time.Duration
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64 // 美元，模型不在价格表中时为0
+}
+
+// Run 生成答案：支持流式输出的Provider每个增量调用一次onDelta，其余Provider生成完成后以完整答案调用一次
+func (c *Contestant) Run(ctx context.Context, prompt llm.Prompt, onDelta func(content string)) (*Result, error) {
+	start := time.Now()
+	result := &Result{}
+	defer func() {
+		result.Latency = time.Since(start)
+		result.Cost = Cost(c.Model, result.PromptTokens, result.CompletionTokens)
+	}()
+
+	if !c.client.SupportsStreaming() {
+		completion, err := c.client.Complete(ctx, prompt)
+		if err != nil {
+			return result, err
+		}
+		result.Answer, result.FinishReason = completion.Content, completion.FinishReason
+		if completion.Usage != nil {
+			result.PromptTokens, result.CompletionTokens = completion.Usage.PromptTokens, completion.Usage.CompletionTokens
+		}
+		onDelta(completion.Content)
+		return result, nil
+	}
+
+	prompt.StreamUsage = true
+	responseChan, errorChan, err := c.client.ChatCompletionStream(ctx, prompt)
+	if err != nil {
+		return result, err
+	}
+
+	var answer strings.Builder
+	for {
+		select {
+		case resp, ok := <-responseChan:
+			if !ok {
+				result.Answer = answer.String()
+				if result.FinishReason == "" {
+					result.FinishReason = "stop"
+				}
+				return result, nil
+			}
+			if resp.Usage != nil {
+				result.PromptTokens, result.CompletionTokens = resp.Usage.PromptTokens, resp.Usage.CompletionTokens
+			}
+			for _, choice := range resp.Choices {
+				if choice.FinishReason != "" {
+					result.FinishReason = choice.FinishReason
+				}
+				if choice.Delta == nil {
+					continue
+				}
+				if content, ok := choice.Delta.Content.(string); ok && content != "" {
+					answer.WriteString(content)
+					onDelta(content)
+				}
+			}
+
+		case err, ok := <-errorChan:
+			if ok && err != nil {
+				result.Answer = answer.String()
+				return result, err
+			}
+
+		case <-ctx.Done():
+			result.Answer = answer.String()
+			return result, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package arena
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// InitialRating 模型的初始Elo分
+	InitialRating = 1000.0
+	// kFactor 每场比较的最大分数变化
+	kFactor = 32.0
+)
+
+// Match 一次投票的对比：获胜模型与其余每个模型各记一场胜负，平局时两两记为平局
+type Match struct {
+	Contestants []string
+	Winner      string // 为空表示平局
+}
+
+// Rating 模型的Elo分和战绩
+type Rating struct {
+	Name    string  `json:"model"`
+	Rating  float64 `json:"rating"`
+	Wins    int     `json:"wins"`
+	Losses  int     `json:"losses"`
+	Ties    int     `json:"ties"`
+	Matches int     `json:"matches"` // 参与的已投票对比数
+}
+
+// Leaderboard 按时间顺序回放投票计算Elo排名，按分数从高到低排序
+func Leaderboard(matches []Match) []Rating {
+	ratings := make(map[string]*Rating)
+	get := func(name string) *Rating {
+		if rating, ok := ratings[name]; ok {
+			return rating
+		}
+		rating := &Rating{Name: name, Rating: InitialRating}
+		ratings[name] = rating
+		return rating
+	}
+
+	for _, match := range matches {
+		for _, name := range match.Contestants {
+			get(name).Matches++
+		}
+
+		if match.Winner != "" {
+			winner := get(match.Winner)
+			for _, name := range match.Contestants {
+				if name == match.Winner {
+					continue
+				}
+				loser := get(name)
+				update(winner, loser, 1)
+				winner.Wins++
+				loser.Losses++
+			}
+			continue
+		}
+
+		for i := 0; i < len(match.Contestants); i++ {
+			for j := i + 1; j < len(match.Contestants); j++ {
+				a, b := get(match.Contestants[i]), get(match.Contestants[j])
+				update(a, b, 0.5)
+				a.Ties++
+				b.Ties++
+			}
+		}
+	}
+
+	result := make([]Rating, 0, len(ratings))
+	for _, rating := range ratings {
+		rating.Rating = math.Round(rating.Rating*10) / 10
+		result = append(result, *rating)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Rating != result[j].Rating {
+			return result[i].Rating > result[j].Rating
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// update 按a的得分（胜1、平0.5）更新两个模型的分数
+func update(a, b *Rating, score float64) {
+	expected := 1 / (1 + math.Pow(10, (b.Rating-a.Rating)/400))
+	delta := kFactor * (score - expected)
+	a.Rating += delta
+	b.Rating -= delta
+}
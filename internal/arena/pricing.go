@@ -0,0 +1,44 @@
+package arena
+
+import "strings"
+
+// price 模型单价（美元/百万token）
+type price struct {
+	prefix     string
+	prompt     float64
+	completion float64
+}
+
+// prices 参考各厂商公开价格，仅用于对比估算；按模型名前缀匹配，较长的前缀排在前面
+var prices = []price{
+	{"gpt-4o-mini", 0.15, 0.6},
+	{"gpt-4o", 2.5, 10},
+	{"gpt-4.1-nano", 0.1, 0.4},
+	{"gpt-4.1-mini", 0.4, 1.6},
+	{"gpt-4.1", 2, 8},
+	{"gpt-4-turbo", 10, 30},
+	{"gpt-4", 30, 60},
+	{"gpt-3.5-turbo", 0.5, 1.5},
+	{"o1-mini", 1.1, 4.4},
+	{"o3-mini", 1.1, 4.4},
+	{"o1", 15, 60},
+	{"gemini-1.5-flash", 0.075, 0.3},
+	{"gemini-1.5-pro", 1.25, 5},
+	{"gemini-2.0-flash", 0.1, 0.4},
+	{"deepseek-chat", 0.27, 1.1},
+	{"deepseek-reasoner", 0.55, 2.19},
+	{"qwen-turbo", 0.05, 0.2},
+	{"qwen-plus", 0.4, 1.2},
+	{"qwen-max", 1.6, 6.4},
+}
+
+// Cost 按价格表估算一次生成的费用（美元），未知模型返回0
+func Cost(model string, promptTokens, completionTokens int) float64 {
+	model = strings.ToLower(model)
+	for _, p := range prices {
+		if strings.HasPrefix(model, p.prefix) {
+			return (float64(promptTokens)*p.prompt + float64(completionTokens)*p.completion) / 1e6
+		}
+	}
+	return 0
+}
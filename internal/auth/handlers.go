@@ -5,18 +5,25 @@ import (
 	"log"
 	"net/http"
 
+	"go-base-web-server/internal/storage"
+
 	"github.com/go-playground/validator/v10"
 )
 
 // 全局验证器实例
 var validate = validator.New()
 
+// Validator 返回全局验证器实例，供其他处理器复用
+func Validator() *validator.Validate {
+	return validate
+}
+
 // UserStorageService 用户存储服务接口
 type UserStorageService interface {
-	CreateUser(username, email, password string) (interface{}, error)
-	ValidateUser(username, password string) (interface{}, error)
+	CreateUser(username, email, password string) (*storage.User, error)
+	ValidateUser(username, password string) (*storage.User, error)
 	UpdateUserLastLogin(userID int) error
-	GetAllUsers() (interface{}, error)
+	GetAllUsers() ([]storage.User, error)
 }
 
 // AuthHandlers 认证处理器结构体
@@ -109,10 +116,8 @@ func (ah *AuthHandlers) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 更新最后登录时间
-	if userID := ah.getUserID(user); userID > 0 {
-		if err := ah.userStorage.UpdateUserLastLogin(userID); err != nil {
-			log.Printf("更新用户最后登录时间失败: %v", err)
-		}
+	if err := ah.userStorage.UpdateUserLastLogin(user.ID); err != nil {
+		log.Printf("更新用户最后登录时间失败: %v", err)
 	}
 
 	// 生成JWT token
@@ -196,7 +201,7 @@ func (ah *AuthHandlers) GetUsersHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	username := ah.getUserField(currentUser, "Username")
+	username := currentUser.Username
 	log.Printf("管理员请求用户列表: %s", username)
 
 	// 获取所有用户
@@ -220,7 +225,7 @@ func (ah *AuthHandlers) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 
 	// 从上下文获取用户信息（如果有的话）
 	if user, ok := GetUserFromContext(r); ok {
-		username := ah.getUserField(user, "Username")
+		username := user.Username
 		log.Printf("用户登出: %s", username)
 	}
 
@@ -232,31 +237,6 @@ func (ah *AuthHandlers) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // generateTokenForUser 为用户生成token的辅助方法
-func (ah *AuthHandlers) generateTokenForUser(user interface{}) (string, error) {
-	userID := ah.getUserID(user)
-	username := ah.getUserField(user, "Username")
-	email := ah.getUserField(user, "Email")
-
-	return ah.jwtService.GenerateToken(userID, username, email)
-}
-
-// getUserID 获取用户ID的辅助方法
-func (ah *AuthHandlers) getUserID(user interface{}) int {
-	if userMap, ok := user.(map[string]interface{}); ok {
-		if id, ok := userMap["id"].(int); ok {
-			return id
-		}
-	}
-	// 使用反射或类型断言来获取ID
-	return 0
-}
-
-// getUserField 获取用户字段的辅助方法
-func (ah *AuthHandlers) getUserField(user interface{}, field string) string {
-	if userMap, ok := user.(map[string]interface{}); ok {
-		if value, ok := userMap[field].(string); ok {
-			return value
-		}
-	}
-	return ""
+func (ah *AuthHandlers) generateTokenForUser(user *storage.User) (string, error) {
+	return ah.jwtService.GenerateToken(user.ID, user.Username, user.Email)
 }
@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+
+	"go-base-web-server/internal/storage"
 )
 
 // UserStorage 用户存储接口
 type UserStorage interface {
-	GetUserByID(id int) (interface{}, error)
+	GetUserByID(id int) (*storage.User, error)
 }
 
 // AuthMiddleware JWT认证中间件
@@ -89,10 +91,49 @@ func OptionalAuthMiddleware(jwtService *JWTService, userStorage UserStorage) fun
 	}
 }
 
+// WebSocketAuthMiddleware WebSocket握手认证中间件：浏览器无法为WebSocket设置请求头，
+// token可通过Authorization header或token查询参数传递；未携带token时按匿名处理，token无效时拒绝升级
+func WebSocketAuthMiddleware(jwtService *JWTService, userStorage UserStorage) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString := r.URL.Query().Get("token")
+			if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+				tokenParts := strings.Split(authHeader, " ")
+				if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+					respondWithError(w, http.StatusUnauthorized, "无效的Authorization header格式")
+					return
+				}
+				tokenString = tokenParts[1]
+			}
+
+			if tokenString == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims, err := jwtService.ValidateToken(tokenString)
+			if err != nil {
+				respondWithError(w, http.StatusUnauthorized, fmt.Sprintf("token验证失败: %v", err))
+				return
+			}
+
+			user, err := userStorage.GetUserByID(claims.UserID)
+			if err != nil {
+				respondWithError(w, http.StatusUnauthorized, "用户不存在或已被禁用")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "user", user)
+			ctx = context.WithValue(ctx, "user_id", claims.UserID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
 // GetUserFromContext 从请求上下文获取用户信息
-func GetUserFromContext(r *http.Request) (interface{}, bool) {
-	user := r.Context().Value("user")
-	return user, user != nil
+func GetUserFromContext(r *http.Request) (*storage.User, bool) {
+	user, ok := r.Context().Value("user").(*storage.User)
+	return user, ok && user != nil
 }
 
 // GetUserIDFromContext 从请求上下文获取用户ID
@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"go-base-web-server/internal/storage"
+
 	"github.com/golang-jwt/jwt/v4"
 )
 
@@ -19,8 +21,8 @@ type UserLoginRequest struct {
 
 // UserLoginResponse 用户登录响应
 type UserLoginResponse struct {
-	User  interface{} `json:"user"`
-	Token string      `json:"token"`
+	User  *storage.User `json:"user"`
+	Token string        `json:"token"`
 }
 
 // JWTClaims JWT声明
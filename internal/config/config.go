@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -13,13 +16,59 @@ type Config struct {
 	Port string
 
 	// 数据库配置
-	DBPath string
+	DBPath      string
+	DatabaseURL string // 数据库DSN，postgres://... 使用PostgreSQL，未设置时使用DBPath的SQLite
 
 	// LLM配置
 	LLMProvider string
 	LLMAPIKey   string
 	LLMAPIURL   string
 	LLMModel    string
+	// 默认系统提示词（未选择角色且请求未指定时使用）
+	LLMSystemPrompt string
+	// 请求可指定的模型（逗号分隔），LLMModel始终可用
+	LLMAllowedModels []string
+	// 结构化输出校验失败后的最大重试次数
+	LLMStructuredRetries int
+
+	// 向量嵌入配置（语义搜索）
+	LLMEmbeddingModel string
+
+	// 辅助模型（会话标题、摘要等后台任务），为空时使用LLMModel
+	LLMUtilityModel string
+
+	// 会话标题和摘要配置
+	ConversationTitles       bool // 第一轮完成后自动生成标题
+	ConversationSummaryTurns int  // 未摘要的轮数超过该值时滚动更新摘要，0表示不生成摘要
+
+	// 用户长期记忆配置
+	MemoryEnabled     bool // 登录用户的问答完成后提取记忆，提问时附加相关记忆
+	MemoryMaxPerUser  int  // 每个用户最多保存的记忆条数，达到后不再自动提取
+	MemoryPromptLimit int  // 每次提问附加的最大记忆条数
+
+	// 应答缓存配置
+	LLMCacheEnabled    bool
+	LLMCacheTTL        time.Duration
+	LLMCacheSimilarity float64
+	LLMCacheScope      string
+	LLMCacheMaxEntries int
+
+	// 流式生成配置（客户端断开后在后台继续生成）
+	GenerationBackground bool
+	GenerationWorkers    int
+	GenerationQueueSize  int
+	GenerationBufferTTL  time.Duration // 生成结束后事件缓冲保留时间（断线重连回放）
+
+	// WebSocket握手允许的Origin（逗号分隔，如 https://app.example.com），为空时只允许同源
+	WSAllowedOrigins []string
+
+	// 图片上传配置（文件保存在本地磁盘）
+	UploadDir        string
+	UploadMaxBytes   int64
+	UploadQuotaBytes int64 // 每个用户上传文件的总字节数上限
+
+	// 模型竞技场参赛模型（逗号分隔，格式为 provider:model），为空时使用LLMModel和LLMAllowedModels
+	ArenaModels []string
 
 	// JWT配置
 	JWTSecret string
@@ -35,16 +84,47 @@ func Load() *Config {
 		log.Println("未找到.env文件，使用系统环境变量")
 	}
 
-	return &Config{
-		Port:        getEnv("PORT", "8080"),
-		DBPath:      getEnv("DB_PATH", "./qa_database.db"),
-		LLMProvider: getEnv("LLM_PROVIDER", "openai"),
-		LLMAPIKey:   getEnv("LLM_API_KEY", ""),
-		LLMAPIURL:   getEnv("LLM_API_URL", ""),
-		LLMModel:    getEnv("LLM_MODEL", ""),
-		JWTSecret:   getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-this-in-production"),
-		LogLevel:    getEnv("LOG_LEVEL", "info"),
+	cfg := &Config{
+		Port:                     getEnv("PORT", "8080"),
+		DBPath:                   getEnv("DB_PATH", "./qa_database.db"),
+		DatabaseURL:              getEnv("DATABASE_URL", ""),
+		LLMProvider:              getEnv("LLM_PROVIDER", "openai"),
+		LLMAPIKey:                getEnv("LLM_API_KEY", ""),
+		LLMAPIURL:                getEnv("LLM_API_URL", ""),
+		LLMModel:                 getEnv("LLM_MODEL", ""),
+		LLMSystemPrompt:          getEnv("LLM_SYSTEM_PROMPT", ""),
+		LLMAllowedModels:         getEnvList("LLM_ALLOWED_MODELS"),
+		LLMStructuredRetries:     getEnvInt("LLM_STRUCTURED_MAX_RETRIES", 2),
+		LLMEmbeddingModel:        getEnv("LLM_EMBEDDING_MODEL", ""),
+		LLMUtilityModel:          getEnv("LLM_UTILITY_MODEL", ""),
+		ConversationTitles:       getEnvBool("CONVERSATION_TITLES", true),
+		ConversationSummaryTurns: getEnvInt("CONVERSATION_SUMMARY_TURNS", 8),
+		MemoryEnabled:            getEnvBool("MEMORY_ENABLED", true),
+		MemoryMaxPerUser:         getEnvInt("MEMORY_MAX_PER_USER", 100),
+		MemoryPromptLimit:        getEnvInt("MEMORY_PROMPT_LIMIT", 8),
+		LLMCacheEnabled:          getEnvBool("LLM_CACHE_ENABLED", false),
+		LLMCacheTTL:              getEnvDuration("LLM_CACHE_TTL", 24*time.Hour),
+		LLMCacheSimilarity:       getEnvFloat("LLM_CACHE_SIMILARITY", 0.95),
+		LLMCacheScope:            getEnv("LLM_CACHE_SCOPE", "global"),
+		LLMCacheMaxEntries:       getEnvInt("LLM_CACHE_MAX_ENTRIES", 1000),
+		GenerationBackground:     getEnvBool("GENERATION_BACKGROUND", false),
+		GenerationWorkers:        getEnvInt("GENERATION_WORKERS", 4),
+		GenerationQueueSize:      getEnvInt("GENERATION_QUEUE_SIZE", 32),
+		GenerationBufferTTL:      getEnvDuration("GENERATION_BUFFER_TTL", 5*time.Minute),
+		WSAllowedOrigins:         getEnvList("WS_ALLOWED_ORIGINS"),
+		UploadDir:                getEnv("UPLOAD_DIR", "./uploads"),
+		UploadMaxBytes:           int64(getEnvInt("UPLOAD_MAX_BYTES", 10<<20)),
+		UploadQuotaBytes:         int64(getEnvInt("UPLOAD_QUOTA_BYTES", 100<<20)),
+		ArenaModels:              getEnvList("ARENA_MODELS"),
+		JWTSecret:                getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-this-in-production"),
+		LogLevel:                 getEnv("LOG_LEVEL", "info"),
 	}
+
+	if cfg.DatabaseURL == "" {
+		cfg.DatabaseURL = cfg.DBPath
+	}
+
+	return cfg
 }
 
 // getEnv 获取环境变量，如果不存在则返回默认值
@@ -55,6 +135,59 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvList 获取逗号分隔的列表类型环境变量
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvBool 获取布尔类型环境变量
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvInt 获取整数类型环境变量
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvFloat 获取浮点类型环境变量
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvDuration 获取时长类型环境变量（如 30m、24h）
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// ArenaCredentials 获取竞技场中指定Provider的API密钥和地址：与主Provider相同时复用LLM配置，
+// 其他Provider读取 ARENA_<PROVIDER>_API_KEY 和 ARENA_<PROVIDER>_API_URL
+func (c *Config) ArenaCredentials(provider string) (apiKey, apiURL string) {
+	if strings.EqualFold(provider, c.LLMProvider) {
+		return c.LLMAPIKey, c.LLMAPIURL
+	}
+	prefix := "ARENA_" + strings.ToUpper(provider) + "_"
+	return getEnv(prefix+"API_KEY", ""), getEnv(prefix+"API_URL", "")
+}
+
 // GetLLMMode 获取LLM运行模式
 func (c *Config) GetLLMMode() string {
 	if c.LLMAPIKey != "" {
@@ -0,0 +1,299 @@
+package generation
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull 后台工作池队列已满
+	ErrQueueFull = errors.New("后台生成队列已满")
+	// ErrCancelled 生成被显式取消（作为取消原因，可通过context.Cause区分客户端断开）
+	ErrCancelled = errors.New("用户取消生成")
+)
+
+// RunFunc 生成任务，通过gen.Emit发布事件，ctx取消时应尽快结束
+type RunFunc func(ctx context.Context, gen *Generation)
+
+// Event 生成过程中的一个事件
+type Event struct {
+	ID   int                    // 从1开始递增的事件序号
+	Data map[string]interface{} // 事件内容（包含type字段）
+}
+
+// Generation 一次生成，缓存全部事件以便客户端断线重连后从任意事件序号继续
+type Generation struct {
+	RecordID   int
+	Background bool // 是否与请求解耦在后台工作池中运行
+	StartedAt  time.Time
+
+	cancel   context.CancelCauseFunc
+	finished chan struct{} // 生成结束时关闭
+	queued   *job          // 在后台队列中等待的任务，取消时不再等待工作池
+
+	mu         sync.Mutex
+	started    bool // 任务是否已开始执行（由工作池或取消时认领，只执行一次）
+	events     []Event
+	done       bool
+	finishedAt time.Time
+	wake       chan struct{} // 有新事件或结束时关闭并替换，用于通知订阅者
+}
+
+func newGeneration(recordID int, background bool) *Generation {
+	return &Generation{
+		RecordID:   recordID,
+		Background: background,
+		StartedAt:  time.Now(),
+		finished:   make(chan struct{}),
+		wake:       make(chan struct{}),
+	}
+}
+
+// Emit 发布事件
+func (g *Generation) Emit(data map[string]interface{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.done {
+		return
+	}
+	g.events = append(g.events, Event{ID: len(g.events) + 1, Data: data})
+	close(g.wake)
+	g.wake = make(chan struct{})
+}
+
+// EventsAfter 返回序号大于after的事件、生成是否已结束，以及等待后续事件的通道
+func (g *Generation) EventsAfter(after int) ([]Event, bool, <-chan struct{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if after < 0 {
+		after = 0
+	}
+	var events []Event
+	if after < len(g.events) {
+		events = append(events, g.events[after:]...)
+	}
+	return events, g.done, g.wake
+}
+
+// Finished 返回生成结束时关闭的通道
+func (g *Generation) Finished() <-chan struct{} {
+	return g.finished
+}
+
+// Done 生成是否已结束
+func (g *Generation) Done() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.done
+}
+
+// claim 认领任务的执行权，已被认领时返回false
+func (g *Generation) claim() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.started {
+		return false
+	}
+	g.started = true
+	return true
+}
+
+// finish 标记生成结束并通知所有订阅者
+func (g *Generation) finish() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.done {
+		return
+	}
+	g.done = true
+	g.finishedAt = time.Now()
+	close(g.wake)
+	close(g.finished)
+}
+
+// expired 生成结束后超过保留时间
+func (g *Generation) expired(now time.Time, retention time.Duration) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.done && now.Sub(g.finishedAt) > retention
+}
+
+// job 工作池任务
+type job struct {
+	ctx context.Context
+	gen *Generation
+	run RunFunc
+}
+
+// Config 生成管理器配置
+type Config struct {
+	Workers    int  // 后台工作池并发数
+	QueueSize  int  // 后台任务等待队列长度
+	Background bool // 流式请求默认是否在后台生成（请求可通过background参数覆盖）
+	// Retention 生成结束后事件在内存中的保留时间，期间断线的客户端仍可按事件序号补齐
+	Retention time.Duration
+}
+
+// Manager 生成管理器：后台任务在有界工作池中运行，生成按记录ID登记，结束后保留一段时间供重连回放
+type Manager struct {
+	config Config
+	jobs   chan job
+
+	mu          sync.Mutex
+	generations map[int]*Generation
+}
+
+// NewManager 创建生成管理器并启动后台工作池
+func NewManager(config Config) *Manager {
+	if config.Workers <= 0 {
+		config.Workers = 4
+	}
+	if config.QueueSize < 0 {
+		config.QueueSize = 0
+	}
+	if config.Retention <= 0 {
+		config.Retention = 5 * time.Minute
+	}
+
+	m := &Manager{
+		config:      config,
+		jobs:        make(chan job, config.QueueSize),
+		generations: make(map[int]*Generation),
+	}
+	for i := 0; i < config.Workers; i++ {
+		go m.worker()
+	}
+	go m.cleanupLoop()
+	return m
+}
+
+// cleanupLoop 定期清理超过保留时间的已结束生成
+func (m *Manager) cleanupLoop() {
+	interval := m.config.Retention / 2
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		m.mu.Lock()
+		for recordID, gen := range m.generations {
+			if gen.expired(now, m.config.Retention) {
+				delete(m.generations, recordID)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// BackgroundByDefault 流式请求默认是否在后台生成
+func (m *Manager) BackgroundByDefault() bool {
+	return m.config.Background
+}
+
+// worker 从队列中取出任务执行
+func (m *Manager) worker() {
+	for j := range m.jobs {
+		m.execute(j)
+	}
+}
+
+// Start 启动一次生成。
+// background为true时任务与请求上下文解耦，进入后台工作池运行，队列已满时退化为随请求运行；
+// 否则任务随parent取消（客户端断开即停止生成）
+func (m *Manager) Start(parent context.Context, recordID int, background bool, run RunFunc) *Generation {
+	if background {
+		ctx, cancel := context.WithCancelCause(context.Background())
+		gen := newGeneration(recordID, true)
+		gen.cancel = cancel
+		gen.queued = &job{ctx: ctx, gen: gen, run: run}
+		m.register(gen)
+
+		select {
+		case m.jobs <- *gen.queued:
+			log.Printf("记录 %d 已加入后台生成队列", recordID)
+			return gen
+		default:
+			cancel(ErrQueueFull)
+			m.unregister(gen)
+			log.Printf("%v，记录 %d 改为随请求生成", ErrQueueFull, recordID)
+		}
+	}
+
+	ctx, cancel := context.WithCancelCause(parent)
+	gen := newGeneration(recordID, false)
+	gen.cancel = cancel
+	m.register(gen)
+	go m.execute(job{ctx: ctx, gen: gen, run: run})
+	return gen
+}
+
+// execute 执行任务，结束后保留事件直到超过保留时间；任务已在排队时被取消并执行过则跳过
+func (m *Manager) execute(j job) {
+	if !j.gen.claim() {
+		return
+	}
+	m.run(j)
+}
+
+// run 运行任务并在结束时标记生成结束
+func (m *Manager) run(j job) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("记录 %d 生成任务异常: %v", j.gen.RecordID, r)
+			j.gen.Emit(map[string]interface{}{"type": "error", "error": "生成任务异常"})
+		}
+		j.gen.cancel(nil)
+		j.gen.finish()
+	}()
+
+	j.run(j.ctx, j.gen)
+}
+
+// Cancel 取消记录进行中的生成（取消原因为ErrCancelled），返回被取消的生成；
+// 仍在后台队列中等待的任务立即以已取消的上下文执行（由任务保存取消状态并发布事件），不再等待工作池。
+// 没有进行中的生成时返回false
+func (m *Manager) Cancel(recordID int) (*Generation, bool) {
+	gen := m.Get(recordID)
+	if gen == nil || gen.Done() {
+		return nil, false
+	}
+	gen.cancel(ErrCancelled)
+	if gen.queued != nil && gen.claim() {
+		log.Printf("记录 %d 的生成在排队中被取消", recordID)
+		go m.run(*gen.queued)
+		return gen, true
+	}
+	log.Printf("记录 %d 的生成已被取消", recordID)
+	return gen, true
+}
+
+// Get 获取记录的生成（进行中或仍在保留期内），不存在时返回nil
+func (m *Manager) Get(recordID int) *Generation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.generations[recordID]
+}
+
+func (m *Manager) register(gen *Generation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.generations[gen.RecordID] = gen
+}
+
+func (m *Manager) unregister(gen *Generation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.generations[gen.RecordID] == gen {
+		delete(m.generations, gen.RecordID)
+	}
+}
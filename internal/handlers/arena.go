@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+
+	"go-base-web-server/internal/arena"
+	"go-base-web-server/internal/auth"
+	"go-base-web-server/internal/llm"
+	"go-base-web-server/internal/storage"
+)
+
+// CompareRequest 模型竞技场对比请求：models为空时使用全部配置的模型
+type CompareRequest struct {
+	Prompt       string   `json:"prompt" validate:"required,max=32000"`
+	Models       []string `json:"models,omitempty" validate:"max=4,dive,min=1,max=200"`
+	SystemPrompt string   `json:"system_prompt,omitempty" validate:"max=8000"`
+	GenerationParamsRequest
+}
+
+// ArenaVoteRequest 竞技场投票请求：winner为获胜模型，tie为true表示平局
+type ArenaVoteRequest struct {
+	Winner string `json:"winner,omitempty" validate:"max=200"`
+	Tie    bool   `json:"tie,omitempty"`
+}
+
+// leaderboardEntry 排行榜中一个模型的Elo分、战绩和用量统计
+type leaderboardEntry struct {
+	arena.Rating
+	Stats *storage.ArenaModelStats `json:"stats,omitempty"`
+}
+
+// CompareHandler 模型竞技场：同一问题并发发送给2-4个模型，各模型的输出以index和model标记后复用同一个SSE连接
+func (app *App) CompareHandler(w http.ResponseWriter, r *http.Request) {
+	setSSEHeaders(w, r)
+
+	var req CompareRequest
+	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxAskBodyBytes)).Decode(&req); err != nil {
+		app.writeSSEError(w, "无效的JSON格式")
+		return
+	}
+	req.Prompt = strings.TrimSpace(req.Prompt)
+	if req.Prompt == "" {
+		app.writeSSEError(w, "缺少prompt参数")
+		return
+	}
+	if err := auth.Validator().Struct(req); err != nil {
+		app.writeSSEError(w, "参数验证失败: "+err.Error())
+		return
+	}
+
+	contestants, err := app.arena.Select(req.Models)
+	if err != nil {
+		app.writeSSEError(w, err.Error())
+		return
+	}
+	prompt := llm.Prompt{Question: req.Prompt, SystemPrompt: req.SystemPrompt, Params: req.GenerationParams()}
+	for _, contestant := range contestants {
+		if err := contestant.ValidateParams(prompt); err != nil {
+			app.writeSSEError(w, contestant.Name+": "+err.Error())
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		app.writeSSEError(w, "不支持流式响应")
+		return
+	}
+
+	owner, newAnonToken := ensureRecordOwner(w, r)
+	entries := make([]storage.ArenaEntry, 0, len(contestants))
+	for _, contestant := range contestants {
+		entries = append(entries, storage.ArenaEntry{Contestant: contestant.Name, Provider: contestant.Provider, Model: contestant.Model})
+	}
+	comparison, err := app.qaStorage.CreateComparison(storage.ArenaComparison{
+		Prompt:       req.Prompt,
+		SystemPrompt: req.SystemPrompt,
+		Entries:      entries,
+	}, owner)
+	if err != nil {
+		app.writeSSEError(w, "创建对比失败")
+		return
+	}
+
+	startEvent := map[string]interface{}{
+		"type":          "start",
+		"comparison_id": comparison.ID,
+		"prompt":        req.Prompt,
+		"models":        comparison.Entries,
+	}
+	if newAnonToken != "" {
+		startEvent["anonymous_token"] = newAnonToken
+	}
+	app.writeSSEData(w, startEvent)
+	flusher.Flush()
+
+	// 各模型并发生成，事件统一经events写入响应；客户端断开后继续消费事件直到全部模型结束
+	ctx := r.Context()
+	events := make(chan map[string]interface{}, 64)
+	results := make([]storage.ArenaEntry, len(contestants))
+	var wg sync.WaitGroup
+	for i, contestant := range contestants {
+		wg.Add(1)
+		go func(i int, contestant *arena.Contestant) {
+			defer wg.Done()
+			results[i] = app.runContestant(ctx, comparison.ID, i, contestant, prompt, events)
+		}(i, contestant)
+	}
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	for event := range events {
+		if ctx.Err() != nil {
+			continue
+		}
+		app.writeSSEData(w, event)
+		flusher.Flush()
+	}
+	if ctx.Err() != nil {
+		log.Printf("客户端断开连接，竞技场对比 %d 已取消", comparison.ID)
+		return
+	}
+
+	// end事件携带保存后的完整结果，读取失败时使用内存中的结果
+	var final interface{} = results
+	if saved, err := app.qaStorage.GetComparison(comparison.ID); err == nil {
+		final = saved.Entries
+	} else {
+		log.Printf("获取对比失败: %v", err)
+	}
+	app.writeSSEData(w, map[string]interface{}{
+		"type":          "end",
+		"comparison_id": comparison.ID,
+		"results":       final,
+	})
+	flusher.Flush()
+}
+
+// runContestant 生成一个模型的答案：增量以delta事件发送，结束时保存结果并发送done或error事件
+func (app *App) runContestant(ctx context.Context, comparisonID, index int, contestant *arena.Contestant, prompt llm.Prompt, events chan<- map[string]interface{}) storage.ArenaEntry {
+	result, err := contestant.Run(ctx, prompt, func(content string) {
+		events <- map[string]interface{}{
+			"type":    "delta",
+			"index":   index,
+			"model":   contestant.Name,
+			"content": content,
+		}
+	})
+
+	entry := storage.ArenaEntry{
+		ComparisonID:     comparisonID,
+		Index:            index,
+		Contestant:       contestant.Name,
+		Provider:         contestant.Provider,
+		Model:            contestant.Model,
+		Answer:           result.Answer,
+		Status:           storage.RecordStatusCompleted,
+		FinishReason:     result.FinishReason,
+		LatencyMs:        result.Latency.Milliseconds(),
+		PromptTokens:     result.PromptTokens,
+		CompletionTokens: result.CompletionTokens,
+		Cost:             result.Cost,
+	}
+	switch {
+	case ctx.Err() != nil:
+		entry.Status, entry.Error = storage.RecordStatusCancelled, "客户端断开连接"
+	case err != nil:
+		log.Printf("竞技场模型 %s 生成失败: %v", contestant.Name, err)
+		entry.Status, entry.Error = storage.RecordStatusFailed, err.Error()
+	}
+	if err := app.qaStorage.FinishArenaEntry(entry); err != nil {
+		log.Printf("保存竞技场结果失败，对比ID: %d, 模型: %s: %v", comparisonID, contestant.Name, err)
+	}
+
+	event := map[string]interface{}{
+		"type":              "done",
+		"index":             index,
+		"model":             contestant.Name,
+		"answer":            entry.Answer,
+		"finish_reason":     entry.FinishReason,
+		"latency_ms":        entry.LatencyMs,
+		"prompt_tokens":     entry.PromptTokens,
+		"completion_tokens": entry.CompletionTokens,
+		"cost":              entry.Cost,
+	}
+	if entry.Status != storage.RecordStatusCompleted {
+		event["type"] = "error"
+		event["error"] = entry.Error
+	}
+	events <- event
+	return entry
+}
+
+// ListArenaModelsHandler 获取竞技场可选的模型
+func (app *App) ListArenaModelsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	models := make([]map[string]interface{}, 0, len(app.arena.Contestants()))
+	for _, contestant := range app.arena.Contestants() {
+		models = append(models, map[string]interface{}{
+			"model":      contestant.Name,
+			"provider":   contestant.Provider,
+			"model_name": contestant.Model,
+			"streaming":  contestant.SupportsStreaming(),
+		})
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "获取竞技场模型成功",
+		"data": map[string]interface{}{
+			"models":          models,
+			"min_contestants": arena.MinContestants,
+			"max_contestants": arena.MaxContestants,
+		},
+		"status": "success",
+	})
+}
+
+// GetComparisonHandler 获取对比的全部结果和投票（所有者或管理员）
+func (app *App) GetComparisonHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	comparison, ok := app.loadComparison(w, r, isAdminRequest(r))
+	if !ok {
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "获取对比成功",
+		"data":    comparison,
+		"status":  "success",
+	})
+}
+
+// VoteComparisonHandler 为对比投票选出最佳答案或平局（仅所有者），重新投票覆盖之前的结果
+func (app *App) VoteComparisonHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	comparison, ok := app.loadComparison(w, r, false)
+	if !ok {
+		return
+	}
+
+	var req ArenaVoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的JSON格式"})
+		return
+	}
+	if err := auth.Validator().Struct(req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "参数验证失败: " + err.Error()})
+		return
+	}
+	if req.Tie == (req.Winner != "") {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "请指定winner或tie之一"})
+		return
+	}
+
+	var winner *storage.ArenaEntry
+	for i, entry := range comparison.Entries {
+		if !storage.IsTerminalStatus(entry.Status) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": "对比仍在生成中"})
+			return
+		}
+		if entry.Contestant == req.Winner {
+			winner = &comparison.Entries[i]
+		}
+	}
+	if !req.Tie {
+		if winner == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "获胜模型不在本次对比中"})
+			return
+		}
+		if winner.Status != storage.RecordStatusCompleted {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "获胜模型没有完成生成"})
+			return
+		}
+	}
+
+	if err := app.qaStorage.VoteComparison(comparison.ID, requestOwner(r).UserID, req.Winner); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "投票失败"})
+		return
+	}
+
+	updated, err := app.qaStorage.GetComparison(comparison.ID)
+	if err != nil {
+		log.Printf("获取对比失败: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取对比失败"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "投票成功",
+		"data":    updated,
+		"status":  "success",
+	})
+}
+
+// ArenaLeaderboardHandler 竞技场排行榜（管理员）：按投票时间回放计算Elo分，附带各模型的延迟、token和费用统计
+func (app *App) ArenaLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	storedMatches, err := app.qaStorage.ListArenaMatches()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取竞技场投票失败"})
+		return
+	}
+	stats, err := app.qaStorage.ArenaModelStats()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取竞技场统计失败"})
+		return
+	}
+
+	matches := make([]arena.Match, 0, len(storedMatches))
+	for _, match := range storedMatches {
+		matches = append(matches, arena.Match{Contestants: match.Contestants, Winner: match.Winner})
+	}
+
+	// 尚无投票的模型以初始分列出
+	statsByModel := make(map[string]*storage.ArenaModelStats, len(stats))
+	for i := range stats {
+		statsByModel[stats[i].Contestant] = &stats[i]
+	}
+	ranked := make(map[string]bool)
+	var entries []leaderboardEntry
+	for _, rating := range arena.Leaderboard(matches) {
+		ranked[rating.Name] = true
+		entries = append(entries, leaderboardEntry{Rating: rating, Stats: statsByModel[rating.Name]})
+	}
+	for i := range stats {
+		if !ranked[stats[i].Contestant] {
+			entries = append(entries, leaderboardEntry{
+				Rating: arena.Rating{Name: stats[i].Contestant, Rating: arena.InitialRating},
+				Stats:  &stats[i],
+			})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Rating.Rating > entries[j].Rating.Rating })
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "获取竞技场排行榜成功",
+		"data": map[string]interface{}{
+			"models":         entries,
+			"votes":          len(matches),
+			"initial_rating": arena.InitialRating,
+		},
+		"status": "success",
+	})
+}
+
+// loadComparison 按路径中的ID获取对比，不存在或请求者不是所有者（allowAdmin时管理员也可访问）时返回404
+func (app *App) loadComparison(w http.ResponseWriter, r *http.Request, allowAdmin bool) (*storage.ArenaComparison, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的ID格式"})
+		return nil, false
+	}
+
+	comparison, err := app.qaStorage.GetComparison(id)
+	if err != nil || !(allowAdmin || comparison.IsOwnedBy(requestOwner(r))) {
+		if err != nil {
+			log.Printf("获取对比失败: %v", err)
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "对比不存在"})
+		return nil, false
+	}
+	return comparison, true
+}
@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-base-web-server/internal/auth"
+	"go-base-web-server/internal/jsonschema"
+	"go-base-web-server/internal/llm"
+	"go-base-web-server/internal/storage"
+	"go-base-web-server/providers"
+)
+
+const (
+	// threadMaxTurns 继续会话时带入的最大历史轮数
+	threadMaxTurns = 10
+	// maxAskBodyBytes POST提问请求体的最大字节数
+	maxAskBodyBytes = 2 << 20
+)
+
+// AskRequest 提问请求：POST请求读取JSON请求体，GET请求从prompt/background查询参数构造
+type AskRequest struct {
+	Prompt string `json:"prompt" validate:"required,max=32000"`
+	// 上一轮问答记录（qa_records.id）的ID，在该记录所在的会话分支上追问；
+	// 与 /api/conversations/{id} 的会话ID（conversations.id）不同
+	ParentRecordID *int   `json:"parent_record_id,omitempty" validate:"omitempty,min=1"`
+	PersonaID      *int   `json:"persona_id,omitempty" validate:"omitempty,min=1"` // 使用的角色，默认沿用会话的角色或用户的默认角色
+	SystemPrompt   string `json:"system_prompt,omitempty" validate:"max=8000"`
+	Model          string `json:"model,omitempty" validate:"max=100"`
+	GenerationParamsRequest
+	Attachments    []AttachmentRequest    `json:"attachments,omitempty" validate:"max=8,dive"`
+	ResponseFormat *ResponseFormatRequest `json:"response_format,omitempty"`                    // 结构化输出
+	N              *int                   `json:"n,omitempty" validate:"omitempty,min=1,max=5"` // 候选答案数量，大于1时生成多个候选供对比
+	Background     *bool                  `json:"background,omitempty"`                         // 流式请求断开后是否继续生成
+
+	VersionOf *int `json:"-"` // 重新生成或编辑时新版本所属轮次的第一个版本，不从请求体读取
+}
+
+// ResponseFormatRequest 结构化输出要求（OpenAI兼容格式）：json_schema按schema校验模型输出，json_object只要求输出合法JSON，
+// 校验失败时带着错误重试至多max_retries次
+type ResponseFormatRequest struct {
+	Type       string             `json:"type" validate:"required,oneof=json_object json_schema"`
+	JSONSchema *JSONSchemaRequest `json:"json_schema,omitempty" validate:"required_if=Type json_schema"`
+	MaxRetries *int               `json:"max_retries,omitempty" validate:"omitempty,min=0,max=5"`
+}
+
+// JSONSchemaRequest 输出须符合的JSON Schema
+type JSONSchemaRequest struct {
+	Name   string          `json:"name,omitempty" validate:"max=64"`
+	Schema json.RawMessage `json:"schema" validate:"required"`
+}
+
+// GenerationParamsRequest 生成参数：通用范围在此校验，按模型的范围由LLMClient.ValidateParams校验
+type GenerationParamsRequest struct {
+	Temperature      *float64 `json:"temperature,omitempty" validate:"omitempty,gte=0,lte=2"`
+	TopP             *float64 `json:"top_p,omitempty" validate:"omitempty,gte=0,lte=1"`
+	MaxTokens        *int     `json:"max_tokens,omitempty" validate:"omitempty,min=1,max=32768"`
+	Stop             []string `json:"stop,omitempty" validate:"max=4,dive,min=1,max=64"`
+	Seed             *int     `json:"seed,omitempty" validate:"omitempty,min=0"`
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty" validate:"omitempty,gte=-2,lte=2"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty" validate:"omitempty,gte=-2,lte=2"`
+}
+
+// GenerationParams 转换为Provider的生成参数
+func (p GenerationParamsRequest) GenerationParams() providers.GenerationParams {
+	return providers.GenerationParams{
+		Temperature:      p.Temperature,
+		TopP:             p.TopP,
+		MaxTokens:        p.MaxTokens,
+		Stop:             p.Stop,
+		Seed:             p.Seed,
+		PresencePenalty:  p.PresencePenalty,
+		FrequencyPenalty: p.FrequencyPenalty,
+	}
+}
+
+// AttachmentRequest 问题附件：图片URL、上传的图片（POST /api/uploads返回的ID）或文本片段
+type AttachmentRequest struct {
+	Type     string `json:"type" validate:"required,oneof=image_url image text"`
+	URL      string `json:"url,omitempty" validate:"required_if=Type image_url,omitempty,url"`
+	UploadID *int   `json:"upload_id,omitempty" validate:"required_if=Type image,omitempty,min=1"`
+	Text     string `json:"text,omitempty" validate:"required_if=Type text,max=100000"`
+	Name     string `json:"name,omitempty" validate:"max=200"`
+}
+
+// preparedAsk 校验后的提问：生成输入、会话中的上一轮记录、使用的角色，以及重新生成或编辑时所属轮次的第一个版本
+type preparedAsk struct {
+	Prompt    llm.Prompt
+	ParentID  *int
+	PersonaID *int
+	VersionOf *int
+}
+
+// askError 带HTTP状态码的提问请求错误
+type askError struct {
+	status  int
+	message string
+}
+
+func (e *askError) Error() string {
+	return e.message
+}
+
+// decodeAskRequest 解析并校验提问请求
+func decodeAskRequest(r *http.Request) (AskRequest, error) {
+	var req AskRequest
+	if r.Method == http.MethodPost {
+		body := http.MaxBytesReader(nil, r.Body, maxAskBodyBytes)
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			return req, &askError{http.StatusBadRequest, "无效的JSON格式"}
+		}
+	} else {
+		req.Prompt = r.URL.Query().Get("prompt")
+		if value := r.URL.Query().Get("background"); value != "" {
+			if parsed, err := strconv.ParseBool(value); err == nil {
+				req.Background = &parsed
+			}
+		}
+	}
+
+	return req, validateAskRequest(&req)
+}
+
+// validateAskRequest 使用全局验证器校验提问请求
+func validateAskRequest(req *AskRequest) error {
+	req.Prompt = strings.TrimSpace(req.Prompt)
+	if req.Prompt == "" {
+		return &askError{http.StatusBadRequest, "缺少prompt参数"}
+	}
+	if err := auth.Validator().Struct(req); err != nil {
+		return &askError{http.StatusBadRequest, "参数验证失败: " + err.Error()}
+	}
+	return nil
+}
+
+// prepareAsk 构造生成输入：继续会话时校验会话归属并带入历史问答，按角色补全系统提示词、模型、生成参数和工具，
+// 再校验模型和生成参数；认证用户附加与问题相关的长期记忆
+func (app *App) prepareAsk(req AskRequest, owner storage.RecordOwner, isAdmin bool, defaultPersonaID *int) (*preparedAsk, error) {
+	ask := &preparedAsk{VersionOf: req.VersionOf}
+
+	var parent *storage.QARecord
+	if req.ParentRecordID != nil {
+		record, err := app.qaStorage.GetRecord(*req.ParentRecordID)
+		if err != nil || (!isAdmin && !record.IsOwnedBy(owner)) {
+			return nil, &askError{http.StatusNotFound, "会话不存在"}
+		}
+		parent = record
+		ask.ParentID = &parent.ID
+	}
+
+	prompt := llm.Prompt{
+		Question:     req.Prompt,
+		SystemPrompt: strings.TrimSpace(req.SystemPrompt),
+		Model:        req.Model,
+		Params:       req.GenerationParams(),
+	}
+
+	persona, err := app.resolvePersona(req.PersonaID, parent, defaultPersonaID)
+	if err != nil {
+		return nil, err
+	}
+	if persona != nil {
+		if err := applyPersona(&prompt, persona); err != nil {
+			log.Printf("角色 %d 配置无效: %v", persona.ID, err)
+			return nil, &askError{http.StatusInternalServerError, "角色配置无效"}
+		}
+		ask.PersonaID = &persona.ID
+	}
+
+	if !app.llmClient.ModelAllowed(prompt.Model) {
+		return nil, &askError{http.StatusBadRequest, fmt.Sprintf("不支持的模型: %s", prompt.Model)}
+	}
+	if err := app.llmClient.ValidateParams(prompt.Model, prompt.Params); err != nil {
+		return nil, &askError{http.StatusBadRequest, "参数验证失败: " + err.Error()}
+	}
+	if prompt.Model == app.llmClient.GetModelName() {
+		prompt.Model = ""
+	}
+
+	for _, attachment := range req.Attachments {
+		if attachment.Type == "image" {
+			image, err := app.loadUploadedImage(*attachment.UploadID, owner)
+			if err != nil {
+				return nil, err
+			}
+			prompt.Attachments = append(prompt.Attachments, image)
+			continue
+		}
+		prompt.Attachments = append(prompt.Attachments, llm.Attachment{
+			Type: attachment.Type,
+			URL:  attachment.URL,
+			Text: attachment.Text,
+			Name: attachment.Name,
+		})
+	}
+	if prompt.HasImages() && !app.llmClient.SupportsVision(prompt.Model) {
+		model := prompt.Model
+		if model == "" {
+			model = app.llmClient.GetModelName()
+		}
+		return nil, &askError{http.StatusBadRequest, fmt.Sprintf("模型 %s 不支持图片输入", model)}
+	}
+
+	if format := req.ResponseFormat; format != nil {
+		prompt.ResponseFormat = &llm.ResponseFormat{MaxRetries: format.MaxRetries}
+		if format.Type == "json_schema" {
+			schema, err := jsonschema.Compile(format.JSONSchema.Schema)
+			if err != nil {
+				return nil, &askError{http.StatusBadRequest, "无效的JSON Schema: " + err.Error()}
+			}
+			prompt.ResponseFormat.Name = format.JSONSchema.Name
+			prompt.ResponseFormat.Schema = schema
+			prompt.ResponseFormat.RawSchema = format.JSONSchema.Schema
+		}
+	}
+
+	if req.N != nil && *req.N > 1 {
+		// 多个候选答案依赖聊天完成接口的n参数；结构化输出按单个答案校验重试
+		if !app.llmClient.SupportsStreaming() {
+			return nil, &askError{http.StatusBadRequest, "当前LLM Provider不支持生成多个候选答案"}
+		}
+		if prompt.ResponseFormat != nil {
+			return nil, &askError{http.StatusBadRequest, "结构化输出不支持生成多个候选答案"}
+		}
+		prompt.N = *req.N
+	}
+
+	if parent != nil {
+		history, summary, err := app.conversationHistory(parent.ID)
+		if err != nil {
+			return nil, &askError{http.StatusInternalServerError, "加载会话历史失败"}
+		}
+		prompt.History, prompt.Summary = history, summary
+	}
+	if owner.UserID != nil {
+		prompt.Memories = app.relevantMemories(*owner.UserID, req.Prompt)
+	}
+
+	ask.Prompt = prompt
+	return ask, nil
+}
+
+// resolvePersona 确定提问使用的角色：请求指定 > 会话沿用 > 用户默认，均未设置时返回nil
+func (app *App) resolvePersona(personaID *int, parent *storage.QARecord, defaultPersonaID *int) (*storage.Persona, error) {
+	switch {
+	case personaID != nil:
+		persona, err := app.qaStorage.GetPersona(*personaID)
+		if err != nil {
+			return nil, &askError{http.StatusBadRequest, "角色不存在"}
+		}
+		return persona, nil
+	case parent != nil:
+		// 会话沿用开始时的角色，未使用角色的会话不套用默认角色
+		personaID = parent.PersonaID
+	default:
+		personaID = defaultPersonaID
+	}
+
+	if personaID == nil {
+		return nil, nil
+	}
+	persona, err := app.qaStorage.GetPersona(*personaID)
+	if err != nil {
+		// 角色已被删除时按未使用角色处理
+		log.Printf("加载角色 %d 失败: %v", *personaID, err)
+		return nil, nil
+	}
+	return persona, nil
+}
+
+// applyPersona 用角色补全请求未指定的系统提示词和模型；生成参数以角色为基础、请求中的参数优先
+func applyPersona(prompt *llm.Prompt, persona *storage.Persona) error {
+	if prompt.SystemPrompt == "" {
+		prompt.SystemPrompt = persona.SystemPrompt
+	}
+	if prompt.Model == "" {
+		prompt.Model = persona.Model
+	}
+
+	if len(persona.Params) > 0 {
+		var params providers.GenerationParams
+		if err := json.Unmarshal(persona.Params, &params); err != nil {
+			return err
+		}
+		prompt.Params = params.Merge(prompt.Params)
+	}
+	if len(persona.Tools) > 0 {
+		if err := json.Unmarshal(persona.Tools, &prompt.Tools); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveAskQuestion 保存问题（继续会话时关联上一轮记录），记录实际使用的模型、角色和生成参数
+func (app *App) saveAskQuestion(ask *preparedAsk, owner storage.RecordOwner) (int, error) {
+	prompt := ask.Prompt
+	question := storage.NewQuestion{
+		Question:  prompt.Question,
+		Owner:     owner,
+		Provider:  app.llmClient.GetProviderType(),
+		Model:     app.llmClient.GetModelName(),
+		ParentID:  ask.ParentID,
+		PersonaID: ask.PersonaID,
+		VersionOf: ask.VersionOf,
+	}
+	if prompt.Model != "" {
+		question.Model = prompt.Model
+	}
+	if !prompt.Params.IsZero() {
+		params, err := json.Marshal(prompt.Params)
+		if err != nil {
+			return 0, err
+		}
+		question.Params = params
+	}
+
+	return app.qaStorage.CreateQuestion(question)
+}
+
+// writeAskError 以JSON返回提问请求错误
+func writeAskError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if e, ok := err.(*askError); ok {
+		status = e.status
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// wantsEventStream 客户端是否要求SSE响应
+func wantsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// conversationHistory 加载recordID所在会话的最近threadMaxTurns轮已完成问答，作为追问的上下文；
+// 会话摘要覆盖到当前分支的某一轮时只带入之后的问答，之前的历史以摘要代替
+// （沿分支遍历到覆盖点为止，未摘要的轮数超过threadMaxTurns时摘要也不会丢失）
+func (app *App) conversationHistory(recordID int) ([]llm.Turn, string, error) {
+	thread, conversation, err := app.qaStorage.GetThreadSinceSummary(recordID, threadMaxTurns)
+	if err != nil {
+		log.Printf("加载会话历史失败: %v", err)
+		return nil, "", err
+	}
+
+	summary := ""
+	if conversation != nil {
+		summary = conversation.Summary
+	}
+
+	history := make([]llm.Turn, 0, len(thread))
+	for _, record := range thread {
+		if record.Status != storage.RecordStatusCompleted {
+			continue
+		}
+		history = append(history, llm.Turn{Question: record.Question, Answer: record.Answer})
+	}
+	return history, summary, nil
+}
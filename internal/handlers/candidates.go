@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-base-web-server/internal/auth"
+	"go-base-web-server/internal/llm"
+	"go-base-web-server/internal/storage"
+)
+
+// PreferredCandidateRequest 选择首选候选答案请求
+type PreferredCandidateRequest struct {
+	Index *int `json:"index" validate:"required,min=0"`
+}
+
+// ListCandidatesHandler 获取记录的全部候选答案，用于并排对比（可查看记录的请求者）
+func (app *App) ListCandidatesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	record, ok := app.loadRecord(w, r)
+	if !ok {
+		return
+	}
+	if !record.CanView(requestOwner(r), isAdminRequest(r)) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "记录不存在"})
+		return
+	}
+
+	candidates, err := app.qaStorage.ListCandidates(record.ID)
+	if err != nil {
+		log.Printf("获取候选答案失败: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取候选答案失败"})
+		return
+	}
+	if !requestShowReasoning(r) {
+		for i := range candidates {
+			candidates[i].Reasoning = ""
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "获取候选答案成功",
+		"data": map[string]interface{}{
+			"record_id":           record.ID,
+			"question":            record.Question,
+			"preferred_candidate": record.PreferredCandidate,
+			"candidates":          candidates,
+		},
+		"status": "success",
+	})
+}
+
+// SetPreferredCandidateHandler 选择首选候选答案（仅所有者），该候选成为记录的答案，追问时作为对话历史；
+// 每次选择连同未选中的候选序号一起保存，可通过 /api/feedback/preferences 导出
+func (app *App) SetPreferredCandidateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	record, ok := app.authorizeRecordOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var req PreferredCandidateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的JSON格式"})
+		return
+	}
+	if err := auth.Validator().Struct(req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "参数验证失败: " + err.Error()})
+		return
+	}
+	if !storage.IsTerminalStatus(record.Status) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "记录仍在生成中"})
+		return
+	}
+
+	err := app.qaStorage.SetPreferredCandidate(record.ID, *req.Index, requestOwner(r))
+	if errors.Is(err, storage.ErrCandidateNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "候选答案不存在"})
+		return
+	}
+	if err != nil {
+		log.Printf("设置首选候选失败: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "设置首选候选失败"})
+		return
+	}
+
+	updated, ok := app.loadRecord(w, r)
+	if !ok {
+		return
+	}
+	// 答案已替换为首选候选，重新生成向量
+	go app.indexRecordEmbedding(updated.ID, updated.Question, updated.Answer)
+	if !requestShowReasoning(r) {
+		updated.Reasoning = ""
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "设置首选候选成功",
+		"data":    updated,
+		"status":  "success",
+	})
+}
+
+// ExportCandidatePreferencesHandler 导出候选答案的选择记录（管理员，jsonl），每行包含选中和未选中的候选序号、
+// 问题及生成参数，用于分析提示词效果；支持provider、model、from/to、limit过滤
+func (app *App) ExportCandidatePreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	q, err := parseFeedbackQuery(r, "")
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultFeedbackExportLimit
+	}
+
+	items, err := app.qaStorage.ListCandidatePreferences(q)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "导出候选选择失败"})
+		return
+	}
+
+	filename := fmt.Sprintf("preferences-%s.jsonl", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	encoder := json.NewEncoder(w)
+	for _, item := range items {
+		encoder.Encode(item)
+	}
+}
+
+// streamCandidate 流式生成中一个候选答案的累积内容
+type streamCandidate struct {
+	answer       strings.Builder
+	reasoning    strings.Builder
+	finishReason string
+}
+
+// streamCandidates 流式生成中按choice index累积的候选答案，未请求多个候选时只有index 0
+type streamCandidates []*streamCandidate
+
+// get 返回index对应的候选，不存在时创建
+func (c *streamCandidates) get(index int) *streamCandidate {
+	if index < 0 {
+		index = 0
+	}
+	for len(*c) <= index {
+		*c = append(*c, &streamCandidate{})
+	}
+	return (*c)[index]
+}
+
+// result 构造生成结果：Answer等字段为第一个候选，有多个候选时填充Candidates；
+// finishReason为候选未提供结束原因时使用的值
+func (c *streamCandidates) result(finishReason string) storage.RecordResult {
+	first := c.get(0)
+	result := storage.RecordResult{
+		Answer:       first.answer.String(),
+		Reasoning:    first.reasoning.String(),
+		FinishReason: first.finishReason,
+	}
+	if result.FinishReason == "" {
+		result.FinishReason = finishReason
+	}
+	if len(*c) < 2 {
+		return result
+	}
+
+	for i, candidate := range *c {
+		reason := candidate.finishReason
+		if reason == "" {
+			reason = finishReason
+		}
+		result.Candidates = append(result.Candidates, storage.Candidate{
+			Index:        i,
+			Answer:       candidate.answer.String(),
+			Reasoning:    candidate.reasoning.String(),
+			FinishReason: reason,
+		})
+	}
+	return result
+}
+
+// choiceEvent 多个候选时为增量事件附加候选序号
+func choiceEvent(multi bool, index int, event map[string]interface{}) map[string]interface{} {
+	if multi {
+		event["index"] = index
+	}
+	return event
+}
+
+// recordCandidates 将LLM返回的候选答案转换为保存的格式
+func recordCandidates(candidates []llm.Candidate) []storage.Candidate {
+	if len(candidates) == 0 {
+		return nil
+	}
+	result := make([]storage.Candidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		result = append(result, storage.Candidate{
+			Index:        candidate.Index,
+			Answer:       candidate.Content,
+			Reasoning:    candidate.Reasoning,
+			FinishReason: candidate.FinishReason,
+		})
+	}
+	return result
+}
+
+// candidateViews end事件和问答响应中的候选答案
+func candidateViews(candidates []storage.Candidate, showReasoning bool) []map[string]interface{} {
+	views := make([]map[string]interface{}, 0, len(candidates))
+	for _, candidate := range candidates {
+		view := map[string]interface{}{
+			"index":         candidate.Index,
+			"answer":        candidate.Answer,
+			"finish_reason": candidate.FinishReason,
+		}
+		if showReasoning && candidate.Reasoning != "" {
+			view["reasoning"] = candidate.Reasoning
+		}
+		views = append(views, view)
+	}
+	return views
+}
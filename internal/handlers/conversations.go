@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-base-web-server/internal/auth"
+	"go-base-web-server/internal/llm"
+	"go-base-web-server/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultConversationLimit 会话列表的默认条数
+	defaultConversationLimit = 20
+	// maxConversationLimit 会话列表的最大条数
+	maxConversationLimit = 100
+	// conversationMaxTurns 更新会话时沿parent_id加载的最大轮数
+	conversationMaxTurns = 1000
+	// summaryKeepTurns 摘要时保留原文的最近轮数
+	summaryKeepTurns = 4
+	// conversationTaskTimeout 生成标题和摘要的超时时间
+	conversationTaskTimeout = 60 * time.Second
+)
+
+// ConversationConfig 会话标题和摘要的后台生成配置
+type ConversationConfig struct {
+	Titles       bool // 第一轮完成后生成标题
+	SummaryTurns int  // 未摘要的已完成轮数超过该值时滚动更新摘要（保留最近summaryKeepTurns轮原文），0表示不生成摘要
+}
+
+// UpdateConversationRequest 修改会话标题请求
+type UpdateConversationRequest struct {
+	Title string `json:"title" validate:"required,max=100"`
+}
+
+// ListConversationsHandler 按最近活动时间倒序获取请求者的会话（参数: limit, offset）
+func (app *App) ListConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	limit, offset := defaultConversationLimit, 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxConversationLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "无效的limit参数（1-100）"})
+			return
+		}
+		limit = parsed
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "无效的offset参数"})
+			return
+		}
+		offset = parsed
+	}
+
+	// 没有匿名令牌的匿名请求没有会话
+	conversations := []storage.Conversation{}
+	if owner := requestOwner(r); owner.UserID != nil || owner.AnonToken != "" {
+		var err error
+		if conversations, err = app.qaStorage.ListConversations(owner, limit, offset); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "获取会话列表失败"})
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "获取会话列表成功",
+		"data": map[string]interface{}{
+			"conversations": conversations,
+			"limit":         limit,
+			"offset":        offset,
+		},
+		"status": "success",
+	})
+}
+
+// GetConversationHandler 获取会话的标题和摘要（所有者或管理员），完整内容通过 /api/records/{root_record_id}/tree 获取
+func (app *App) GetConversationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	conversation, ok := app.loadConversation(w, r)
+	if !ok {
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "获取会话成功",
+		"data":    conversation,
+		"status":  "success",
+	})
+}
+
+// UpdateConversationHandler 修改会话标题（仅所有者），修改后不再自动生成
+func (app *App) UpdateConversationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	conversation, ok := app.loadConversation(w, r)
+	if !ok {
+		return
+	}
+	if !conversation.IsOwnedBy(requestOwner(r)) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "只有会话所有者可以修改标题"})
+		return
+	}
+
+	var req UpdateConversationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的JSON格式"})
+		return
+	}
+	req.Title = strings.TrimSpace(req.Title)
+	if err := auth.Validator().Struct(req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "参数验证失败: " + err.Error()})
+		return
+	}
+
+	if err := app.qaStorage.SetConversationTitle(conversation.ID, req.Title, true); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "修改会话标题失败"})
+		return
+	}
+	conversation.Title = req.Title
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "修改会话标题成功",
+		"data":    conversation,
+		"status":  "success",
+	})
+}
+
+// loadConversation 根据路由中的id加载会话并校验请求者是所有者或管理员，失败时写入错误响应
+func (app *App) loadConversation(w http.ResponseWriter, r *http.Request) (*storage.Conversation, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的ID格式"})
+		return nil, false
+	}
+
+	conversation, err := app.qaStorage.GetConversation(id)
+	if err == nil && !conversation.IsOwnedBy(requestOwner(r)) && !isAdminRequest(r) {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("获取会话失败: %v", err)
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "会话不存在"})
+		return nil, false
+	}
+	return conversation, true
+}
+
+// updateConversation 一轮问答完成后更新所在会话：记录最近活动时间，第一轮完成后生成标题，
+// 未摘要的轮数超过阈值时滚动更新摘要。只加载摘要覆盖点之后的记录，在后台运行，失败时仅记录日志
+func (app *App) updateConversation(recordID int) {
+	thread, summarized, err := app.qaStorage.GetThreadSinceSummary(recordID, conversationMaxTurns)
+	if err != nil {
+		log.Printf("记录%d加载会话失败: %v", recordID, err)
+		return
+	}
+
+	var rootID int
+	previous := ""
+	switch {
+	case summarized != nil:
+		rootID, previous = summarized.RootRecordID, summarized.Summary
+	case len(thread) > 0 && thread[0].ParentID == nil:
+		rootID = thread[0].ID
+		if thread[0].VersionOf != nil {
+			rootID = *thread[0].VersionOf
+		}
+	default:
+		return
+	}
+
+	conversation, err := app.qaStorage.TouchConversation(rootID)
+	if err != nil {
+		log.Printf("记录%d更新会话失败: %v", recordID, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), conversationTaskTimeout)
+	defer cancel()
+
+	if app.conversations.Titles && conversation.Title == "" {
+		// 第一轮失败时用之后第一个完成的轮次生成标题
+		for _, record := range thread {
+			if record.Status != storage.RecordStatusCompleted {
+				continue
+			}
+			title, err := app.llmClient.GenerateTitle(ctx, record.Question, record.Answer)
+			if err != nil {
+				log.Printf("会话%d生成标题失败: %v", conversation.ID, err)
+			} else if err := app.qaStorage.SetConversationTitle(conversation.ID, title, false); err == nil {
+				log.Printf("会话%d生成标题: %s", conversation.ID, title)
+			}
+			break
+		}
+	}
+
+	if app.conversations.SummaryTurns > 0 {
+		app.summarizeConversation(ctx, conversation, previous, thread)
+	}
+}
+
+// summarizeConversation 当前分支上未摘要的已完成轮数超过SummaryTurns时，把已有摘要和除最近summaryKeepTurns轮外的问答
+// 合并为新的摘要。thread为摘要覆盖点之后的记录，previous为覆盖点在当前分支上时的已有摘要
+// （摘要属于其他分支时为空，thread从第一轮开始）
+func (app *App) summarizeConversation(ctx context.Context, conversation *storage.Conversation, previous string, thread []storage.QARecord) {
+	var pending []storage.QARecord
+	for _, record := range thread {
+		if record.Status == storage.RecordStatusCompleted {
+			pending = append(pending, record)
+		}
+	}
+	if len(pending) <= app.conversations.SummaryTurns || len(pending) <= summaryKeepTurns {
+		return
+	}
+	covered := pending[:len(pending)-summaryKeepTurns]
+
+	turns := make([]llm.Turn, 0, len(covered))
+	for _, record := range covered {
+		turns = append(turns, llm.Turn{Question: record.Question, Answer: record.Answer})
+	}
+	summary, err := app.llmClient.SummarizeConversation(ctx, previous, turns)
+	if err != nil {
+		log.Printf("会话%d生成摘要失败: %v", conversation.ID, err)
+		return
+	}
+	through := covered[len(covered)-1].ID
+	if err := app.qaStorage.SetConversationSummary(conversation.ID, summary, through); err != nil {
+		log.Printf("会话%d保存摘要失败: %v", conversation.ID, err)
+		return
+	}
+	log.Printf("会话%d摘要已更新，覆盖到记录%d", conversation.ID, through)
+}
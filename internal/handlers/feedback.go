@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-base-web-server/internal/auth"
+	"go-base-web-server/internal/storage"
+)
+
+const (
+	// defaultFeedbackExportLimit 导出评价的默认条数
+	defaultFeedbackExportLimit = 1000
+	// maxFeedbackExportLimit 导出评价的最大条数
+	maxFeedbackExportLimit = 10000
+)
+
+// FeedbackRequest 答案评价请求：rating为up或down，差评可选择问题类型并附带说明
+type FeedbackRequest struct {
+	Rating     string   `json:"rating" validate:"required,oneof=up down"`
+	Categories []string `json:"categories,omitempty" validate:"max=3,dive,oneof=incorrect harmful unhelpful"`
+	Comment    string   `json:"comment,omitempty" validate:"max=2000"`
+}
+
+// SubmitFeedbackHandler 评价记录的答案（可查看记录的请求者），同一评价者重复提交时覆盖之前的评价
+func (app *App) SubmitFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	record, ok := app.loadRecord(w, r)
+	if !ok {
+		return
+	}
+	if !record.CanView(requestOwner(r), isAdminRequest(r)) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "记录不存在"})
+		return
+	}
+
+	var req FeedbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的JSON格式"})
+		return
+	}
+	if err := auth.Validator().Struct(req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "参数验证失败: " + err.Error()})
+		return
+	}
+	if req.Rating == storage.FeedbackUp && len(req.Categories) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "只有差评可以选择问题类型"})
+		return
+	}
+	if !storage.IsTerminalStatus(record.Status) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "记录仍在生成中"})
+		return
+	}
+
+	owner, newAnonToken := ensureRecordOwner(w, r)
+	feedback, err := app.qaStorage.SaveFeedback(storage.RecordFeedback{
+		RecordID:   record.ID,
+		Rating:     req.Rating,
+		Categories: uniqueStrings(req.Categories),
+		Comment:    strings.TrimSpace(req.Comment),
+	}, owner)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "保存评价失败"})
+		return
+	}
+
+	data := map[string]interface{}{"feedback": feedback}
+	if counts, err := app.qaStorage.FeedbackCounts(record.ID); err == nil {
+		data["counts"] = counts
+	} else {
+		log.Printf("统计评价失败: %v", err)
+	}
+	if newAnonToken != "" {
+		data["anonymous_token"] = newAnonToken
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "评价成功",
+		"data":    data,
+		"status":  "success",
+	})
+}
+
+// GetFeedbackHandler 获取记录的评价数量和请求者自己的评价
+func (app *App) GetFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	record, ok := app.loadRecord(w, r)
+	if !ok {
+		return
+	}
+	owner := requestOwner(r)
+	if !record.CanView(owner, isAdminRequest(r)) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "记录不存在"})
+		return
+	}
+
+	counts, err := app.qaStorage.FeedbackCounts(record.ID)
+	if err != nil {
+		log.Printf("统计评价失败: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取评价失败"})
+		return
+	}
+	mine, err := app.qaStorage.GetFeedback(record.ID, owner)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("获取评价失败: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取评价失败"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "获取评价成功",
+		"data": map[string]interface{}{
+			"record_id": record.ID,
+			"counts":    counts,
+			"mine":      mine,
+		},
+		"status": "success",
+	})
+}
+
+// FeedbackStatsHandler 评价汇总（管理员）：好评差评数、各问题类型数量及按模型的差评率
+func (app *App) FeedbackStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	q, err := parseFeedbackQuery(r, "")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	stats, err := app.qaStorage.FeedbackStats(q)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "统计评价失败"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "获取评价汇总成功",
+		"data":    stats,
+		"status":  "success",
+	})
+}
+
+// ExportFeedbackHandler 导出评价及对应的问题和答案（管理员），默认导出差评，用于调整提示词。
+// format=jsonl（默认，每行一个JSON对象）或csv
+func (app *App) ExportFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	q, err := parseFeedbackQuery(r, storage.FeedbackDown)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultFeedbackExportLimit
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "jsonl"
+	}
+	if format != "jsonl" && format != "csv" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的format参数，可选 jsonl 或 csv"})
+		return
+	}
+
+	items, err := app.qaStorage.ListFeedback(q)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "导出评价失败"})
+		return
+	}
+
+	filename := fmt.Sprintf("feedback-%s.%s", time.Now().Format("20060102-150405"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	if format == "jsonl" {
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+		encoder := json.NewEncoder(w)
+		for _, item := range items {
+			encoder.Encode(item)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"record_id", "rating", "categories", "comment", "question", "answer", "provider", "model", "user_id", "updated_at"})
+	for _, item := range items {
+		userID := ""
+		if item.UserID != nil {
+			userID = strconv.Itoa(*item.UserID)
+		}
+		writer.Write([]string{
+			strconv.Itoa(item.RecordID), item.Rating, strings.Join(item.Categories, ";"), item.Comment,
+			item.Question, item.Answer, item.Provider, item.Model, userID, item.UpdatedAt.Format(time.RFC3339),
+		})
+	}
+	writer.Flush()
+}
+
+// parseFeedbackQuery 解析评价过滤参数: rating(up|down|all，未提供时为defaultRating), category,
+// provider, model, from/to(RFC3339或YYYY-MM-DD), limit
+func parseFeedbackQuery(r *http.Request, defaultRating string) (storage.FeedbackQuery, error) {
+	params := r.URL.Query()
+	q := storage.FeedbackQuery{
+		Rating:   params.Get("rating"),
+		Category: params.Get("category"),
+		Provider: params.Get("provider"),
+		Model:    params.Get("model"),
+	}
+
+	switch q.Rating {
+	case "":
+		q.Rating = defaultRating
+	case "all":
+		q.Rating = ""
+	case storage.FeedbackUp, storage.FeedbackDown:
+	default:
+		return q, fmt.Errorf("无效的rating参数: %s", q.Rating)
+	}
+
+	if q.Category != "" {
+		known := false
+		for _, category := range storage.FeedbackCategories {
+			known = known || category == q.Category
+		}
+		if !known {
+			return q, fmt.Errorf("无效的category参数: %s", q.Category)
+		}
+	}
+
+	if limitStr := params.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxFeedbackExportLimit {
+			return q, fmt.Errorf("无效的limit参数（1-%d）", maxFeedbackExportLimit)
+		}
+		q.Limit = limit
+	}
+
+	for _, bound := range []struct {
+		name   string
+		target **time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		value := params.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := parseTimeParam(value)
+		if err != nil {
+			return q, fmt.Errorf("无效的%s参数: %s", bound.name, value)
+		}
+		*bound.target = &t
+	}
+	return q, nil
+}
+
+// uniqueStrings 去除重复值并保持原有顺序
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
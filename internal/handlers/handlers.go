@@ -3,47 +3,84 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go-base-web-server/internal/arena"
+	"go-base-web-server/internal/auth"
+	"go-base-web-server/internal/generation"
+	"go-base-web-server/internal/llm"
+	"go-base-web-server/internal/storage"
+	"go-base-web-server/internal/uploads"
 	"go-base-web-server/providers"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/gorilla/mux"
 )
 
-// QAStorage QA存储接口
-type QAStorage interface {
-	SaveQuestion(question string, userID *int) (int, error)
-	UpdateAnswer(id int, answer string) error
-	GetRecord(id int) (interface{}, error)
-	GetAllRecords() (interface{}, error)
-	GetRecordsByUserID(userID int) (interface{}, error)
-}
-
 // LLMClient LLM客户端接口
 type LLMClient interface {
-	AskQuestion(question string) (string, error)
+	Complete(ctx context.Context, prompt llm.Prompt) (*llm.Completion, error)
+	CompleteStructured(ctx context.Context, prompt llm.Prompt, onRetry func(attempt int, err error)) (*llm.StructuredCompletion, error)
+	ModelAllowed(model string) bool
+	SupportsVision(model string) bool
+	ValidateParams(model string, params providers.GenerationParams) error
 	CheckConnection() error
 	GetProviderInfo() map[string]interface{}
+	GetProviderType() string
+	GetModelName() string
 	// 添加流式聊天方法
-	ChatCompletionStream(ctx context.Context, question string) (<-chan *providers.ChatCompletionStreamResponse, <-chan error, error)
+	ChatCompletionStream(ctx context.Context, prompt llm.Prompt) (<-chan *providers.ChatCompletionStreamResponse, <-chan error, error)
 	SupportsStreaming() bool
+	// 向量嵌入方法（语义搜索）
+	CreateEmbedding(ctx context.Context, text string) ([]float32, error)
+	SupportsEmbedding() bool
+	GetEmbeddingModel() string
+	// 会话标题和摘要（使用辅助模型）
+	GenerateTitle(ctx context.Context, question, answer string) (string, error)
+	SummarizeConversation(ctx context.Context, previous string, turns []llm.Turn) (string, error)
+	// 用户长期记忆提取（使用辅助模型）
+	ExtractMemories(ctx context.Context, question, answer string, known []string) ([]string, error)
+	// 应答缓存方法
+	LookupCache(ctx context.Context, question string, owner llm.CacheOwner) (*llm.CacheHit, []float32)
+	StoreCache(question, answer string, vector []float32, owner llm.CacheOwner)
 }
 
+const (
+	// cacheReplayChunkRunes 缓存回放时每个增量事件包含的字符数
+	cacheReplayChunkRunes = 8
+	// cacheReplayInterval 缓存回放时增量事件之间的间隔
+	cacheReplayInterval = 20 * time.Millisecond
+	// cancelWaitTimeout 取消生成后等待部分答案保存的最长时间
+	cancelWaitTimeout = 5 * time.Second
+)
+
 // App 应用结构体，包含所有依赖
 type App struct {
-	qaStorage QAStorage
-	llmClient LLMClient
+	qaStorage   storage.Store
+	llmClient   LLMClient
+	generations *generation.Manager
+	uploads     *uploads.Store // 上传图片的磁盘存储
+	arena       *arena.Arena   // 模型竞技场的参赛模型
+
+	conversations ConversationConfig // 会话标题和摘要的后台生成
+	memories      MemoryConfig       // 用户长期记忆
+	webSocket     WebSocketConfig    // WebSocket聊天通道
 }
 
 // NewApp 创建新的应用实例
-func NewApp(qaStorage QAStorage, llmClient LLMClient) *App {
+func NewApp(qaStorage storage.Store, llmClient LLMClient, generations *generation.Manager, uploadStore *uploads.Store, modelArena *arena.Arena,
+	conversations ConversationConfig, memories MemoryConfig, webSocket WebSocketConfig) *App {
 	return &App{
-		qaStorage: qaStorage,
-		llmClient: llmClient,
+		qaStorage:     qaStorage,
+		llmClient:     llmClient,
+		generations:   generations,
+		uploads:       uploadStore,
+		arena:         modelArena,
+		conversations: conversations,
+		memories:      memories,
+		webSocket:     webSocket,
 	}
 }
 
@@ -56,23 +93,78 @@ func (app *App) HomeHandler(w http.ResponseWriter, r *http.Request) {
 		"version":     "2.0.0",
 		"description": "现代化的前后端分离问答系统后端API - 支持用户认证",
 		"endpoints": map[string]interface{}{
-			"GET /":                        "API信息",
-			"GET /api/health":              "健康检查",
-			"POST /api/auth/register":      "用户注册",
-			"POST /api/auth/login":         "用户登录",
-			"POST /api/auth/logout":        "用户登出",
-			"GET /api/ask":                 "提问接口 (参数: prompt)",
-			"GET /api/ask/stream":          "流式提问接口 (参数: prompt) - SSE",
-			"GET /api/records":             "获取所有问答记录",
-			"GET /api/records/{id}":        "获取特定记录",
-			"GET /api/user/profile":        "获取用户资料 (需要认证)",
-			"POST /api/user/refresh-token": "刷新token (需要认证)",
-			"GET /api/user/records":        "获取用户记录 (需要认证)",
-			"GET /api/user/users":          "获取用户列表 (需要认证)",
+			"GET /":                                       "API信息",
+			"GET /api/health":                             "健康检查",
+			"POST /api/auth/register":                     "用户注册",
+			"POST /api/auth/login":                        "用户登录",
+			"POST /api/auth/logout":                       "用户登出",
+			"GET /api/ask":                                "提问接口 (参数: prompt)",
+			"GET /api/ask/stream":                         "流式提问接口 (参数: prompt, background) - SSE",
+			"POST /api/ask":                               "提问接口 (JSON: prompt, parent_record_id, persona_id, system_prompt, model, temperature, top_p, max_tokens, stop, seed, presence_penalty, frequency_penalty, attachments, response_format)，Accept: text/event-stream时返回SSE",
+			"POST /api/ask/stream":                        "流式提问接口 (JSON请求体同POST /api/ask) - SSE",
+			"GET /api/records":                            "获取自己的问答记录，scope=public获取公开记录 (参数: limit, cursor, sort, order, from, to, user_id, provider, model, status, answered)",
+			"GET /api/records/{id}":                       "获取特定记录 (所有者、管理员或shared/public记录)",
+			"GET /api/records/{id}/stream":                "重新连接记录的生成流，生成已结束时直接返回结果 - SSE",
+			"POST /api/records/{id}/cancel":               "取消进行中的生成，保存部分答案（仅所有者）",
+			"GET /api/ws":                                 "WebSocket聊天通道，支持并发生成、继续会话和取消",
+			"PUT /api/records/{id}/visibility":            "修改记录可见性 (private/shared/public，仅所有者)",
+			"POST /api/records/{id}/share":                "创建分享链接 (参数: expires_in/expires_at, scope=record/conversation，仅所有者)",
+			"GET /api/records/{id}/candidates":            "获取记录的全部候选答案 (n>1时生成)",
+			"PUT /api/records/{id}/candidates/preferred":  "选择首选候选答案 (JSON: index，仅所有者)",
+			"GET /api/records/{id}/shares":                "获取记录的分享链接 (仅所有者)",
+			"GET /api/share/{slug}":                       "通过分享链接只读查看内容 (无需认证)，会话分享返回到该记录为止最近50轮的问答",
+			"DELETE /api/share/{slug}":                    "撤销分享链接 (仅所有者)",
+			"GET /api/records/search":                     "搜索问答记录 (参数: q, limit) - 关键词+语义混合排序 (需要认证)",
+			"GET /api/personas":                           "获取角色列表",
+			"GET /api/personas/{id}":                      "获取特定角色",
+			"POST /api/personas":                          "创建角色 (JSON: name, description, system_prompt, model, params, tools，仅管理员)",
+			"PUT /api/personas/{id}":                      "更新角色 (JSON请求体同创建，仅管理员)",
+			"DELETE /api/personas/{id}":                   "删除角色 (仅管理员)",
+			"POST /api/uploads":                           "上传图片 (需要登录，multipart/form-data: file，PNG/JPEG/GIF/WebP，按用户配额限制总大小)，提问时以 {type: image, upload_id} 附件引用",
+			"GET /api/uploads/{id}":                       "获取上传的图片 (仅所有者)",
+			"DELETE /api/uploads/{id}":                    "删除上传的图片 (仅所有者)",
+			"POST /api/compare":                           "模型竞技场 (JSON: prompt, models, system_prompt, 生成参数)，并发对比2-4个模型 - SSE",
+			"GET /api/compare/models":                     "获取竞技场可选的模型",
+			"GET /api/compare/{id}":                       "获取对比结果和投票 (所有者/管理员)",
+			"POST /api/compare/{id}/vote":                 "投票 (JSON: winner 或 tie: true，仅所有者，重新投票覆盖)",
+			"GET /api/arena/leaderboard":                  "竞技场Elo排行榜及各模型延迟、token、费用统计 (仅管理员)",
+			"POST /api/records/{id}/regenerate":           "重新生成答案，创建该轮的新版本 (JSON可选: model, 生成参数, n, background；Accept: text/event-stream时返回SSE，仅所有者)",
+			"POST /api/records/{id}/edit":                 "编辑问题后重新提交 (JSON: prompt，其余同regenerate)，原记录及后续追问保留为另一分支",
+			"GET /api/records/{id}/versions":              "获取同一轮的全部版本 (按version排序)",
+			"GET /api/records/{id}/tree":                  "获取记录所在会话的完整树 (roots嵌套children，path为到该记录的路径)",
+			"GET /api/conversations":                      "获取自己的会话列表，按最近活动排序 (参数: limit, offset)，标题和摘要由后台自动生成",
+			"GET /api/conversations/{id}":                 "获取会话的标题和摘要 (所有者/管理员)",
+			"PUT /api/conversations/{id}":                 "修改会话标题 (JSON: title，仅所有者)，修改后不再自动生成",
+			"POST /api/records/{id}/feedback":             "评价答案 (JSON: rating up/down, categories incorrect/harmful/unhelpful, comment)，重复提交覆盖",
+			"GET /api/records/{id}/feedback":              "获取记录的好评差评数量和自己的评价",
+			"GET /api/feedback/stats":                     "评价汇总 (仅管理员，参数: rating, category, provider, model, from, to)",
+			"GET /api/feedback/export":                    "导出评价及问答 (仅管理员，默认差评，format=jsonl|csv)",
+			"GET /api/user/profile":                       "获取用户资料 (需要认证)",
+			"POST /api/user/refresh-token":                "刷新token (需要认证)",
+			"GET /api/user/records":                       "获取用户记录 (需要认证，分页参数同/api/records)",
+			"PUT /api/user/persona":                       "设置默认角色 (JSON: persona_id，null清除，需要认证)",
+			"PUT /api/user/preferences":                   "更新用户偏好 (JSON: show_reasoning，需要认证)",
+			"GET /api/user/memories":                      "获取自己的长期记忆 (需要认证)，问答完成后自动提取，提问时附加相关记忆",
+			"POST /api/user/memories":                     "手动添加长期记忆 (JSON: content，需要认证)",
+			"PUT /api/user/memories/{id}":                 "修改长期记忆 (JSON: content，需要认证)",
+			"DELETE /api/user/memories/{id}":              "删除长期记忆 (需要认证)",
+			"DELETE /api/user/memories":                   "清空长期记忆 (需要认证)",
+			"GET /api/user/users":                         "获取用户列表 (需要认证)",
+			"GET /api/templates":                          "获取自己的和共享给自己的提示词模板 (需要认证)",
+			"POST /api/templates":                         "创建模板 (JSON: name, description, body, system_prompt, variables，需要认证)",
+			"GET /api/templates/{id}":                     "获取模板 (参数: version，所有者或被共享的用户)",
+			"PUT /api/templates/{id}":                     "更新模板，内容变化时生成新版本 (仅所有者)",
+			"DELETE /api/templates/{id}":                  "删除模板及全部版本 (仅所有者)",
+			"GET /api/templates/{id}/versions":            "获取模板版本历史",
+			"POST /api/templates/{id}/shares":             "共享模板 (JSON: username，仅所有者)",
+			"GET /api/templates/{id}/shares":              "获取模板共享列表 (仅所有者)",
+			"DELETE /api/templates/{id}/shares/{user_id}": "取消共享 (仅所有者)",
+			"POST /api/templates/{id}/run":                "渲染模板并流式回答 (JSON: variables, version，其余字段同POST /api/ask) - SSE",
 		},
 		"authentication": map[string]string{
-			"type":   "Bearer Token (JWT)",
-			"header": "Authorization: Bearer <token>",
+			"type":      "Bearer Token (JWT)",
+			"header":    "Authorization: Bearer <token>",
+			"anonymous": "X-Anonymous-Token: <token> 或 anon_token Cookie（匿名首次提问时签发）",
 		},
 		"cors": "已启用跨域支持",
 	}
@@ -82,30 +174,46 @@ func (app *App) HomeHandler(w http.ResponseWriter, r *http.Request) {
 
 // AskHandler 提问处理器 - 核心业务流程（支持用户认证）
 func (app *App) AskHandler(w http.ResponseWriter, r *http.Request) {
+	// POST请求要求SSE响应时按流式提问处理
+	if r.Method == http.MethodPost && wantsEventStream(r) {
+		app.AskStreamHandler(w, r)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 
-	question := r.URL.Query().Get("prompt")
-	if question == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "缺少prompt参数"})
+	req, err := decodeAskRequest(r)
+	if err != nil {
+		writeAskError(w, err)
 		return
 	}
+	app.answerAsk(w, r, req)
+}
+
+// answerAsk 以JSON回答已校验的提问请求（提问接口、重新生成和编辑共用），调用前须已设置JSON响应头
+func (app *App) answerAsk(w http.ResponseWriter, r *http.Request, req AskRequest) {
+	question := req.Prompt
 
 	log.Printf("收到问题: %s", question)
 
-	// 获取用户ID（如果已认证）
-	var userID *int
-	if user, ok := getUserFromContext(r); ok {
-		if id := getUserID(user); id > 0 {
-			userID = &id
-			log.Printf("认证用户提问: ID %d", id)
-		}
+	// 获取请求者身份（认证用户或匿名会话，匿名请求首次提问时签发令牌）
+	owner, newAnonToken := ensureRecordOwner(w, r)
+	userID := owner.UserID
+	if userID != nil {
+		log.Printf("认证用户提问: ID %d", *userID)
 	} else {
 		log.Printf("匿名用户提问")
 	}
 
+	ask, err := app.prepareAsk(req, owner, isAdminRequest(r), requestDefaultPersona(r))
+	if err != nil {
+		writeAskError(w, err)
+		return
+	}
+	prompt := ask.Prompt
+
 	// 1. 保存问题到数据库
-	recordID, err := app.qaStorage.SaveQuestion(question, userID)
+	recordID, err := app.saveAskQuestion(ask, owner)
 	if err != nil {
 		log.Printf("保存问题失败: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -113,78 +221,181 @@ func (app *App) AskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 2. 调用LLM获取答案
-	answer, err := app.llmClient.AskQuestion(question)
-	if err != nil {
-		log.Printf("LLM调用失败: %v", err)
-		app.qaStorage.UpdateAnswer(recordID, "抱歉，AI服务暂时不可用")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "AI服务不可用"})
-		return
+	start := time.Now()
+
+	// 2. 优先查询应答缓存，未命中时调用LLM获取答案
+	answer, reasoning, finishReason := "", "", "stop"
+	var candidates []storage.Candidate
+	var cacheHit *llm.CacheHit
+	var cacheVector []float32
+	var structured *llm.StructuredCompletion
+	if prompt.Cacheable() {
+		cacheHit, cacheVector = app.llmClient.LookupCache(r.Context(), question, cacheOwner(owner))
 	}
+	if cacheHit != nil {
+		answer = cacheHit.Answer
+	} else {
+		var completion *llm.Completion
+		if prompt.ResponseFormat != nil {
+			// 结构化输出：校验失败时带着错误重试
+			if structured, err = app.llmClient.CompleteStructured(r.Context(), prompt, nil); err == nil {
+				completion = &structured.Completion
+			}
+		} else {
+			completion, err = app.llmClient.Complete(r.Context(), prompt)
+		}
 
-	// 3. 更新数据库中的答案
-	err = app.qaStorage.UpdateAnswer(recordID, answer)
-	if err != nil {
-		log.Printf("更新答案失败: %v", err)
+		var outputErr *llm.StructuredOutputError
+		if errors.As(err, &outputErr) {
+			log.Printf("结构化输出校验失败: %v", outputErr)
+			app.finishRecord(recordID, structuredFailure(outputErr, start))
+			w.WriteHeader(http.StatusBadGateway)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":    outputErr.Error(),
+				"id":       recordID,
+				"output":   outputErr.Output,
+				"attempts": outputErr.Attempts,
+			})
+			return
+		}
+		if err != nil {
+			log.Printf("LLM调用失败: %v", err)
+			app.finishRecord(recordID, interruptedResult(r.Context(), "", err, start))
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "AI服务不可用"})
+			return
+		}
+		answer, reasoning, finishReason = completion.Content, completion.Reasoning, completion.FinishReason
+		candidates = recordCandidates(completion.Candidates)
+		if prompt.Cacheable() {
+			go app.llmClient.StoreCache(question, answer, cacheVector, cacheOwner(owner))
+		}
+	}
+
+	// 3. 保存答案并标记记录完成
+	result := storage.RecordResult{
+		Status:       storage.RecordStatusCompleted,
+		Answer:       answer,
+		Reasoning:    reasoning,
+		FinishReason: finishReason,
+		Latency:      time.Since(start),
+		Candidates:   candidates,
+	}
+	if err := app.qaStorage.FinishRecord(recordID, result); err != nil {
+		log.Printf("保存答案失败: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "保存答案失败"})
 		return
 	}
 
+	// 异步生成向量（用于语义搜索）、更新会话标题和摘要并提取用户记忆
+	go app.indexRecordEmbedding(recordID, question, answer)
+	go app.updateConversation(recordID)
+	go app.extractMemories(recordID, userID, question, answer)
+
 	// 4. 返回完整的问答结果
 	response := map[string]interface{}{
-		"id":       recordID,
-		"question": question,
-		"answer":   answer,
-		"user_id":  userID,
-		"status":   "success",
+		"id":            recordID,
+		"question":      question,
+		"answer":        answer,
+		"user_id":       userID,
+		"parent_id":     ask.ParentID,
+		"finish_reason": finishReason,
+		"latency_ms":    result.Latency.Milliseconds(),
+		"cached":        cacheHit != nil,
+		"status":        "success",
+	}
+	if cacheHit != nil {
+		response["cache"] = cacheHit
+	}
+	if reasoning != "" && requestShowReasoning(r) {
+		response["reasoning"] = reasoning
+	}
+	if len(candidates) > 0 {
+		response["candidates"] = candidateViews(candidates, requestShowReasoning(r))
+	}
+	if ask.VersionOf != nil {
+		response["version_of"] = *ask.VersionOf
+	}
+	if structured != nil {
+		response["data"] = structured.Data
+		response["attempts"] = structured.Attempts
+	}
+	if newAnonToken != "" {
+		response["anonymous_token"] = newAnonToken
 	}
 
 	log.Printf("问答完成，ID: %d", recordID)
 	json.NewEncoder(w).Encode(response)
 }
 
-// GetRecordsHandler 获取所有记录处理器
+// GetRecordsHandler 获取记录列表处理器（游标分页，支持过滤和排序）
 func (app *App) GetRecordsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	records, err := app.qaStorage.GetAllRecords()
+	query, err := parseRecordQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	// 按请求者身份限定可见范围
+	switch {
+	case r.URL.Query().Get("scope") == storage.VisibilityPublic:
+		// 公开记录列表，任何人可访问
+		query.Visibility = storage.VisibilityPublic
+	case isAdminRequest(r):
+		// 管理员可以查看所有记录
+	default:
+		owner := requestOwner(r)
+		if owner.UserID == nil && owner.AnonToken == "" {
+			// 没有身份的匿名请求不拥有任何记录
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"message": "获取记录成功",
+				"data":    storage.RecordPage{Records: []storage.QARecord{}, Limit: query.Limit},
+				"status":  "success",
+			})
+			return
+		}
+		query.UserID = owner.UserID
+		query.AnonToken = owner.AnonToken
+	}
+
+	page, err := app.qaStorage.ListRecords(query)
 	if err != nil {
 		log.Printf("获取记录失败: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "获取记录失败"})
 		return
 	}
+	hideReasoning(r, page.Records)
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "获取记录成功",
-		"data":    records,
+		"data":    page,
 		"status":  "success",
 	})
 }
 
-// GetRecordHandler 获取单个记录处理器
+// GetRecordHandler 获取单个记录处理器（校验所有权和可见性）
 func (app *App) GetRecordHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	vars := mux.Vars(r)
-	idStr := vars["id"]
-
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "无效的ID格式"})
+	record, ok := app.loadRecord(w, r)
+	if !ok {
 		return
 	}
 
-	record, err := app.qaStorage.GetRecord(id)
-	if err != nil {
-		log.Printf("获取记录失败: %v", err)
+	// 对无权访问的记录返回404，避免泄露记录是否存在
+	if !record.CanView(requestOwner(r), isAdminRequest(r)) {
 		w.WriteHeader(http.StatusNotFound)
 		json.NewEncoder(w).Encode(map[string]string{"error": "记录不存在"})
 		return
 	}
+	if !requestShowReasoning(r) {
+		record.Reasoning = ""
+	}
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "获取记录成功",
@@ -198,27 +409,35 @@ func (app *App) GetUserRecordsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// 从上下文获取用户信息
-	user, ok := getUserFromContext(r)
-	if !ok {
+	if _, ok := getUserFromContext(r); !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]string{"error": "需要用户认证"})
 		return
 	}
 
-	userID := getUserID(user)
+	userID, _ := getUserIDFromContext(r)
 	if userID == 0 {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]string{"error": "无效的用户ID"})
 		return
 	}
 
-	records, err := app.qaStorage.GetRecordsByUserID(userID)
+	query, err := parseRecordQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	query.UserID = &userID // 只能查询自己的记录
+
+	records, err := app.qaStorage.ListRecords(query)
 	if err != nil {
 		log.Printf("获取用户记录失败: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "获取记录失败"})
 		return
 	}
+	hideReasoning(r, records.Records)
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "获取用户记录成功",
@@ -248,183 +467,708 @@ func (app *App) HealthHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // 辅助函数：从上下文获取用户信息
-func getUserFromContext(r *http.Request) (interface{}, bool) {
-	user := r.Context().Value("user")
-	return user, user != nil
+func getUserFromContext(r *http.Request) (*storage.User, bool) {
+	return auth.GetUserFromContext(r)
 }
 
-// 辅助函数：获取用户ID
-func getUserID(user interface{}) int {
-	if userMap, ok := user.(map[string]interface{}); ok {
-		if id, ok := userMap["id"].(int); ok {
-			return id
-		}
-	}
-	return 0
+// 辅助函数：从上下文获取用户ID（由认证中间件写入）
+func getUserIDFromContext(r *http.Request) (int, bool) {
+	id, ok := r.Context().Value("user_id").(int)
+	return id, ok && id > 0
+}
+
+// 辅助函数：判断当前用户是否为管理员
+func isAdminRequest(r *http.Request) bool {
+	user, ok := getUserFromContext(r)
+	return ok && user.IsAdminUser()
 }
 
 // AskStreamHandler 流式提问处理器 - 支持SSE实时响应
 func (app *App) AskStreamHandler(w http.ResponseWriter, r *http.Request) {
-	// 设置SSE响应头
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("X-Accel-Buffering", "no") // 禁用nginx缓冲
+	setSSEHeaders(w, r)
 
-	// 设置CORS头部（确保SSE请求的跨域支持）
-	origin := r.Header.Get("Origin")
-	if origin != "" {
-		w.Header().Set("Access-Control-Allow-Origin", origin)
-	} else {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+	// EventSource断线重连会带上Last-Event-ID请求原地址，此时续传原记录而不是重新提问
+	if recordID, after, ok := parseLastEventID(r); ok {
+		app.resumeRecordStream(w, r, recordID, after)
+		return
 	}
-	w.Header().Set("Access-Control-Allow-Credentials", "true")
-	w.Header().Set("Access-Control-Expose-Headers", "Content-Type")
 
-	question := r.URL.Query().Get("prompt")
-	if question == "" {
-		app.writeSSEError(w, "缺少prompt参数")
+	req, err := decodeAskRequest(r)
+	if err != nil {
+		app.writeSSEError(w, err.Error())
 		return
 	}
+	app.streamAsk(w, r, req)
+}
+
+// streamAsk 以SSE流式回答已校验的提问请求（提问接口和模板运行共用），调用前须已设置SSE响应头
+func (app *App) streamAsk(w http.ResponseWriter, r *http.Request, req AskRequest) {
+	question := req.Prompt
 
 	log.Printf("收到流式问题: %s", question)
 
-	// 检查是否支持流式聊天
-	if !app.llmClient.SupportsStreaming() {
-		app.writeSSEError(w, "当前LLM Provider不支持流式聊天")
+	// 获取请求者身份（认证用户或匿名会话，匿名请求首次提问时签发令牌）
+	owner, newAnonToken := ensureRecordOwner(w, r)
+	userID := owner.UserID
+	if userID != nil {
+		log.Printf("认证用户流式提问: ID %d", *userID)
+	} else {
+		log.Printf("匿名用户流式提问")
+	}
+
+	ask, err := app.prepareAsk(req, owner, isAdminRequest(r), requestDefaultPersona(r))
+	if err != nil {
+		app.writeSSEError(w, err.Error())
 		return
 	}
+	prompt := ask.Prompt
 
-	// 获取用户ID（如果已认证）
-	var userID *int
-	if user, ok := getUserFromContext(r); ok {
-		if id := getUserID(user); id > 0 {
-			userID = &id
-			log.Printf("认证用户流式提问: ID %d", id)
-		}
-	} else {
-		log.Printf("匿名用户流式提问")
+	// 命中缓存时无需Provider支持流式聊天
+	ctx := r.Context()
+	var cacheHit *llm.CacheHit
+	var cacheVector []float32
+	if prompt.Cacheable() {
+		cacheHit, cacheVector = app.llmClient.LookupCache(ctx, question, cacheOwner(owner))
+	}
+
+	// 检查是否支持流式聊天（结构化输出校验完整结果后一次性返回，不需要流式接口）
+	if cacheHit == nil && prompt.ResponseFormat == nil && !app.llmClient.SupportsStreaming() {
+		app.writeSSEError(w, "当前LLM Provider不支持流式聊天")
+		return
 	}
 
 	// 1. 保存问题到数据库
-	recordID, err := app.qaStorage.SaveQuestion(question, userID)
+	recordID, err := app.saveAskQuestion(ask, owner)
 	if err != nil {
 		log.Printf("保存问题失败: %v", err)
 		app.writeSSEError(w, "保存问题失败")
 		return
 	}
 
+	start := time.Now()
+
 	// 获取flusher用于立即发送数据
 	flusher, ok := w.(http.Flusher)
 	if !ok {
+		app.finishRecord(recordID, storage.RecordResult{Status: storage.RecordStatusFailed, Error: "不支持流式响应", Latency: time.Since(start)})
 		app.writeSSEError(w, "不支持流式响应")
 		return
 	}
 
+	// 后台模式：客户端断开后继续生成，可通过记录ID重新连接
+	background := app.generations.BackgroundByDefault()
+	if req.Background != nil {
+		background = *req.Background
+	}
+
 	// 发送开始事件
-	app.writeSSEData(w, map[string]interface{}{
-		"type":      "start",
-		"record_id": recordID,
-		"question":  question,
-		"user_id":   userID,
-	})
+	startEvent := map[string]interface{}{
+		"type":       "start",
+		"record_id":  recordID,
+		"parent_id":  ask.ParentID,
+		"question":   question,
+		"user_id":    userID,
+		"cached":     cacheHit != nil,
+		"background": background && cacheHit == nil,
+	}
+	if newAnonToken != "" {
+		startEvent["anonymous_token"] = newAnonToken
+	}
+	if ask.VersionOf != nil {
+		startEvent["version_of"] = *ask.VersionOf
+	}
+	app.writeSSEEvent(w, sseEventID(recordID, 0), startEvent)
 	log.Printf("发送开始事件，记录ID: %d", recordID)
 	flusher.Flush() // 立即发送开始事件
 
-	// 2. 调用LLM流式接口
-	ctx := r.Context()
-	responseChan, errorChan, err := app.llmClient.ChatCompletionStream(ctx, question)
+	// 2. 启动生成
+	gen := app.startGeneration(ctx, streamJob{
+		RecordID:      recordID,
+		Prompt:        prompt,
+		Owner:         owner,
+		CacheHit:      cacheHit,
+		CacheVector:   cacheVector,
+		Background:    background,
+		Start:         start,
+		ShowReasoning: requestShowReasoning(r),
+	})
+
+	// 3. 将生成事件转发给客户端
+	if !app.pipeGeneration(ctx, w, flusher, gen, 0) {
+		log.Printf("客户端断开连接，记录ID: %d", recordID)
+		return
+	}
+	log.Printf("流式问答完成，ID: %d", recordID)
+}
+
+// streamJob 一次流式生成的参数（SSE和WebSocket共用）
+type streamJob struct {
+	RecordID   int
+	Prompt     llm.Prompt
+	Owner      storage.RecordOwner
+	CacheHit   *llm.CacheHit // 命中应答缓存时回放缓存答案
+	Background bool
+	Start      time.Time
+	// 是否向客户端发布推理模型的思考过程（reasoning事件），不影响保存
+	ShowReasoning bool
+	// 未命中缓存时查询生成的问题向量，写入缓存时复用，不再重复调用向量接口
+	CacheVector []float32
+}
+
+// startGeneration 启动生成：命中缓存时以模拟流的方式回放答案（记录直接完成）；
+// 后台模式下与请求解耦，客户端断开后继续生成并保存完整答案
+func (app *App) startGeneration(ctx context.Context, job streamJob) *generation.Generation {
+	recordID := job.RecordID
+
+	if cacheHit := job.CacheHit; cacheHit != nil {
+		result := storage.RecordResult{
+			Status:       storage.RecordStatusCompleted,
+			Answer:       cacheHit.Answer,
+			FinishReason: "stop",
+			Latency:      time.Since(job.Start),
+		}
+		app.finishRecord(recordID, result)
+		go app.updateConversation(recordID)
+		go app.extractMemories(recordID, job.Owner.UserID, job.Prompt.Question, cacheHit.Answer)
+		return app.generations.Start(ctx, recordID, false, func(genCtx context.Context, gen *generation.Generation) {
+			replayCachedAnswer(genCtx, gen, cacheHit.Answer, map[string]interface{}{
+				"type":          "end",
+				"record_id":     recordID,
+				"answer":        cacheHit.Answer,
+				"finish_reason": result.FinishReason,
+				"latency_ms":    result.Latency.Milliseconds(),
+				"cached":        true,
+				"cache":         cacheHit,
+			})
+		})
+	}
+
+	gen := app.generations.Start(ctx, recordID, job.Background, func(genCtx context.Context, gen *generation.Generation) {
+		if job.Prompt.ResponseFormat != nil {
+			app.structuredGeneration(genCtx, gen, job)
+			return
+		}
+		app.streamGeneration(genCtx, gen, job)
+	})
+	if gen.Background {
+		log.Printf("记录 %d 在后台生成，客户端断开后可通过 /api/records/%d/stream 重新连接", recordID, recordID)
+	}
+	return gen
+}
+
+// streamGeneration 调用LLM流式接口生成答案，保存结果并发布delta/reasoning/tool/end/error/cancelled事件；
+// 请求多个候选答案时按choice index分别累积，增量事件携带index
+func (app *App) streamGeneration(ctx context.Context, gen *generation.Generation, job streamJob) {
+	recordID, question, start := job.RecordID, job.Prompt.Question, job.Start
+	multi := job.Prompt.N > 1
+
+	responseChan, errorChan, err := app.llmClient.ChatCompletionStream(ctx, job.Prompt)
 	if err != nil {
 		log.Printf("启动流式聊天失败: %v", err)
-		app.writeSSEError(w, "启动流式聊天失败")
+		app.interruptGeneration(ctx, gen, recordID, storage.RecordResult{}, err, "启动流式聊天失败", start)
 		return
 	}
 
-	var fullAnswer strings.Builder
+	if err := app.qaStorage.UpdateStatus(recordID, storage.RecordStatusStreaming); err != nil {
+		log.Printf("更新记录状态失败: %v", err)
+	}
+
+	var candidates streamCandidates
 
 	log.Printf("开始监听流式响应...")
 
-	// 3. 处理流式响应
 	for {
 		select {
 		case resp, ok := <-responseChan:
 			if !ok {
-				// 流式响应结束
-				finalAnswer := fullAnswer.String()
+				// 流式响应结束，保存答案并标记记录完成
+				result := candidates.result("stop")
+				result.Status = storage.RecordStatusCompleted
+				result.Latency = time.Since(start)
+				finalAnswer := result.Answer
 				log.Printf("流式响应结束，最终答案长度: %d", len(finalAnswer))
 
-				// 更新数据库中的答案
-				if err := app.qaStorage.UpdateAnswer(recordID, finalAnswer); err != nil {
-					log.Printf("更新答案失败: %v", err)
+				if err := app.qaStorage.FinishRecord(recordID, result); err != nil {
+					log.Printf("保存答案失败: %v", err)
 				} else {
 					log.Printf("答案更新成功，ID: %d", recordID)
+					go app.indexRecordEmbedding(recordID, question, finalAnswer)
+					go app.updateConversation(recordID)
+					go app.extractMemories(recordID, job.Owner.UserID, question, finalAnswer)
+					// 带历史或自定义生成选项的答案依赖上下文，不写入应答缓存
+					if job.Prompt.Cacheable() {
+						go app.llmClient.StoreCache(question, finalAnswer, job.CacheVector, cacheOwner(job.Owner))
+					}
 				}
 
-				// 发送结束事件
-				app.writeSSEData(w, map[string]interface{}{
-					"type":      "end",
-					"record_id": recordID,
-					"answer":    finalAnswer,
-				})
-				log.Printf("发送结束事件")
-				flusher.Flush()
-
-				log.Printf("流式问答完成，ID: %d", recordID)
+				endEvent := map[string]interface{}{
+					"type":          "end",
+					"record_id":     recordID,
+					"answer":        finalAnswer,
+					"finish_reason": result.FinishReason,
+					"latency_ms":    result.Latency.Milliseconds(),
+					"cached":        false,
+				}
+				if job.ShowReasoning && result.Reasoning != "" {
+					endEvent["reasoning"] = result.Reasoning
+				}
+				if len(result.Candidates) > 0 {
+					endEvent["candidates"] = candidateViews(result.Candidates, job.ShowReasoning)
+				}
+				gen.Emit(endEvent)
 				return
 			}
 
 			log.Printf("收到流式响应: %+v", resp)
 
 			// 处理流式数据
-			if len(resp.Choices) > 0 && resp.Choices[0].Delta != nil {
-				log.Printf("处理Delta数据: %+v", resp.Choices[0].Delta)
-				if resp.Choices[0].Delta.Content != nil {
-					if content, ok := resp.Choices[0].Delta.Content.(string); ok && content != "" {
-						log.Printf("收到增量内容: %s", content)
-						fullAnswer.WriteString(content)
-
-						// 发送增量数据
-						app.writeSSEData(w, map[string]interface{}{
-							"type":    "delta",
-							"content": content,
-						})
-						log.Printf("发送增量数据: %s", content)
-
-						flusher.Flush()
-					} else {
-						log.Printf("Delta Content为空或类型不匹配: %v", resp.Choices[0].Delta.Content)
+			for _, choice := range resp.Choices {
+				candidate := candidates.get(choice.Index)
+				if choice.FinishReason != "" {
+					candidate.finishReason = choice.FinishReason
+				}
+				if choice.Delta == nil {
+					continue
+				}
+
+				// 思考过程单独累积保存，按用户偏好以reasoning事件发布
+				if reasoning := choice.Delta.ReasoningContent; reasoning != "" {
+					candidate.reasoning.WriteString(reasoning)
+					if job.ShowReasoning {
+						gen.Emit(choiceEvent(multi, choice.Index, map[string]interface{}{
+							"type":    "reasoning",
+							"content": reasoning,
+						}))
 					}
-				} else {
-					log.Printf("Delta Content为nil")
 				}
-			} else {
-				log.Printf("没有有效的Choices或Delta数据")
+				if content, ok := choice.Delta.Content.(string); ok && content != "" {
+					candidate.answer.WriteString(content)
+					gen.Emit(choiceEvent(multi, choice.Index, map[string]interface{}{
+						"type":    "delta",
+						"content": content,
+					}))
+				}
+				if toolCalls := choice.Delta.ToolCalls; len(toolCalls) > 0 {
+					gen.Emit(choiceEvent(multi, choice.Index, map[string]interface{}{
+						"type":       "tool",
+						"tool_calls": toolCalls,
+					}))
+				}
 			}
 
 		case err, ok := <-errorChan:
 			if ok && err != nil {
 				log.Printf("流式响应错误: %v", err)
 
-				// 保存错误信息到数据库
-				app.qaStorage.UpdateAnswer(recordID, "抱歉，AI服务出现错误")
-
-				app.writeSSEError(w, fmt.Sprintf("流式响应错误: %v", err))
+				// 保存错误原因和已生成的部分答案
+				app.interruptGeneration(ctx, gen, recordID, candidates.result(""), err, fmt.Sprintf("流式响应错误: %v", err), start)
 				return
 			}
 
 		case <-ctx.Done():
-			log.Printf("客户端断开连接")
+			log.Printf("生成已取消，保存部分答案，ID: %d", recordID)
+			app.interruptGeneration(ctx, gen, recordID, candidates.result(""), ctx.Err(), "", start)
 			return
 		}
 	}
 }
 
+// structuredGeneration 生成结构化输出：完整输出通过校验后以一个delta事件发布，end事件携带解析后的data；
+// 每次校验失败重试前发布retry事件，重试用尽时记录失败并发布携带最后一次输出的error事件
+func (app *App) structuredGeneration(ctx context.Context, gen *generation.Generation, job streamJob) {
+	recordID, start := job.RecordID, job.Start
+
+	if err := app.qaStorage.UpdateStatus(recordID, storage.RecordStatusStreaming); err != nil {
+		log.Printf("更新记录状态失败: %v", err)
+	}
+
+	structured, err := app.llmClient.CompleteStructured(ctx, job.Prompt, func(attempt int, err error) {
+		gen.Emit(map[string]interface{}{
+			"type":    "retry",
+			"attempt": attempt,
+			"error":   err.Error(),
+		})
+	})
+
+	var outputErr *llm.StructuredOutputError
+	if errors.As(err, &outputErr) {
+		log.Printf("结构化输出校验失败: %v", outputErr)
+		app.finishRecord(recordID, structuredFailure(outputErr, start))
+		gen.Emit(map[string]interface{}{
+			"type":      "error",
+			"record_id": recordID,
+			"error":     outputErr.Error(),
+			"output":    outputErr.Output,
+			"attempts":  outputErr.Attempts,
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("LLM调用失败: %v", err)
+		app.interruptGeneration(ctx, gen, recordID, storage.RecordResult{}, err, "AI服务不可用", start)
+		return
+	}
+
+	result := storage.RecordResult{
+		Status:       storage.RecordStatusCompleted,
+		Answer:       structured.Content,
+		Reasoning:    structured.Reasoning,
+		FinishReason: structured.FinishReason,
+		Latency:      time.Since(start),
+	}
+	if err := app.qaStorage.FinishRecord(recordID, result); err != nil {
+		log.Printf("保存答案失败: %v", err)
+	} else {
+		go app.indexRecordEmbedding(recordID, job.Prompt.Question, structured.Content)
+		go app.updateConversation(recordID)
+		go app.extractMemories(recordID, job.Owner.UserID, job.Prompt.Question, structured.Content)
+	}
+
+	showReasoning := job.ShowReasoning && structured.Reasoning != ""
+	if showReasoning {
+		gen.Emit(map[string]interface{}{
+			"type":    "reasoning",
+			"content": structured.Reasoning,
+		})
+	}
+	gen.Emit(map[string]interface{}{
+		"type":    "delta",
+		"content": structured.Content,
+	})
+	endEvent := map[string]interface{}{
+		"type":          "end",
+		"record_id":     recordID,
+		"answer":        structured.Content,
+		"data":          structured.Data,
+		"attempts":      structured.Attempts,
+		"finish_reason": result.FinishReason,
+		"latency_ms":    result.Latency.Milliseconds(),
+		"cached":        false,
+	}
+	if showReasoning {
+		endEvent["reasoning"] = structured.Reasoning
+	}
+	gen.Emit(endEvent)
+}
+
+// structuredFailure 结构化输出重试用尽时的记录结果，保存最后一次的输出
+func structuredFailure(err *llm.StructuredOutputError, start time.Time) storage.RecordResult {
+	return storage.RecordResult{
+		Status:  storage.RecordStatusFailed,
+		Answer:  err.Output,
+		Error:   err.Error(),
+		Latency: time.Since(start),
+	}
+}
+
+// pipeGeneration 将序号大于after的生成事件写入SSE（id为"记录ID-事件序号"），
+// 直到生成结束（返回true）或客户端断开（返回false）
+func (app *App) pipeGeneration(ctx context.Context, w http.ResponseWriter, flusher http.Flusher, gen *generation.Generation, after int) bool {
+	for {
+		events, done, wait := gen.EventsAfter(after)
+		for _, event := range events {
+			app.writeSSEEvent(w, sseEventID(gen.RecordID, event.ID), event.Data)
+			after = event.ID
+		}
+		if len(events) > 0 {
+			flusher.Flush()
+		}
+		if done {
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-wait:
+		}
+	}
+}
+
+// RecordStreamHandler 重新连接记录的生成流：生成进行中或仍在缓冲期内时从Last-Event-ID之后回放并继续推送，
+// 否则直接返回已保存的结果
+func (app *App) RecordStreamHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	record, ok := app.loadRecord(w, r)
+	if !ok {
+		return
+	}
+	if !record.CanView(requestOwner(r), isAdminRequest(r)) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "记录不存在"})
+		return
+	}
+
+	after := 0
+	if recordID, lastID, ok := parseLastEventID(r); ok && recordID == record.ID {
+		after = lastID
+	}
+
+	setSSEHeaders(w, r)
+	app.streamRecord(w, r, record, after)
+}
+
+// CancelRecordHandler 取消记录进行中的生成（仅所有者或管理员）：
+// 取消Provider请求，保存部分答案并标记为cancelled，订阅该生成的SSE连接收到cancelled事件。
+// 等待超时仍未结束时返回202和记录的当前状态
+func (app *App) CancelRecordHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	record, ok := app.authorizeRecordOwner(w, r)
+	if !ok {
+		return
+	}
+
+	if gen, ok := app.generations.Cancel(record.ID); ok {
+		// 等待生成任务保存部分答案后再返回最新记录
+		select {
+		case <-gen.Finished():
+		case <-time.After(cancelWaitTimeout):
+			log.Printf("等待记录 %d 的生成结束超时", record.ID)
+		}
+	} else if storage.IsTerminalStatus(record.Status) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "记录已生成结束"})
+		return
+	} else {
+		// 没有进行中的生成（例如服务重启导致中断）：直接标记为已取消
+		err := app.qaStorage.FinishRecord(record.ID, storage.RecordResult{
+			Status: storage.RecordStatusCancelled,
+			Answer: record.Answer,
+			Error:  generation.ErrCancelled.Error(),
+		})
+		if err != nil && !errors.Is(err, storage.ErrRecordFinished) {
+			log.Printf("取消记录失败: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "取消生成失败"})
+			return
+		}
+	}
+
+	if updated, err := app.qaStorage.GetRecord(record.ID); err == nil {
+		record = updated
+	}
+
+	if !storage.IsTerminalStatus(record.Status) {
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "已请求取消，生成尚未结束",
+			"data":    record,
+			"status":  "success",
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "已取消生成",
+		"data":    record,
+		"status":  "success",
+	})
+}
+
+// resumeRecordStream 按Last-Event-ID续传记录的生成流，无权访问时按记录不存在处理
+func (app *App) resumeRecordStream(w http.ResponseWriter, r *http.Request, recordID, after int) {
+	record, err := app.qaStorage.GetRecord(recordID)
+	if err != nil || !record.CanView(requestOwner(r), isAdminRequest(r)) {
+		app.writeSSEError(w, "记录不存在")
+		return
+	}
+
+	log.Printf("客户端按Last-Event-ID续传记录 %d，已接收事件序号: %d", recordID, after)
+	app.streamRecord(w, r, record, after)
+}
+
+// streamRecord 推送记录的生成流：先发送start事件，生成仍在内存中时推送序号大于after的事件，
+// 否则返回已保存的结果
+func (app *App) streamRecord(w http.ResponseWriter, r *http.Request, record *storage.QARecord, after int) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		app.writeSSEError(w, "不支持流式响应")
+		return
+	}
+
+	gen := app.generations.Get(record.ID)
+	app.writeSSEEvent(w, sseEventID(record.ID, after), map[string]interface{}{
+		"type":          "start",
+		"record_id":     record.ID,
+		"question":      record.Question,
+		"status":        record.Status,
+		"reattached":    true,
+		"last_event_id": after,
+	})
+	flusher.Flush()
+
+	if gen != nil {
+		log.Printf("客户端重新连接记录 %d 的生成流", record.ID)
+		app.pipeGeneration(r.Context(), w, flusher, gen, after)
+		return
+	}
+
+	// 没有进行中的生成：返回已保存的结果
+	switch record.Status {
+	case storage.RecordStatusCompleted:
+		app.writeSSEData(w, map[string]interface{}{
+			"type":          "end",
+			"record_id":     record.ID,
+			"answer":        record.Answer,
+			"finish_reason": record.FinishReason,
+			"latency_ms":    record.LatencyMs,
+		})
+	case storage.RecordStatusCancelled:
+		app.writeSSEData(w, map[string]interface{}{
+			"type":       "cancelled",
+			"record_id":  record.ID,
+			"answer":     record.Answer,
+			"error":      record.Error,
+			"latency_ms": record.LatencyMs,
+		})
+	case storage.RecordStatusFailed:
+		app.writeSSEData(w, map[string]interface{}{
+			"type":      "error",
+			"record_id": record.ID,
+			"status":    record.Status,
+			"error":     record.Error,
+			"answer":    record.Answer,
+		})
+	default:
+		app.writeSSEError(w, "生成已中断")
+	}
+	flusher.Flush()
+}
+
+// interruptGeneration 保存未正常完成的生成结果并发布终止事件：
+// 已取消时发布cancelled事件（携带部分答案），否则发布message对应的error事件。partial为已生成的部分内容
+func (app *App) interruptGeneration(ctx context.Context, gen *generation.Generation, recordID int, partial storage.RecordResult, err error, message string, start time.Time) {
+	result := interruptedResult(ctx, partial.Answer, err, start)
+	result.Reasoning = partial.Reasoning
+	result.Candidates = partial.Candidates
+	app.finishRecord(recordID, result)
+
+	if result.Status == storage.RecordStatusCancelled {
+		gen.Emit(map[string]interface{}{
+			"type":       "cancelled",
+			"record_id":  recordID,
+			"answer":     result.Answer,
+			"error":      result.Error,
+			"latency_ms": result.Latency.Milliseconds(),
+		})
+		return
+	}
+	gen.Emit(map[string]interface{}{"type": "error", "record_id": recordID, "error": message})
+}
+
+// interruptedResult 构造未正常完成的生成结果：请求已取消（客户端断开或显式取消）记为cancelled，否则记为failed
+func interruptedResult(ctx context.Context, partial string, err error, start time.Time) storage.RecordResult {
+	result := storage.RecordResult{
+		Status:  storage.RecordStatusFailed,
+		Answer:  partial,
+		Latency: time.Since(start),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if ctx.Err() != nil {
+		result.Status = storage.RecordStatusCancelled
+		result.Error = "客户端断开连接"
+		if errors.Is(context.Cause(ctx), generation.ErrCancelled) {
+			result.Error = generation.ErrCancelled.Error()
+		}
+	}
+	return result
+}
+
+// finishRecord 保存生成结果，失败时仅记录日志
+func (app *App) finishRecord(recordID int, result storage.RecordResult) {
+	if err := app.qaStorage.FinishRecord(recordID, result); err != nil {
+		log.Printf("保存生成结果失败，ID: %d: %v", recordID, err)
+	}
+}
+
+// replayCachedAnswer 将缓存答案切分为增量事件模拟流式输出，最后发布end事件；ctx取消时停止
+func replayCachedAnswer(ctx context.Context, gen *generation.Generation, answer string, endEvent map[string]interface{}) {
+	runes := []rune(answer)
+	for start := 0; start < len(runes); start += cacheReplayChunkRunes {
+		end := start + cacheReplayChunkRunes
+		if end > len(runes) {
+			end = len(runes)
+		}
+
+		gen.Emit(map[string]interface{}{
+			"type":    "delta",
+			"content": string(runes[start:end]),
+			"cached":  true,
+		})
+
+		select {
+		case <-ctx.Done():
+			// 记录已完成，end事件携带完整答案，续传的客户端仍可获得结果
+			gen.Emit(endEvent)
+			return
+		case <-time.After(cacheReplayInterval):
+		}
+	}
+	gen.Emit(endEvent)
+}
+
+// setSSEHeaders 设置SSE响应头和跨域头
+func setSSEHeaders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // 禁用nginx缓冲
+
+	// 设置CORS头部（确保SSE请求的跨域支持）
+	origin := r.Header.Get("Origin")
+	if origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	}
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Access-Control-Expose-Headers", "Content-Type, "+anonTokenHeader)
+}
+
+// sseEventID 生成SSE事件ID：记录ID-事件序号（序号0为start事件）
+func sseEventID(recordID, seq int) string {
+	return fmt.Sprintf("%d-%d", recordID, seq)
+}
+
+// parseLastEventID 解析断线重连时的Last-Event-ID（请求头或last_event_id查询参数），
+// 返回记录ID和客户端已接收的最后一个事件序号
+func parseLastEventID(r *http.Request) (recordID, seq int, ok bool) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+
+	parts := strings.SplitN(value, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	recordID, err := strconv.Atoi(parts[0])
+	if err != nil || recordID <= 0 {
+		return 0, 0, false
+	}
+	seq, err = strconv.Atoi(parts[1])
+	if err != nil || seq < 0 {
+		return 0, 0, false
+	}
+	return recordID, seq, true
+}
+
 // writeSSEData 写入SSE数据
 func (app *App) writeSSEData(w http.ResponseWriter, data interface{}) {
 	jsonData, _ := json.Marshal(data)
 	fmt.Fprintf(w, "data: %s\n\n", jsonData)
 }
 
+// writeSSEEvent 写入带ID的SSE数据，客户端断线重连时通过Last-Event-ID带回
+func (app *App) writeSSEEvent(w http.ResponseWriter, id string, data interface{}) {
+	jsonData, _ := json.Marshal(data)
+	fmt.Fprintf(w, "id: %s\ndata: %s\n\n", id, jsonData)
+}
+
 // writeSSEError 写入SSE错误
 func (app *App) writeSSEError(w http.ResponseWriter, message string) {
 	errorData := map[string]interface{}{
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-base-web-server/internal/auth"
+	"go-base-web-server/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// memoryRetrievalTimeout 提问时检索相关记忆（生成问题向量）的超时时间
+const memoryRetrievalTimeout = 5 * time.Second
+
+// MemoryConfig 用户长期记忆配置：只对认证用户生效，匿名请求不提取也不附加记忆
+type MemoryConfig struct {
+	Enabled     bool // 问答完成后在后台提取记忆，提问时附加相关记忆（管理接口不受影响）
+	MaxPerUser  int  // 每个用户最多保存的记忆条数
+	PromptLimit int  // 每次提问附加的最大记忆条数，记忆更多时按与问题的相关度选取
+}
+
+// MemoryRequest 添加或修改记忆请求
+type MemoryRequest struct {
+	Content string `json:"content" validate:"required,max=500"`
+}
+
+// ListMemoriesHandler 获取当前用户的全部长期记忆，按最近更新时间倒序
+func (app *App) ListMemoriesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "需要登录"})
+		return
+	}
+
+	memories, err := app.qaStorage.ListMemories(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取记忆失败"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "获取记忆成功",
+		"data": map[string]interface{}{
+			"memories": memories,
+			"enabled":  app.memories.Enabled,
+		},
+		"status": "success",
+	})
+}
+
+// CreateMemoryHandler 手动添加一条长期记忆
+func (app *App) CreateMemoryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "需要登录"})
+		return
+	}
+	content, ok := decodeMemoryRequest(w, r)
+	if !ok {
+		return
+	}
+
+	memory := storage.UserMemory{UserID: userID, Content: content}
+	memory.EmbeddingModel, memory.Embedding = app.memoryEmbedding(content)
+	created, err := app.qaStorage.CreateMemory(memory, app.memories.MaxPerUser)
+	if errors.Is(err, storage.ErrMemoryLimit) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("记忆数量已达上限（%d条）", app.memories.MaxPerUser)})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "添加记忆失败"})
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "添加记忆成功",
+		"data":    created,
+		"status":  "success",
+	})
+}
+
+// UpdateMemoryHandler 修改一条长期记忆的内容
+func (app *App) UpdateMemoryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	memory, ok := app.loadMemory(w, r)
+	if !ok {
+		return
+	}
+	content, ok := decodeMemoryRequest(w, r)
+	if !ok {
+		return
+	}
+
+	model, vector := app.memoryEmbedding(content)
+	updated, err := app.qaStorage.UpdateMemory(memory.ID, content, model, vector)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "修改记忆失败"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "修改记忆成功",
+		"data":    updated,
+		"status":  "success",
+	})
+}
+
+// DeleteMemoryHandler 删除一条长期记忆
+func (app *App) DeleteMemoryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	memory, ok := app.loadMemory(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.qaStorage.DeleteMemory(memory.ID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "删除记忆失败"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "删除记忆成功",
+		"data":    map[string]int{"id": memory.ID},
+		"status":  "success",
+	})
+}
+
+// ClearMemoriesHandler 清空当前用户的全部长期记忆
+func (app *App) ClearMemoriesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "需要登录"})
+		return
+	}
+
+	deleted, err := app.qaStorage.DeleteUserMemories(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "清空记忆失败"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "清空记忆成功",
+		"data":    map[string]int{"deleted": deleted},
+		"status":  "success",
+	})
+}
+
+// loadMemory 根据路由中的id加载当前用户的记忆，失败时写入错误响应（他人的记忆按不存在处理）
+func (app *App) loadMemory(w http.ResponseWriter, r *http.Request) (*storage.UserMemory, bool) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "需要登录"})
+		return nil, false
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的ID格式"})
+		return nil, false
+	}
+
+	memory, err := app.qaStorage.GetMemory(id)
+	if err == nil && memory.UserID != userID {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("获取记忆失败: %v", err)
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "记忆不存在"})
+		return nil, false
+	}
+	return memory, true
+}
+
+// decodeMemoryRequest 解析并校验记忆内容，失败时写入错误响应
+func decodeMemoryRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req MemoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的JSON格式"})
+		return "", false
+	}
+	req.Content = strings.TrimSpace(req.Content)
+	if err := auth.Validator().Struct(req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "参数验证失败: " + err.Error()})
+		return "", false
+	}
+	return req.Content, true
+}
+
+// extractMemories 认证用户的一轮问答完成后，用辅助模型从问答中提取新的长期记忆并保存（跳过与已有记忆重复的内容，
+// 达到MaxPerUser后不再提取）。在后台运行，失败时仅记录日志
+func (app *App) extractMemories(recordID int, userID *int, question, answer string) {
+	if !app.memories.Enabled || userID == nil {
+		return
+	}
+
+	existing, err := app.qaStorage.ListMemories(*userID)
+	if err != nil {
+		log.Printf("用户%d加载记忆失败: %v", *userID, err)
+		return
+	}
+	// 已达上限时不再调用辅助模型；并发的提取可能同时通过此检查，上限由CreateMemory在写入时保证
+	remaining := app.memories.MaxPerUser - len(existing)
+	if remaining <= 0 {
+		return
+	}
+
+	known := make([]string, 0, len(existing))
+	seen := make(map[string]bool, len(existing))
+	for _, memory := range existing {
+		known = append(known, memory.Content)
+		seen[normalizeMemory(memory.Content)] = true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), conversationTaskTimeout)
+	defer cancel()
+
+	extracted, err := app.llmClient.ExtractMemories(ctx, question, answer, known)
+	if err != nil {
+		log.Printf("记录%d提取记忆失败: %v", recordID, err)
+		return
+	}
+
+	added := 0
+	for _, content := range extracted {
+		if added >= remaining {
+			break
+		}
+		key := normalizeMemory(content)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		memory := storage.UserMemory{UserID: *userID, Content: content, SourceRecordID: &recordID}
+		memory.EmbeddingModel, memory.Embedding = app.memoryEmbedding(content)
+		if _, err := app.qaStorage.CreateMemory(memory, app.memories.MaxPerUser); err != nil {
+			if !errors.Is(err, storage.ErrMemoryLimit) {
+				log.Printf("记录%d保存记忆失败: %v", recordID, err)
+			}
+			break
+		}
+		added++
+	}
+	if added > 0 {
+		log.Printf("记录%d为用户%d新增%d条记忆", recordID, *userID, added)
+	}
+}
+
+// relevantMemories 获取与问题相关的记忆内容，附加在系统提示词后；失败时不附加记忆
+func (app *App) relevantMemories(userID int, question string) []string {
+	if !app.memories.Enabled || app.memories.PromptLimit <= 0 {
+		return nil
+	}
+
+	// 只有记忆多于PromptLimit条需要排序时才生成问题向量
+	var embed func(text string) ([]float32, error)
+	if app.llmClient.SupportsEmbedding() {
+		embed = func(text string) ([]float32, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), memoryRetrievalTimeout)
+			defer cancel()
+			if runes := []rune(text); len(runes) > maxEmbeddingInputRunes {
+				text = string(runes[:maxEmbeddingInputRunes])
+			}
+			return app.llmClient.CreateEmbedding(ctx, text)
+		}
+	}
+
+	memories, err := app.qaStorage.RelevantMemories(userID, question, app.llmClient.GetEmbeddingModel(), app.memories.PromptLimit, embed)
+	if err != nil {
+		log.Printf("用户%d检索记忆失败: %v", userID, err)
+		return nil
+	}
+	contents := make([]string, 0, len(memories))
+	for _, memory := range memories {
+		contents = append(contents, memory.Content)
+	}
+	return contents
+}
+
+// memoryEmbedding 生成记忆内容的向量，不支持或失败时返回空（检索时按字符匹配）
+func (app *App) memoryEmbedding(content string) (string, []float32) {
+	if !app.llmClient.SupportsEmbedding() {
+		return "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	vector, err := app.llmClient.CreateEmbedding(ctx, content)
+	if err != nil {
+		log.Printf("生成记忆向量失败: %v", err)
+		return "", nil
+	}
+	return app.llmClient.GetEmbeddingModel(), vector
+}
+
+// normalizeMemory 记忆去重使用的规范化内容（忽略大小写、首尾空白和结尾句号）
+func normalizeMemory(content string) string {
+	return strings.ToLower(strings.TrimRight(strings.TrimSpace(content), "。."))
+}
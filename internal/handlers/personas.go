@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-base-web-server/internal/auth"
+	"go-base-web-server/internal/storage"
+	"go-base-web-server/providers"
+
+	"github.com/gorilla/mux"
+)
+
+// PersonaRequest 创建或更新角色请求
+type PersonaRequest struct {
+	Name         string                  `json:"name" validate:"required,max=64"`
+	Description  string                  `json:"description,omitempty" validate:"max=500"`
+	SystemPrompt string                  `json:"system_prompt,omitempty" validate:"max=8000"`
+	Model        string                  `json:"model,omitempty" validate:"max=100"`
+	Params       GenerationParamsRequest `json:"params"`
+	Tools        []providers.Tool        `json:"tools,omitempty" validate:"max=16"`
+}
+
+// DefaultPersonaRequest 设置默认角色请求，persona_id为null时清除
+type DefaultPersonaRequest struct {
+	PersonaID *int `json:"persona_id"`
+}
+
+// ListPersonasHandler 获取角色列表
+func (app *App) ListPersonasHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	personas, err := app.qaStorage.ListPersonas()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取角色列表失败"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "获取角色列表成功",
+		"data":    personas,
+		"status":  "success",
+	})
+}
+
+// GetPersonaHandler 获取特定角色
+func (app *App) GetPersonaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	persona, ok := app.loadPersona(w, r)
+	if !ok {
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "获取角色成功",
+		"data":    persona,
+		"status":  "success",
+	})
+}
+
+// CreatePersonaHandler 创建角色（仅管理员）
+func (app *App) CreatePersonaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !requireAdmin(w, r) {
+		return
+	}
+	persona, ok := app.decodePersona(w, r)
+	if !ok {
+		return
+	}
+
+	created, err := app.qaStorage.CreatePersona(persona)
+	if err != nil {
+		writePersonaError(w, err, "创建角色失败")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "创建角色成功",
+		"data":    created,
+		"status":  "success",
+	})
+}
+
+// UpdatePersonaHandler 更新角色（仅管理员）
+func (app *App) UpdatePersonaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !requireAdmin(w, r) {
+		return
+	}
+	existing, ok := app.loadPersona(w, r)
+	if !ok {
+		return
+	}
+	persona, ok := app.decodePersona(w, r)
+	if !ok {
+		return
+	}
+	persona.ID = existing.ID
+
+	updated, err := app.qaStorage.UpdatePersona(persona)
+	if err != nil {
+		writePersonaError(w, err, "更新角色失败")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "更新角色成功",
+		"data":    updated,
+		"status":  "success",
+	})
+}
+
+// DeletePersonaHandler 删除角色（仅管理员），使用该角色的会话和默认设置改为不使用角色
+func (app *App) DeletePersonaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !requireAdmin(w, r) {
+		return
+	}
+	persona, ok := app.loadPersona(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.qaStorage.DeletePersona(persona.ID); err != nil {
+		writePersonaError(w, err, "删除角色失败")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "删除角色成功",
+		"data":    map[string]int{"id": persona.ID},
+		"status":  "success",
+	})
+}
+
+// SetDefaultPersonaHandler 设置当前用户的默认角色（新会话未指定角色时使用）
+func (app *App) SetDefaultPersonaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "需要登录"})
+		return
+	}
+
+	var req DefaultPersonaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的JSON格式"})
+		return
+	}
+	if req.PersonaID != nil {
+		if _, err := app.qaStorage.GetPersona(*req.PersonaID); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "角色不存在"})
+			return
+		}
+	}
+
+	if err := app.qaStorage.SetDefaultPersona(userID, req.PersonaID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "设置默认角色失败"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "设置默认角色成功",
+		"data":    map[string]interface{}{"default_persona_id": req.PersonaID},
+		"status":  "success",
+	})
+}
+
+// loadPersona 根据路由中的id加载角色，失败时写入错误响应
+func (app *App) loadPersona(w http.ResponseWriter, r *http.Request) (*storage.Persona, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的ID"})
+		return nil, false
+	}
+
+	persona, err := app.qaStorage.GetPersona(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "角色不存在"})
+		return nil, false
+	}
+	return persona, true
+}
+
+// decodePersona 解析并校验角色请求：模型须为可用模型，生成参数按该模型校验，工具须为具名的function
+func (app *App) decodePersona(w http.ResponseWriter, r *http.Request) (storage.Persona, bool) {
+	var req PersonaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的JSON格式"})
+		return storage.Persona{}, false
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if err := validatePersonaRequest(req, app.llmClient); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return storage.Persona{}, false
+	}
+
+	persona := storage.Persona{
+		Name:         req.Name,
+		Description:  strings.TrimSpace(req.Description),
+		SystemPrompt: strings.TrimSpace(req.SystemPrompt),
+		Model:        req.Model,
+	}
+	if params := req.Params.GenerationParams(); !params.IsZero() {
+		persona.Params, _ = json.Marshal(params)
+	}
+	if len(req.Tools) > 0 {
+		persona.Tools, _ = json.Marshal(req.Tools)
+	}
+	return persona, true
+}
+
+// validatePersonaRequest 校验角色请求
+func validatePersonaRequest(req PersonaRequest, llmClient LLMClient) error {
+	if req.Name == "" {
+		return fmt.Errorf("缺少name参数")
+	}
+	if err := auth.Validator().Struct(req); err != nil {
+		return fmt.Errorf("参数验证失败: %v", err)
+	}
+	if !llmClient.ModelAllowed(req.Model) {
+		return fmt.Errorf("不支持的模型: %s", req.Model)
+	}
+	if err := llmClient.ValidateParams(req.Model, req.Params.GenerationParams()); err != nil {
+		return fmt.Errorf("参数验证失败: %v", err)
+	}
+	for _, tool := range req.Tools {
+		if tool.Type != "function" || strings.TrimSpace(tool.Function.Name) == "" {
+			return fmt.Errorf("工具定义无效: type必须为function且需指定函数名称")
+		}
+	}
+	return nil
+}
+
+// writePersonaError 按角色存储错误写入响应
+func writePersonaError(w http.ResponseWriter, err error, message string) {
+	switch err {
+	case storage.ErrPersonaNameTaken:
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	case sql.ErrNoRows:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "角色不存在"})
+	default:
+		log.Printf("%s: %v", message, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+	}
+}
+
+// requireAdmin 检查请求者是否为管理员，否则写入403响应
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if isAdminRequest(r) {
+		return true
+	}
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{"error": "只有管理员可以执行此操作"})
+	return false
+}
+
+// requestDefaultPersona 认证用户的默认角色，匿名请求返回nil
+func requestDefaultPersona(r *http.Request) *int {
+	user, ok := getUserFromContext(r)
+	if !ok {
+		return nil
+	}
+	return user.DefaultPersonaID
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go-base-web-server/internal/storage"
+)
+
+// PreferencesRequest 更新用户偏好请求，未提供的字段保持不变
+type PreferencesRequest struct {
+	ShowReasoning *bool `json:"show_reasoning"`
+}
+
+// UpdatePreferencesHandler 更新当前用户的偏好（是否显示推理模型的思考过程）
+func (app *App) UpdatePreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "需要登录"})
+		return
+	}
+
+	var req PreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的JSON格式"})
+		return
+	}
+
+	showReasoning := requestShowReasoning(r)
+	if req.ShowReasoning != nil {
+		if err := app.qaStorage.SetShowReasoning(userID, *req.ShowReasoning); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "更新偏好失败"})
+			return
+		}
+		showReasoning = *req.ShowReasoning
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "更新偏好成功",
+		"data":    map[string]interface{}{"show_reasoning": showReasoning},
+		"status":  "success",
+	})
+}
+
+// requestShowReasoning 请求者是否显示思考过程：认证用户按偏好，匿名请求默认显示
+func requestShowReasoning(r *http.Request) bool {
+	user, ok := getUserFromContext(r)
+	if !ok {
+		return true
+	}
+	return user.ShowReasoning
+}
+
+// hideReasoning 按请求者偏好去除记录中的思考过程（只影响响应，不修改保存的内容）
+func hideReasoning(r *http.Request, records []storage.QARecord) {
+	if requestShowReasoning(r) {
+		return
+	}
+	for i := range records {
+		records[i].Reasoning = ""
+	}
+}
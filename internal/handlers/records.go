@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-base-web-server/internal/llm"
+	"go-base-web-server/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// anonTokenHeader 匿名会话令牌请求/响应头
+	anonTokenHeader = "X-Anonymous-Token"
+	// anonTokenCookie 匿名会话令牌Cookie（EventSource无法设置请求头）
+	anonTokenCookie = "anon_token"
+	// anonTokenMaxAge 匿名会话令牌Cookie有效期
+	anonTokenMaxAge = 365 * 24 * time.Hour
+)
+
+// UpdateVisibilityRequest 更新记录可见性请求
+type UpdateVisibilityRequest struct {
+	Visibility string `json:"visibility"`
+}
+
+// UpdateRecordVisibilityHandler 更新记录可见性（仅所有者或管理员）
+func (app *App) UpdateRecordVisibilityHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	record, ok := app.authorizeRecordOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateVisibilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的JSON格式"})
+		return
+	}
+
+	if !storage.ValidVisibility(req.Visibility) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "visibility必须为private、shared或public"})
+		return
+	}
+
+	if err := app.qaStorage.UpdateVisibility(record.ID, req.Visibility); err != nil {
+		log.Printf("更新记录可见性失败: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "更新可见性失败"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "更新可见性成功",
+		"data": map[string]interface{}{
+			"id":         record.ID,
+			"visibility": req.Visibility,
+		},
+		"status": "success",
+	})
+}
+
+// loadRecord 根据路由中的id加载记录，失败时写入错误响应
+func (app *App) loadRecord(w http.ResponseWriter, r *http.Request) (*storage.QARecord, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的ID格式"})
+		return nil, false
+	}
+
+	record, err := app.qaStorage.GetRecord(id)
+	if err != nil {
+		log.Printf("获取记录失败: %v", err)
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "记录不存在"})
+		return nil, false
+	}
+
+	return record, true
+}
+
+// authorizeRecordOwner 加载记录并校验当前请求者是所有者或管理员
+func (app *App) authorizeRecordOwner(w http.ResponseWriter, r *http.Request) (*storage.QARecord, bool) {
+	record, ok := app.loadRecord(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if !isAdminRequest(r) && !record.IsOwnedBy(requestOwner(r)) {
+		// 对无权访问的记录返回404，避免泄露记录是否存在
+		if !record.CanView(requestOwner(r), false) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "记录不存在"})
+			return nil, false
+		}
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "只有记录所有者可以执行此操作"})
+		return nil, false
+	}
+
+	return record, true
+}
+
+// anonymousToken 从请求头或Cookie中读取匿名会话令牌
+func anonymousToken(r *http.Request) string {
+	if token := r.Header.Get(anonTokenHeader); token != "" {
+		return token
+	}
+	if cookie, err := r.Cookie(anonTokenCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// requestOwner 当前请求者身份：认证用户优先，否则为匿名会话
+func requestOwner(r *http.Request) storage.RecordOwner {
+	if id, ok := getUserIDFromContext(r); ok {
+		return storage.RecordOwner{UserID: &id}
+	}
+	return storage.RecordOwner{AnonToken: anonymousToken(r)}
+}
+
+// cacheOwner 应答缓存使用的请求者身份：匿名会话以令牌哈希区分，不在缓存中保存令牌原文
+func cacheOwner(owner storage.RecordOwner) llm.CacheOwner {
+	if owner.UserID != nil {
+		return llm.CacheOwner{UserID: owner.UserID}
+	}
+	if owner.AnonToken == "" {
+		return llm.CacheOwner{}
+	}
+	return llm.CacheOwner{AnonKey: storage.HashAnonToken(owner.AnonToken)}
+}
+
+// ensureRecordOwner 获取请求者身份，匿名请求没有令牌时签发新令牌（写入响应头和Cookie）。
+// 必须在写入响应状态码之前调用。
+func ensureRecordOwner(w http.ResponseWriter, r *http.Request) (storage.RecordOwner, string) {
+	owner := requestOwner(r)
+	if owner.UserID != nil || owner.AnonToken != "" {
+		return owner, ""
+	}
+
+	token, err := storage.GenerateAnonToken()
+	if err != nil {
+		log.Printf("生成匿名会话令牌失败: %v", err)
+		return owner, ""
+	}
+
+	w.Header().Set(anonTokenHeader, token)
+	http.SetCookie(w, &http.Cookie{
+		Name:     anonTokenCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(anonTokenMaxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	owner.AnonToken = token
+	return owner, token
+}
+
+// parseRecordQuery 解析记录列表的分页、过滤和排序参数
+//
+// 支持的参数: limit, cursor, sort(created_at|updated_at|id), order(asc|desc),
+// from/to(RFC3339或YYYY-MM-DD), user_id, provider, model, answered(true|false)
+func parseRecordQuery(r *http.Request) (storage.RecordQuery, error) {
+	params := r.URL.Query()
+	q := storage.RecordQuery{
+		Provider: params.Get("provider"),
+		Model:    params.Get("model"),
+		Status:   params.Get("status"),
+		SortBy:   params.Get("sort"),
+		Order:    params.Get("order"),
+		Cursor:   params.Get("cursor"),
+	}
+
+	if limitStr := params.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			return q, fmt.Errorf("无效的limit参数")
+		}
+		q.Limit = limit
+	}
+
+	if userIDStr := params.Get("user_id"); userIDStr != "" {
+		userID, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			return q, fmt.Errorf("无效的user_id参数")
+		}
+		q.UserID = &userID
+	}
+
+	if answeredStr := params.Get("answered"); answeredStr != "" {
+		answered, err := strconv.ParseBool(answeredStr)
+		if err != nil {
+			return q, fmt.Errorf("无效的answered参数")
+		}
+		q.Answered = &answered
+	}
+
+	for _, bound := range []struct {
+		name   string
+		target **time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		value := params.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := parseTimeParam(value)
+		if err != nil {
+			return q, fmt.Errorf("无效的%s参数: %s", bound.name, value)
+		}
+		*bound.target = &t
+	}
+
+	if err := q.Normalize(); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+// parseTimeParam 解析RFC3339或YYYY-MM-DD格式的时间
+func parseTimeParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultSearchLimit 默认返回的搜索结果数量
+	defaultSearchLimit = 20
+	// maxSearchLimit 单次搜索允许返回的最大结果数量
+	maxSearchLimit = 100
+	// maxEmbeddingInputRunes 生成向量时截取的最大字符数
+	maxEmbeddingInputRunes = 2000
+	// embeddingBackfillBatch 历史记录补齐向量的批大小
+	embeddingBackfillBatch = 50
+)
+
+// SearchRecordsHandler 搜索问答记录处理器（关键词+语义混合排序）
+func (app *App) SearchRecordsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "需要用户认证"})
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "缺少q参数"})
+		return
+	}
+
+	limit := defaultSearchLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "无效的limit参数"})
+			return
+		}
+		if parsed > maxSearchLimit {
+			parsed = maxSearchLimit
+		}
+		limit = parsed
+	}
+
+	// 管理员搜索全部记录，普通用户只能搜索自己的记录
+	scope := &userID
+	if isAdminRequest(r) {
+		scope = nil
+	}
+
+	// 生成查询向量；失败时退化为纯关键词检索
+	var queryVector []float32
+	mode := "keyword"
+	if app.llmClient.SupportsEmbedding() {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		vector, err := app.llmClient.CreateEmbedding(ctx, query)
+		cancel()
+		if err != nil {
+			log.Printf("生成查询向量失败，仅使用关键词检索: %v", err)
+		} else {
+			queryVector = vector
+			mode = "hybrid"
+		}
+	}
+
+	results, err := app.qaStorage.SearchRecords(query, queryVector, app.llmClient.GetEmbeddingModel(), scope, limit)
+	if err != nil {
+		log.Printf("搜索记录失败: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "搜索记录失败"})
+		return
+	}
+	// 与列表、详情接口一致，按请求者偏好去除思考过程
+	if !requestShowReasoning(r) {
+		for i := range results {
+			results[i].Reasoning = ""
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "搜索成功",
+		"data":    results,
+		"query":   query,
+		"mode":    mode,
+		"status":  "success",
+	})
+}
+
+// BackfillEmbeddings 为历史记录补齐向量（启动时在后台调用）
+func (app *App) BackfillEmbeddings() {
+	if !app.llmClient.SupportsEmbedding() {
+		return
+	}
+
+	count, err := app.qaStorage.BackfillEmbeddings(app.llmClient.GetEmbeddingModel(), embeddingBackfillBatch, func(question, answer string) ([]float32, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		return app.llmClient.CreateEmbedding(ctx, embeddingInput(question, answer))
+	})
+	if err != nil {
+		log.Printf("补齐历史记录向量中断: %v", err)
+	}
+	if count > 0 {
+		log.Printf("已为%d条历史记录补齐向量", count)
+	}
+}
+
+// indexRecordEmbedding 为问答记录生成并保存向量
+func (app *App) indexRecordEmbedding(recordID int, question, answer string) {
+	if !app.llmClient.SupportsEmbedding() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	vector, err := app.llmClient.CreateEmbedding(ctx, embeddingInput(question, answer))
+	if err != nil {
+		log.Printf("记录%d生成向量失败: %v", recordID, err)
+		return
+	}
+
+	if err := app.qaStorage.SaveEmbedding(recordID, app.llmClient.GetEmbeddingModel(), vector); err != nil {
+		log.Printf("记录%d保存向量失败: %v", recordID, err)
+	}
+}
+
+// embeddingInput 组合问答文本作为向量输入
+func embeddingInput(question, answer string) string {
+	text := "问题: " + question + "\n回答: " + answer
+	if runes := []rune(text); len(runes) > maxEmbeddingInputRunes {
+		text = string(runes[:maxEmbeddingInputRunes])
+	}
+	return text
+}
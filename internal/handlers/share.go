@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"go-base-web-server/internal/auth"
+	"go-base-web-server/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// sharedThreadMaxTurns 会话分享页（无需认证）最多返回的轮数，更早的轮次不返回
+const sharedThreadMaxTurns = 50
+
+// CreateShareRequest 创建分享链接请求
+type CreateShareRequest struct {
+	// 分享范围：record（默认）只分享该记录，conversation分享从会话第一轮到该记录的整个分支
+	Scope     string     `json:"scope,omitempty" validate:"omitempty,oneof=record conversation"`
+	ExpiresIn string     `json:"expires_in,omitempty"` // 有效时长，如 "24h"、"168h"
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // 过期时间（RFC3339），与expires_in二选一
+}
+
+// SharedRecord 分享页返回的只读记录内容（不包含用户信息）
+type SharedRecord struct {
+	ID        int       `json:"id"`
+	Question  string    `json:"question"`
+	Answer    string    `json:"answer"`
+	Provider  string    `json:"provider,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateShareHandler 为记录或记录所在的会话创建公开分享链接（仅所有者或管理员）
+func (app *App) CreateShareHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	record, ok := app.authorizeRecordOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateShareRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "无效的JSON格式"})
+			return
+		}
+	}
+	if err := auth.Validator().Struct(req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "参数验证失败: " + err.Error()})
+		return
+	}
+	scope := req.Scope
+	if scope == "" {
+		scope = storage.ShareScopeRecord
+	}
+
+	expiresAt := req.ExpiresAt
+	if req.ExpiresIn != "" {
+		duration, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || duration <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "无效的expires_in参数"})
+			return
+		}
+		t := time.Now().Add(duration)
+		expiresAt = &t
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "过期时间必须晚于当前时间"})
+		return
+	}
+
+	share, err := app.qaStorage.CreateShare(record.ID, scope, requestOwner(r).UserID, expiresAt)
+	if err != nil {
+		log.Printf("创建分享链接失败: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "创建分享链接失败"})
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "创建分享链接成功",
+		"data": map[string]interface{}{
+			"share": share,
+			"url":   "/api/share/" + share.Slug,
+		},
+		"status": "success",
+	})
+}
+
+// ListSharesHandler 获取记录的分享链接列表（仅所有者或管理员）
+func (app *App) ListSharesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	record, ok := app.authorizeRecordOwner(w, r)
+	if !ok {
+		return
+	}
+
+	shares, err := app.qaStorage.ListSharesByRecord(record.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取分享链接失败"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "获取分享链接成功",
+		"data":    shares,
+		"status":  "success",
+	})
+}
+
+// RevokeShareHandler 撤销分享链接（仅记录所有者或管理员）
+func (app *App) RevokeShareHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	slug := mux.Vars(r)["slug"]
+	share, err := app.qaStorage.GetShareBySlug(slug)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "分享链接不存在"})
+		return
+	}
+
+	record, err := app.qaStorage.GetRecord(share.RecordID)
+	if err != nil || (!isAdminRequest(r) && !record.IsOwnedBy(requestOwner(r))) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "分享链接不存在"})
+		return
+	}
+
+	if err := app.qaStorage.RevokeShare(slug); err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": "分享链接已被撤销"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "撤销分享链接失败"})
+		return
+	}
+
+	log.Printf("分享链接已撤销: %s", slug)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "撤销分享链接成功",
+		"status":  "success",
+	})
+}
+
+// GetSharedHandler 通过分享链接获取只读内容（无需认证）：record为分享的记录，会话分享时turns为到该记录为止
+// 最近sharedThreadMaxTurns轮中已完成的问答，truncated表示更早的轮次未返回。
+// 记录尚未生成完成（或生成失败、被取消）时按不存在处理
+func (app *App) GetSharedHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	slug := mux.Vars(r)["slug"]
+	share, err := app.qaStorage.GetShareBySlug(slug)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "分享链接不存在"})
+		return
+	}
+
+	if !share.Active(time.Now()) {
+		w.WriteHeader(http.StatusGone)
+		json.NewEncoder(w).Encode(map[string]string{"error": "分享链接已过期或已被撤销"})
+		return
+	}
+
+	record, err := app.qaStorage.GetRecord(share.RecordID)
+	if err != nil || record.Status != storage.RecordStatusCompleted {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "分享的内容不存在"})
+		return
+	}
+
+	data := map[string]interface{}{"record": sharedRecord(record)}
+	if share.Scope == storage.ShareScopeConversation {
+		thread, err := app.qaStorage.GetRecordThread(record.ID, sharedThreadMaxTurns)
+		if err != nil {
+			log.Printf("获取分享的会话失败: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "获取分享内容失败"})
+			return
+		}
+		turns := make([]SharedRecord, 0, len(thread))
+		for i := range thread {
+			if thread[i].Status == storage.RecordStatusCompleted {
+				turns = append(turns, sharedRecord(&thread[i]))
+			}
+		}
+		data["turns"] = turns
+		data["truncated"] = len(thread) > 0 && thread[0].ParentID != nil
+	}
+
+	if err := app.qaStorage.IncrementShareViews(slug); err == nil {
+		share.ViewCount++
+	}
+
+	data["share"] = map[string]interface{}{
+		"slug":       share.Slug,
+		"scope":      share.Scope,
+		"view_count": share.ViewCount,
+		"expires_at": share.ExpiresAt,
+		"created_at": share.CreatedAt,
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "获取分享内容成功",
+		"data":    data,
+		"status":  "success",
+	})
+}
+
+// sharedRecord 转换为分享页返回的只读内容
+func sharedRecord(record *storage.QARecord) SharedRecord {
+	return SharedRecord{
+		ID:        record.ID,
+		Question:  record.Question,
+		Answer:    record.Answer,
+		Provider:  record.Provider,
+		Model:     record.Model,
+		CreatedAt: record.CreatedAt,
+	}
+}
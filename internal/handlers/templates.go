@@ -0,0 +1,442 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-base-web-server/internal/auth"
+	"go-base-web-server/internal/storage"
+	"go-base-web-server/internal/templates"
+
+	"github.com/gorilla/mux"
+)
+
+// TemplateRequest 创建或更新提示词模板请求
+type TemplateRequest struct {
+	Name         string               `json:"name" validate:"required,max=100"`
+	Description  string               `json:"description,omitempty" validate:"max=500"`
+	Body         string               `json:"body" validate:"required,max=32000"`
+	SystemPrompt string               `json:"system_prompt,omitempty" validate:"max=8000"`
+	Variables    []templates.Variable `json:"variables,omitempty" validate:"max=50,dive"`
+}
+
+// RunTemplateRequest 运行模板请求：变量值和可选的模板版本，其余字段同提问请求（prompt由模板渲染生成）
+type RunTemplateRequest struct {
+	Variables map[string]interface{} `json:"variables"`
+	Version   *int                   `json:"version,omitempty"` // 为空时使用当前版本
+	AskRequest
+}
+
+// ShareTemplateRequest 共享模板请求
+type ShareTemplateRequest struct {
+	Username string `json:"username" validate:"required"`
+}
+
+// ListTemplatesHandler 获取自己的和共享给自己的模板
+func (app *App) ListTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := getUserIDFromContext(r)
+	list, err := app.qaStorage.ListTemplates(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取模板列表失败"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "获取模板列表成功",
+		"data":    list,
+		"status":  "success",
+	})
+}
+
+// CreateTemplateHandler 创建模板（版本1）
+func (app *App) CreateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	template, ok := decodeTemplate(w, r)
+	if !ok {
+		return
+	}
+	template.UserID, _ = getUserIDFromContext(r)
+
+	created, err := app.qaStorage.CreateTemplate(template)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "创建模板失败"})
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "创建模板成功",
+		"data":    created,
+		"status":  "success",
+	})
+}
+
+// GetTemplateHandler 获取模板（所有者或被共享的用户），version参数指定历史版本
+func (app *App) GetTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	template, ok := app.loadTemplate(w, r, false)
+	if !ok {
+		return
+	}
+	if value := r.URL.Query().Get("version"); value != "" {
+		if !app.loadTemplateVersion(w, template, value) {
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "获取模板成功",
+		"data":    template,
+		"status":  "success",
+	})
+}
+
+// UpdateTemplateHandler 更新模板（仅所有者），内容（body、system_prompt、variables）变化时生成新版本
+func (app *App) UpdateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	existing, ok := app.loadTemplate(w, r, true)
+	if !ok {
+		return
+	}
+	template, ok := decodeTemplate(w, r)
+	if !ok {
+		return
+	}
+	template.ID = existing.ID
+
+	newVersion := template.Body != existing.Body || template.SystemPrompt != existing.SystemPrompt ||
+		!bytes.Equal(template.Variables, existing.Variables)
+	updated, err := app.qaStorage.UpdateTemplate(template, newVersion)
+	if err != nil {
+		log.Printf("更新模板失败: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "更新模板失败"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "更新模板成功",
+		"data":    updated,
+		"status":  "success",
+	})
+}
+
+// DeleteTemplateHandler 删除模板及其全部版本（仅所有者）
+func (app *App) DeleteTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	template, ok := app.loadTemplate(w, r, true)
+	if !ok {
+		return
+	}
+
+	if err := app.qaStorage.DeleteTemplate(template.ID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "删除模板失败"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "删除模板成功",
+		"data":    map[string]int{"id": template.ID},
+		"status":  "success",
+	})
+}
+
+// ListTemplateVersionsHandler 获取模板的版本历史（所有者或被共享的用户）
+func (app *App) ListTemplateVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	template, ok := app.loadTemplate(w, r, false)
+	if !ok {
+		return
+	}
+
+	versions, err := app.qaStorage.ListTemplateVersions(template.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取模板版本失败"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "获取模板版本成功",
+		"data":    versions,
+		"status":  "success",
+	})
+}
+
+// ShareTemplateHandler 将模板共享给其他用户（仅所有者）
+func (app *App) ShareTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	template, ok := app.loadTemplate(w, r, true)
+	if !ok {
+		return
+	}
+
+	var req ShareTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Username) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "缺少username参数"})
+		return
+	}
+
+	user, err := app.qaStorage.GetUserByUsername(strings.TrimSpace(req.Username))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "用户不存在"})
+		return
+	}
+	if user.ID == template.UserID {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "不能共享给模板所有者"})
+		return
+	}
+
+	if err := app.qaStorage.ShareTemplate(template.ID, user.ID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "共享模板失败"})
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "共享模板成功",
+		"data": map[string]interface{}{
+			"template_id": template.ID,
+			"user_id":     user.ID,
+			"username":    user.Username,
+		},
+		"status": "success",
+	})
+}
+
+// ListTemplateSharesHandler 获取模板共享的用户（仅所有者）
+func (app *App) ListTemplateSharesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	template, ok := app.loadTemplate(w, r, true)
+	if !ok {
+		return
+	}
+
+	shares, err := app.qaStorage.ListTemplateShares(template.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取模板共享失败"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "获取模板共享成功",
+		"data":    shares,
+		"status":  "success",
+	})
+}
+
+// UnshareTemplateHandler 取消对用户的共享（仅所有者）
+func (app *App) UnshareTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	template, ok := app.loadTemplate(w, r, true)
+	if !ok {
+		return
+	}
+	userID, err := strconv.Atoi(mux.Vars(r)["user_id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的用户ID"})
+		return
+	}
+
+	if err := app.qaStorage.UnshareTemplate(template.ID, userID); err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "模板未共享给该用户"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "取消共享失败"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "取消共享成功",
+		"data": map[string]int{
+			"template_id": template.ID,
+			"user_id":     userID,
+		},
+		"status": "success",
+	})
+}
+
+// RunTemplateHandler 用变量值渲染模板，并通过提问流程以SSE流式返回结果（所有者或被共享的用户）
+func (app *App) RunTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	// 断线重连续传原记录
+	if recordID, after, ok := parseLastEventID(r); ok {
+		setSSEHeaders(w, r)
+		app.resumeRecordStream(w, r, recordID, after)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	template, ok := app.loadTemplate(w, r, false)
+	if !ok {
+		return
+	}
+
+	var req RunTemplateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxAskBodyBytes)).Decode(&req); err != nil {
+		writeAskError(w, &askError{http.StatusBadRequest, "无效的JSON格式"})
+		return
+	}
+	if req.Version != nil && *req.Version != template.Version {
+		if !app.loadTemplateVersion(w, template, strconv.Itoa(*req.Version)) {
+			return
+		}
+	}
+
+	var variables []templates.Variable
+	if len(template.Variables) > 0 {
+		if err := json.Unmarshal(template.Variables, &variables); err != nil {
+			log.Printf("模板 %d 变量定义无效: %v", template.ID, err)
+			writeAskError(w, &askError{http.StatusInternalServerError, "模板变量定义无效"})
+			return
+		}
+	}
+	prompt, err := templates.Render(template.Body, variables, req.Variables)
+	if err != nil {
+		writeAskError(w, &askError{http.StatusBadRequest, "变量验证失败: " + err.Error()})
+		return
+	}
+
+	req.Prompt = prompt
+	if strings.TrimSpace(req.SystemPrompt) == "" {
+		req.SystemPrompt = template.SystemPrompt
+	}
+	if err := validateAskRequest(&req.AskRequest); err != nil {
+		writeAskError(w, err)
+		return
+	}
+
+	log.Printf("运行模板 %d (版本 %d)", template.ID, template.Version)
+	setSSEHeaders(w, r)
+	app.streamAsk(w, r, req.AskRequest)
+}
+
+// loadTemplate 根据路由中的id加载模板并检查权限：所有者和管理员可以管理，被共享的用户只能查看和运行。
+// 失败时写入错误响应
+func (app *App) loadTemplate(w http.ResponseWriter, r *http.Request, manage bool) (*storage.PromptTemplate, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的ID"})
+		return nil, false
+	}
+
+	template, err := app.qaStorage.GetTemplate(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "模板不存在"})
+		return nil, false
+	}
+
+	userID, _ := getUserIDFromContext(r)
+	if template.UserID == userID || isAdminRequest(r) {
+		return template, true
+	}
+
+	// 未共享的模板对其他用户不可见
+	shared, err := app.qaStorage.TemplateSharedWith(template.ID, userID)
+	if err != nil || !shared {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "模板不存在"})
+		return nil, false
+	}
+	if manage {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "只有模板所有者可以执行此操作"})
+		return nil, false
+	}
+	return template, true
+}
+
+// loadTemplateVersion 用指定版本的内容替换模板的当前内容，失败时写入错误响应
+func (app *App) loadTemplateVersion(w http.ResponseWriter, template *storage.PromptTemplate, value string) bool {
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的version参数"})
+		return false
+	}
+
+	version, err := app.qaStorage.GetTemplateVersion(template.ID, number)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "模板版本不存在"})
+		return false
+	}
+
+	template.Version = version.Version
+	template.Body = version.Body
+	template.SystemPrompt = version.SystemPrompt
+	template.Variables = version.Variables
+	return true
+}
+
+// decodeTemplate 解析并校验模板请求：模板中的占位符须全部定义为变量，失败时写入错误响应
+func decodeTemplate(w http.ResponseWriter, r *http.Request) (storage.PromptTemplate, bool) {
+	var req TemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的JSON格式"})
+		return storage.PromptTemplate{}, false
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if err := validateTemplateRequest(req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return storage.PromptTemplate{}, false
+	}
+
+	template := storage.PromptTemplate{
+		Name:         req.Name,
+		Description:  strings.TrimSpace(req.Description),
+		Body:         req.Body,
+		SystemPrompt: strings.TrimSpace(req.SystemPrompt),
+	}
+	if len(req.Variables) > 0 {
+		template.Variables, _ = json.Marshal(req.Variables)
+	}
+	return template, true
+}
+
+// validateTemplateRequest 校验模板请求
+func validateTemplateRequest(req TemplateRequest) error {
+	if req.Name == "" || strings.TrimSpace(req.Body) == "" {
+		return fmt.Errorf("缺少name或body参数")
+	}
+	if err := auth.Validator().Struct(req); err != nil {
+		return fmt.Errorf("参数验证失败: %v", err)
+	}
+	if err := templates.Validate(req.Body, req.Variables); err != nil {
+		return fmt.Errorf("模板验证失败: %v", err)
+	}
+	return nil
+}
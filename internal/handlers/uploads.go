@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"go-base-web-server/internal/llm"
+	"go-base-web-server/internal/storage"
+	"go-base-web-server/internal/uploads"
+
+	"github.com/gorilla/mux"
+)
+
+// uploadFormOverhead 多部分表单中文件以外内容（边界、字段头）允许的字节数
+const uploadFormOverhead = 1 << 20
+
+// UploadHandler 上传图片（需要登录，multipart/form-data的file字段），按文件内容检测类型并校验大小和用户配额后保存到磁盘，
+// 返回的ID可在提问时以 {"type":"image","upload_id":ID} 附件引用
+func (app *App) UploadHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// 匿名令牌可随时重新签发，无法按匿名会话限制配额，上传只对认证用户开放
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "上传文件需要登录"})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, app.uploads.MaxBytes()+uploadFormOverhead)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeUploadError(w, uploads.ErrTooLarge, app.uploads.MaxBytes())
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "缺少file文件字段"})
+		return
+	}
+	defer file.Close()
+
+	saved, err := app.uploads.Save(file)
+	if err != nil {
+		writeUploadError(w, err, app.uploads.MaxBytes())
+		return
+	}
+
+	upload, err := app.qaStorage.CreateUpload(storage.Upload{
+		Filename:    header.Filename,
+		MimeType:    saved.MimeType,
+		Size:        saved.Size,
+		StorageName: saved.Name,
+	}, storage.RecordOwner{UserID: &userID}, app.uploads.QuotaBytes())
+	if err != nil {
+		app.uploads.Remove(saved.Name)
+		if errors.Is(err, storage.ErrUploadQuota) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("上传空间不足，每个用户最多 %d 字节，请先删除不再使用的图片", app.uploads.QuotaBytes())})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "保存上传文件失败"})
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "上传成功",
+		"data":    upload,
+		"status":  "success",
+	})
+}
+
+// GetUploadHandler 获取上传的图片内容（仅所有者或管理员）
+func (app *App) GetUploadHandler(w http.ResponseWriter, r *http.Request) {
+	upload, ok := app.authorizeUpload(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := app.uploads.Read(upload.StorageName)
+	if err != nil {
+		log.Printf("读取上传文件失败: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "文件不存在"})
+		return
+	}
+
+	w.Header().Set("Content-Type", upload.MimeType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Write(data)
+}
+
+// DeleteUploadHandler 删除上传的图片及其磁盘文件（仅所有者或管理员）
+func (app *App) DeleteUploadHandler(w http.ResponseWriter, r *http.Request) {
+	upload, ok := app.authorizeUpload(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.qaStorage.DeleteUpload(upload.ID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "删除文件失败"})
+		return
+	}
+	if err := app.uploads.Remove(upload.StorageName); err != nil {
+		log.Printf("删除磁盘文件失败: %v", err)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "删除文件成功",
+		"data":    map[string]int{"id": upload.ID},
+		"status":  "success",
+	})
+}
+
+// authorizeUpload 根据路由中的id加载上传文件并校验归属，失败时写入JSON错误响应（无权访问时按不存在处理）
+func (app *App) authorizeUpload(w http.ResponseWriter, r *http.Request) (*storage.Upload, bool) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的ID"})
+		return nil, false
+	}
+
+	upload, err := app.qaStorage.GetUpload(id)
+	if err != nil || (!isAdminRequest(r) && !upload.IsOwnedBy(requestOwner(r))) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "文件不存在"})
+		return nil, false
+	}
+	return upload, true
+}
+
+// loadUploadedImage 读取提问者上传的图片作为附件
+func (app *App) loadUploadedImage(id int, owner storage.RecordOwner) (llm.Attachment, error) {
+	upload, err := app.qaStorage.GetUpload(id)
+	if err != nil || !upload.IsOwnedBy(owner) {
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("加载上传文件失败: %v", err)
+		}
+		return llm.Attachment{}, &askError{http.StatusBadRequest, fmt.Sprintf("图片 %d 不存在", id)}
+	}
+
+	data, err := app.uploads.Read(upload.StorageName)
+	if err != nil {
+		log.Printf("读取上传文件失败: %v", err)
+		return llm.Attachment{}, &askError{http.StatusBadRequest, fmt.Sprintf("图片 %d 不存在", id)}
+	}
+
+	return llm.Attachment{
+		Type:     "image",
+		Name:     upload.Filename,
+		MimeType: upload.MimeType,
+		Data:     data,
+	}, nil
+}
+
+// writeUploadError 按上传校验错误返回对应的状态码
+func writeUploadError(w http.ResponseWriter, err error, maxBytes int64) {
+	status, message := http.StatusInternalServerError, "保存上传文件失败"
+	switch {
+	case errors.Is(err, uploads.ErrTooLarge):
+		status, message = http.StatusRequestEntityTooLarge, fmt.Sprintf("文件不能超过 %d 字节", maxBytes)
+	case errors.Is(err, uploads.ErrUnsupportedType):
+		status, message = http.StatusUnsupportedMediaType, err.Error()+"，只支持PNG、JPEG、GIF和WebP图片"
+	case errors.Is(err, uploads.ErrEmpty):
+		status, message = http.StatusBadRequest, err.Error()
+	default:
+		log.Printf("保存上传文件失败: %v", err)
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
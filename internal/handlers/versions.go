@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"go-base-web-server/internal/auth"
+	"go-base-web-server/internal/storage"
+)
+
+// RecordVersionRequest 重新生成或编辑请求：编辑时prompt为修改后的问题（重新生成时忽略）；
+// 未指定的模型和生成参数沿用原记录，附件未随记录保存，需要时重新提供
+type RecordVersionRequest struct {
+	Prompt string `json:"prompt,omitempty" validate:"max=32000"`
+	Model  string `json:"model,omitempty" validate:"max=100"`
+	GenerationParamsRequest
+	Attachments []AttachmentRequest `json:"attachments,omitempty" validate:"max=8,dive"`
+	N           *int                `json:"n,omitempty" validate:"omitempty,min=1,max=5"`
+	Background  *bool               `json:"background,omitempty"`
+}
+
+// recordTreeNode 会话树中的一条记录及以其为上一轮的记录
+type recordTreeNode struct {
+	storage.QARecord
+	Children []*recordTreeNode `json:"children"`
+}
+
+// RegenerateRecordHandler 重新生成记录的答案（仅所有者）：以相同问题创建该轮的新版本，保留原记录
+func (app *App) RegenerateRecordHandler(w http.ResponseWriter, r *http.Request) {
+	app.createRecordVersion(w, r, false)
+}
+
+// EditRecordHandler 编辑问题后重新提交（仅所有者）：以修改后的问题创建该轮的新版本，原记录及其后续追问保留为另一分支
+func (app *App) EditRecordHandler(w http.ResponseWriter, r *http.Request) {
+	app.createRecordVersion(w, r, true)
+}
+
+// createRecordVersion 创建记录的新版本：与原记录共享上一轮和角色，Accept: text/event-stream时以SSE返回
+func (app *App) createRecordVersion(w http.ResponseWriter, r *http.Request, edit bool) {
+	w.Header().Set("Content-Type", "application/json")
+
+	record, ok := app.authorizeRecordOwner(w, r)
+	if !ok {
+		return
+	}
+	owner := requestOwner(r)
+	if !record.IsOwnedBy(owner) {
+		// 新版本归属于请求者，管理员不能在他人的会话中创建版本
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "只有记录所有者可以执行此操作"})
+		return
+	}
+	if !storage.IsTerminalStatus(record.Status) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "记录仍在生成中"})
+		return
+	}
+
+	var req RecordVersionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxAskBodyBytes)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的JSON格式"})
+		return
+	}
+	if err := auth.Validator().Struct(req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "参数验证失败: " + err.Error()})
+		return
+	}
+
+	question := record.Question
+	if edit {
+		if question = strings.TrimSpace(req.Prompt); question == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "缺少prompt参数"})
+			return
+		}
+	}
+
+	// 新版本归入该轮第一个版本的版本组
+	versionOf := record.ID
+	if record.VersionOf != nil {
+		versionOf = *record.VersionOf
+	}
+	ask := AskRequest{
+		Prompt:                  question,
+		ParentRecordID:          record.ParentID,
+		Model:                   req.Model,
+		GenerationParamsRequest: req.GenerationParamsRequest,
+		Attachments:             req.Attachments,
+		N:                       req.N,
+		Background:              req.Background,
+		VersionOf:               &versionOf,
+	}
+	// 显式指定模型也使请求不查询应答缓存，重新生成总会得到新的答案
+	if ask.Model == "" {
+		ask.Model = record.Model
+	}
+	if req.GenerationParams().IsZero() && len(record.Params) > 0 {
+		if err := json.Unmarshal(record.Params, &ask.GenerationParamsRequest); err != nil {
+			log.Printf("记录 %d 的生成参数无效: %v", record.ID, err)
+		}
+	}
+	// 原记录的角色已被删除时按未使用角色处理
+	if record.PersonaID != nil {
+		if _, err := app.qaStorage.GetPersona(*record.PersonaID); err == nil {
+			ask.PersonaID = record.PersonaID
+		}
+	}
+
+	if err := validateAskRequest(&ask); err != nil {
+		writeAskError(w, err)
+		return
+	}
+
+	if wantsEventStream(r) {
+		setSSEHeaders(w, r)
+		app.streamAsk(w, r, ask)
+		return
+	}
+	app.answerAsk(w, r, ask)
+}
+
+// ListRecordVersionsHandler 获取记录所在轮次的全部版本，按版本号排序
+func (app *App) ListRecordVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	record, ok := app.loadRecord(w, r)
+	if !ok {
+		return
+	}
+	owner, isAdmin := requestOwner(r), isAdminRequest(r)
+	if !record.CanView(owner, isAdmin) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "记录不存在"})
+		return
+	}
+
+	all, err := app.qaStorage.ListRecordVersions(record.ID)
+	if err != nil {
+		log.Printf("获取记录版本失败: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取记录版本失败"})
+		return
+	}
+	versions := make([]storage.QARecord, 0, len(all))
+	for _, version := range all {
+		if version.CanView(owner, isAdmin) {
+			versions = append(versions, version)
+		}
+	}
+	hideReasoning(r, versions)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "获取记录版本成功",
+		"data": map[string]interface{}{
+			"record_id": record.ID,
+			"versions":  versions,
+		},
+		"status": "success",
+	})
+}
+
+// GetConversationTreeHandler 获取记录所在会话的完整树：同一节点下的子节点互为分支（重新生成、编辑或不同的追问），
+// path为从会话第一轮到该记录的记录ID；请求者是会话所有者或管理员时附带会话的标题和摘要
+func (app *App) GetConversationTreeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	record, ok := app.loadRecord(w, r)
+	if !ok {
+		return
+	}
+	owner, isAdmin := requestOwner(r), isAdminRequest(r)
+	if !record.CanView(owner, isAdmin) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "记录不存在"})
+		return
+	}
+
+	records, err := app.qaStorage.GetConversationTree(record.ID)
+	if err != nil {
+		log.Printf("获取会话树失败: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取会话树失败"})
+		return
+	}
+	hideReasoning(r, records)
+
+	// 记录按层级顺序返回，上一轮总在前面；不可查看的记录及其后续分支不返回
+	nodes := make(map[int]*recordTreeNode, len(records))
+	roots := []*recordTreeNode{}
+	for _, rec := range records {
+		if !rec.CanView(owner, isAdmin) {
+			continue
+		}
+		node := &recordTreeNode{QARecord: rec, Children: []*recordTreeNode{}}
+		if rec.ParentID == nil {
+			roots = append(roots, node)
+		} else if parent, ok := nodes[*rec.ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			continue
+		}
+		nodes[rec.ID] = node
+	}
+
+	var path []int
+	for node := nodes[record.ID]; node != nil; {
+		path = append([]int{node.ID}, path...)
+		if node.ParentID == nil {
+			break
+		}
+		node = nodes[*node.ParentID]
+	}
+
+	data := map[string]interface{}{
+		"record_id": record.ID,
+		"path":      path,
+		"roots":     roots,
+	}
+	// 第一条记录为会话第一轮的第一个版本
+	if len(records) > 0 {
+		conversation, err := app.qaStorage.GetConversationByRoot(records[0].ID)
+		if err == nil && (conversation.IsOwnedBy(owner) || isAdmin) {
+			data["conversation"] = conversation
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "获取会话树成功",
+		"data":    data,
+		"status":  "success",
+	})
+}
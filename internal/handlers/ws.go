@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go-base-web-server/internal/generation"
+	"go-base-web-server/internal/llm"
+	"go-base-web-server/internal/storage"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsWriteWait 单条消息的写超时
+	wsWriteWait = 10 * time.Second
+	// wsPongWait 等待客户端pong的最长时间，超时视为连接断开
+	wsPongWait = 60 * time.Second
+	// wsPingInterval 服务端发送ping的间隔（须小于wsPongWait）
+	wsPingInterval = 25 * time.Second
+	// wsMaxMessageBytes 客户端单条消息的最大字节数
+	wsMaxMessageBytes = 1 << 20
+	// wsMaxConcurrent 单个连接上同时进行的生成数上限
+	wsMaxConcurrent = 4
+)
+
+// WebSocketConfig WebSocket聊天通道配置
+type WebSocketConfig struct {
+	// 握手允许的Origin（scheme://host[:port]），为空时只允许与请求Host同源；
+	// 浏览器会自动携带Cookie和?token=，限制来源防止其他站点以用户身份建立连接
+	AllowedOrigins []string
+}
+
+// checkOrigin 校验握手请求的Origin：未携带Origin的非浏览器客户端直接放行，否则须同源或在允许列表中
+func (c WebSocketConfig) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range c.AllowedOrigins {
+		if strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+			return true
+		}
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	log.Printf("拒绝来源为 %s 的WebSocket连接", origin)
+	return false
+}
+
+// wsClientMessage 客户端消息，ask/continue消息可携带AskRequest的全部字段
+//
+//	{"type":"ask","request_id":"a1","prompt":"你好","temperature":0.2}
+//	{"type":"continue","request_id":"a2","record_id":12,"prompt":"继续"}
+//	{"type":"cancel","record_id":13}
+//	{"type":"ping"}
+type wsClientMessage struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"` // 客户端自定义的请求标识，原样带回该请求的所有服务端消息
+	RecordID  int    `json:"record_id,omitempty"`  // continue: 继续的会话记录；cancel: 要取消的记录
+	AskRequest
+}
+
+// wsSession 一个WebSocket连接，写操作由writeLoop串行完成
+type wsSession struct {
+	app              *App
+	conn             *websocket.Conn
+	owner            storage.RecordOwner
+	isAdmin          bool
+	defaultPersonaID *int // 握手时用户的默认角色
+	showReasoning    bool // 握手时用户是否显示思考过程
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	send   chan map[string]interface{}
+
+	slots chan struct{} // 并发生成的名额（容量为wsMaxConcurrent），收到ask时预占，生成结束后释放
+
+	mu     sync.Mutex
+	active map[int]string // 本连接进行中的生成：记录ID -> request_id
+}
+
+// WebSocketHandler WebSocket聊天通道：一个连接上可并发多个生成，
+// 客户端发送ask/continue/cancel/ping消息，服务端推送start/delta/reasoning/tool/end/error/cancelled消息
+func (app *App) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	owner, newAnonToken := ensureRecordOwner(w, r)
+
+	// ensureRecordOwner签发的匿名令牌Cookie随握手响应返回
+	responseHeader := http.Header{}
+	if cookies := w.Header().Values("Set-Cookie"); len(cookies) > 0 {
+		responseHeader["Set-Cookie"] = cookies
+	}
+
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  4096,
+		WriteBufferSize: 4096,
+		CheckOrigin:     app.webSocket.checkOrigin,
+	}
+	conn, err := upgrader.Upgrade(w, r, responseHeader)
+	if err != nil {
+		log.Printf("WebSocket升级失败: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &wsSession{
+		app:              app,
+		conn:             conn,
+		owner:            owner,
+		isAdmin:          isAdminRequest(r),
+		defaultPersonaID: requestDefaultPersona(r),
+		showReasoning:    requestShowReasoning(r),
+		ctx:              ctx,
+		cancel:           cancel,
+		send:             make(chan map[string]interface{}, 64),
+		slots:            make(chan struct{}, wsMaxConcurrent),
+		active:           make(map[int]string),
+	}
+	log.Printf("WebSocket连接建立: %s, UserID: %v", r.RemoteAddr, owner.UserID)
+
+	connected := map[string]interface{}{"type": "connected", "user_id": owner.UserID}
+	if newAnonToken != "" {
+		connected["anonymous_token"] = newAnonToken
+	}
+	session.emit(connected)
+
+	go session.writeLoop()
+	session.readLoop()
+	log.Printf("WebSocket连接关闭: %s", r.RemoteAddr)
+}
+
+// readLoop 读取客户端消息直到连接关闭，关闭后取消随连接运行的生成
+func (s *wsSession) readLoop() {
+	defer s.cancel()
+
+	s.conn.SetReadLimit(wsMaxMessageBytes)
+	s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("读取WebSocket消息失败: %v", err)
+			}
+			return
+		}
+		s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		var msg wsClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.emitError("", "无效的JSON格式")
+			continue
+		}
+
+		switch msg.Type {
+		case "ask", "continue":
+			// 在读循环中预占名额，保证并发上限；准备问题和生成在独立的goroutine中进行，不阻塞后续消息
+			select {
+			case s.slots <- struct{}{}:
+				go s.handleAsk(msg)
+			default:
+				s.emitError(msg.RequestID, "当前连接进行中的生成过多，请稍后再试")
+			}
+		case "cancel":
+			s.handleCancel(msg)
+		case "ping":
+			s.emit(map[string]interface{}{"type": "pong", "request_id": msg.RequestID})
+		default:
+			s.emitError(msg.RequestID, "未知的消息类型: "+msg.Type)
+		}
+	}
+}
+
+// writeLoop 串行写出消息并定期发送ping，连接关闭或写失败时退出
+func (s *wsSession) writeLoop() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer func() {
+		ticker.Stop()
+		s.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg := <-s.send:
+			s.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := s.conn.WriteJSON(msg); err != nil {
+				log.Printf("写入WebSocket消息失败: %v", err)
+				s.cancel()
+				return
+			}
+		case <-ticker.C:
+			s.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := s.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				s.cancel()
+				return
+			}
+		case <-s.ctx.Done():
+			s.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(wsWriteWait))
+			return
+		}
+	}
+}
+
+// emit 发送消息，连接已关闭时丢弃
+func (s *wsSession) emit(msg map[string]interface{}) {
+	select {
+	case s.send <- msg:
+	case <-s.ctx.Done():
+	}
+}
+
+// emitError 发送错误消息
+func (s *wsSession) emitError(requestID, message string) {
+	s.emit(map[string]interface{}{"type": "error", "request_id": requestID, "error": message})
+}
+
+// handleAsk 处理ask/continue消息并转发生成事件，结束后释放预占的名额
+func (s *wsSession) handleAsk(msg wsClientMessage) {
+	defer func() { <-s.slots }()
+
+	if gen := s.startAsk(msg); gen != nil {
+		s.forward(msg.RequestID, gen)
+	}
+}
+
+// startAsk 保存问题并启动生成，失败时发送错误消息并返回nil；continue消息在record_id所在会话中追问并带入历史问答
+func (s *wsSession) startAsk(msg wsClientMessage) *generation.Generation {
+	app := s.app
+	req := msg.AskRequest
+	if msg.Type == "continue" {
+		req.ParentRecordID = &msg.RecordID
+	}
+	if err := validateAskRequest(&req); err != nil {
+		s.emitError(msg.RequestID, err.Error())
+		return nil
+	}
+
+	ask, err := app.prepareAsk(req, s.owner, s.isAdmin, s.defaultPersonaID)
+	if err != nil {
+		s.emitError(msg.RequestID, err.Error())
+		return nil
+	}
+	prompt := ask.Prompt
+
+	var cacheHit *llm.CacheHit
+	var cacheVector []float32
+	if prompt.Cacheable() {
+		cacheHit, cacheVector = app.llmClient.LookupCache(s.ctx, prompt.Question, cacheOwner(s.owner))
+	}
+	if cacheHit == nil && prompt.ResponseFormat == nil && !app.llmClient.SupportsStreaming() {
+		s.emitError(msg.RequestID, "当前LLM Provider不支持流式聊天")
+		return nil
+	}
+
+	recordID, err := app.saveAskQuestion(ask, s.owner)
+	if err != nil {
+		log.Printf("保存问题失败: %v", err)
+		s.emitError(msg.RequestID, "保存问题失败")
+		return nil
+	}
+
+	background := app.generations.BackgroundByDefault()
+	if req.Background != nil {
+		background = *req.Background
+	}
+
+	s.mu.Lock()
+	s.active[recordID] = msg.RequestID
+	s.mu.Unlock()
+
+	s.emit(map[string]interface{}{
+		"type":       "start",
+		"request_id": msg.RequestID,
+		"record_id":  recordID,
+		"parent_id":  ask.ParentID,
+		"question":   prompt.Question,
+		"cached":     cacheHit != nil,
+		"background": background && cacheHit == nil,
+	})
+
+	return app.startGeneration(s.ctx, streamJob{
+		RecordID:      recordID,
+		Prompt:        prompt,
+		Owner:         s.owner,
+		CacheHit:      cacheHit,
+		CacheVector:   cacheVector,
+		Background:    background,
+		Start:         time.Now(),
+		ShowReasoning: s.showReasoning,
+	})
+}
+
+// forward 将生成事件转发到连接，附带request_id、record_id和event_id（与SSE事件ID一致）
+func (s *wsSession) forward(requestID string, gen *generation.Generation) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.active, gen.RecordID)
+		s.mu.Unlock()
+	}()
+
+	after := 0
+	for {
+		events, done, wait := gen.EventsAfter(after)
+		for _, event := range events {
+			// 事件数据由所有订阅者共享，复制后再附加字段
+			msg := make(map[string]interface{}, len(event.Data)+3)
+			for k, v := range event.Data {
+				msg[k] = v
+			}
+			msg["request_id"] = requestID
+			msg["record_id"] = gen.RecordID
+			msg["event_id"] = sseEventID(gen.RecordID, event.ID)
+			s.emit(msg)
+			after = event.ID
+		}
+		if done {
+			return
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-wait:
+		}
+	}
+}
+
+// handleCancel 取消记录进行中的生成（仅所有者或管理员），cancelled消息由forward推送
+func (s *wsSession) handleCancel(msg wsClientMessage) {
+	record, ok := s.ownedRecord(msg.RecordID)
+	if !ok {
+		s.emitError(msg.RequestID, "记录不存在")
+		return
+	}
+	if _, ok := s.app.generations.Cancel(record.ID); !ok {
+		s.emitError(msg.RequestID, "记录未在生成中")
+	}
+}
+
+// ownedRecord 加载当前连接身份拥有的记录（管理员可访问全部记录）
+func (s *wsSession) ownedRecord(id int) (*storage.QARecord, bool) {
+	record, err := s.app.qaStorage.GetRecord(id)
+	if err != nil {
+		return nil, false
+	}
+	if !s.isAdmin && !record.IsOwnedBy(s.owner) {
+		return nil, false
+	}
+	return record, true
+}
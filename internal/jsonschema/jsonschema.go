@@ -0,0 +1,479 @@
+// Package jsonschema JSON Schema常用子集的校验：用于按调用方提供的Schema校验模型的结构化输出。
+// 支持type、enum、const、properties、required、additionalProperties、items、min/maxItems、
+// min/maxLength、pattern、minimum/maximum、exclusiveMinimum/exclusiveMaximum、allOf/anyOf/oneOf/not
+// 以及指向$defs/definitions的本地$ref，其余关键字（如format）忽略。
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxDepth 校验时的最大嵌套深度，防止自引用的$ref无限递归
+const maxDepth = 64
+
+// validTypes Schema中type允许的取值
+var validTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// Schema 已编译的JSON Schema
+type Schema struct {
+	root     map[string]interface{}
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+// ValidationError 校验失败的位置（JSONPath形式，根为$）和原因
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Compile 解析并检查Schema：type取值、pattern正则和$ref须有效
+func Compile(raw []byte) (*Schema, error) {
+	var root interface{}
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return nil, fmt.Errorf("不是合法的JSON: %v", err)
+	}
+	object, ok := root.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Schema须为JSON对象")
+	}
+
+	s := &Schema{root: object, patterns: make(map[string]*regexp.Regexp)}
+	if err := s.check(object, "#"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// check 递归检查子Schema的关键字
+func (s *Schema) check(schema map[string]interface{}, at string) error {
+	if value, ok := schema["type"]; ok {
+		types, ok := typeList(value)
+		if !ok {
+			return fmt.Errorf("%s/type 须为字符串或字符串数组", at)
+		}
+		for _, name := range types {
+			if !validTypes[name] {
+				return fmt.Errorf("%s/type 不支持的类型: %s", at, name)
+			}
+		}
+	}
+
+	if value, ok := schema["pattern"]; ok {
+		pattern, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s/pattern 须为字符串", at)
+		}
+		if _, err := s.pattern(pattern); err != nil {
+			return fmt.Errorf("%s/pattern 无效: %v", at, err)
+		}
+	}
+
+	if value, ok := schema["$ref"]; ok {
+		ref, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s/$ref 须为字符串", at)
+		}
+		if _, err := s.resolve(ref); err != nil {
+			return fmt.Errorf("%s/$ref %v", at, err)
+		}
+	}
+
+	if value, ok := schema["required"]; ok {
+		list, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s/required 须为字符串数组", at)
+		}
+		for _, item := range list {
+			if _, ok := item.(string); !ok {
+				return fmt.Errorf("%s/required 须为字符串数组", at)
+			}
+		}
+	}
+	if value, ok := schema["enum"]; ok {
+		if _, ok := value.([]interface{}); !ok {
+			return fmt.Errorf("%s/enum 须为数组", at)
+		}
+	}
+
+	// 嵌套的子Schema
+	for _, keyword := range []string{"properties", "$defs", "definitions"} {
+		if value, ok := schema[keyword]; ok {
+			children, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s/%s 须为对象", at, keyword)
+			}
+			for name, child := range children {
+				if err := s.checkChild(child, at+"/"+keyword+"/"+name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, keyword := range []string{"items", "not"} {
+		if value, ok := schema[keyword]; ok {
+			if err := s.checkChild(value, at+"/"+keyword); err != nil {
+				return err
+			}
+		}
+	}
+	if value, ok := schema["additionalProperties"]; ok {
+		if _, isBool := value.(bool); !isBool {
+			if err := s.checkChild(value, at+"/additionalProperties"); err != nil {
+				return err
+			}
+		}
+	}
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+		if value, ok := schema[keyword]; ok {
+			list, ok := value.([]interface{})
+			if !ok || len(list) == 0 {
+				return fmt.Errorf("%s/%s 须为非空数组", at, keyword)
+			}
+			for i, child := range list {
+				if err := s.checkChild(child, fmt.Sprintf("%s/%s/%d", at, keyword, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkChild 检查子Schema，须为对象或布尔值
+func (s *Schema) checkChild(value interface{}, at string) error {
+	switch child := value.(type) {
+	case map[string]interface{}:
+		return s.check(child, at)
+	case bool:
+		return nil
+	}
+	return fmt.Errorf("%s 须为Schema对象", at)
+}
+
+// resolve 解析本地$ref（#、#/$defs/name、#/definitions/name等JSON Pointer）
+func (s *Schema) resolve(ref string) (interface{}, error) {
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("只支持本地引用: %s", ref)
+	}
+
+	var current interface{} = s.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("无法解析: %s", ref)
+		}
+		if current, ok = object[token]; !ok {
+			return nil, fmt.Errorf("无法解析: %s", ref)
+		}
+	}
+	return current, nil
+}
+
+// Validate 按Schema校验JSON解码后的值（encoding/json的默认类型），返回第一个不符合之处
+func (s *Schema) Validate(value interface{}) error {
+	return s.validate(s.root, value, "$", 0)
+}
+
+// ValidateJSON 解析JSON文本并校验
+func (s *Schema) ValidateJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return &ValidationError{Path: "$", Message: "不是合法的JSON: " + err.Error()}
+	}
+	return s.Validate(value)
+}
+
+// validate 按子Schema（对象或布尔值）校验path处的值
+func (s *Schema) validate(node interface{}, value interface{}, path string, depth int) error {
+	if depth > maxDepth {
+		return &ValidationError{Path: path, Message: "嵌套过深"}
+	}
+
+	schema, ok := node.(map[string]interface{})
+	if !ok {
+		if allowed, isBool := node.(bool); isBool && !allowed {
+			return &ValidationError{Path: path, Message: "不允许出现"}
+		}
+		return nil
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := s.resolve(ref)
+		if err != nil {
+			return &ValidationError{Path: path, Message: err.Error()}
+		}
+		if err := s.validate(target, value, path, depth+1); err != nil {
+			return err
+		}
+	}
+
+	if types, ok := typeList(schema["type"]); ok && !matchesAnyType(value, types) {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("应为%s，实际为%s", strings.Join(types, "或"), typeOf(value))}
+	}
+	if options, ok := schema["enum"].([]interface{}); ok && !containsValue(options, value) {
+		return &ValidationError{Path: path, Message: "不在enum允许的取值中"}
+	}
+	if expected, ok := schema["const"]; ok && !reflect.DeepEqual(expected, value) {
+		return &ValidationError{Path: path, Message: "不等于const指定的值"}
+	}
+
+	var err error
+	switch v := value.(type) {
+	case string:
+		err = s.validateString(schema, v, path)
+	case float64:
+		err = validateNumber(schema, v, path)
+	case []interface{}:
+		err = s.validateArray(schema, v, path, depth)
+	case map[string]interface{}:
+		err = s.validateObject(schema, v, path, depth)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.validateCombinators(schema, value, path, depth)
+}
+
+// validateString 校验字符串长度（按字符计）和pattern
+func (s *Schema) validateString(schema map[string]interface{}, value, path string) error {
+	length := float64(len([]rune(value)))
+	if min, ok := number(schema["minLength"]); ok && length < min {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("长度不能小于%g", min)}
+	}
+	if max, ok := number(schema["maxLength"]); ok && length > max {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("长度不能超过%g", max)}
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		compiled, err := s.pattern(pattern)
+		if err != nil {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("pattern %s 无效: %v", pattern, err)}
+		}
+		if !compiled.MatchString(value) {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("不匹配pattern %s", pattern)}
+		}
+	}
+	return nil
+}
+
+// pattern 返回编译后的正则；Compile未检查的位置（如$ref指向$defs之外的子Schema）在首次校验时编译
+func (s *Schema) pattern(expr string) (*regexp.Regexp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if compiled, ok := s.patterns[expr]; ok {
+		return compiled, nil
+	}
+	compiled, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	s.patterns[expr] = compiled
+	return compiled, nil
+}
+
+// validateNumber 校验数值范围
+func validateNumber(schema map[string]interface{}, value float64, path string) error {
+	if min, ok := number(schema["minimum"]); ok && value < min {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("不能小于%g", min)}
+	}
+	if max, ok := number(schema["maximum"]); ok && value > max {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("不能大于%g", max)}
+	}
+	if min, ok := number(schema["exclusiveMinimum"]); ok && value <= min {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("须大于%g", min)}
+	}
+	if max, ok := number(schema["exclusiveMaximum"]); ok && value >= max {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("须小于%g", max)}
+	}
+	return nil
+}
+
+// validateArray 校验数组长度和元素
+func (s *Schema) validateArray(schema map[string]interface{}, value []interface{}, path string, depth int) error {
+	if min, ok := number(schema["minItems"]); ok && float64(len(value)) < min {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("元素个数不能少于%g", min)}
+	}
+	if max, ok := number(schema["maxItems"]); ok && float64(len(value)) > max {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("元素个数不能超过%g", max)}
+	}
+	if items, ok := schema["items"]; ok {
+		for i, item := range value {
+			if err := s.validate(items, item, path+"["+strconv.Itoa(i)+"]", depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateObject 校验必填属性、已声明的属性和额外属性
+func (s *Schema) validateObject(schema map[string]interface{}, value map[string]interface{}, path string, depth int) error {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, item := range required {
+			if name, ok := item.(string); ok {
+				if _, exists := value[name]; !exists {
+					return &ValidationError{Path: path, Message: "缺少必填属性 " + name}
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	for _, name := range sortedKeys(value) {
+		child := path + "." + name
+		if property, ok := properties[name]; ok {
+			if err := s.validate(property, value[name], child, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		if additional, ok := schema["additionalProperties"]; ok {
+			if allowed, isBool := additional.(bool); isBool && !allowed {
+				return &ValidationError{Path: child, Message: "不允许的额外属性"}
+			}
+			if err := s.validate(additional, value[name], child, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateCombinators 校验allOf/anyOf/oneOf/not
+func (s *Schema) validateCombinators(schema map[string]interface{}, value interface{}, path string, depth int) error {
+	if list, ok := schema["allOf"].([]interface{}); ok {
+		for _, child := range list {
+			if err := s.validate(child, value, path, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	if list, ok := schema["anyOf"].([]interface{}); ok {
+		var firstErr error
+		matched := false
+		for _, child := range list {
+			err := s.validate(child, value, path, depth+1)
+			if err == nil {
+				matched = true
+				break
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if !matched {
+			return &ValidationError{Path: path, Message: "不符合anyOf中的任何一项（" + firstErr.Error() + "）"}
+		}
+	}
+	if list, ok := schema["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, child := range list {
+			if s.validate(child, value, path, depth+1) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("须恰好符合oneOf中的一项，实际符合%d项", matches)}
+		}
+	}
+	if not, ok := schema["not"]; ok && s.validate(not, value, path, depth+1) == nil {
+		return &ValidationError{Path: path, Message: "不能符合not指定的Schema"}
+	}
+	return nil
+}
+
+// typeList 将type关键字转换为类型名列表
+func typeList(value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, true
+	case []interface{}:
+		types := make([]string, 0, len(v))
+		for _, item := range v {
+			name, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			types = append(types, name)
+		}
+		return types, len(types) > 0
+	}
+	return nil, false
+}
+
+// matchesAnyType 值是否属于types中的任一类型
+func matchesAnyType(value interface{}, types []string) bool {
+	actual := typeOf(value)
+	for _, name := range types {
+		if name == actual || (name == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf 值的JSON Schema类型，整数值为integer
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// containsValue enum中是否包含值
+func containsValue(options []interface{}, value interface{}) bool {
+	for _, option := range options {
+		if reflect.DeepEqual(option, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// number 读取数值关键字
+func number(value interface{}) (float64, bool) {
+	n, ok := value.(float64)
+	return n, ok
+}
+
+// sortedKeys 按字典序返回对象的属性名，使错误信息稳定
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,168 @@
+package jsonschema_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"go-base-web-server/internal/jsonschema"
+)
+
+// TestCompileErrors 无效的Schema在编译时报错
+func TestCompileErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		schema string
+		want   string
+	}{
+		{"非JSON", `{`, "不是合法的JSON"},
+		{"非对象", `[]`, "须为JSON对象"},
+		{"未知类型", `{"type":"map"}`, "#/type 不支持的类型"},
+		{"type非字符串", `{"type":1}`, "#/type 须为字符串或字符串数组"},
+		{"无效pattern", `{"properties":{"a":{"pattern":"("}}}`, "#/properties/a/pattern 无效"},
+		{"外部引用", `{"$ref":"http://example.com/schema"}`, "只支持本地引用"},
+		{"无法解析的引用", `{"$ref":"#/$defs/missing"}`, "无法解析"},
+		{"required非数组", `{"required":"a"}`, "#/required 须为字符串数组"},
+		{"空anyOf", `{"anyOf":[]}`, "#/anyOf 须为非空数组"},
+		{"子Schema非对象", `{"items":1}`, "#/items 须为Schema对象"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := jsonschema.Compile([]byte(tc.schema))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("期望错误包含 %q，实际: %v", tc.want, err)
+			}
+		})
+	}
+}
+
+// TestValidate 按关键字校验值，path为期望的出错位置（为空表示校验通过）
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		schema string
+		value  string
+		path   string
+	}{
+		// type
+		{"字符串", `{"type":"string"}`, `"a"`, ""},
+		{"类型不符", `{"type":"string"}`, `1`, "$"},
+		{"整数属于number", `{"type":"number"}`, `1`, ""},
+		{"小数不属于integer", `{"type":"integer"}`, `1.5`, "$"},
+		{"类型数组", `{"type":["string","null"]}`, `null`, ""},
+		{"类型数组不符", `{"type":["string","null"]}`, `true`, "$"},
+
+		// enum和const
+		{"enum命中", `{"enum":["a","b"]}`, `"b"`, ""},
+		{"enum未命中", `{"enum":["a","b"]}`, `"c"`, "$"},
+		{"const不等", `{"const":{"a":1}}`, `{"a":2}`, "$"},
+
+		// required
+		{"必填属性齐全", `{"type":"object","required":["a"]}`, `{"a":1}`, ""},
+		{"缺少必填属性", `{"type":"object","required":["a","b"]}`, `{"a":1}`, "$"},
+
+		// properties和additionalProperties
+		{"属性类型不符", `{"properties":{"a":{"type":"string"}}}`, `{"a":1}`, "$.a"},
+		{"默认允许额外属性", `{"properties":{"a":{}}}`, `{"b":1}`, ""},
+		{"禁止额外属性", `{"properties":{"a":{}},"additionalProperties":false}`, `{"a":1,"b":2}`, "$.b"},
+		{"额外属性按Schema校验", `{"additionalProperties":{"type":"integer"}}`, `{"a":1,"b":"x"}`, "$.b"},
+
+		// 数组
+		{"元素类型不符", `{"items":{"type":"string"}}`, `["a",1]`, "$[1]"},
+		{"元素过少", `{"minItems":2}`, `[1]`, "$"},
+		{"元素过多", `{"maxItems":1}`, `[1,2]`, "$"},
+
+		// 字符串和数值
+		{"长度按字符计", `{"maxLength":2}`, `"你好"`, ""},
+		{"长度超出", `{"maxLength":2}`, `"你好吗"`, "$"},
+		{"小于minimum", `{"minimum":1}`, `0`, "$"},
+		{"等于exclusiveMaximum", `{"exclusiveMaximum":1}`, `1`, "$"},
+
+		// pattern
+		{"匹配pattern", `{"pattern":"^[a-z]+$"}`, `"abc"`, ""},
+		{"不匹配pattern", `{"pattern":"^[a-z]+$"}`, `"ABC"`, "$"},
+		{"pattern不作用于非字符串", `{"pattern":"^[a-z]+$"}`, `1`, ""},
+		{"子Schema的pattern", `{"properties":{"code":{"pattern":"^\\d{3}$"}}}`, `{"code":"12a"}`, "$.code"},
+		// $ref指向Compile未检查的位置时，pattern在校验时编译
+		{"未检查位置的pattern", `{"$ref":"#/components/code","components":{"code":{"pattern":"^\\d+$"}}}`, `"x1"`, "$"},
+		{"未检查位置的无效pattern", `{"$ref":"#/components/code","components":{"code":{"pattern":"("}}}`, `"x"`, "$"},
+
+		// $ref
+		{"引用$defs", `{"$defs":{"id":{"type":"integer"}},"properties":{"id":{"$ref":"#/$defs/id"}}}`, `{"id":"1"}`, "$.id"},
+		{"引用definitions", `{"definitions":{"id":{"type":"integer"}},"items":{"$ref":"#/definitions/id"}}`, `[1,2]`, ""},
+		{"自引用", `{"type":"object","properties":{"child":{"$ref":"#"}},"additionalProperties":false}`, `{"child":{"child":{"x":1}}}`, "$.child.child.x"},
+		{"转义的引用", `{"$defs":{"a/b":{"type":"string"}},"$ref":"#/$defs/a~1b"}`, `1`, "$"},
+
+		// 组合关键字
+		{"allOf全部满足", `{"allOf":[{"type":"integer"},{"minimum":1}]}`, `2`, ""},
+		{"allOf部分不满足", `{"allOf":[{"type":"integer"},{"minimum":1}]}`, `0`, "$"},
+		{"anyOf满足一项", `{"anyOf":[{"type":"string"},{"type":"integer"}]}`, `1`, ""},
+		{"anyOf都不满足", `{"anyOf":[{"type":"string"},{"type":"integer"}]}`, `true`, "$"},
+		{"oneOf恰好一项", `{"oneOf":[{"type":"integer"},{"type":"string"}]}`, `1`, ""},
+		{"oneOf多项满足", `{"oneOf":[{"type":"integer"},{"type":"number"}]}`, `1`, "$"},
+		{"not满足", `{"not":{"type":"string"}}`, `1`, ""},
+		{"not不满足", `{"not":{"type":"string"}}`, `"a"`, "$"},
+
+		// 布尔子Schema
+		{"false子Schema", `{"properties":{"a":false}}`, `{"a":1}`, "$.a"},
+		{"true子Schema", `{"items":true}`, `[1,"a"]`, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			schema, err := jsonschema.Compile([]byte(tc.schema))
+			if err != nil {
+				t.Fatalf("编译Schema失败: %v", err)
+			}
+			err = schema.ValidateJSON([]byte(tc.value))
+			if tc.path == "" {
+				if err != nil {
+					t.Fatalf("期望校验通过，实际: %v", err)
+				}
+				return
+			}
+			var validationErr *jsonschema.ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("期望ValidationError，实际: %v", err)
+			}
+			if validationErr.Path != tc.path {
+				t.Fatalf("期望出错位置 %s，实际: %v", tc.path, validationErr)
+			}
+		})
+	}
+}
+
+// TestValidateJSONInvalid 非法JSON返回根位置的校验错误
+func TestValidateJSONInvalid(t *testing.T) {
+	schema, err := jsonschema.Compile([]byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var validationErr *jsonschema.ValidationError
+	if err := schema.ValidateJSON([]byte(`{"a":`)); !errors.As(err, &validationErr) || validationErr.Path != "$" {
+		t.Fatalf("期望根位置的ValidationError，实际: %v", err)
+	}
+}
+
+// TestValidateConcurrent 同一Schema可被并发校验（延迟编译的pattern共享缓存）
+func TestValidateConcurrent(t *testing.T) {
+	schema, err := jsonschema.Compile([]byte(`{"$ref":"#/components/code","components":{"code":{"pattern":"^\\d+$"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := schema.Validate("123"); err != nil {
+				t.Error(err)
+			}
+			if err := schema.Validate("abc"); err == nil {
+				t.Error("期望不匹配pattern")
+			}
+		}()
+	}
+	wg.Wait()
+}
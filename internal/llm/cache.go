@@ -0,0 +1,266 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// 缓存作用域
+const (
+	CacheScopeGlobal = "global" // 所有用户共享缓存
+	CacheScopeUser   = "user"   // 按用户隔离缓存
+)
+
+// CacheConfig 语义缓存配置
+type CacheConfig struct {
+	Enabled             bool
+	TTL                 time.Duration
+	SimilarityThreshold float64 // 语义命中所需的最低余弦相似度
+	Scope               string  // global 或 user
+	MaxEntries          int
+}
+
+// CacheHit 缓存命中信息
+type CacheHit struct {
+	Answer     string    `json:"-"`
+	MatchType  string    `json:"match_type"` // exact 或 semantic
+	Similarity float64   `json:"similarity"`
+	Question   string    `json:"cached_question"`
+	CachedAt   time.Time `json:"cached_at"`
+}
+
+// cacheEntry 缓存条目
+type cacheEntry struct {
+	key       string
+	partition string // 作用域+模型+参数，语义匹配仅在同一分区内进行
+	question  string
+	answer    string
+	vector    []float32
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+// responseCache 基于精确匹配和向量相似度的内存应答缓存
+type responseCache struct {
+	config  CacheConfig
+	mu      sync.RWMutex
+	entries map[string]*cacheEntry
+}
+
+// newResponseCache 创建应答缓存
+func newResponseCache(config CacheConfig) *responseCache {
+	if config.TTL <= 0 {
+		config.TTL = 24 * time.Hour
+	}
+	if config.SimilarityThreshold <= 0 || config.SimilarityThreshold > 1 {
+		config.SimilarityThreshold = 0.95
+	}
+	if config.Scope != CacheScopeUser {
+		config.Scope = CacheScopeGlobal
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = 1000
+	}
+
+	return &responseCache{
+		config:  config,
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+// CacheOwner 请求者身份，按用户隔离缓存时用于划分分区
+type CacheOwner struct {
+	UserID  *int
+	AnonKey string // 匿名会话的标识（令牌哈希），没有匿名令牌时为空
+}
+
+// partitionFor 计算缓存分区（作用域+模型+参数）；按用户隔离且请求者没有稳定身份时返回false，不使用缓存
+func (rc *responseCache) partitionFor(model, params string, owner CacheOwner) (string, bool) {
+	scope := CacheScopeGlobal
+	if rc.config.Scope == CacheScopeUser {
+		switch {
+		case owner.UserID != nil:
+			scope = fmt.Sprintf("user:%d", *owner.UserID)
+		case owner.AnonKey != "":
+			scope = "anon:" + owner.AnonKey
+		default:
+			return "", false
+		}
+	}
+	return scope + "|" + model + "|" + params, true
+}
+
+// exactKey 计算精确匹配键
+func exactKey(partition, normalized string) string {
+	sum := sha256.Sum256([]byte(partition + "|" + normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookupExact 按规范化问题精确匹配，不需要生成向量
+func (rc *responseCache) lookupExact(partition, normalized string) *CacheHit {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+
+	entry, ok := rc.entries[exactKey(partition, normalized)]
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		return nil
+	}
+	return &CacheHit{
+		Answer:     entry.answer,
+		MatchType:  "exact",
+		Similarity: 1,
+		Question:   entry.question,
+		CachedAt:   entry.createdAt,
+	}
+}
+
+// lookupSimilar 在同分区内做向量相似度匹配
+func (rc *responseCache) lookupSimilar(partition string, vector []float32) *CacheHit {
+	now := time.Now()
+
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+
+	var best *cacheEntry
+	bestScore := rc.config.SimilarityThreshold
+	for _, entry := range rc.entries {
+		if entry.partition != partition || entry.vector == nil || !now.Before(entry.expiresAt) {
+			continue
+		}
+		if score := cosineSimilarity(vector, entry.vector); score >= bestScore {
+			best, bestScore = entry, score
+		}
+	}
+
+	if best == nil {
+		return nil
+	}
+
+	return &CacheHit{
+		Answer:     best.answer,
+		MatchType:  "semantic",
+		Similarity: bestScore,
+		Question:   best.question,
+		CachedAt:   best.createdAt,
+	}
+}
+
+// store 写入缓存，超出容量时先清理过期条目再淘汰最旧条目
+func (rc *responseCache) store(partition, normalized, question, answer string, vector []float32) {
+	now := time.Now()
+	entry := &cacheEntry{
+		key:       exactKey(partition, normalized),
+		partition: partition,
+		question:  question,
+		answer:    answer,
+		vector:    vector,
+		createdAt: now,
+		expiresAt: now.Add(rc.config.TTL),
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.entries[entry.key] = entry
+	if len(rc.entries) <= rc.config.MaxEntries {
+		return
+	}
+
+	for key, e := range rc.entries {
+		if !now.Before(e.expiresAt) {
+			delete(rc.entries, key)
+		}
+	}
+
+	for len(rc.entries) > rc.config.MaxEntries {
+		var oldest *cacheEntry
+		for _, e := range rc.entries {
+			if oldest == nil || e.createdAt.Before(oldest.createdAt) {
+				oldest = e
+			}
+		}
+		delete(rc.entries, oldest.key)
+	}
+}
+
+// LookupCache 查询应答缓存：先做精确匹配，未命中时才生成向量做语义匹配；
+// 未启用或未命中时hit为nil，vector为本次生成的问题向量，供StoreCache复用
+func (c *Client) LookupCache(ctx context.Context, question string, owner CacheOwner) (hit *CacheHit, vector []float32) {
+	if c.cache == nil {
+		return nil, nil
+	}
+	partition, ok := c.cache.partitionFor(c.getModel(), c.cacheParams(), owner)
+	if !ok {
+		return nil, nil
+	}
+
+	normalized := normalizePrompt(question)
+
+	hit = c.cache.lookupExact(partition, normalized)
+	if hit == nil && c.SupportsEmbedding() {
+		if v, err := c.CreateEmbedding(ctx, normalized); err == nil {
+			vector = v
+			hit = c.cache.lookupSimilar(partition, vector)
+		} else {
+			log.Printf("缓存查询生成向量失败，仅使用精确匹配: %v", err)
+		}
+	}
+
+	if hit != nil {
+		log.Printf("命中应答缓存 (%s, 相似度: %.3f): %s", hit.MatchType, hit.Similarity, question)
+	}
+	return hit, vector
+}
+
+// StoreCache 将成功的应答写入缓存；vector为LookupCache返回的问题向量，为nil时该条目只参与精确匹配
+func (c *Client) StoreCache(question, answer string, vector []float32, owner CacheOwner) {
+	if c.cache == nil || strings.TrimSpace(answer) == "" {
+		return
+	}
+	partition, ok := c.cache.partitionFor(c.getModel(), c.cacheParams(), owner)
+	if !ok {
+		return
+	}
+
+	c.cache.store(partition, normalizePrompt(question), question, answer, vector)
+}
+
+// cacheParams 影响应答内容的生成参数，参与缓存分区
+func (c *Client) cacheParams() string {
+	return c.provider.GetProviderName() + "|" + c.SystemPrompt("")
+}
+
+// normalizePrompt 规范化问题文本：去除首尾空白和结尾标点、折叠空白、转小写
+func normalizePrompt(prompt string) string {
+	prompt = strings.ToLower(strings.Join(strings.Fields(prompt), " "))
+	return strings.TrimRightFunc(prompt, func(r rune) bool {
+		return unicode.IsPunct(r) || unicode.IsSpace(r)
+	})
+}
+
+// cosineSimilarity 计算余弦相似度
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
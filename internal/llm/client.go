@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"go-base-web-server/providers"
 	"log"
+	"sort"
 	"strings"
 )
 
@@ -13,6 +14,9 @@ type Client struct {
 	provider     providers.LLMProvider
 	chatProvider providers.ChatCompletionProvider // 添加流式provider
 	config       Config                           // 添加配置字段
+
+	embeddingProvider providers.EmbeddingProvider // 向量嵌入provider（可选）
+	cache             *responseCache              // 应答缓存（可选）
 }
 
 // Config LLM配置
@@ -21,6 +25,15 @@ type Config struct {
 	APIKey   string
 	APIURL   string
 	Model    string
+
+	SystemPrompt   string   // 默认系统提示词，为空时使用providers.DefaultSystemPrompt
+	AllowedModels  []string // 请求可指定的其他模型
+	EmbeddingModel string   // 向量模型名称
+	UtilityModel   string   // 会话标题、摘要等后台任务使用的低成本模型，为空时使用Model
+
+	StructuredMaxRetries int // 结构化输出校验失败后的最大重试次数，0时使用默认值
+
+	Cache CacheConfig // 应答缓存配置
 }
 
 // NewClient 创建新的LLM客户端，支持多种Provider
@@ -31,10 +44,11 @@ func NewClient(config Config) *Client {
 	}
 
 	providerConfig := providers.ProviderConfig{
-		Name:   providerType,
-		APIKey: config.APIKey,
-		APIURL: config.APIURL,
-		Model:  config.Model,
+		Name:         providerType,
+		APIKey:       config.APIKey,
+		APIURL:       config.APIURL,
+		Model:        config.Model,
+		SystemPrompt: config.SystemPrompt,
 	}
 
 	var provider providers.LLMProvider
@@ -59,22 +73,32 @@ func NewClient(config Config) *Client {
 
 	log.Printf("初始化LLM Provider: %s", provider.GetProviderName())
 
+	client := &Client{
+		provider: provider,
+		config:   config, // 保存配置
+	}
+
 	// 检查是否支持流式聊天
 	if chatProvider, ok := provider.(providers.ChatCompletionProvider); ok {
 		log.Printf("Provider %s 支持流式聊天", provider.GetProviderName())
-		return &Client{
-			provider:     provider,
-			chatProvider: chatProvider,
-			config:       config, // 保存配置
-		}
+		client.chatProvider = chatProvider
+	} else {
+		log.Printf("Provider %s 不支持流式聊天", provider.GetProviderName())
+	}
+
+	// 检查是否支持向量嵌入
+	if embeddingProvider, ok := provider.(providers.EmbeddingProvider); ok {
+		log.Printf("Provider %s 支持向量嵌入 (模型: %s)", provider.GetProviderName(), client.GetEmbeddingModel())
+		client.embeddingProvider = embeddingProvider
 	}
 
-	log.Printf("Provider %s 不支持流式聊天", provider.GetProviderName())
-	return &Client{
-		provider:     provider,
-		chatProvider: nil,
-		config:       config, // 保存配置
+	if config.Cache.Enabled {
+		client.cache = newResponseCache(config.Cache)
+		log.Printf("应答缓存已启用 (作用域: %s, TTL: %v, 相似度阈值: %.2f)",
+			client.cache.config.Scope, client.cache.config.TTL, client.cache.config.SimilarityThreshold)
 	}
+
+	return client
 }
 
 // AskQuestion 向LLM提问
@@ -83,7 +107,7 @@ func (c *Client) AskQuestion(question string) (string, error) {
 		return "", fmt.Errorf("LLM Provider未初始化")
 	}
 
-	log.Printf("使用 %s 处理问题: %s", c.provider.GetProviderName(), question)
+	log.Printf("使用 %s 处理问题 (长度: %d)", c.provider.GetProviderName(), len([]rune(question)))
 
 	answer, err := c.provider.AskQuestion(question)
 	if err != nil {
@@ -95,6 +119,100 @@ func (c *Client) AskQuestion(question string) (string, error) {
 	return answer, nil
 }
 
+// askWithOptions 不支持聊天完成接口的Provider：通过OptionsProvider传递系统提示词和生成参数，否则只发送问题
+func (c *Client) askWithOptions(prompt Prompt) (string, error) {
+	optionsProvider, ok := c.provider.(providers.OptionsProvider)
+	if !ok {
+		return c.AskQuestion(prompt.Question)
+	}
+
+	log.Printf("使用 %s 处理%s (参数: %v, 长度: %d)", c.provider.GetProviderName(), prompt.taskName(), prompt.Params.Names(), len([]rune(prompt.Question)))
+
+	answer, err := optionsProvider.AskQuestionWithOptions(prompt.Question, providers.QuestionOptions{
+		SystemPrompt:   c.promptSystemPrompt(prompt),
+		Params:         prompt.Params,
+		ResponseFormat: c.nativeResponseFormat(prompt),
+		Images:         prompt.images(),
+	})
+	if err != nil {
+		log.Printf("LLM调用失败: %v", err)
+		return "", err
+	}
+	return answer, nil
+}
+
+// Completion 一次问答的生成结果
+type Completion struct {
+	Content      string
+	Reasoning    string           // 推理模型的思考过程（reasoning_content），不计入答案
+	FinishReason string           // stop、length等，Provider未提供时为stop
+	Candidates   []Candidate      // 请求多个候选答案（N>1）时的全部候选，Content等字段为第一个候选
+	Usage        *providers.Usage // token用量，Provider未返回时为空
+}
+
+// Candidate 多个候选答案之一，Index对应choices中的index
+type Candidate struct {
+	Index        int
+	Content      string
+	Reasoning    string
+	FinishReason string
+}
+
+// Complete 向LLM提问并返回答案和结束原因。
+// 支持聊天完成接口的Provider通过ChatCompletion获取finish_reason，其余Provider退化为AskQuestion（仅使用问题文本）
+func (c *Client) Complete(ctx context.Context, prompt Prompt) (*Completion, error) {
+	if c.chatProvider == nil {
+		answer, err := c.askWithOptions(prompt)
+		if err != nil {
+			return nil, err
+		}
+		return &Completion{Content: answer, FinishReason: "stop"}, nil
+	}
+
+	req := c.newChatRequest(prompt, false)
+	log.Printf("使用 %s 处理%s (模型: %s, 长度: %d)", c.provider.GetProviderName(), prompt.taskName(), req.Model, len([]rune(prompt.Question)))
+
+	resp, err := c.chatProvider.ChatCompletion(ctx, req)
+	if err != nil {
+		log.Printf("LLM调用失败: %v", err)
+		return nil, err
+	}
+	if len(resp.Choices) == 0 || resp.Choices[0].Message == nil {
+		return nil, fmt.Errorf("没有返回任何选择")
+	}
+
+	candidates := make([]Candidate, 0, len(resp.Choices))
+	for _, choice := range resp.Choices {
+		if choice.Message == nil {
+			continue
+		}
+		content, ok := choice.Message.Content.(string)
+		if !ok {
+			return nil, fmt.Errorf("响应格式错误")
+		}
+		finishReason := choice.FinishReason
+		if finishReason == "" {
+			finishReason = "stop"
+		}
+		candidates = append(candidates, Candidate{
+			Index:        choice.Index,
+			Content:      content,
+			Reasoning:    choice.Message.ReasoningContent,
+			FinishReason: finishReason,
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Index < candidates[j].Index })
+
+	first := candidates[0]
+	completion := &Completion{Content: first.Content, Reasoning: first.Reasoning, FinishReason: first.FinishReason, Usage: resp.Usage}
+	if len(candidates) > 1 {
+		completion.Candidates = candidates
+	}
+
+	log.Printf("LLM响应成功，答案长度: %d, 结束原因: %s, 候选数: %d", len(first.Content), first.FinishReason, len(candidates))
+	return completion, nil
+}
+
 // CheckConnection 检查API连接
 func (c *Client) CheckConnection() error {
 	if c.provider == nil {
@@ -119,40 +237,266 @@ func (c *Client) GetProviderInfo() map[string]interface{} {
 	}
 }
 
+// Prompt 一次生成的输入：当前问题及同一会话中的历史问答，以及请求级的生成选项
+type Prompt struct {
+	Question string
+	Task     string   // 后台任务类型（TaskTitle等），为空表示用户提问；只用于日志
+	History  []Turn   // 按时间正序
+	Summary  string   // 较早历史的摘要（附加在系统提示词后），History为摘要之后的问答
+	Memories []string // 与问题相关的用户长期记忆（附加在系统提示词后）
+
+	SystemPrompt string       // 为空时使用配置的系统提示词
+	Model        string       // 为空时使用配置的模型，须通过ModelAllowed校验
+	Attachments  []Attachment // 随问题发送的附件
+	Params       providers.GenerationParams
+	Tools        []providers.Tool // 允许模型调用的工具（仅聊天完成接口）
+
+	ResponseFormat *ResponseFormat // 结构化输出要求，为空时输出自由文本
+	N              int             // 候选答案数量，大于1时要求聊天完成接口返回多个候选
+	StreamUsage    bool            // 流式响应结束前返回token用量（stream_options.include_usage）
+}
+
+// 后台任务类型：输入包含用户的问答和记忆，日志中只记录任务类型和长度
+const (
+	TaskTitle   = "title"
+	TaskSummary = "summary"
+	TaskMemory  = "memory"
+)
+
+// taskName 日志中的任务名称
+func (p Prompt) taskName() string {
+	switch p.Task {
+	case TaskTitle:
+		return "标题生成"
+	case TaskSummary:
+		return "会话摘要"
+	case TaskMemory:
+		return "记忆提取"
+	}
+	return "问题"
+}
+
+// Attachment 问题附件：图片URL、上传的图片或文本片段
+type Attachment struct {
+	Type     string // image_url、image 或 text
+	URL      string
+	Text     string
+	Name     string
+	MimeType string // 上传图片的类型
+	Data     []byte // 上传图片的内容
+}
+
+// IsImage 是否为图片附件
+func (a Attachment) IsImage() bool {
+	return a.Type == "image_url" || a.Type == "image"
+}
+
+// HasImages 是否带有图片附件（需要视觉模型）
+func (p Prompt) HasImages() bool {
+	for _, attachment := range p.Attachments {
+		if attachment.IsImage() {
+			return true
+		}
+	}
+	return false
+}
+
+// images 上传的图片，供不支持聊天完成接口的Provider转换为自身格式
+func (p Prompt) images() []providers.Image {
+	var images []providers.Image
+	for _, attachment := range p.Attachments {
+		if attachment.Type == "image" {
+			images = append(images, providers.Image{MimeType: attachment.MimeType, Data: attachment.Data})
+		}
+	}
+	return images
+}
+
+// Cacheable 是否可使用应答缓存：缓存只按问题文本和默认生成选项分区，
+// 带历史、记忆、附件或自定义选项的请求答案依赖上下文，不查询也不写入缓存
+func (p Prompt) Cacheable() bool {
+	return len(p.History) == 0 && p.Summary == "" && len(p.Memories) == 0 && len(p.Attachments) == 0 && p.SystemPrompt == "" && p.Model == "" &&
+		p.Params.IsZero() && len(p.Tools) == 0 && p.ResponseFormat == nil && p.N <= 1
+}
+
+// SystemPrompt 解析实际使用的系统提示词：请求或角色指定 > 配置 > providers.DefaultSystemPrompt
+func (c *Client) SystemPrompt(override string) string {
+	if override != "" {
+		return override
+	}
+	if c.config.SystemPrompt != "" {
+		return c.config.SystemPrompt
+	}
+	return providers.DefaultSystemPrompt
+}
+
+// Turn 一轮历史问答。只包含答案，推理模型的思考过程不作为历史发送给模型
+type Turn struct {
+	Question string
+	Answer   string
+}
+
 // ChatCompletionStream 流式聊天完成
-func (c *Client) ChatCompletionStream(ctx context.Context, question string) (<-chan *providers.ChatCompletionStreamResponse, <-chan error, error) {
+func (c *Client) ChatCompletionStream(ctx context.Context, prompt Prompt) (<-chan *providers.ChatCompletionStreamResponse, <-chan error, error) {
 	if c.chatProvider == nil {
 		return nil, nil, fmt.Errorf("当前Provider不支持流式聊天")
 	}
 
-	// 使用配置中的模型名称，如果为空则使用默认值
-	model := c.config.Model
-	if model == "" {
-		model = "gpt-3.5-turbo" // 默认模型
+	req := c.newChatRequest(prompt, true)
+
+	log.Printf("使用 %s 处理流式问题 (模型: %s, 历史轮数: %d): %s", c.provider.GetProviderName(), req.Model, len(prompt.History), prompt.Question)
+
+	responseChan, errorChan := c.chatProvider.ChatCompletionStream(ctx, req)
+	return responseChan, errorChan, nil
+}
+
+// newChatRequest 构建聊天完成请求（系统提示词+历史问答+用户问题及附件）
+func (c *Client) newChatRequest(prompt Prompt, stream bool) *providers.ChatCompletionRequest {
+	messages := []providers.Message{
+		{
+			Role:    "system",
+			Content: c.promptSystemPrompt(prompt),
+		},
+	}
+	for _, turn := range prompt.History {
+		messages = append(messages,
+			providers.Message{Role: "user", Content: turn.Question},
+			providers.Message{Role: "assistant", Content: turn.Answer},
+		)
+	}
+	messages = append(messages, providers.Message{
+		Role:    "user",
+		Content: userContent(prompt),
+	})
+
+	model := c.getModel()
+	if prompt.Model != "" {
+		model = prompt.Model
 	}
 
 	req := &providers.ChatCompletionRequest{
-		Model: model, // 使用配置中的模型
-		Messages: []providers.Message{
-			{
-				Role:    "system",
-				Content: "你是一个有用的AI助手，请用中文回答问题。",
-			},
-			{
-				Role:    "user",
-				Content: question,
-			},
-		},
-		Stream: true,
+		Model:    model,
+		Messages: messages,
+		Stream:   stream,
+		Tools:    prompt.Tools,
+
+		ResponseFormat: c.nativeResponseFormat(prompt),
+	}
+	prompt.Params.ApplyTo(req)
+	if prompt.N > 1 {
+		n := prompt.N
+		req.N = &n
+	}
+	if stream && prompt.StreamUsage {
+		req.StreamOptions = map[string]interface{}{"include_usage": true}
 	}
+	return req
+}
 
-	log.Printf("使用 %s 处理流式问题 (模型: %s): %s", c.provider.GetProviderName(), model, question)
+// nativeResponseFormat 原生支持时透传给Provider的response_format
+func (c *Client) nativeResponseFormat(prompt Prompt) map[string]interface{} {
+	if prompt.ResponseFormat == nil || !c.NativeResponseFormat() {
+		return nil
+	}
+	return prompt.ResponseFormat.openAIFormat()
+}
 
-	responseChan, errorChan := c.chatProvider.ChatCompletionStream(ctx, req)
-	return responseChan, errorChan, nil
+// userContent 用户消息内容：没有附件时为纯文本，否则为多段内容（问题+附件）
+func userContent(prompt Prompt) interface{} {
+	if len(prompt.Attachments) == 0 {
+		return prompt.Question
+	}
+
+	parts := []providers.ContentPart{{Type: "text", Text: prompt.Question}}
+	for _, attachment := range prompt.Attachments {
+		switch attachment.Type {
+		case "image_url":
+			parts = append(parts, providers.ContentPart{Type: "image_url", ImageURL: &providers.ImageURL{URL: attachment.URL}})
+		case "image":
+			image := providers.Image{MimeType: attachment.MimeType, Data: attachment.Data}
+			parts = append(parts, providers.ContentPart{Type: "image_url", ImageURL: &providers.ImageURL{URL: image.DataURL()}})
+		case "text":
+			text := attachment.Text
+			if attachment.Name != "" {
+				text = fmt.Sprintf("附件 %s:\n%s", attachment.Name, attachment.Text)
+			}
+			parts = append(parts, providers.ContentPart{Type: "text", Text: text})
+		}
+	}
+	return parts
+}
+
+// GetProviderType 获取当前Provider类型标识（如openai、bella、mock）
+func (c *Client) GetProviderType() string {
+	providerType := strings.ToLower(c.config.Provider)
+	if providerType == "" {
+		return "openai"
+	}
+	return providerType
+}
+
+// GetModelName 获取当前使用的模型名称
+func (c *Client) GetModelName() string {
+	return c.getModel()
+}
+
+// ModelAllowed 请求指定的模型是否可用：为空或为配置的模型时始终可用，否则须在AllowedModels中
+func (c *Client) ModelAllowed(model string) bool {
+	if model == "" || model == c.getModel() {
+		return true
+	}
+	for _, allowed := range c.config.AllowedModels {
+		if model == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// getModel 使用配置中的模型名称，如果为空则使用默认值
+func (c *Client) getModel() string {
+	if c.config.Model != "" {
+		return c.config.Model
+	}
+	return "gpt-3.5-turbo" // 默认模型
 }
 
 // SupportsStreaming 检查是否支持流式聊天
 func (c *Client) SupportsStreaming() bool {
 	return c.chatProvider != nil
 }
+
+// SupportsEmbedding 检查是否支持向量嵌入
+func (c *Client) SupportsEmbedding() bool {
+	return c.embeddingProvider != nil
+}
+
+// GetEmbeddingModel 获取向量模型名称
+func (c *Client) GetEmbeddingModel() string {
+	if c.config.EmbeddingModel != "" {
+		return c.config.EmbeddingModel
+	}
+	return "text-embedding-3-small" // 默认向量模型
+}
+
+// CreateEmbedding 生成文本向量
+func (c *Client) CreateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	if c.embeddingProvider == nil {
+		return nil, fmt.Errorf("当前Provider不支持向量嵌入")
+	}
+
+	resp, err := c.embeddingProvider.CreateEmbeddings(ctx, &providers.EmbeddingRequest{
+		Model: c.GetEmbeddingModel(),
+		Input: []string{text},
+	})
+	if err != nil {
+		log.Printf("生成向量失败: %v", err)
+		return nil, err
+	}
+
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("向量响应为空")
+	}
+
+	return resp.Data[0].Embedding, nil
+}
@@ -0,0 +1,101 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go-base-web-server/providers"
+)
+
+const (
+	// titleMaxRunes 会话标题的最大字符数
+	titleMaxRunes = 30
+	// titleMaxTokens 生成标题的最大token数
+	titleMaxTokens = 60
+	// summaryMaxTokens 生成摘要的最大token数
+	summaryMaxTokens = 800
+	// conversationInputMaxRunes 发送给辅助模型的每段问题或答案的最大字符数
+	conversationInputMaxRunes = 2000
+)
+
+// titleSystemPrompt 生成会话标题的系统提示词
+const titleSystemPrompt = `你负责为对话起标题。根据用户的第一个问题和助手的回答，用不超过15个字概括对话主题，
+使用与问题相同的语言，只输出标题本身，不要加引号、标点结尾或任何解释。`
+
+// summarySystemPrompt 生成会话摘要的系统提示词
+const summarySystemPrompt = `你负责压缩对话历史。把已有摘要和新的几轮问答合并为一份新的摘要，供后续对话作为上下文使用：
+保留用户的目标、已给出的关键事实、结论、代码或数据要点以及尚未解决的问题，省略寒暄和重复内容。
+使用与对话相同的语言，以第三人称简洁陈述，不超过300字，只输出摘要本身。`
+
+// GetUtilityModel 获取会话标题、摘要等后台任务使用的模型，未配置时使用主模型
+func (c *Client) GetUtilityModel() string {
+	if c.config.UtilityModel != "" {
+		return c.config.UtilityModel
+	}
+	return c.getModel()
+}
+
+// GenerateTitle 根据会话第一轮的问答生成简短标题
+func (c *Client) GenerateTitle(ctx context.Context, question, answer string) (string, error) {
+	input := fmt.Sprintf("问题：%s\n\n回答：%s", truncateRunes(question, conversationInputMaxRunes), truncateRunes(answer, conversationInputMaxRunes))
+	completion, err := c.completeUtility(ctx, TaskTitle, titleSystemPrompt, input, titleMaxTokens)
+	if err != nil {
+		return "", err
+	}
+
+	// 只取第一行，去掉模型常加的前缀、引号和结尾标点
+	title := strings.TrimSpace(completion.Content)
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = title[:i]
+	}
+	title = strings.TrimPrefix(strings.TrimPrefix(title, "标题："), "标题:")
+	title = strings.Trim(strings.TrimSpace(title), "\"'“”‘’《》「」#*")
+	title = strings.TrimRight(title, "。.！!？?")
+	if title == "" {
+		return "", fmt.Errorf("模型未返回标题")
+	}
+	return truncateRunes(title, titleMaxRunes), nil
+}
+
+// SummarizeConversation 将已有摘要（可为空）和其后的几轮问答合并为新的滚动摘要
+func (c *Client) SummarizeConversation(ctx context.Context, previous string, turns []Turn) (string, error) {
+	var input strings.Builder
+	if previous != "" {
+		input.WriteString("已有摘要：\n" + previous + "\n\n")
+	}
+	input.WriteString("新的问答：\n")
+	for i, turn := range turns {
+		fmt.Fprintf(&input, "\n[第%d轮]\n用户：%s\n助手：%s\n", i+1,
+			truncateRunes(turn.Question, conversationInputMaxRunes), truncateRunes(turn.Answer, conversationInputMaxRunes))
+	}
+
+	completion, err := c.completeUtility(ctx, TaskSummary, summarySystemPrompt, input.String(), summaryMaxTokens)
+	if err != nil {
+		return "", err
+	}
+	summary := strings.TrimSpace(completion.Content)
+	if summary == "" {
+		return "", fmt.Errorf("模型未返回摘要")
+	}
+	return summary, nil
+}
+
+// completeUtility 使用辅助模型完成后台任务（不使用应答缓存）
+func (c *Client) completeUtility(ctx context.Context, task, systemPrompt, input string, maxTokens int) (*Completion, error) {
+	return c.Complete(ctx, Prompt{
+		Question:     input,
+		Task:         task,
+		SystemPrompt: systemPrompt,
+		Model:        c.GetUtilityModel(),
+		Params:       providers.GenerationParams{MaxTokens: &maxTokens},
+	})
+}
+
+// truncateRunes 按字符数截断文本
+func truncateRunes(text string, maxRunes int) string {
+	if runes := []rune(text); len(runes) > maxRunes {
+		return string(runes[:maxRunes]) + "…"
+	}
+	return text
+}
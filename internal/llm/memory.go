@@ -0,0 +1,89 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go-base-web-server/internal/jsonschema"
+	"go-base-web-server/providers"
+)
+
+const (
+	// memoryMaxTokens 提取记忆的最大token数
+	memoryMaxTokens = 400
+	// memoryMaxRunes 单条记忆的最大字符数
+	memoryMaxRunes = 200
+	// memoryKnownLimit 提取时提供给模型用于去重的已有记忆条数
+	memoryKnownLimit = 50
+)
+
+// memorySystemPrompt 提取用户长期记忆的系统提示词
+const memorySystemPrompt = `你负责维护关于用户的长期记忆。阅读用户的问题和助手的回答，找出用户明确透露的、在以后的对话中仍然有用的关于用户本人的稳定事实，
+例如偏好（语言、回答风格、技术栈）、职业或角色、正在进行的项目、长期目标。
+不要记录一次性的问题内容、助手给出的知识、临时状态、推测或敏感信息（密码、证件号、健康状况等），不要重复已有记忆。
+每条记忆用一句第三人称的简短陈述（如"用户是后端工程师，主要使用Go"），使用与用户相同的语言。
+以JSON输出：{"memories": ["..."]}，没有值得记住的内容时输出 {"memories": []}。`
+
+// memorySchema 提取结果的JSON Schema
+const memorySchema = `{
+	"type": "object",
+	"properties": {
+		"memories": {
+			"type": "array",
+			"items": {"type": "string", "minLength": 1, "maxLength": 200},
+			"maxItems": 5
+		}
+	},
+	"required": ["memories"],
+	"additionalProperties": false
+}`
+
+// memoryFormat 提取记忆的结构化输出格式
+var memoryFormat = func() *ResponseFormat {
+	schema, err := jsonschema.Compile([]byte(memorySchema))
+	if err != nil {
+		panic(fmt.Sprintf("记忆提取Schema无效: %v", err))
+	}
+	return &ResponseFormat{Name: "user_memories", Schema: schema, RawSchema: json.RawMessage(memorySchema)}
+}()
+
+// ExtractMemories 使用辅助模型从一轮问答中提取关于用户的新记忆，known为已有记忆（避免重复提取），没有新记忆时返回空切片
+func (c *Client) ExtractMemories(ctx context.Context, question, answer string, known []string) ([]string, error) {
+	var input strings.Builder
+	if len(known) > 0 {
+		if len(known) > memoryKnownLimit {
+			known = known[:memoryKnownLimit]
+		}
+		input.WriteString("已有记忆：\n- " + strings.Join(known, "\n- ") + "\n\n")
+	}
+	fmt.Fprintf(&input, "问题：%s\n\n回答：%s", truncateRunes(question, conversationInputMaxRunes), truncateRunes(answer, conversationInputMaxRunes))
+
+	maxTokens := memoryMaxTokens
+	completion, err := c.CompleteStructured(ctx, Prompt{
+		Question:       input.String(),
+		Task:           TaskMemory,
+		SystemPrompt:   memorySystemPrompt,
+		Model:          c.GetUtilityModel(),
+		Params:         providers.GenerationParams{MaxTokens: &maxTokens},
+		ResponseFormat: memoryFormat,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Memories []string `json:"memories"`
+	}
+	if err := json.Unmarshal(completion.Data, &result); err != nil {
+		return nil, err
+	}
+	memories := make([]string, 0, len(result.Memories))
+	for _, memory := range result.Memories {
+		if memory = strings.TrimSpace(memory); memory != "" {
+			memories = append(memories, truncateRunes(memory, memoryMaxRunes))
+		}
+	}
+	return memories, nil
+}
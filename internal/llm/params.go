@@ -0,0 +1,134 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+
+	"go-base-web-server/providers"
+)
+
+// ParamLimits 模型允许的生成参数范围
+type ParamLimits struct {
+	MinTemperature float64
+	MaxTemperature float64
+	MaxTokens      int
+	Unsupported    []string // 不支持的参数名
+}
+
+// defaultParamLimits 未知模型使用的参数范围
+var defaultParamLimits = ParamLimits{MinTemperature: 0, MaxTemperature: 2, MaxTokens: 32768}
+
+// modelParamLimits 按模型名前缀匹配的参数范围，靠前的优先
+var modelParamLimits = []struct {
+	prefix string
+	limits ParamLimits
+}{
+	{"gpt-3.5", ParamLimits{MinTemperature: 0, MaxTemperature: 2, MaxTokens: 4096}},
+	{"gpt-4o", ParamLimits{MinTemperature: 0, MaxTemperature: 2, MaxTokens: 16384}},
+	{"gpt-4", ParamLimits{MinTemperature: 0, MaxTemperature: 2, MaxTokens: 8192}},
+	// 推理模型只接受默认temperature
+	{"o1", ParamLimits{MinTemperature: 1, MaxTemperature: 1, MaxTokens: 32768, Unsupported: []string{"top_p", "presence_penalty", "frequency_penalty"}}},
+	{"o3", ParamLimits{MinTemperature: 1, MaxTemperature: 1, MaxTokens: 32768, Unsupported: []string{"top_p", "presence_penalty", "frequency_penalty"}}},
+	{"qwen", ParamLimits{MinTemperature: 0, MaxTemperature: 1.99, MaxTokens: 8192}},
+	{"gemini", ParamLimits{MinTemperature: 0, MaxTemperature: 2, MaxTokens: 8192}},
+	{"deepseek", ParamLimits{MinTemperature: 0, MaxTemperature: 2, MaxTokens: 8192}},
+}
+
+// providerParamLimits 模型由Provider接口地址决定的Provider使用固定的参数范围
+var providerParamLimits = map[string]ParamLimits{
+	"baidu":  {MinTemperature: 0.01, MaxTemperature: 1, MaxTokens: 2048, Unsupported: []string{"seed", "presence_penalty", "frequency_penalty"}},
+	"wenxin": {MinTemperature: 0.01, MaxTemperature: 1, MaxTokens: 2048, Unsupported: []string{"seed", "presence_penalty", "frequency_penalty"}},
+}
+
+// providerUnsupportedParams Provider的翻译层无法传递的参数
+var providerUnsupportedParams = map[string][]string{
+	"ali":    {"frequency_penalty"},
+	"qwen":   {"frequency_penalty"},
+	"tongyi": {"frequency_penalty"},
+}
+
+// visionModelPrefixes 支持图片输入的模型名前缀
+var visionModelPrefixes = []string{
+	"gpt-4o", "gpt-4-turbo", "gpt-4-vision", "gpt-4.1", "gpt-5", "o1", "o3", "o4",
+	"gemini", "claude-3", "claude-sonnet", "claude-opus", "qwen-vl", "qwen2-vl", "qwen2.5-vl", "glm-4v",
+}
+
+// visionProviders 翻译层可以传递图片的Provider（baidu、ali只发送文本）
+var visionProviders = map[string]bool{
+	"openai": true,
+	"bella":  true,
+	"gemini": true,
+	"google": true,
+	"mock":   true,
+}
+
+// SupportsVision 当前Provider下指定模型（为空时使用配置的模型）是否支持图片输入
+func (c *Client) SupportsVision(model string) bool {
+	providerType := c.GetProviderType()
+	if !visionProviders[providerType] {
+		return false
+	}
+	if providerType == "mock" {
+		return true
+	}
+
+	if model == "" {
+		model = c.getModel()
+	}
+	lower := strings.ToLower(model)
+	for _, prefix := range visionModelPrefixes {
+		if strings.HasPrefix(lower, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParamLimitsFor 返回当前Provider下指定模型（为空时使用配置的模型）的参数范围
+func (c *Client) ParamLimitsFor(model string) ParamLimits {
+	if model == "" {
+		model = c.getModel()
+	}
+
+	providerType := c.GetProviderType()
+	if limits, ok := providerParamLimits[providerType]; ok {
+		return limits
+	}
+
+	limits := defaultParamLimits
+	lower := strings.ToLower(model)
+	for _, entry := range modelParamLimits {
+		if strings.HasPrefix(lower, entry.prefix) {
+			limits = entry.limits
+			break
+		}
+	}
+	if unsupported := providerUnsupportedParams[providerType]; len(unsupported) > 0 {
+		limits.Unsupported = append(append([]string(nil), limits.Unsupported...), unsupported...)
+	}
+	return limits
+}
+
+// ValidateParams 按模型的参数范围校验生成参数
+func (c *Client) ValidateParams(model string, params providers.GenerationParams) error {
+	if model == "" {
+		model = c.getModel()
+	}
+	limits := c.ParamLimitsFor(model)
+
+	for _, name := range params.Names() {
+		for _, unsupported := range limits.Unsupported {
+			if name == unsupported {
+				return fmt.Errorf("模型 %s 不支持参数 %s", model, name)
+			}
+		}
+	}
+
+	if t := params.Temperature; t != nil && (*t < limits.MinTemperature || *t > limits.MaxTemperature) {
+		return fmt.Errorf("模型 %s 的temperature取值范围为 %g~%g", model, limits.MinTemperature, limits.MaxTemperature)
+	}
+	if m := params.MaxTokens; m != nil && *m > limits.MaxTokens {
+		return fmt.Errorf("模型 %s 的max_tokens不能超过 %d", model, limits.MaxTokens)
+	}
+	return nil
+}
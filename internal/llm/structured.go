@@ -0,0 +1,191 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"go-base-web-server/internal/jsonschema"
+)
+
+// defaultStructuredMaxRetries 未配置时结构化输出校验失败后的最大重试次数
+const defaultStructuredMaxRetries = 2
+
+// nativeSchemaProviders 支持OpenAI response_format（json_schema）的Provider，其余Provider通过系统提示词注入Schema说明
+var nativeSchemaProviders = map[string]bool{
+	"openai": true,
+	"bella":  true,
+}
+
+// ResponseFormat 结构化输出要求：Schema为空时只要求输出合法的JSON
+type ResponseFormat struct {
+	Name       string             // Schema名称，透传给支持json_schema的Provider
+	Schema     *jsonschema.Schema // 已编译的Schema，用于校验输出
+	RawSchema  json.RawMessage    // Schema原文，透传给Provider或写入提示词
+	MaxRetries *int               // 为空时使用配置的重试次数
+}
+
+// openAIFormat 转换为OpenAI兼容API的response_format
+func (f *ResponseFormat) openAIFormat() map[string]interface{} {
+	if f.Schema == nil {
+		return map[string]interface{}{"type": "json_object"}
+	}
+
+	name := f.Name
+	if name == "" {
+		name = "response"
+	}
+	return map[string]interface{}{
+		"type": "json_schema",
+		"json_schema": map[string]interface{}{
+			"name":   name,
+			"schema": f.RawSchema,
+		},
+	}
+}
+
+// instructions 写入系统提示词的输出格式说明
+func (f *ResponseFormat) instructions() string {
+	if f.Schema == nil {
+		return "请只输出一个合法的JSON值，不要包含Markdown代码块或其他说明文字。"
+	}
+	return fmt.Sprintf("请只输出一个符合以下JSON Schema的JSON值，不要包含Markdown代码块或其他说明文字。\nJSON Schema:\n%s", f.RawSchema)
+}
+
+// Parse 从模型输出中提取JSON并按Schema校验
+func (f *ResponseFormat) Parse(output string) (json.RawMessage, error) {
+	text := extractJSON(output)
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return nil, fmt.Errorf("输出不是合法的JSON: %v", err)
+	}
+	if f.Schema != nil {
+		if err := f.Schema.Validate(value); err != nil {
+			return nil, err
+		}
+	}
+	return json.RawMessage(text), nil
+}
+
+// extractJSON 去除模型常加的Markdown代码块和前后说明文字
+func extractJSON(output string) string {
+	text := strings.TrimSpace(output)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```")
+		if newline := strings.IndexByte(text, '\n'); newline >= 0 {
+			text = text[newline+1:] // 跳过```json等语言标记
+		}
+		text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+	}
+	if strings.HasPrefix(text, "{") || strings.HasPrefix(text, "[") {
+		return text
+	}
+
+	// 截取第一个{或[到最后一个}或]之间的内容
+	start := strings.IndexAny(text, "{[")
+	end := strings.LastIndexAny(text, "}]")
+	if start >= 0 && end > start {
+		return text[start : end+1]
+	}
+	return text
+}
+
+// StructuredOutputError 重试用尽后模型输出仍不符合要求
+type StructuredOutputError struct {
+	Output   string // 最后一次的输出
+	Err      error  // 最后一次的校验错误
+	Attempts int
+}
+
+func (e *StructuredOutputError) Error() string {
+	return fmt.Sprintf("模型输出不符合JSON Schema（已尝试%d次）: %v", e.Attempts, e.Err)
+}
+
+// StructuredCompletion 通过校验的结构化输出
+type StructuredCompletion struct {
+	Completion
+	Data     json.RawMessage // 解析后的JSON
+	Attempts int
+}
+
+// NativeResponseFormat 当前Provider是否原生支持response_format
+func (c *Client) NativeResponseFormat() bool {
+	return nativeSchemaProviders[c.GetProviderType()]
+}
+
+// structuredMaxRetries 结构化输出的最大重试次数：请求指定 > 配置 > 默认
+func (c *Client) structuredMaxRetries(format *ResponseFormat) int {
+	switch {
+	case format.MaxRetries != nil:
+		return *format.MaxRetries
+	case c.config.StructuredMaxRetries > 0:
+		return c.config.StructuredMaxRetries
+	}
+	return defaultStructuredMaxRetries
+}
+
+// promptSystemPrompt 生成使用的系统提示词：依次附加用户的长期记忆和较早历史的摘要，不支持原生response_format（或只要求JSON对象）时追加输出格式说明
+func (c *Client) promptSystemPrompt(prompt Prompt) string {
+	systemPrompt := c.SystemPrompt(prompt.SystemPrompt)
+	if len(prompt.Memories) > 0 {
+		systemPrompt += "\n\n关于用户的长期记忆（仅在与问题相关时参考，不要主动提及）：\n- " + strings.Join(prompt.Memories, "\n- ")
+	}
+	if prompt.Summary != "" {
+		systemPrompt += "\n\n以下是本次对话较早内容的摘要：\n" + prompt.Summary
+	}
+	if format := prompt.ResponseFormat; format != nil && (!c.NativeResponseFormat() || format.Schema == nil) {
+		systemPrompt += "\n\n" + format.instructions()
+	}
+	return systemPrompt
+}
+
+// CompleteStructured 生成结构化输出：输出不是合法JSON或不符合Schema时，把上一次的输出和校验错误带入对话重试，
+// 最多重试MaxRetries次；onRetry在每次重试前调用（可为nil）。重试用尽时返回*StructuredOutputError
+func (c *Client) CompleteStructured(ctx context.Context, prompt Prompt, onRetry func(attempt int, err error)) (*StructuredCompletion, error) {
+	format := prompt.ResponseFormat
+	if format == nil {
+		return nil, fmt.Errorf("未指定结构化输出格式")
+	}
+	maxRetries := c.structuredMaxRetries(format)
+
+	current := prompt
+	for attempt := 1; ; attempt++ {
+		completion, err := c.Complete(ctx, current)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := format.Parse(completion.Content)
+		if err == nil {
+			return &StructuredCompletion{Completion: *completion, Data: data, Attempts: attempt}, nil
+		}
+		if attempt > maxRetries {
+			return nil, &StructuredOutputError{Output: completion.Content, Err: err, Attempts: attempt}
+		}
+
+		log.Printf("结构化输出校验失败（第%d次）: %v", attempt, err)
+		if onRetry != nil {
+			onRetry(attempt, err)
+		}
+		current = c.retryPrompt(prompt, current, completion.Content, err)
+	}
+}
+
+// retryPrompt 构造重试的输入：聊天完成接口把上一次的输出作为历史、以校验错误作为新问题；
+// 不支持历史的Provider把原问题、上一次的输出和校验错误合并为一个问题
+func (c *Client) retryPrompt(original, current Prompt, output string, err error) Prompt {
+	correction := fmt.Sprintf("上一次的输出不符合要求：%v\n请修正后重新输出，只输出JSON。", err)
+
+	retry := current
+	if c.chatProvider == nil {
+		retry.Question = fmt.Sprintf("%s\n\n上一次的输出：\n%s\n\n%s", original.Question, output, correction)
+		return retry
+	}
+
+	retry.History = append(append([]Turn(nil), current.History...), Turn{Question: current.Question, Answer: output})
+	retry.Question = correction
+	return retry
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+)
+
+// arenaEntryColumns 竞技场结果查询字段
+const arenaEntryColumns = `id, comparison_id, entry_index, contestant, provider, model, answer, status, error_message, finish_reason,
+	latency_ms, prompt_tokens, completion_tokens, cost, created_at`
+
+// ArenaStorage 模型竞技场数据库操作
+type ArenaStorage struct {
+	db *DB
+}
+
+// NewArenaStorage 创建竞技场存储实例
+func NewArenaStorage(db *DB) *ArenaStorage {
+	return &ArenaStorage{db: db}
+}
+
+// CreateComparison 创建对比并为c.Entries中的每个模型创建待生成的结果，归属于认证用户或匿名会话
+func (as *ArenaStorage) CreateComparison(c ArenaComparison, owner RecordOwner) (*ArenaComparison, error) {
+	anonTokenHash := ""
+	if owner.UserID == nil && owner.AnonToken != "" {
+		anonTokenHash = HashAnonToken(owner.AnonToken)
+	}
+
+	tx, err := as.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	id, err := tx.InsertID(`INSERT INTO arena_comparisons (user_id, anon_token_hash, prompt, system_prompt) VALUES (?, ?, ?, ?)`,
+		owner.UserID, anonTokenHash, c.Prompt, c.SystemPrompt)
+	if err != nil {
+		log.Printf("创建竞技场对比失败: %v", err)
+		return nil, err
+	}
+	for i, entry := range c.Entries {
+		_, err := tx.Exec(`INSERT INTO arena_entries (comparison_id, entry_index, contestant, provider, model, status) VALUES (?, ?, ?, ?, ?, ?)`,
+			id, i, entry.Contestant, entry.Provider, entry.Model, RecordStatusPending)
+		if err != nil {
+			log.Printf("创建竞技场结果失败: %v", err)
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("竞技场对比创建成功，ID: %d, 模型数: %d", id, len(c.Entries))
+	return as.GetComparison(id)
+}
+
+// FinishArenaEntry 保存对比中一个模型的最终结果（按ComparisonID和Index定位）
+func (as *ArenaStorage) FinishArenaEntry(entry ArenaEntry) error {
+	_, err := as.db.Exec(`UPDATE arena_entries SET answer = ?, status = ?, error_message = ?, finish_reason = ?,
+	latency_ms = ?, prompt_tokens = ?, completion_tokens = ?, cost = ? WHERE comparison_id = ? AND entry_index = ?`,
+		entry.Answer, entry.Status, entry.Error, entry.FinishReason, entry.LatencyMs, entry.PromptTokens,
+		entry.CompletionTokens, entry.Cost, entry.ComparisonID, entry.Index)
+	if err != nil {
+		log.Printf("保存竞技场结果失败: %v", err)
+	}
+	return err
+}
+
+// GetComparison 获取对比及其全部结果和投票，不存在时返回sql.ErrNoRows
+func (as *ArenaStorage) GetComparison(id int) (*ArenaComparison, error) {
+	var c ArenaComparison
+	var userID sql.NullInt64
+	err := as.db.QueryRow(`SELECT id, user_id, anon_token_hash, prompt, system_prompt, created_at FROM arena_comparisons WHERE id = ?`, id).Scan(
+		&c.ID, &userID, &c.AnonTokenHash, &c.Prompt, &c.SystemPrompt, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if userID.Valid {
+		id := int(userID.Int64)
+		c.UserID = &id
+	}
+
+	rows, err := as.db.Query(`SELECT `+arenaEntryColumns+` FROM arena_entries WHERE comparison_id = ? ORDER BY entry_index`, id)
+	if err != nil {
+		log.Printf("查询竞技场结果失败: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	c.Entries = []ArenaEntry{}
+	for rows.Next() {
+		var e ArenaEntry
+		if err := rows.Scan(&e.ID, &e.ComparisonID, &e.Index, &e.Contestant, &e.Provider, &e.Model, &e.Answer, &e.Status,
+			&e.Error, &e.FinishReason, &e.LatencyMs, &e.PromptTokens, &e.CompletionTokens, &e.Cost, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		c.Entries = append(c.Entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var vote ArenaVote
+	var voterID sql.NullInt64
+	err = as.db.QueryRow(`SELECT comparison_id, user_id, winner, created_at, updated_at FROM arena_votes WHERE comparison_id = ?`, id).Scan(
+		&vote.ComparisonID, &voterID, &vote.Winner, &vote.CreatedAt, &vote.UpdatedAt)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return nil, err
+	default:
+		if voterID.Valid {
+			id := int(voterID.Int64)
+			vote.UserID = &id
+		}
+		vote.Tie = vote.Winner == ""
+		c.Vote = &vote
+	}
+	return &c, nil
+}
+
+// VoteComparison 为对比投票，winner为获胜模型（空表示平局）；已投票时覆盖之前的结果
+func (as *ArenaStorage) VoteComparison(comparisonID int, userID *int, winner string) error {
+	tx, err := as.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE arena_votes SET user_id = ?, winner = ?, updated_at = CURRENT_TIMESTAMP WHERE comparison_id = ?`,
+		userID, winner, comparisonID)
+	if err != nil {
+		log.Printf("更新竞技场投票失败: %v", err)
+		return err
+	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		if _, err := tx.Exec(`INSERT INTO arena_votes (comparison_id, user_id, winner) VALUES (?, ?, ?)`, comparisonID, userID, winner); err != nil {
+			log.Printf("保存竞技场投票失败: %v", err)
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("竞技场对比 %d 投票成功，获胜模型: %q", comparisonID, winner)
+	return nil
+}
+
+// ListArenaMatches 获取全部已投票对比的参赛模型和获胜者，按投票时间正序（用于回放计算Elo）
+func (as *ArenaStorage) ListArenaMatches() ([]ArenaMatch, error) {
+	rows, err := as.db.Query(`SELECT v.comparison_id, v.winner, e.contestant
+	FROM arena_votes v JOIN arena_entries e ON e.comparison_id = v.comparison_id
+	ORDER BY v.updated_at, v.comparison_id, e.entry_index`)
+	if err != nil {
+		log.Printf("查询竞技场投票失败: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []ArenaMatch{}
+	for rows.Next() {
+		var comparisonID int
+		var winner, contestant string
+		if err := rows.Scan(&comparisonID, &winner, &contestant); err != nil {
+			return nil, err
+		}
+		if n := len(matches); n == 0 || matches[n-1].ComparisonID != comparisonID {
+			matches = append(matches, ArenaMatch{ComparisonID: comparisonID, Winner: winner})
+		}
+		last := &matches[len(matches)-1]
+		last.Contestants = append(last.Contestants, contestant)
+	}
+	return matches, rows.Err()
+}
+
+// ArenaModelStats 按模型统计已完成结果的数量、平均延迟、token用量和费用
+func (as *ArenaStorage) ArenaModelStats() ([]ArenaModelStats, error) {
+	rows, err := as.db.Query(`SELECT contestant, COUNT(*), AVG(latency_ms), SUM(prompt_tokens), SUM(completion_tokens), SUM(cost)
+	FROM arena_entries WHERE status = ? GROUP BY contestant ORDER BY contestant`, RecordStatusCompleted)
+	if err != nil {
+		log.Printf("统计竞技场模型失败: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []ArenaModelStats{}
+	for rows.Next() {
+		var s ArenaModelStats
+		if err := rows.Scan(&s.Contestant, &s.Entries, &s.AvgLatencyMs, &s.PromptTokens, &s.CompletionTokens, &s.Cost); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// ErrCandidateNotFound 记录没有指定序号的候选答案
+var ErrCandidateNotFound = errors.New("候选答案不存在")
+
+// ListCandidates 获取记录的全部候选答案，按序号排序；只有一个答案的记录返回空列表
+func (s *QAStorage) ListCandidates(recordID int) ([]Candidate, error) {
+	var preferred sql.NullInt64
+	if err := s.db.QueryRow(`SELECT preferred_candidate FROM qa_records WHERE id = ?`, recordID).Scan(&preferred); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT record_id, candidate_index, answer, reasoning, finish_reason, created_at
+	FROM record_candidates WHERE record_id = ? ORDER BY candidate_index`, recordID)
+	if err != nil {
+		log.Printf("查询候选答案失败: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates := []Candidate{}
+	for rows.Next() {
+		var c Candidate
+		if err := rows.Scan(&c.RecordID, &c.Index, &c.Answer, &c.Reasoning, &c.FinishReason, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		c.Preferred = preferred.Valid && int(preferred.Int64) == c.Index
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// SetPreferredCandidate 记录用户选择的首选候选，并以该候选作为记录的答案（追问时作为对话历史）。
+// 每次选择都追加一条偏好记录，保留未选中的候选序号；记录或候选不存在时返回ErrCandidateNotFound
+func (s *QAStorage) SetPreferredCandidate(recordID, index int, owner RecordOwner) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var c Candidate
+	err = tx.QueryRow(`SELECT answer, reasoning, finish_reason FROM record_candidates WHERE record_id = ? AND candidate_index = ?`,
+		recordID, index).Scan(&c.Answer, &c.Reasoning, &c.FinishReason)
+	if err == sql.ErrNoRows {
+		return ErrCandidateNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE qa_records SET answer = ?, reasoning = ?, finish_reason = ?, preferred_candidate = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		c.Answer, c.Reasoning, c.FinishReason, index, recordID)
+	if err != nil {
+		log.Printf("设置首选候选失败: %v", err)
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT candidate_index FROM record_candidates WHERE record_id = ? AND candidate_index <> ? ORDER BY candidate_index`, recordID, index)
+	if err != nil {
+		return err
+	}
+	var rejected []string
+	for rows.Next() {
+		var i int
+		if err := rows.Scan(&i); err != nil {
+			rows.Close()
+			return err
+		}
+		rejected = append(rejected, strconv.Itoa(i))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	anonTokenHash := ""
+	if owner.UserID == nil && owner.AnonToken != "" {
+		anonTokenHash = HashAnonToken(owner.AnonToken)
+	}
+	_, err = tx.Exec(`INSERT INTO candidate_preferences (record_id, user_id, anon_token_hash, chosen_index, rejected_indices) VALUES (?, ?, ?, ?, ?)`,
+		recordID, owner.UserID, anonTokenHash, index, strings.Join(rejected, ","))
+	if err != nil {
+		log.Printf("保存候选选择失败: %v", err)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("记录 %d 的首选候选设置为 %d", recordID, index)
+	return nil
+}
+
+// ListCandidatePreferences 按选择时间倒序获取候选选择及记录的问题和生成参数（用于导出），
+// 使用q中的Provider、Model、From/To（按选择时间）和Limit过滤
+func (s *QAStorage) ListCandidatePreferences(q FeedbackQuery) ([]CandidatePreferenceItem, error) {
+	where := []string{}
+	args := []interface{}{}
+	if q.Provider != "" {
+		where = append(where, "r.provider = ?")
+		args = append(args, q.Provider)
+	}
+	if q.Model != "" {
+		where = append(where, "r.model = ?")
+		args = append(args, q.Model)
+	}
+	if q.From != nil {
+		where = append(where, "p.created_at >= ?")
+		args = append(args, s.db.TimeArg(*q.From))
+	}
+	if q.To != nil {
+		where = append(where, "p.created_at < ?")
+		args = append(args, s.db.TimeArg(*q.To))
+	}
+
+	query := `SELECT ` + recordColumns("r") + `, p.id, p.record_id, p.user_id, p.anon_token_hash, p.chosen_index, p.rejected_indices, p.created_at
+	FROM candidate_preferences p JOIN qa_records r ON r.id = p.record_id` + joinWhere(where) + `
+	ORDER BY p.created_at DESC, p.id DESC`
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, q.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		log.Printf("查询候选选择失败: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []CandidatePreferenceItem{}
+	for rows.Next() {
+		var p CandidatePreference
+		var rejected string
+		record, err := scanRecord(rows, &p.ID, &p.RecordID, &p.UserID, &p.AnonTokenHash, &p.Chosen, &rejected, &p.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		p.Rejected = []int{}
+		for _, value := range strings.Split(rejected, ",") {
+			if i, err := strconv.Atoi(value); err == nil {
+				p.Rejected = append(p.Rejected, i)
+			}
+		}
+		items = append(items, CandidatePreferenceItem{
+			CandidatePreference: p,
+			Question:            record.Question,
+			Provider:            record.Provider,
+			Model:               record.Model,
+			PersonaID:           record.PersonaID,
+			GenerationParams:    record.Params,
+		})
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+)
+
+// conversationColumns 会话查询字段，所有者和第一轮的问题来自根记录（c为会话表、r为记录表的别名）
+const conversationColumns = `c.id, c.root_record_id, r.question, c.title, c.summary, c.summary_record_id, r.user_id, r.anon_token_hash, c.created_at, c.updated_at`
+
+// conversationFrom 会话查询的FROM子句
+const conversationFrom = ` FROM conversations c JOIN qa_records r ON r.id = c.root_record_id`
+
+// scanConversation 按conversationColumns的顺序扫描一个会话
+func scanConversation(row interface{ Scan(...interface{}) error }) (*Conversation, error) {
+	var c Conversation
+	if err := row.Scan(&c.ID, &c.RootRecordID, &c.Question, &c.Title, &c.Summary, &c.SummaryRecordID,
+		&c.UserID, &c.AnonTokenHash, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetConversation 根据ID获取会话
+func (s *QAStorage) GetConversation(id int) (*Conversation, error) {
+	return scanConversation(s.db.QueryRow(`SELECT `+conversationColumns+conversationFrom+` WHERE c.id = ?`, id))
+}
+
+// GetConversationByRoot 根据根记录（第一轮的第一个版本）获取会话
+func (s *QAStorage) GetConversationByRoot(rootRecordID int) (*Conversation, error) {
+	return scanConversation(s.db.QueryRow(`SELECT `+conversationColumns+conversationFrom+` WHERE c.root_record_id = ?`, rootRecordID))
+}
+
+// TouchConversation 会话有一轮问答完成：更新updated_at并返回会话，会话不存在时（迁移前的记录）先创建
+func (s *QAStorage) TouchConversation(rootRecordID int) (*Conversation, error) {
+	result, err := s.db.Exec(`UPDATE conversations SET updated_at = CURRENT_TIMESTAMP WHERE root_record_id = ?`, rootRecordID)
+	if err != nil {
+		log.Printf("更新会话失败: %v", err)
+		return nil, err
+	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		if _, err := s.db.Exec(`INSERT INTO conversations (root_record_id) VALUES (?)`, rootRecordID); err != nil {
+			log.Printf("创建会话失败: %v", err)
+			return nil, err
+		}
+	}
+	return s.GetConversationByRoot(rootRecordID)
+}
+
+// ListConversations 按最近活动时间倒序获取用户或匿名会话的会话列表
+func (s *QAStorage) ListConversations(owner RecordOwner, limit, offset int) ([]Conversation, error) {
+	where, ownerArg := "r.user_id IS NULL AND r.anon_token_hash = ?", interface{}(HashAnonToken(owner.AnonToken))
+	if owner.UserID != nil {
+		where, ownerArg = "r.user_id = ?", *owner.UserID
+	}
+
+	rows, err := s.db.Query(`SELECT `+conversationColumns+conversationFrom+` WHERE `+where+`
+	ORDER BY c.updated_at DESC, c.id DESC LIMIT ? OFFSET ?`, ownerArg, limit, offset)
+	if err != nil {
+		log.Printf("查询会话失败: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := []Conversation{}
+	for rows.Next() {
+		c, err := scanConversation(rows)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, *c)
+	}
+	return conversations, rows.Err()
+}
+
+// SetConversationTitle 设置会话标题；overwrite为false时只在标题为空时设置（自动生成的标题不覆盖用户修改的标题）。
+// 会话不存在时返回sql.ErrNoRows
+func (s *QAStorage) SetConversationTitle(id int, title string, overwrite bool) error {
+	query := `UPDATE conversations SET title = ? WHERE id = ?`
+	if !overwrite {
+		query += ` AND title = ''`
+	}
+	result, err := s.db.Exec(query, title, id)
+	if err != nil {
+		log.Printf("更新会话标题失败: %v", err)
+		return err
+	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 && overwrite {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetConversationSummary 保存会话的滚动摘要，throughRecordID为摘要覆盖到的最后一条记录
+func (s *QAStorage) SetConversationSummary(id int, summary string, throughRecordID int) error {
+	if _, err := s.db.Exec(`UPDATE conversations SET summary = ?, summary_record_id = ? WHERE id = ?`, summary, throughRecordID, id); err != nil {
+		log.Printf("保存会话摘要失败: %v", err)
+		return err
+	}
+	return nil
+}
+
+// FindThreadSummary 在一段会话记录中查找摘要覆盖点：返回summary_record_id为其中某条记录的会话，
+// 没有时返回sql.ErrNoRows（摘要属于其他分支或尚未生成）
+func (s *QAStorage) FindThreadSummary(recordIDs []int) (*Conversation, error) {
+	if len(recordIDs) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	args := make([]interface{}, 0, len(recordIDs))
+	for _, id := range recordIDs {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	return scanConversation(s.db.QueryRow(`SELECT `+conversationColumns+conversationFrom+`
+	WHERE c.summary_record_id IN (`+placeholders+`) AND c.summary <> ''`, args...))
+}
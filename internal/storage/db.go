@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// 支持的数据库方言
+const (
+	DialectSQLite   = "sqlite"
+	DialectPostgres = "postgres"
+)
+
+// DB 带方言信息的数据库连接，SQL统一使用?占位符，执行前按方言转换
+type DB struct {
+	*sql.DB
+	dialect string
+}
+
+// Tx 带方言信息的事务
+type Tx struct {
+	*sql.Tx
+	dialect string
+}
+
+// ParseDSN 解析数据库DSN，返回方言和驱动使用的连接串
+// postgres://、postgresql:// 使用PostgreSQL；sqlite://路径、file:或普通文件路径使用SQLite
+func ParseDSN(dsn string) (dialect, driverDSN string, err error) {
+	switch {
+	case dsn == "":
+		return "", "", fmt.Errorf("数据库DSN不能为空")
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		return DialectPostgres, dsn, nil
+	case strings.HasPrefix(dsn, "sqlite://"):
+		return DialectSQLite, strings.TrimPrefix(dsn, "sqlite://"), nil
+	case strings.HasPrefix(dsn, "sqlite:"):
+		return DialectSQLite, strings.TrimPrefix(dsn, "sqlite:"), nil
+	case strings.Contains(dsn, "://"):
+		return "", "", fmt.Errorf("不支持的数据库DSN: %s", dsn)
+	default:
+		return DialectSQLite, dsn, nil
+	}
+}
+
+// RedactDSN 隐藏DSN中的密码，用于日志输出（SQLite路径原样返回）
+func RedactDSN(dsn string) string {
+	dialect, _, err := ParseDSN(dsn)
+	if err != nil || dialect != DialectPostgres {
+		return dsn
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "postgres://***"
+	}
+	if query := u.Query(); query.Has("password") {
+		query.Set("password", "xxxxx")
+		u.RawQuery = query.Encode()
+	}
+	return u.Redacted()
+}
+
+// OpenDB 按DSN打开数据库连接
+func OpenDB(dsn string) (*DB, error) {
+	dialect, driverDSN, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	driver := "sqlite3"
+	if dialect == DialectPostgres {
+		driver = "postgres"
+	}
+
+	db, err := sql.Open(driver, driverDSN)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{DB: db, dialect: dialect}, nil
+}
+
+// Dialect 返回数据库方言
+func (db *DB) Dialect() string {
+	return db.dialect
+}
+
+// Exec 执行SQL（自动转换占位符）
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(rebind(db.dialect, query), args...)
+}
+
+// Query 查询多行（自动转换占位符）
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(rebind(db.dialect, query), args...)
+}
+
+// QueryRow 查询单行（自动转换占位符）
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(rebind(db.dialect, query), args...)
+}
+
+// Begin 开启事务
+func (db *DB) Begin() (*Tx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, dialect: db.dialect}, nil
+}
+
+// InsertID 执行INSERT并返回新记录ID（PostgreSQL不支持LastInsertId，改用RETURNING）
+func (db *DB) InsertID(query string, args ...interface{}) (int, error) {
+	if db.dialect == DialectPostgres {
+		var id int
+		err := db.QueryRow(query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// TimeArg 将时间转换为查询参数：SQLite按CURRENT_TIMESTAMP的文本格式比较，PostgreSQL直接使用时间类型
+func (db *DB) TimeArg(t time.Time) interface{} {
+	if db.dialect == DialectPostgres {
+		return t.UTC()
+	}
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+// LikeOperator 不区分大小写的模糊匹配操作符（SQLite的LIKE默认不区分ASCII大小写）
+func (db *DB) LikeOperator() string {
+	if db.dialect == DialectPostgres {
+		return "ILIKE"
+	}
+	return "LIKE"
+}
+
+// Exec 执行SQL（自动转换占位符）
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(rebind(tx.dialect, query), args...)
+}
+
+// InsertID 在事务中执行INSERT并返回新记录ID
+func (tx *Tx) InsertID(query string, args ...interface{}) (int, error) {
+	if tx.dialect == DialectPostgres {
+		var id int
+		err := tx.QueryRow(query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// QueryRow 查询单行（自动转换占位符）
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(rebind(tx.dialect, query), args...)
+}
+
+// rebind 将?占位符转换为PostgreSQL的$n格式，跳过字符串字面量中的问号
+func rebind(dialect, query string) string {
+	if dialect != DialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	inString := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			inString = !inString
+			b.WriteByte(c)
+		case c == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
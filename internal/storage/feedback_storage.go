@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+)
+
+// feedbackColumns 评价查询字段
+const feedbackColumns = `f.id, f.record_id, f.user_id, f.anon_token_hash, f.rating, f.categories, f.comment, f.created_at, f.updated_at`
+
+// feedbackDest 按feedbackColumns的顺序返回扫描目标，categories为逗号分隔的原始值
+func feedbackDest(f *RecordFeedback, categories *string) []interface{} {
+	return []interface{}{&f.ID, &f.RecordID, &f.UserID, &f.AnonTokenHash, &f.Rating, categories, &f.Comment, &f.CreatedAt, &f.UpdatedAt}
+}
+
+// splitCategories 解析逗号分隔的问题类型
+func splitCategories(value string) []string {
+	categories := []string{}
+	for _, category := range strings.Split(value, ",") {
+		if category != "" {
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
+
+// feedbackOwnerWhere 按评价者（认证用户或匿名会话）定位评价的条件
+func feedbackOwnerWhere(owner RecordOwner) (string, interface{}) {
+	if owner.UserID != nil {
+		return "f.user_id = ?", *owner.UserID
+	}
+	return "f.user_id IS NULL AND f.anon_token_hash = ?", HashAnonToken(owner.AnonToken)
+}
+
+// SaveFeedback 保存评价者对记录的评价，已评价过时覆盖之前的评价
+func (s *QAStorage) SaveFeedback(f RecordFeedback, owner RecordOwner) (*RecordFeedback, error) {
+	anonTokenHash := ""
+	if owner.UserID == nil && owner.AnonToken != "" {
+		anonTokenHash = HashAnonToken(owner.AnonToken)
+	}
+	categories := strings.Join(f.Categories, ",")
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ownerWhere, ownerArg := feedbackOwnerWhere(owner)
+	var id int
+	err = tx.QueryRow(`SELECT f.id FROM record_feedback f WHERE f.record_id = ? AND `+ownerWhere, f.RecordID, ownerArg).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		id, err = tx.InsertID(`INSERT INTO record_feedback (record_id, user_id, anon_token_hash, rating, categories, comment) VALUES (?, ?, ?, ?, ?, ?)`,
+			f.RecordID, owner.UserID, anonTokenHash, f.Rating, categories, f.Comment)
+	case err == nil:
+		_, err = tx.Exec(`UPDATE record_feedback SET rating = ?, categories = ?, comment = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+			f.Rating, categories, f.Comment, id)
+	}
+	if err != nil {
+		log.Printf("保存评价失败: %v", err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("评价保存成功，记录ID: %d, 评价: %s", f.RecordID, f.Rating)
+	return s.getFeedback(`f.id = ?`, id)
+}
+
+// GetFeedback 获取评价者对记录的评价，未评价时返回sql.ErrNoRows
+func (s *QAStorage) GetFeedback(recordID int, owner RecordOwner) (*RecordFeedback, error) {
+	if owner.UserID == nil && owner.AnonToken == "" {
+		return nil, sql.ErrNoRows
+	}
+	ownerWhere, ownerArg := feedbackOwnerWhere(owner)
+	return s.getFeedback(`f.record_id = ? AND `+ownerWhere, recordID, ownerArg)
+}
+
+// getFeedback 按条件获取一条评价
+func (s *QAStorage) getFeedback(where string, args ...interface{}) (*RecordFeedback, error) {
+	var f RecordFeedback
+	var categories string
+	if err := s.db.QueryRow(`SELECT `+feedbackColumns+` FROM record_feedback f WHERE `+where, args...).Scan(feedbackDest(&f, &categories)...); err != nil {
+		return nil, err
+	}
+	f.Categories = splitCategories(categories)
+	return &f, nil
+}
+
+// FeedbackCounts 统计记录的好评和差评数量
+func (s *QAStorage) FeedbackCounts(recordID int) (FeedbackCounts, error) {
+	var counts FeedbackCounts
+	err := s.db.QueryRow(`SELECT COALESCE(SUM(CASE WHEN rating = ? THEN 1 ELSE 0 END), 0), COALESCE(SUM(CASE WHEN rating = ? THEN 1 ELSE 0 END), 0)
+	FROM record_feedback WHERE record_id = ?`, FeedbackUp, FeedbackDown, recordID).Scan(&counts.Up, &counts.Down)
+	return counts, err
+}
+
+// feedbackWhere 构造评价过滤条件（f为评价表、r为记录表的别名）
+func (s *QAStorage) feedbackWhere(q FeedbackQuery) (string, []interface{}) {
+	where := []string{}
+	args := []interface{}{}
+	if q.Rating != "" {
+		where = append(where, "f.rating = ?")
+		args = append(args, q.Rating)
+	}
+	if q.Category != "" {
+		where = append(where, "(',' || f.categories || ',') LIKE ?")
+		args = append(args, "%,"+q.Category+",%")
+	}
+	if q.Provider != "" {
+		where = append(where, "r.provider = ?")
+		args = append(args, q.Provider)
+	}
+	if q.Model != "" {
+		where = append(where, "r.model = ?")
+		args = append(args, q.Model)
+	}
+	if q.From != nil {
+		where = append(where, "f.updated_at >= ?")
+		args = append(args, s.db.TimeArg(*q.From))
+	}
+	if q.To != nil {
+		where = append(where, "f.updated_at < ?")
+		args = append(args, s.db.TimeArg(*q.To))
+	}
+	return joinWhere(where), args
+}
+
+// FeedbackStats 汇总评价：总数、好评差评数、各问题类型数量，以及按Provider和模型的差评率
+func (s *QAStorage) FeedbackStats(q FeedbackQuery) (*FeedbackStats, error) {
+	where, args := s.feedbackWhere(q)
+	rows, err := s.db.Query(`SELECT r.provider, r.model, f.rating, f.categories, COUNT(*)
+	FROM record_feedback f JOIN qa_records r ON r.id = f.record_id`+where+`
+	GROUP BY r.provider, r.model, f.rating, f.categories ORDER BY r.provider, r.model`, args...)
+	if err != nil {
+		log.Printf("统计评价失败: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := &FeedbackStats{Categories: make(map[string]int), Models: []FeedbackModelStats{}}
+	for _, category := range FeedbackCategories {
+		stats.Categories[category] = 0
+	}
+	for rows.Next() {
+		var provider, model, rating, categories sql.NullString
+		var count int
+		if err := rows.Scan(&provider, &model, &rating, &categories, &count); err != nil {
+			return nil, err
+		}
+
+		n := len(stats.Models)
+		if n == 0 || stats.Models[n-1].Provider != provider.String || stats.Models[n-1].Model != model.String {
+			stats.Models = append(stats.Models, FeedbackModelStats{Provider: provider.String, Model: model.String})
+		}
+		modelStats := &stats.Models[len(stats.Models)-1]
+
+		stats.Total += count
+		switch rating.String {
+		case FeedbackUp:
+			stats.Up += count
+			modelStats.Up += count
+		case FeedbackDown:
+			stats.Down += count
+			modelStats.Down += count
+		}
+		for _, category := range splitCategories(categories.String) {
+			stats.Categories[category] += count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range stats.Models {
+		if total := stats.Models[i].Up + stats.Models[i].Down; total > 0 {
+			stats.Models[i].DownRate = float64(stats.Models[i].Down) / float64(total)
+		}
+	}
+	return stats, nil
+}
+
+// ListFeedback 按评价时间倒序获取评价及被评价记录的问题和答案（用于导出）
+func (s *QAStorage) ListFeedback(q FeedbackQuery) ([]FeedbackItem, error) {
+	where, args := s.feedbackWhere(q)
+	query := `SELECT ` + recordColumns("r") + `, ` + feedbackColumns + `
+	FROM record_feedback f JOIN qa_records r ON r.id = f.record_id` + where + `
+	ORDER BY f.updated_at DESC, f.id DESC`
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, q.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		log.Printf("查询评价失败: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []FeedbackItem{}
+	for rows.Next() {
+		var feedback RecordFeedback
+		var categories string
+		record, err := scanRecord(rows, feedbackDest(&feedback, &categories)...)
+		if err != nil {
+			return nil, err
+		}
+		feedback.Categories = splitCategories(categories)
+		items = append(items, FeedbackItem{
+			RecordFeedback:   feedback,
+			Question:         record.Question,
+			Answer:           record.Answer,
+			Provider:         record.Provider,
+			Model:            record.Model,
+			PersonaID:        record.PersonaID,
+			GenerationParams: record.Params,
+		})
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ErrMemoryLimit 用户的记忆数量已达上限
+var ErrMemoryLimit = errors.New("记忆数量已达上限")
+
+// memoryColumns 用户记忆查询字段
+const memoryColumns = `id, user_id, content, source_record_id, embedding_model, embedding, created_at, updated_at`
+
+// MemoryStorage 用户长期记忆数据库操作
+type MemoryStorage struct {
+	db *DB
+}
+
+// NewMemoryStorage 创建用户记忆存储实例
+func NewMemoryStorage(db *DB) *MemoryStorage {
+	return &MemoryStorage{db: db}
+}
+
+// scanMemory 按memoryColumns的顺序扫描一条记忆
+func scanMemory(row interface{ Scan(...interface{}) error }) (*UserMemory, error) {
+	var m UserMemory
+	var blob []byte
+	if err := row.Scan(&m.ID, &m.UserID, &m.Content, &m.SourceRecordID, &m.EmbeddingModel, &blob, &m.CreatedAt, &m.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if len(blob) > 0 {
+		m.Embedding = decodeVector(blob)
+	}
+	return &m, nil
+}
+
+// CreateMemory 保存一条用户记忆，m.Embedding为空时不保存向量；用户已有limit条记忆时返回ErrMemoryLimit。
+// 计数和写入在同一事务中进行，并先锁定用户行，并发写入同一用户的记忆时不会超出上限
+func (ms *MemoryStorage) CreateMemory(m UserMemory, limit int) (*UserMemory, error) {
+	var blob []byte
+	if len(m.Embedding) > 0 {
+		blob = encodeVector(m.Embedding)
+	}
+
+	tx, err := ms.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// 空更新取得用户行的写锁（SQLite为数据库写锁），同一用户的写入在此排队
+	if _, err := tx.Exec(`UPDATE users SET updated_at = updated_at WHERE id = ?`, m.UserID); err != nil {
+		return nil, err
+	}
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM user_memories WHERE user_id = ?`, m.UserID).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count >= limit {
+		return nil, ErrMemoryLimit
+	}
+
+	id, err := tx.InsertID(`INSERT INTO user_memories (user_id, content, source_record_id, embedding_model, embedding) VALUES (?, ?, ?, ?, ?)`,
+		m.UserID, m.Content, m.SourceRecordID, m.EmbeddingModel, blob)
+	if err != nil {
+		log.Printf("保存用户记忆失败: %v", err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ms.GetMemory(id)
+}
+
+// UpdateMemory 修改记忆内容并替换向量（vector为空时清除旧向量），记忆不存在时返回sql.ErrNoRows
+func (ms *MemoryStorage) UpdateMemory(id int, content, model string, vector []float32) (*UserMemory, error) {
+	var blob []byte
+	if len(vector) > 0 {
+		blob = encodeVector(vector)
+	} else {
+		model = ""
+	}
+	result, err := ms.db.Exec(`UPDATE user_memories SET content = ?, embedding_model = ?, embedding = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		content, model, blob, id)
+	if err != nil {
+		log.Printf("更新用户记忆失败: %v", err)
+		return nil, err
+	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return ms.GetMemory(id)
+}
+
+// DeleteMemory 删除一条记忆，不存在时返回sql.ErrNoRows
+func (ms *MemoryStorage) DeleteMemory(id int) error {
+	result, err := ms.db.Exec(`DELETE FROM user_memories WHERE id = ?`, id)
+	if err != nil {
+		log.Printf("删除用户记忆失败: %v", err)
+		return err
+	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteUserMemories 删除用户的全部记忆，返回删除的条数
+func (ms *MemoryStorage) DeleteUserMemories(userID int) (int, error) {
+	result, err := ms.db.Exec(`DELETE FROM user_memories WHERE user_id = ?`, userID)
+	if err != nil {
+		log.Printf("清空用户记忆失败: %v", err)
+		return 0, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return int(rowsAffected), err
+}
+
+// GetMemory 根据ID获取记忆，不存在时返回sql.ErrNoRows
+func (ms *MemoryStorage) GetMemory(id int) (*UserMemory, error) {
+	return scanMemory(ms.db.QueryRow(`SELECT `+memoryColumns+` FROM user_memories WHERE id = ?`, id))
+}
+
+// ListMemories 按最近更新时间倒序获取用户的全部记忆
+func (ms *MemoryStorage) ListMemories(userID int) ([]UserMemory, error) {
+	rows, err := ms.db.Query(`SELECT `+memoryColumns+` FROM user_memories WHERE user_id = ? ORDER BY updated_at DESC, id DESC`, userID)
+	if err != nil {
+		log.Printf("查询用户记忆失败: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	memories := []UserMemory{}
+	for rows.Next() {
+		m, err := scanMemory(rows)
+		if err != nil {
+			return nil, err
+		}
+		memories = append(memories, *m)
+	}
+	return memories, rows.Err()
+}
+
+// RelevantMemories 获取与问题最相关的至多limit条记忆。记忆不超过limit条时全部返回（不生成问题向量）；
+// 否则按相关度排序：问题向量和记忆向量都可用（同一模型）时使用余弦相似度，否则使用字符二元组重合度，
+// 相关度相同时较新的记忆在前。embed为nil或失败时只按字符重合度排序
+func (ms *MemoryStorage) RelevantMemories(userID int, queryText, model string, limit int, embed func(text string) ([]float32, error)) ([]UserMemory, error) {
+	memories, err := ms.ListMemories(userID)
+	if err != nil || len(memories) <= limit {
+		return memories, err
+	}
+
+	var queryVector []float32
+	if embed != nil {
+		if queryVector, err = embed(queryText); err != nil {
+			log.Printf("生成记忆检索向量失败，使用字符匹配: %v", err)
+			queryVector = nil
+		}
+	}
+
+	queryBigrams := textBigrams(queryText)
+	scores := make([]float64, len(memories))
+	for i, m := range memories {
+		if queryVector != nil && m.EmbeddingModel == model && len(m.Embedding) == len(queryVector) {
+			scores[i] = cosineSimilarity(queryVector, m.Embedding)
+		} else {
+			scores[i] = bigramOverlap(queryBigrams, textBigrams(m.Content))
+		}
+	}
+
+	// memories已按更新时间倒序，稳定排序保证相关度相同时较新的在前
+	order := make([]int, len(memories))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+
+	relevant := make([]UserMemory, 0, limit)
+	for _, i := range order[:limit] {
+		relevant = append(relevant, memories[i])
+	}
+	return relevant, nil
+}
+
+// textBigrams 文本中相邻两个字母或数字组成的字符二元组（忽略大小写，中文按字切分），只有一个字符时为该字符本身
+func textBigrams(text string) map[string]bool {
+	bigrams := map[string]bool{}
+	var word []rune
+	flush := func() {
+		if len(word) == 1 {
+			bigrams[string(word)] = true
+		}
+		for i := 0; i+1 < len(word); i++ {
+			bigrams[string(word[i:i+2])] = true
+		}
+		word = word[:0]
+	}
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			word = append(word, r)
+		} else {
+			flush()
+		}
+	}
+	flush()
+	return bigrams
+}
+
+// bigramOverlap 记忆的字符二元组在问题中出现的比例
+func bigramOverlap(query, memory map[string]bool) float64 {
+	if len(memory) == 0 {
+		return 0
+	}
+	shared := 0
+	for bigram := range memory {
+		if query[bigram] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(memory))
+}
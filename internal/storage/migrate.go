@@ -0,0 +1,308 @@
+package storage
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// 迁移文件名格式：0001_name.up.sql / 0001_name.down.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration 一个版本化的数据库迁移
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus 迁移的应用状态
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// Migrator 负责应用和回滚数据库迁移
+type Migrator struct {
+	db         *DB
+	migrations []Migration
+}
+
+// NewMigrator 创建迁移器并加载对应方言的内嵌迁移文件（migrations/<dialect>/）
+func NewMigrator(db *DB) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles, path.Join("migrations", db.Dialect()))
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// loadMigrations 读取并校验迁移文件，按版本号升序返回
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		matches := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("无效的迁移文件名: %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(matches[1])
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		} else if m.Name != matches[2] {
+			return nil, fmt.Errorf("迁移版本 %d 存在多个名称: %s, %s", version, m.Name, matches[2])
+		}
+
+		if matches[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("迁移 %04d_%s 缺少up或down文件", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// ensureVersionTable 创建迁移版本记录表
+func (m *Migrator) ensureVersionTable() error {
+	timeType := "DATETIME"
+	if m.db.Dialect() == DialectPostgres {
+		timeType = "TIMESTAMPTZ"
+	}
+
+	_, err := m.db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at ` + timeType + ` DEFAULT CURRENT_TIMESTAMP
+	);`)
+	if err != nil {
+		log.Printf("创建迁移版本表失败: %v", err)
+	}
+	return err
+}
+
+// appliedVersions 查询已应用的迁移版本
+func (m *Migrator) appliedVersions() (map[int]time.Time, error) {
+	rows, err := m.db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// Up 按顺序应用所有未执行的迁移，返回本次应用的数量
+func (m *Migrator) Up() (int, error) {
+	if err := m.ensureVersionTable(); err != nil {
+		return 0, err
+	}
+
+	applied, err := m.appliedVersions()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(applied) == 0 && m.db.Dialect() == DialectSQLite {
+		if err := m.adoptLegacySchema(); err != nil {
+			return 0, err
+		}
+	}
+
+	count := 0
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		err := m.inTx(func(tx *Tx) error {
+			if _, err := tx.Exec(migration.Up); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, migration.Version, migration.Name)
+			return err
+		})
+		if err != nil {
+			log.Printf("应用迁移 %04d_%s 失败: %v", migration.Version, migration.Name, err)
+			return count, fmt.Errorf("应用迁移 %04d_%s 失败: %w", migration.Version, migration.Name, err)
+		}
+
+		log.Printf("已应用迁移 %04d_%s", migration.Version, migration.Name)
+		count++
+	}
+
+	return count, nil
+}
+
+// Down 按倒序回滚最近应用的steps个迁移，返回实际回滚的数量
+func (m *Migrator) Down(steps int) (int, error) {
+	if err := m.ensureVersionTable(); err != nil {
+		return 0, err
+	}
+
+	applied, err := m.appliedVersions()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		err := m.inTx(func(tx *Tx) error {
+			if _, err := tx.Exec(migration.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, migration.Version)
+			return err
+		})
+		if err != nil {
+			log.Printf("回滚迁移 %04d_%s 失败: %v", migration.Version, migration.Name, err)
+			return count, fmt.Errorf("回滚迁移 %04d_%s 失败: %w", migration.Version, migration.Name, err)
+		}
+
+		log.Printf("已回滚迁移 %04d_%s", migration.Version, migration.Name)
+		count++
+	}
+
+	return count, nil
+}
+
+// Status 返回所有迁移及其应用状态
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	if err := m.ensureVersionTable(); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// inTx 在事务中执行，出错时回滚
+func (m *Migrator) inTx(fn func(tx *Tx) error) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// legacyColumns 引入迁移之前通过ALTER TABLE逐步补充的字段
+var legacyColumns = []struct {
+	table, column, definition string
+}{
+	{"qa_records", "user_id", "INTEGER REFERENCES users(id)"},
+	{"qa_records", "provider", "TEXT DEFAULT ''"},
+	{"qa_records", "model", "TEXT DEFAULT ''"},
+	{"qa_records", "visibility", "TEXT DEFAULT 'private'"},
+	{"qa_records", "anon_token_hash", "TEXT DEFAULT ''"},
+	{"users", "is_admin", "BOOLEAN DEFAULT 0"},
+}
+
+// adoptLegacySchema 接管引入迁移之前创建的SQLite数据库：补齐缺失字段，
+// 使初始迁移中的CREATE ... IF NOT EXISTS和索引可以直接执行
+func (m *Migrator) adoptLegacySchema() error {
+	return m.inTx(func(tx *Tx) error {
+		for _, col := range legacyColumns {
+			exists, err := tableExists(tx, col.table)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				continue
+			}
+
+			hasColumn, err := columnExists(tx, col.table, col.column)
+			if err != nil {
+				return err
+			}
+			if hasColumn {
+				continue
+			}
+
+			if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", col.table, col.column, col.definition)); err != nil {
+				log.Printf("补充字段 %s.%s 失败: %v", col.table, col.column, err)
+				return err
+			}
+			log.Printf("已为旧数据库补充字段 %s.%s", col.table, col.column)
+		}
+		return nil
+	})
+}
+
+// tableExists 检查表是否存在
+func tableExists(tx *Tx, table string) (bool, error) {
+	var count int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&count)
+	return count > 0, err
+}
+
+// columnExists 检查表中是否存在指定字段
+func columnExists(tx *Tx, table, column string) (bool, error) {
+	var count int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+	return count > 0, err
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS record_shares;
+DROP TABLE IF EXISTS qa_embeddings;
+DROP TABLE IF EXISTS qa_records;
+DROP TABLE IF EXISTS users;
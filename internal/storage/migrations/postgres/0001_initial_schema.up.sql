@@ -0,0 +1,54 @@
+-- 初始数据库结构（PostgreSQL）
+
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	username TEXT UNIQUE NOT NULL,
+	email TEXT UNIQUE NOT NULL,
+	password_hash TEXT NOT NULL,
+	api_key TEXT UNIQUE,
+	is_active BOOLEAN DEFAULT TRUE,
+	is_admin BOOLEAN DEFAULT FALSE,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS qa_records (
+	id SERIAL PRIMARY KEY,
+	question TEXT NOT NULL,
+	answer TEXT DEFAULT '',
+	user_id INTEGER REFERENCES users(id),
+	provider TEXT DEFAULT '',
+	model TEXT DEFAULT '',
+	visibility TEXT DEFAULT 'private',
+	anon_token_hash TEXT DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_qa_records_created_at ON qa_records(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_qa_records_updated_at ON qa_records(updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_qa_records_user_created ON qa_records(user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_qa_records_provider_model ON qa_records(provider, model, created_at);
+CREATE INDEX IF NOT EXISTS idx_qa_records_anon_token ON qa_records(anon_token_hash, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_qa_records_visibility ON qa_records(visibility, created_at, id);
+
+CREATE TABLE IF NOT EXISTS qa_embeddings (
+	record_id INTEGER PRIMARY KEY REFERENCES qa_records(id) ON DELETE CASCADE,
+	model TEXT NOT NULL,
+	dimension INTEGER NOT NULL,
+	vector BYTEA NOT NULL,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS record_shares (
+	id SERIAL PRIMARY KEY,
+	slug TEXT UNIQUE NOT NULL,
+	record_id INTEGER NOT NULL REFERENCES qa_records(id) ON DELETE CASCADE,
+	user_id INTEGER,
+	expires_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ,
+	view_count INTEGER DEFAULT 0,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_record_shares_record ON record_shares(record_id);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_qa_records_status;
+
+-- 恢复旧格式：失败记录的错误提示写回answer
+UPDATE qa_records SET answer = '抱歉，AI服务暂时不可用' WHERE status = 'failed' AND answer = '';
+
+ALTER TABLE qa_records DROP COLUMN latency_ms;
+ALTER TABLE qa_records DROP COLUMN finish_reason;
+ALTER TABLE qa_records DROP COLUMN error_message;
+ALTER TABLE qa_records DROP COLUMN status;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_qa_records_parent_id;
+
+ALTER TABLE qa_records DROP COLUMN parent_id;
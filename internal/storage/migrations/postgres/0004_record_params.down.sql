@@ -0,0 +1 @@
+ALTER TABLE qa_records DROP COLUMN generation_params;
@@ -0,0 +1,4 @@
+ALTER TABLE qa_records DROP COLUMN persona_id;
+ALTER TABLE users DROP COLUMN default_persona_id;
+
+DROP TABLE IF EXISTS personas;
@@ -0,0 +1,17 @@
+-- 角色：管理员定义的系统提示词、默认模型、生成参数和允许调用的工具
+
+CREATE TABLE IF NOT EXISTS personas (
+	id SERIAL PRIMARY KEY,
+	name TEXT UNIQUE NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	system_prompt TEXT NOT NULL DEFAULT '',
+	model TEXT NOT NULL DEFAULT '',
+	generation_params TEXT NOT NULL DEFAULT '',
+	tools TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 用户的默认角色，以及会话使用的角色（记录在每轮问答上，追问时沿用）
+ALTER TABLE users ADD COLUMN default_persona_id INTEGER REFERENCES personas(id);
+ALTER TABLE qa_records ADD COLUMN persona_id INTEGER REFERENCES personas(id);
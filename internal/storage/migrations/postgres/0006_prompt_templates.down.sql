@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS prompt_template_shares;
+DROP TABLE IF EXISTS prompt_template_versions;
+DROP TABLE IF EXISTS prompt_templates;
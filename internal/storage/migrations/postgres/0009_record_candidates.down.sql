@@ -0,0 +1,4 @@
+ALTER TABLE qa_records DROP COLUMN preferred_candidate;
+ALTER TABLE qa_records DROP COLUMN candidate_count;
+
+DROP TABLE IF EXISTS record_candidates;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS arena_votes;
+DROP TABLE IF EXISTS arena_entries;
+DROP TABLE IF EXISTS arena_comparisons;
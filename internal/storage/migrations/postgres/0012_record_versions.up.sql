@@ -0,0 +1,6 @@
+-- 记录版本：重新生成或编辑问题时创建新记录，与原记录共享parent_id（成为会话树中的兄弟分支）。
+-- version_of为同一轮第一个版本的ID（第一个版本本身为空），version从1开始递增
+ALTER TABLE qa_records ADD COLUMN version_of INTEGER REFERENCES qa_records(id);
+ALTER TABLE qa_records ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+CREATE INDEX IF NOT EXISTS idx_qa_records_version_of ON qa_records(version_of);
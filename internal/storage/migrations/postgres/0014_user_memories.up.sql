@@ -0,0 +1,15 @@
+-- 用户长期记忆：每轮问答完成后由模型从问答中提取的关于用户的稳定事实（偏好、角色、项目等），
+-- 用户可查看、修改和删除。embedding为内容的向量（embedding_model生成），用于提问时检索相关记忆
+
+CREATE TABLE IF NOT EXISTS user_memories (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	content TEXT NOT NULL,
+	source_record_id INTEGER REFERENCES qa_records(id) ON DELETE SET NULL,
+	embedding_model TEXT NOT NULL DEFAULT '',
+	embedding BYTEA,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_memories_user_id ON user_memories(user_id, updated_at);
@@ -0,0 +1,2 @@
+-- 加载会话历史时沿parent_id遍历到摘要覆盖点为止，每一轮都按summary_record_id查找会话
+CREATE INDEX IF NOT EXISTS idx_conversations_summary_record ON conversations(summary_record_id);
@@ -0,0 +1,14 @@
+-- 问答记录生命周期：状态、错误原因、结束原因和耗时
+
+ALTER TABLE qa_records ADD COLUMN status TEXT NOT NULL DEFAULT 'pending';
+ALTER TABLE qa_records ADD COLUMN error_message TEXT DEFAULT '';
+ALTER TABLE qa_records ADD COLUMN finish_reason TEXT DEFAULT '';
+ALTER TABLE qa_records ADD COLUMN latency_ms INTEGER DEFAULT 0;
+
+-- 回填历史记录：写入answer的错误提示转为failed，空答案视为生成中断
+UPDATE qa_records SET status = 'failed', error_message = answer, answer = ''
+WHERE answer IN ('抱歉，AI服务暂时不可用', '抱歉，AI服务出现错误');
+UPDATE qa_records SET status = 'completed' WHERE status = 'pending' AND answer != '';
+UPDATE qa_records SET status = 'cancelled', error_message = '生成中断' WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_qa_records_status ON qa_records(status, created_at, id);
@@ -0,0 +1,5 @@
+-- 问答记录的上一轮记录，用于在同一会话中继续提问
+
+ALTER TABLE qa_records ADD COLUMN parent_id INTEGER REFERENCES qa_records(id);
+
+CREATE INDEX IF NOT EXISTS idx_qa_records_parent_id ON qa_records(parent_id);
@@ -0,0 +1,3 @@
+-- 生成记录时使用的请求级生成参数（JSON），用于复现生成结果
+
+ALTER TABLE qa_records ADD COLUMN generation_params TEXT NOT NULL DEFAULT '';
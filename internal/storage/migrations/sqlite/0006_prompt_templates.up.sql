@@ -0,0 +1,33 @@
+-- 提示词模板：模板本身只保存名称和当前版本，每次修改内容生成新版本
+
+CREATE TABLE IF NOT EXISTS prompt_templates (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	name TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	current_version INTEGER NOT NULL DEFAULT 1,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_prompt_templates_user ON prompt_templates(user_id, updated_at);
+
+CREATE TABLE IF NOT EXISTS prompt_template_versions (
+	template_id INTEGER NOT NULL REFERENCES prompt_templates(id) ON DELETE CASCADE,
+	version INTEGER NOT NULL,
+	body TEXT NOT NULL,
+	system_prompt TEXT NOT NULL DEFAULT '',
+	variables TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (template_id, version)
+);
+
+-- 模板共享：被共享的用户可以查看和运行模板
+CREATE TABLE IF NOT EXISTS prompt_template_shares (
+	template_id INTEGER NOT NULL REFERENCES prompt_templates(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (template_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_prompt_template_shares_user ON prompt_template_shares(user_id);
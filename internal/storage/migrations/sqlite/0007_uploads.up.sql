@@ -0,0 +1,15 @@
+-- 上传的图片：文件保存在本地磁盘（UPLOAD_DIR），表中保存元数据和归属（认证用户或匿名会话）
+
+CREATE TABLE IF NOT EXISTS uploads (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER REFERENCES users(id),
+	anon_token_hash TEXT NOT NULL DEFAULT '',
+	filename TEXT NOT NULL DEFAULT '',
+	mime_type TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	storage_name TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_uploads_user ON uploads(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_uploads_anon_token ON uploads(anon_token_hash, created_at);
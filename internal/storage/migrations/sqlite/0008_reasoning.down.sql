@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN show_reasoning;
+ALTER TABLE qa_records DROP COLUMN reasoning;
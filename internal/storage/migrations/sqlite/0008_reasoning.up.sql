@@ -0,0 +1,5 @@
+-- 推理模型的思考过程单独保存，不计入答案，也不作为对话历史发送给模型
+ALTER TABLE qa_records ADD COLUMN reasoning TEXT NOT NULL DEFAULT '';
+
+-- 用户是否显示思考过程
+ALTER TABLE users ADD COLUMN show_reasoning BOOLEAN NOT NULL DEFAULT 1;
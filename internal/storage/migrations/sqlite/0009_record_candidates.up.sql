@@ -0,0 +1,15 @@
+-- 一次提问生成的多个候选答案（n>1），记录的answer为首选候选（默认第一个）
+
+CREATE TABLE IF NOT EXISTS record_candidates (
+	record_id INTEGER NOT NULL REFERENCES qa_records(id) ON DELETE CASCADE,
+	candidate_index INTEGER NOT NULL,
+	answer TEXT NOT NULL DEFAULT '',
+	reasoning TEXT NOT NULL DEFAULT '',
+	finish_reason TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (record_id, candidate_index)
+);
+
+-- 候选答案数量（只有一个答案时为0），以及用户选择的首选候选
+ALTER TABLE qa_records ADD COLUMN candidate_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE qa_records ADD COLUMN preferred_candidate INTEGER;
@@ -0,0 +1,43 @@
+-- 模型竞技场：同一问题并发发送给多个模型的对比、每个模型的结果和用户投票
+
+CREATE TABLE IF NOT EXISTS arena_comparisons (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER REFERENCES users(id),
+	anon_token_hash TEXT NOT NULL DEFAULT '',
+	prompt TEXT NOT NULL,
+	system_prompt TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_arena_comparisons_user_id ON arena_comparisons(user_id);
+
+-- contestant为 provider/model；status沿用问答记录的状态值
+CREATE TABLE IF NOT EXISTS arena_entries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	comparison_id INTEGER NOT NULL REFERENCES arena_comparisons(id) ON DELETE CASCADE,
+	entry_index INTEGER NOT NULL,
+	contestant TEXT NOT NULL,
+	provider TEXT NOT NULL,
+	model TEXT NOT NULL,
+	answer TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL DEFAULT 'pending',
+	error_message TEXT NOT NULL DEFAULT '',
+	finish_reason TEXT NOT NULL DEFAULT '',
+	latency_ms INTEGER NOT NULL DEFAULT 0,
+	prompt_tokens INTEGER NOT NULL DEFAULT 0,
+	completion_tokens INTEGER NOT NULL DEFAULT 0,
+	cost REAL NOT NULL DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (comparison_id, entry_index)
+);
+
+CREATE INDEX IF NOT EXISTS idx_arena_entries_contestant ON arena_entries(contestant);
+
+-- 每个对比一票，重新投票时覆盖；winner为空表示平局
+CREATE TABLE IF NOT EXISTS arena_votes (
+	comparison_id INTEGER PRIMARY KEY REFERENCES arena_comparisons(id) ON DELETE CASCADE,
+	user_id INTEGER REFERENCES users(id),
+	winner TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
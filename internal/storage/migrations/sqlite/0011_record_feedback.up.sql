@@ -0,0 +1,17 @@
+-- 用户对答案的评价：rating为up/down，categories为逗号分隔的问题类型（incorrect、harmful、unhelpful）。
+-- 每个用户（或匿名会话）对一条记录只保留一条评价，重复提交时覆盖
+
+CREATE TABLE IF NOT EXISTS record_feedback (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	record_id INTEGER NOT NULL REFERENCES qa_records(id) ON DELETE CASCADE,
+	user_id INTEGER REFERENCES users(id),
+	anon_token_hash TEXT NOT NULL DEFAULT '',
+	rating TEXT NOT NULL,
+	categories TEXT NOT NULL DEFAULT '',
+	comment TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_record_feedback_record_id ON record_feedback(record_id);
+CREATE INDEX IF NOT EXISTS idx_record_feedback_rating ON record_feedback(rating, created_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_qa_records_version_of;
+ALTER TABLE qa_records DROP COLUMN version;
+ALTER TABLE qa_records DROP COLUMN version_of;
@@ -0,0 +1,18 @@
+-- 会话：以第一轮的第一个版本为根记录，保存自动生成（或用户修改）的标题和较早历史的滚动摘要。
+-- summary_record_id为摘要覆盖到的最后一条记录，追问时只发送其后的问答，之前的历史以摘要代替
+
+CREATE TABLE IF NOT EXISTS conversations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	root_record_id INTEGER NOT NULL UNIQUE REFERENCES qa_records(id) ON DELETE CASCADE,
+	title TEXT NOT NULL DEFAULT '',
+	summary TEXT NOT NULL DEFAULT '',
+	summary_record_id INTEGER REFERENCES qa_records(id) ON DELETE SET NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversations_updated_at ON conversations(updated_at);
+
+-- 为已有会话创建记录（标题在下一轮完成后生成）
+INSERT INTO conversations (root_record_id, created_at, updated_at)
+SELECT id, created_at, COALESCE(updated_at, created_at) FROM qa_records WHERE parent_id IS NULL AND version_of IS NULL;
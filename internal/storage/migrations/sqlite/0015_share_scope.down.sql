@@ -0,0 +1 @@
+ALTER TABLE record_shares DROP COLUMN scope;
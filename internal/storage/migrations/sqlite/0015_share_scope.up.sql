@@ -0,0 +1,2 @@
+-- 分享范围：record只分享一条记录，conversation分享从会话第一轮到该记录的整个分支
+ALTER TABLE record_shares ADD COLUMN scope TEXT NOT NULL DEFAULT 'record';
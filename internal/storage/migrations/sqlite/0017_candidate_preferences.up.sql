@@ -0,0 +1,14 @@
+-- 用户在多个候选答案中的选择：每次选择追加一行，保留当时未选中的候选序号（逗号分隔），用于分析提示词效果
+
+CREATE TABLE IF NOT EXISTS candidate_preferences (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	record_id INTEGER NOT NULL REFERENCES qa_records(id) ON DELETE CASCADE,
+	user_id INTEGER REFERENCES users(id),
+	anon_token_hash TEXT NOT NULL DEFAULT '',
+	chosen_index INTEGER NOT NULL,
+	rejected_indices TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_candidate_preferences_record_id ON candidate_preferences(record_id);
+CREATE INDEX IF NOT EXISTS idx_candidate_preferences_created_at ON candidate_preferences(created_at);
@@ -1,27 +1,441 @@
 package storage
 
 import (
+	"encoding/json"
 	"time"
 )
 
 // QARecord 问答记录结构体
 type QARecord struct {
-	ID        int       `json:"id"`
-	Question  string    `json:"question"`
-	Answer    string    `json:"answer"`
-	UserID    *int      `json:"user_id,omitempty"` // 添加用户ID字段，使用指针以支持null值
+	ID            int             `json:"id"`
+	Question      string          `json:"question"`
+	Answer        string          `json:"answer"`
+	Reasoning     string          `json:"reasoning,omitempty"` // 推理模型的思考过程，不计入答案
+	UserID        *int            `json:"user_id,omitempty"`   // 添加用户ID字段，使用指针以支持null值
+	Provider      string          `json:"provider,omitempty"`  // 生成答案的Provider
+	Model         string          `json:"model,omitempty"`     // 生成答案的模型
+	Visibility    string          `json:"visibility"`          // 可见性: private/shared/public
+	AnonTokenHash string          `json:"-"`                   // 匿名会话令牌哈希（匿名记录归属）
+	Status        string          `json:"status"`              // 生命周期状态: pending/streaming/completed/failed/cancelled
+	Error         string          `json:"error,omitempty"`     // 失败或取消原因
+	FinishReason  string          `json:"finish_reason,omitempty"`
+	LatencyMs     int64           `json:"latency_ms"`           // 从提问到生成结束的耗时（毫秒）
+	ParentID      *int            `json:"parent_id,omitempty"`  // 同一会话中的上一轮记录
+	PersonaID     *int            `json:"persona_id,omitempty"` // 会话使用的角色
+	Params        json.RawMessage `json:"params,omitempty"`     // 请求级生成参数（JSON）
+	// 多个候选答案（n>1）时的候选数量和用户选择的首选候选，answer为首选候选的内容
+	CandidateCount     int  `json:"candidate_count,omitempty"`
+	PreferredCandidate *int `json:"preferred_candidate,omitempty"`
+	// 重新生成或编辑产生的版本：VersionOf为同一轮第一个版本的ID，Version从1开始
+	VersionOf *int      `json:"version_of,omitempty"`
+	Version   int       `json:"version"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// NewQuestion 新问题记录的字段
+type NewQuestion struct {
+	Question  string
+	Owner     RecordOwner
+	Provider  string
+	Model     string
+	ParentID  *int            // 同一会话中的上一轮记录，为空时开始新会话
+	PersonaID *int            // 使用的角色
+	Params    json.RawMessage // 请求级生成参数（JSON），为空表示使用默认参数
+	VersionOf *int            // 作为该轮第一个版本的新版本保存（重新生成或编辑），与其共享ParentID
+}
+
+// 记录生命周期状态
+const (
+	RecordStatusPending   = "pending"   // 已保存问题，等待生成
+	RecordStatusStreaming = "streaming" // 正在流式生成
+	RecordStatusCompleted = "completed" // 生成完成
+	RecordStatusFailed    = "failed"    // 生成失败
+	RecordStatusCancelled = "cancelled" // 生成被取消（如客户端断开），answer保存已生成的部分
+)
+
+// ValidRecordStatus 检查记录状态取值是否合法
+func ValidRecordStatus(status string) bool {
+	switch status {
+	case RecordStatusPending, RecordStatusStreaming, RecordStatusCompleted, RecordStatusFailed, RecordStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// IsTerminalStatus 判断是否为终止状态（生成已结束）
+func IsTerminalStatus(status string) bool {
+	return status == RecordStatusCompleted || status == RecordStatusFailed || status == RecordStatusCancelled
+}
+
+// RecordResult 一次生成的最终结果
+type RecordResult struct {
+	Status       string // completed | failed | cancelled
+	Answer       string // 完整答案，取消时为已生成的部分答案
+	Reasoning    string // 推理模型的思考过程
+	Error        string
+	FinishReason string
+	Latency      time.Duration
+	Candidates   []Candidate // 多个候选答案（n>1）时的全部候选，Answer等字段为第一个候选
+}
+
+// Candidate 一次提问生成的候选答案之一
+type Candidate struct {
+	RecordID     int       `json:"record_id"`
+	Index        int       `json:"index"`
+	Answer       string    `json:"answer"`
+	Reasoning    string    `json:"reasoning,omitempty"`
+	FinishReason string    `json:"finish_reason,omitempty"`
+	Preferred    bool      `json:"preferred"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// CandidatePreference 用户在多个候选答案中的一次选择，Rejected为当时未选中的候选序号
+type CandidatePreference struct {
+	ID            int       `json:"id"`
+	RecordID      int       `json:"record_id"`
+	UserID        *int      `json:"user_id,omitempty"`
+	AnonTokenHash string    `json:"-"`
+	Chosen        int       `json:"chosen_index"`
+	Rejected      []int     `json:"rejected_indices"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// CandidatePreferenceItem 导出的候选选择，附带记录的问题和生成参数
+type CandidatePreferenceItem struct {
+	CandidatePreference
+	Question         string          `json:"question"`
+	Provider         string          `json:"provider"`
+	Model            string          `json:"model"`
+	PersonaID        *int            `json:"persona_id,omitempty"`
+	GenerationParams json.RawMessage `json:"generation_params,omitempty"`
+}
+
+// 记录可见性
+const (
+	VisibilityPrivate = "private" // 仅所有者和管理员可见
+	VisibilityShared  = "shared"  // 知道记录ID的任何人可查看，但不出现在公开列表中
+	VisibilityPublic  = "public"  // 任何人可查看，并出现在公开列表中
+)
+
+// ValidVisibility 检查可见性取值是否合法
+func ValidVisibility(visibility string) bool {
+	switch visibility {
+	case VisibilityPrivate, VisibilityShared, VisibilityPublic:
+		return true
+	}
+	return false
+}
+
+// RecordOwner 记录归属：认证用户或匿名会话
+type RecordOwner struct {
+	UserID    *int
+	AnonToken string // 匿名会话令牌（明文，仅在存储时哈希）
+}
+
+// IsOwnedBy 判断记录是否属于指定的用户或匿名会话
+func (r *QARecord) IsOwnedBy(owner RecordOwner) bool {
+	if owner.UserID != nil {
+		return r.UserID != nil && *r.UserID == *owner.UserID
+	}
+	return r.UserID == nil && owner.AnonToken != "" && r.AnonTokenHash == HashAnonToken(owner.AnonToken)
+}
+
+// CanView 判断访问者是否可以查看记录
+func (r *QARecord) CanView(owner RecordOwner, isAdmin bool) bool {
+	if isAdmin || r.Visibility == VisibilityShared || r.Visibility == VisibilityPublic {
+		return true
+	}
+	return r.IsOwnedBy(owner)
+}
+
+// 分享范围
+const (
+	ShareScopeRecord       = "record"       // 只分享一条记录
+	ShareScopeConversation = "conversation" // 分享从会话第一轮到该记录的整个分支
+)
+
+// RecordShare 问答记录的公开分享链接
+type RecordShare struct {
+	ID        int        `json:"id"`
+	Slug      string     `json:"slug"`
+	RecordID  int        `json:"record_id"`
+	Scope     string     `json:"scope"`
+	UserID    *int       `json:"user_id,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	ViewCount int        `json:"view_count"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Active 分享链接是否仍然有效（未撤销且未过期）
+func (s *RecordShare) Active(now time.Time) bool {
+	if s.RevokedAt != nil {
+		return false
+	}
+	return s.ExpiresAt == nil || now.Before(*s.ExpiresAt)
+}
+
 // User 用户模型
 type User struct {
-	ID        int       `json:"id" db:"id"`
-	Username  string    `json:"username" db:"username"`
-	Email     string    `json:"email" db:"email"`
-	Password  string    `json:"-" db:"password_hash"` // 不在JSON中返回密码
-	APIKey    string    `json:"api_key,omitempty" db:"api_key"`
-	IsActive  bool      `json:"is_active" db:"is_active"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID       int    `json:"id" db:"id"`
+	Username string `json:"username" db:"username"`
+	Email    string `json:"email" db:"email"`
+	Password string `json:"-" db:"password_hash"` // 不在JSON中返回密码
+	APIKey   string `json:"api_key,omitempty" db:"api_key"`
+	IsActive bool   `json:"is_active" db:"is_active"`
+	IsAdmin  bool   `json:"is_admin" db:"is_admin"`
+	// 未指定角色时使用的默认角色
+	DefaultPersonaID *int `json:"default_persona_id,omitempty" db:"default_persona_id"`
+	// 是否显示推理模型的思考过程
+	ShowReasoning bool      `json:"show_reasoning" db:"show_reasoning"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// IsAdminUser 是否为管理员（供只依赖接口的模块判断权限）
+func (u *User) IsAdminUser() bool {
+	return u.IsAdmin
+}
+
+// Persona 角色：管理员定义的系统提示词、默认模型、生成参数和允许调用的工具
+type Persona struct {
+	ID           int             `json:"id"`
+	Name         string          `json:"name"`
+	Description  string          `json:"description,omitempty"`
+	SystemPrompt string          `json:"system_prompt,omitempty"`
+	Model        string          `json:"model,omitempty"`  // 为空时使用配置的模型
+	Params       json.RawMessage `json:"params,omitempty"` // 生成参数（JSON），请求中的参数优先
+	Tools        json.RawMessage `json:"tools,omitempty"`  // 允许调用的工具定义（JSON数组）
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+// PromptTemplate 提示词模板，内容字段为当前版本
+type PromptTemplate struct {
+	ID           int             `json:"id"`
+	UserID       int             `json:"user_id"` // 创建者
+	Name         string          `json:"name"`
+	Description  string          `json:"description,omitempty"`
+	Version      int             `json:"version"` // 当前版本号
+	Body         string          `json:"body"`    // 含{{变量}}占位符的提示词
+	SystemPrompt string          `json:"system_prompt,omitempty"`
+	Variables    json.RawMessage `json:"variables,omitempty"` // 变量定义（JSON数组）
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+// TemplateVersion 提示词模板的一个版本（创建后不再修改）
+type TemplateVersion struct {
+	TemplateID   int             `json:"template_id"`
+	Version      int             `json:"version"`
+	Body         string          `json:"body"`
+	SystemPrompt string          `json:"system_prompt,omitempty"`
+	Variables    json.RawMessage `json:"variables,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// TemplateShare 模板共享给的用户
+type TemplateShare struct {
+	TemplateID int       `json:"template_id"`
+	UserID     int       `json:"user_id"`
+	Username   string    `json:"username"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Upload 上传的图片，文件内容保存在本地磁盘
+type Upload struct {
+	ID            int       `json:"id"`
+	UserID        *int      `json:"user_id,omitempty"`
+	AnonTokenHash string    `json:"-"`
+	Filename      string    `json:"filename,omitempty"` // 客户端提供的原始文件名
+	MimeType      string    `json:"mime_type"`          // 按文件内容检测的类型
+	Size          int64     `json:"size"`
+	StorageName   string    `json:"-"` // 磁盘上的文件名（相对上传目录）
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// IsOwnedBy 判断上传的文件是否属于指定的用户或匿名会话
+func (u *Upload) IsOwnedBy(owner RecordOwner) bool {
+	if owner.UserID != nil {
+		return u.UserID != nil && *u.UserID == *owner.UserID
+	}
+	return u.UserID == nil && owner.AnonToken != "" && u.AnonTokenHash == HashAnonToken(owner.AnonToken)
+}
+
+// ArenaComparison 模型竞技场的一次对比：同一问题发送给多个模型
+type ArenaComparison struct {
+	ID            int          `json:"id"`
+	UserID        *int         `json:"user_id,omitempty"`
+	AnonTokenHash string       `json:"-"`
+	Prompt        string       `json:"prompt"`
+	SystemPrompt  string       `json:"system_prompt,omitempty"`
+	Entries       []ArenaEntry `json:"entries"`
+	Vote          *ArenaVote   `json:"vote,omitempty"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+// IsOwnedBy 判断对比是否属于指定的用户或匿名会话
+func (c *ArenaComparison) IsOwnedBy(owner RecordOwner) bool {
+	if owner.UserID != nil {
+		return c.UserID != nil && *c.UserID == *owner.UserID
+	}
+	return c.UserID == nil && owner.AnonToken != "" && c.AnonTokenHash == HashAnonToken(owner.AnonToken)
+}
+
+// ArenaEntry 对比中一个模型的结果
+type ArenaEntry struct {
+	ID               int       `json:"id"`
+	ComparisonID     int       `json:"comparison_id"`
+	Index            int       `json:"index"`
+	Contestant       string    `json:"model"` // provider/model
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model_name"`
+	Answer           string    `json:"answer"`
+	Status           string    `json:"status"` // 沿用问答记录的状态值
+	Error            string    `json:"error,omitempty"`
+	FinishReason     string    `json:"finish_reason,omitempty"`
+	LatencyMs        int64     `json:"latency_ms"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Cost             float64   `json:"cost"` // 美元，按价格表估算
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// ArenaVote 对比的投票结果，Winner为空表示平局
+type ArenaVote struct {
+	ComparisonID int       `json:"comparison_id"`
+	UserID       *int      `json:"user_id,omitempty"`
+	Winner       string    `json:"winner"`
+	Tie          bool      `json:"tie"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ArenaMatch 已投票对比的参赛模型和获胜者，用于计算排行榜
+type ArenaMatch struct {
+	ComparisonID int
+	Contestants  []string
+	Winner       string
+}
+
+// ArenaModelStats 模型在竞技场中已完成结果的统计
+type ArenaModelStats struct {
+	Contestant       string  `json:"model"`
+	Entries          int     `json:"entries"`
+	AvgLatencyMs     float64 `json:"avg_latency_ms"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// 答案评价
+const (
+	FeedbackUp   = "up"
+	FeedbackDown = "down"
+)
+
+// FeedbackCategories 差评可选的问题类型
+var FeedbackCategories = []string{"incorrect", "harmful", "unhelpful"}
+
+// RecordFeedback 用户对一条记录答案的评价
+type RecordFeedback struct {
+	ID            int       `json:"id"`
+	RecordID      int       `json:"record_id"`
+	UserID        *int      `json:"user_id,omitempty"`
+	AnonTokenHash string    `json:"-"`
+	Rating        string    `json:"rating"` // up | down
+	Categories    []string  `json:"categories"`
+	Comment       string    `json:"comment,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// FeedbackCounts 评价数量
+type FeedbackCounts struct {
+	Up   int `json:"up"`
+	Down int `json:"down"`
+}
+
+// FeedbackQuery 评价统计和导出的过滤条件，From/To按评价时间过滤
+type FeedbackQuery struct {
+	Rating   string
+	Category string
+	Provider string
+	Model    string
+	From     *time.Time
+	To       *time.Time
+	Limit    int
+}
+
+// FeedbackItem 导出的评价，附带被评价记录的问题和答案
+type FeedbackItem struct {
+	RecordFeedback
+	Question         string          `json:"question"`
+	Answer           string          `json:"answer"`
+	Provider         string          `json:"provider"`
+	Model            string          `json:"model"`
+	PersonaID        *int            `json:"persona_id,omitempty"`
+	GenerationParams json.RawMessage `json:"generation_params,omitempty"`
+}
+
+// FeedbackModelStats 按Provider和模型统计的评价数量
+type FeedbackModelStats struct {
+	Provider string  `json:"provider"`
+	Model    string  `json:"model"`
+	Up       int     `json:"up"`
+	Down     int     `json:"down"`
+	DownRate float64 `json:"down_rate"`
+}
+
+// FeedbackStats 评价汇总
+type FeedbackStats struct {
+	Total int `json:"total"`
+	FeedbackCounts
+	Categories map[string]int       `json:"categories"`
+	Models     []FeedbackModelStats `json:"models"`
+}
+
+// Conversation 会话：根记录为第一轮的第一个版本，标题和摘要由后台生成，标题可由所有者修改
+type Conversation struct {
+	ID              int       `json:"id"`
+	RootRecordID    int       `json:"root_record_id"`
+	Question        string    `json:"question"` // 第一轮的问题，标题生成前可用于显示
+	Title           string    `json:"title"`
+	Summary         string    `json:"summary,omitempty"`
+	SummaryRecordID *int      `json:"summary_record_id,omitempty"` // 摘要覆盖到的最后一条记录
+	UserID          *int      `json:"user_id,omitempty"`
+	AnonTokenHash   string    `json:"-"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"` // 最近一轮完成的时间
+}
+
+// IsOwnedBy 判断会话是否属于指定的用户或匿名会话
+func (c *Conversation) IsOwnedBy(owner RecordOwner) bool {
+	if owner.UserID != nil {
+		return c.UserID != nil && *c.UserID == *owner.UserID
+	}
+	return c.UserID == nil && owner.AnonToken != "" && c.AnonTokenHash == HashAnonToken(owner.AnonToken)
+}
+
+// UserMemory 用户长期记忆：从问答中提取或由用户添加的关于用户的稳定事实，提问时检索相关记忆附加在系统提示词后
+type UserMemory struct {
+	ID             int       `json:"id"`
+	UserID         int       `json:"user_id"`
+	Content        string    `json:"content"`
+	SourceRecordID *int      `json:"source_record_id,omitempty"` // 提取记忆的问答记录，用户添加的记忆为空
+	EmbeddingModel string    `json:"-"`
+	Embedding      []float32 `json:"-"` // 内容的向量，未生成时为空
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// SearchResult 搜索结果（混合关键词与语义排序）
+type SearchResult struct {
+	QARecord
+	Score           float64 `json:"score"`                  // 融合后的排序得分
+	KeywordRank     int     `json:"keyword_rank,omitempty"` // 关键词检索名次（从1开始）
+	Similarity      float64 `json:"similarity,omitempty"`   // 向量余弦相似度
+	QuestionSnippet string  `json:"question_snippet"`       // 高亮后的问题片段
+	AnswerSnippet   string  `json:"answer_snippet"`         // 高亮后的答案片段
 }
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+)
+
+// ErrPersonaNameTaken 角色名称已被其他角色使用
+var ErrPersonaNameTaken = errors.New("角色名称已存在")
+
+// personaColumns 角色查询字段
+const personaColumns = `id, name, description, system_prompt, model, generation_params, tools, created_at, updated_at`
+
+// PersonaStorage 角色数据库操作
+type PersonaStorage struct {
+	db *DB
+}
+
+// NewPersonaStorage 创建角色存储实例
+func NewPersonaStorage(db *DB) *PersonaStorage {
+	return &PersonaStorage{db: db}
+}
+
+// CreatePersona 创建角色，名称重复时返回ErrPersonaNameTaken
+func (ps *PersonaStorage) CreatePersona(p Persona) (*Persona, error) {
+	if taken, err := ps.personaNameTaken(p.Name, 0); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, ErrPersonaNameTaken
+	}
+
+	id, err := ps.db.InsertID(`INSERT INTO personas (name, description, system_prompt, model, generation_params, tools) VALUES (?, ?, ?, ?, ?, ?)`,
+		p.Name, p.Description, p.SystemPrompt, p.Model, string(p.Params), string(p.Tools))
+	if err != nil {
+		log.Printf("创建角色失败: %v", err)
+		return nil, err
+	}
+
+	log.Printf("角色创建成功: %s (ID: %d)", p.Name, id)
+	return ps.GetPersona(id)
+}
+
+// UpdatePersona 按ID更新角色的全部字段，角色不存在时返回sql.ErrNoRows
+func (ps *PersonaStorage) UpdatePersona(p Persona) (*Persona, error) {
+	if taken, err := ps.personaNameTaken(p.Name, p.ID); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, ErrPersonaNameTaken
+	}
+
+	result, err := ps.db.Exec(`UPDATE personas SET name = ?, description = ?, system_prompt = ?, model = ?, generation_params = ?, tools = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		p.Name, p.Description, p.SystemPrompt, p.Model, string(p.Params), string(p.Tools), p.ID)
+	if err != nil {
+		log.Printf("更新角色失败: %v", err)
+		return nil, err
+	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return ps.GetPersona(p.ID)
+}
+
+// DeletePersona 删除角色，并清除用户默认角色和记录上的引用；角色不存在时返回sql.ErrNoRows
+func (ps *PersonaStorage) DeletePersona(id int) error {
+	if _, err := ps.db.Exec(`UPDATE users SET default_persona_id = NULL WHERE default_persona_id = ?`, id); err != nil {
+		log.Printf("清除用户默认角色失败: %v", err)
+		return err
+	}
+	if _, err := ps.db.Exec(`UPDATE qa_records SET persona_id = NULL WHERE persona_id = ?`, id); err != nil {
+		log.Printf("清除记录角色失败: %v", err)
+		return err
+	}
+
+	result, err := ps.db.Exec(`DELETE FROM personas WHERE id = ?`, id)
+	if err != nil {
+		log.Printf("删除角色失败: %v", err)
+		return err
+	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetPersona 根据ID获取角色
+func (ps *PersonaStorage) GetPersona(id int) (*Persona, error) {
+	return scanPersona(ps.db.QueryRow(`SELECT `+personaColumns+` FROM personas WHERE id = ?`, id))
+}
+
+// ListPersonas 获取所有角色，按名称排序
+func (ps *PersonaStorage) ListPersonas() ([]Persona, error) {
+	rows, err := ps.db.Query(`SELECT ` + personaColumns + ` FROM personas ORDER BY name`)
+	if err != nil {
+		log.Printf("查询角色列表失败: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	personas := []Persona{}
+	for rows.Next() {
+		persona, err := scanPersona(rows)
+		if err != nil {
+			log.Printf("扫描角色失败: %v", err)
+			continue
+		}
+		personas = append(personas, *persona)
+	}
+	return personas, rows.Err()
+}
+
+// personaNameTaken 名称是否已被excludeID以外的角色使用
+func (ps *PersonaStorage) personaNameTaken(name string, excludeID int) (bool, error) {
+	var count int
+	if err := ps.db.QueryRow(`SELECT COUNT(*) FROM personas WHERE name = ? AND id != ?`, name, excludeID).Scan(&count); err != nil {
+		log.Printf("检查角色名称失败: %v", err)
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// scanPersona 按personaColumns的顺序扫描角色
+func scanPersona(row rowScanner) (*Persona, error) {
+	var persona Persona
+	var params, tools string
+	err := row.Scan(&persona.ID, &persona.Name, &persona.Description, &persona.SystemPrompt, &persona.Model,
+		&params, &tools, &persona.CreatedAt, &persona.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if params != "" {
+		persona.Params = json.RawMessage(params)
+	}
+	if tools != "" {
+		persona.Tools = json.RawMessage(tools)
+	}
+	return &persona, nil
+}
@@ -0,0 +1,27 @@
+package storage_test
+
+import (
+	"os"
+	"testing"
+
+	"go-base-web-server/internal/storage"
+)
+
+// postgresDSNEnv PostgreSQL一致性检查使用的DSN，与storecheck子命令相同
+const postgresDSNEnv = "STORECHECK_POSTGRES_DSN"
+
+// TestPostgresStore 在配置的PostgreSQL数据库上执行存储一致性检查，未设置DSN时跳过
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("未设置 %s", postgresDSNEnv)
+	}
+
+	store, err := storage.Open(dsn)
+	if err != nil {
+		t.Fatalf("打开存储失败: %v", err)
+	}
+	defer store.Close()
+
+	runStoreTests(t, store)
+}
@@ -1,109 +1,271 @@
 package storage
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
-
-	_ "github.com/mattn/go-sqlite3"
+	"strings"
 )
 
 // QAStorage QA记录数据库操作
 type QAStorage struct {
-	db *sql.DB
+	db         *DB
+	ftsEnabled bool // 是否启用FTS5全文索引
 }
 
-// NewQAStorage 创建新的QA存储实例
-func NewQAStorage(dbPath string) (*QAStorage, error) {
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		return nil, err
-	}
-
+// NewQAStorage 创建QA存储实例（表结构由迁移创建）
+func NewQAStorage(db *DB) (*QAStorage, error) {
 	storage := &QAStorage{db: db}
 
-	// 初始化数据库表
-	if err := storage.initTables(); err != nil {
-		return nil, err
+	// 全文索引依赖构建标签，不纳入版本化迁移，启动时按运行环境初始化；PostgreSQL使用ILIKE检索
+	if db.Dialect() == DialectSQLite {
+		if err := storage.initSearchIndex(); err != nil {
+			return nil, err
+		}
 	}
 
 	return storage, nil
 }
 
-// initTables 初始化数据库表
-func (s *QAStorage) initTables() error {
-	query := `
-	CREATE TABLE IF NOT EXISTS qa_records (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		question TEXT NOT NULL,
-		answer TEXT DEFAULT '',
-		user_id INTEGER,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);`
+// SaveQuestion 保存新问题，返回记录ID（关联用户或匿名会话，记录生成答案的Provider和模型）
+func (s *QAStorage) SaveQuestion(question string, owner RecordOwner, provider, model string) (int, error) {
+	return s.CreateQuestion(NewQuestion{Question: question, Owner: owner, Provider: provider, Model: model})
+}
+
+// CreateQuestion 保存新问题（可关联会话中的上一轮记录并记录生成参数），返回记录ID；
+// 开始新会话时（没有上一轮且不是已有记录的新版本）同时创建会话
+func (s *QAStorage) CreateQuestion(q NewQuestion) (int, error) {
+	// 新版本的序号为同一轮已有版本的最大序号加一
+	query := `INSERT INTO qa_records (question, user_id, anon_token_hash, provider, model, parent_id, persona_id, generation_params, version_of, version)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, (SELECT COALESCE(MAX(version), 0) + 1 FROM qa_records WHERE id = ? OR version_of = ?))`
 
-	_, err := s.db.Exec(query)
+	anonTokenHash := ""
+	if q.Owner.UserID == nil && q.Owner.AnonToken != "" {
+		anonTokenHash = HashAnonToken(q.Owner.AnonToken)
+	}
+	userID := q.Owner.UserID
+
+	tx, err := s.db.Begin()
 	if err != nil {
-		log.Printf("创建表失败: %v", err)
-		return err
+		return 0, err
 	}
+	defer tx.Rollback()
 
-	log.Println("QA数据库表初始化成功")
-	return nil
+	id, err := tx.InsertID(query, q.Question, userID, anonTokenHash, q.Provider, q.Model, q.ParentID, q.PersonaID, string(q.Params),
+		q.VersionOf, q.VersionOf, q.VersionOf)
+	if err == nil && q.ParentID == nil && q.VersionOf == nil {
+		_, err = tx.Exec(`INSERT INTO conversations (root_record_id) VALUES (?)`, id)
+	}
+	if err != nil {
+		log.Printf("保存问题失败: %v", err)
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	log.Printf("问题保存成功，ID: %d, UserID: %v", id, userID)
+	return id, nil
 }
 
-// SaveQuestion 保存新问题，返回记录ID（支持用户关联）
-func (s *QAStorage) SaveQuestion(question string, userID *int) (int, error) {
-	query := `INSERT INTO qa_records (question, user_id) VALUES (?, ?)`
+// threadWalkLimit 沿parent_id向上查找摘要覆盖点时最多遍历的轮数
+const threadWalkLimit = 1000
+
+// GetRecordThread 沿parent_id向上获取recordID所在会话的最近maxTurns轮记录（含recordID本身），按时间正序返回
+func (s *QAStorage) GetRecordThread(recordID int, maxTurns int) ([]QARecord, error) {
+	thread, _, err := s.recordThread(recordID, maxTurns, false)
+	return thread, err
+}
 
-	result, err := s.db.Exec(query, question, userID)
+// GetThreadSinceSummary 沿parent_id向上获取recordID所在分支上会话摘要覆盖点之后的最近maxTurns轮记录，按时间正序返回；
+// 遇到覆盖点即停止遍历（至多threadWalkLimit轮），覆盖点在当前分支上时同时返回该会话（含摘要），否则会话为nil
+func (s *QAStorage) GetThreadSinceSummary(recordID int, maxTurns int) ([]QARecord, *Conversation, error) {
+	thread, summarized, err := s.recordThread(recordID, maxTurns, true)
+	if err != nil || !summarized {
+		return thread, nil, err
+	}
+	conversation, err := s.FindThreadSummary([]int{thread[0].ID})
 	if err != nil {
-		log.Printf("保存问题失败: %v", err)
-		return 0, err
+		return nil, nil, err
+	}
+	return thread[1:], conversation, nil
+}
+
+// recordThread 用递归查询沿parent_id向上获取最近maxTurns轮记录，按时间正序返回。stopAtSummary为true时遍历到会话摘要覆盖点为止
+// （不受maxTurns限制，至多threadWalkLimit轮），覆盖点作为第一条记录返回，summarized表示第一条记录是否为覆盖点
+func (s *QAStorage) recordThread(recordID, maxTurns int, stopAtSummary bool) (thread []QARecord, summarized bool, err error) {
+	stop := func(column string) string { return "0" }
+	walkLimit := maxTurns
+	if stopAtSummary {
+		stop = func(column string) string {
+			return `CASE WHEN EXISTS (SELECT 1 FROM conversations c WHERE c.summary_record_id = ` + column + ` AND c.summary <> '') THEN 1 ELSE 0 END`
+		}
+		walkLimit = threadWalkLimit
 	}
 
-	id, err := result.LastInsertId()
+	rows, err := s.db.Query(`WITH RECURSIVE thread (id, parent_id, depth, stop) AS (
+		SELECT id, parent_id, 1, `+stop("id")+` FROM qa_records WHERE id = ?
+		UNION ALL
+		SELECT q.id, q.parent_id, t.depth + 1, `+stop("q.id")+`
+		FROM qa_records q JOIN thread t ON q.id = t.parent_id
+		WHERE t.stop = 0 AND t.depth < ?
+	)
+	SELECT `+recordColumns("r")+`, t.stop FROM thread t JOIN qa_records r ON r.id = t.id
+	WHERE t.depth <= ? OR t.stop = 1
+	ORDER BY t.depth DESC`, recordID, walkLimit, maxTurns)
 	if err != nil {
-		log.Printf("获取插入ID失败: %v", err)
-		return 0, err
+		log.Printf("查询会话记录失败: %v", err)
+		return nil, false, err
 	}
+	defer rows.Close()
 
-	log.Printf("问题保存成功，ID: %d, UserID: %v", id, userID)
-	return int(id), nil
+	for rows.Next() {
+		var isStop int
+		record, err := scanRecord(rows, &isStop)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(thread) == 0 {
+			summarized = isStop == 1
+		}
+		thread = append(thread, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	if len(thread) == 0 {
+		return nil, false, sql.ErrNoRows
+	}
+	return thread, summarized, nil
 }
 
-// UpdateAnswer 更新答案
-func (s *QAStorage) UpdateAnswer(id int, answer string) error {
-	query := `UPDATE qa_records SET answer = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+// ErrRecordFinished 记录已处于终止状态，不能再更新生成结果
+var ErrRecordFinished = errors.New("记录已结束生成")
 
-	result, err := s.db.Exec(query, answer, id)
+// UpdateStatus 更新生成中记录的状态（如pending -> streaming）
+func (s *QAStorage) UpdateStatus(id int, status string) error {
+	if !ValidRecordStatus(status) || IsTerminalStatus(status) {
+		return fmt.Errorf("无效的记录状态: %s", status)
+	}
+
+	result, err := s.db.Exec(`UPDATE qa_records SET status = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status IN ('pending', 'streaming')`, status, id)
 	if err != nil {
-		log.Printf("更新答案失败: %v", err)
+		log.Printf("更新记录状态失败: %v", err)
 		return err
 	}
 
+	return s.checkInFlightUpdate(result, id)
+}
+
+// FinishRecord 保存生成结果并将记录置为终止状态（completed/failed/cancelled），
+// 有多个候选答案时一并保存；已结束的记录不会被覆盖
+func (s *QAStorage) FinishRecord(id int, res RecordResult) error {
+	if !IsTerminalStatus(res.Status) {
+		return fmt.Errorf("无效的终止状态: %s", res.Status)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE qa_records
+	SET answer = ?, reasoning = ?, status = ?, error_message = ?, finish_reason = ?, latency_ms = ?, candidate_count = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status IN ('pending', 'streaming')`
+
+	result, err := tx.Exec(query, res.Answer, res.Reasoning, res.Status, res.Error, res.FinishReason, res.Latency.Milliseconds(), len(res.Candidates), id)
+	if err != nil {
+		log.Printf("保存生成结果失败: %v", err)
+		return err
+	}
+
+	if err := s.checkInFlightUpdate(result, id); err != nil {
+		return err
+	}
+
+	for _, candidate := range res.Candidates {
+		if _, err := tx.Exec(`INSERT INTO record_candidates (record_id, candidate_index, answer, reasoning, finish_reason) VALUES (?, ?, ?, ?, ?)`,
+			id, candidate.Index, candidate.Answer, candidate.Reasoning, candidate.FinishReason); err != nil {
+			log.Printf("保存候选答案失败: %v", err)
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("生成结果保存成功，ID: %d, 状态: %s, 耗时: %v", id, res.Status, res.Latency)
+	return nil
+}
+
+// checkInFlightUpdate 检查针对生成中记录的更新是否生效，区分记录不存在和已结束
+func (s *QAStorage) checkInFlightUpdate(result sql.Result, id int) error {
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		log.Printf("获取影响行数失败: %v", err)
 		return err
 	}
+	if rowsAffected > 0 {
+		return nil
+	}
 
-	if rowsAffected == 0 {
-		log.Printf("未找到ID为%d的记录", id)
+	var status string
+	if err := s.db.QueryRow(`SELECT status FROM qa_records WHERE id = ?`, id).Scan(&status); err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("未找到ID为%d的记录", id)
+		}
+		return err
+	}
+	return ErrRecordFinished
+}
+
+// UpdateVisibility 更新记录可见性
+func (s *QAStorage) UpdateVisibility(id int, visibility string) error {
+	if !ValidVisibility(visibility) {
+		return fmt.Errorf("无效的可见性: %s", visibility)
+	}
+
+	result, err := s.db.Exec(`UPDATE qa_records SET visibility = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, visibility, id)
+	if err != nil {
+		log.Printf("更新记录可见性失败: %v", err)
+		return err
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
 		return sql.ErrNoRows
 	}
 
-	log.Printf("答案更新成功，ID: %d", id)
+	log.Printf("记录可见性更新成功，ID: %d, 可见性: %s", id, visibility)
 	return nil
 }
 
-// GetRecord 根据ID获取记录
-func (s *QAStorage) GetRecord(id int) (interface{}, error) {
-	query := `SELECT id, question, answer, user_id, created_at, updated_at FROM qa_records WHERE id = ?`
+// HashAnonToken 计算匿名会话令牌的哈希（数据库中不保存明文令牌）
+func HashAnonToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
 
-	row := s.db.QueryRow(query, id)
+// GenerateAnonToken 生成新的匿名会话令牌
+func GenerateAnonToken() (string, error) {
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
 
-	var record QARecord
-	err := row.Scan(&record.ID, &record.Question, &record.Answer, &record.UserID, &record.CreatedAt, &record.UpdatedAt)
+// GetRecord 根据ID获取记录
+func (s *QAStorage) GetRecord(id int) (*QARecord, error) {
+	query := `SELECT ` + recordColumns("") + ` FROM qa_records WHERE id = ?`
+
+	record, err := scanRecord(s.db.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Printf("未找到ID为%d的记录", id)
@@ -117,8 +279,8 @@ func (s *QAStorage) GetRecord(id int) (interface{}, error) {
 }
 
 // GetAllRecords 获取所有记录
-func (s *QAStorage) GetAllRecords() (interface{}, error) {
-	query := `SELECT id, question, answer, user_id, created_at, updated_at FROM qa_records ORDER BY created_at DESC`
+func (s *QAStorage) GetAllRecords() ([]QARecord, error) {
+	query := `SELECT ` + recordColumns("") + ` FROM qa_records ORDER BY created_at DESC`
 
 	rows, err := s.db.Query(query)
 	if err != nil {
@@ -129,8 +291,7 @@ func (s *QAStorage) GetAllRecords() (interface{}, error) {
 
 	var records []QARecord
 	for rows.Next() {
-		var record QARecord
-		err := rows.Scan(&record.ID, &record.Question, &record.Answer, &record.UserID, &record.CreatedAt, &record.UpdatedAt)
+		record, err := scanRecord(rows)
 		if err != nil {
 			log.Printf("扫描记录失败: %v", err)
 			continue
@@ -142,8 +303,8 @@ func (s *QAStorage) GetAllRecords() (interface{}, error) {
 }
 
 // GetRecordsByUserID 获取指定用户的问答记录
-func (s *QAStorage) GetRecordsByUserID(userID int) (interface{}, error) {
-	query := `SELECT id, question, answer, user_id, created_at, updated_at FROM qa_records WHERE user_id = ? ORDER BY created_at DESC`
+func (s *QAStorage) GetRecordsByUserID(userID int) ([]QARecord, error) {
+	query := `SELECT ` + recordColumns("") + ` FROM qa_records WHERE user_id = ? ORDER BY created_at DESC`
 
 	rows, err := s.db.Query(query, userID)
 	if err != nil {
@@ -154,8 +315,7 @@ func (s *QAStorage) GetRecordsByUserID(userID int) (interface{}, error) {
 
 	var records []QARecord
 	for rows.Next() {
-		var record QARecord
-		err := rows.Scan(&record.ID, &record.Question, &record.Answer, &record.UserID, &record.CreatedAt, &record.UpdatedAt)
+		record, err := scanRecord(rows)
 		if err != nil {
 			log.Printf("扫描记录失败: %v", err)
 			continue
@@ -166,12 +326,35 @@ func (s *QAStorage) GetRecordsByUserID(userID int) (interface{}, error) {
 	return records, nil
 }
 
-// GetDB 获取数据库连接（用于用户存储）
-func (s *QAStorage) GetDB() *sql.DB {
-	return s.db
+// rowScanner 兼容*sql.Row和*sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
 
-// Close 关闭数据库连接
-func (s *QAStorage) Close() error {
-	return s.db.Close()
+// recordColumns 问答记录查询字段，alias为表别名（可为空）
+func recordColumns(alias string) string {
+	prefix := ""
+	if alias != "" {
+		prefix = alias + "."
+	}
+	columns := []string{"id", "question", "answer", "reasoning", "user_id", "provider", "model", "visibility", "anon_token_hash",
+		"status", "error_message", "finish_reason", "latency_ms", "parent_id", "persona_id", "generation_params", "candidate_count", "preferred_candidate", "version_of", "version", "created_at", "updated_at"}
+	for i, column := range columns {
+		columns[i] = prefix + column
+	}
+	return strings.Join(columns, ", ")
+}
+
+// scanRecord 按recordColumns的顺序扫描记录，extra为追加字段
+func scanRecord(row rowScanner, extra ...interface{}) (QARecord, error) {
+	var record QARecord
+	var params string
+	dest := []interface{}{&record.ID, &record.Question, &record.Answer, &record.Reasoning, &record.UserID, &record.Provider, &record.Model,
+		&record.Visibility, &record.AnonTokenHash, &record.Status, &record.Error, &record.FinishReason, &record.LatencyMs,
+		&record.ParentID, &record.PersonaID, &params, &record.CandidateCount, &record.PreferredCandidate, &record.VersionOf, &record.Version, &record.CreatedAt, &record.UpdatedAt}
+	err := row.Scan(append(dest, extra...)...)
+	if params != "" {
+		record.Params = json.RawMessage(params)
+	}
+	return record, err
 }
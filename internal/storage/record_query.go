@@ -0,0 +1,269 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRecordPageSize 默认分页大小
+	DefaultRecordPageSize = 20
+	// MaxRecordPageSize 最大分页大小
+	MaxRecordPageSize = 100
+)
+
+// SQLite中DATETIME字段的存储格式（CURRENT_TIMESTAMP，UTC）
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+// recordSortColumns 允许排序的字段
+var recordSortColumns = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"id":         true,
+}
+
+// RecordQuery 问答记录列表查询条件
+type RecordQuery struct {
+	UserID     *int       // 按用户过滤
+	AnonToken  string     // 按匿名会话过滤（仅匿名记录）
+	Visibility string     // 按可见性过滤
+	Status     string     // 按生命周期状态过滤
+	Provider   string     // 按Provider过滤
+	Model      string     // 按模型过滤
+	Answered   *bool      // true仅已完成，false仅未完成（生成中、失败或取消）
+	From       *time.Time // 创建时间下限（含）
+	To         *time.Time // 创建时间上限（不含）
+	SortBy     string     // created_at | updated_at | id
+	Order      string     // asc | desc
+	Limit      int
+	Cursor     string // 上一页返回的next_cursor
+
+	cursor *recordCursor // 解码后的游标
+}
+
+// RecordPage 分页结果
+type RecordPage struct {
+	Records    []QARecord `json:"records"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+	HasMore    bool       `json:"has_more"`
+	Total      int        `json:"total"`
+	Limit      int        `json:"limit"`
+}
+
+// recordCursor 游标内容：最后一条记录的排序值和ID
+type recordCursor struct {
+	SortBy string `json:"s"`
+	Order  string `json:"o"`
+	Value  string `json:"v"`
+	ID     int    `json:"id"`
+}
+
+// Normalize 校验并补全查询条件的默认值
+func (q *RecordQuery) Normalize() error {
+	if q.SortBy == "" {
+		q.SortBy = "created_at"
+	}
+	if !recordSortColumns[q.SortBy] {
+		return fmt.Errorf("不支持的排序字段: %s", q.SortBy)
+	}
+
+	q.Order = strings.ToLower(q.Order)
+	if q.Order == "" {
+		q.Order = "desc"
+	}
+	if q.Order != "asc" && q.Order != "desc" {
+		return fmt.Errorf("不支持的排序方向: %s", q.Order)
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = DefaultRecordPageSize
+	}
+	if q.Limit > MaxRecordPageSize {
+		q.Limit = MaxRecordPageSize
+	}
+
+	if q.Visibility != "" && !ValidVisibility(q.Visibility) {
+		return fmt.Errorf("无效的可见性: %s", q.Visibility)
+	}
+
+	if q.Status != "" && !ValidRecordStatus(q.Status) {
+		return fmt.Errorf("无效的记录状态: %s", q.Status)
+	}
+
+	if q.From != nil && q.To != nil && !q.From.Before(*q.To) {
+		return fmt.Errorf("时间范围无效: from必须早于to")
+	}
+
+	q.cursor = nil
+	if q.Cursor != "" {
+		cursor, err := decodeRecordCursor(q.Cursor)
+		if err != nil {
+			return err
+		}
+		if cursor.SortBy != q.SortBy || cursor.Order != q.Order {
+			return fmt.Errorf("游标与排序条件不匹配")
+		}
+		q.cursor = cursor
+	}
+
+	return nil
+}
+
+// ListRecords 按条件分页查询问答记录（基于游标的键集分页）
+func (s *QAStorage) ListRecords(q RecordQuery) (*RecordPage, error) {
+	if err := q.Normalize(); err != nil {
+		return nil, err
+	}
+
+	where, args := q.filters(s.db)
+
+	// 统计满足过滤条件的总数（不受游标影响）
+	var total int
+	countQuery := `SELECT COUNT(*) FROM qa_records` + joinWhere(where)
+	if err := s.db.QueryRow(countQuery, args...).Scan(&total); err != nil {
+		log.Printf("统计记录数失败: %v", err)
+		return nil, err
+	}
+
+	if cursor := q.cursor; cursor != nil {
+		op := "<"
+		if q.Order == "asc" {
+			op = ">"
+		}
+
+		if q.SortBy == "id" {
+			where = append(where, "id "+op+" ?")
+			args = append(args, cursor.ID)
+		} else {
+			where = append(where, fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", q.SortBy, op, q.SortBy, op))
+			args = append(args, cursor.Value, cursor.Value, cursor.ID)
+		}
+	}
+
+	order := strings.ToUpper(q.Order)
+	query := fmt.Sprintf(`SELECT %s, CAST(%s AS TEXT)
+	FROM qa_records%s
+	ORDER BY %s %s, id %s
+	LIMIT ?`, recordColumns(""), q.SortBy, joinWhere(where), q.SortBy, order, order)
+	args = append(args, q.Limit+1)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		log.Printf("分页查询记录失败: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &RecordPage{Records: []QARecord{}, Total: total, Limit: q.Limit}
+	var lastSortValue string
+	for rows.Next() {
+		var sortValue string
+		record, err := scanRecord(rows, &sortValue)
+		if err != nil {
+			log.Printf("扫描记录失败: %v", err)
+			continue
+		}
+
+		if len(page.Records) == q.Limit {
+			page.HasMore = true
+			break
+		}
+		page.Records = append(page.Records, record)
+		lastSortValue = sortValue
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if page.HasMore {
+		last := page.Records[len(page.Records)-1]
+		page.NextCursor = encodeRecordCursor(recordCursor{
+			SortBy: q.SortBy,
+			Order:  q.Order,
+			Value:  lastSortValue,
+			ID:     last.ID,
+		})
+	}
+
+	return page, nil
+}
+
+// filters 构建过滤条件
+func (q *RecordQuery) filters(db *DB) ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+
+	if q.UserID != nil {
+		where = append(where, "user_id = ?")
+		args = append(args, *q.UserID)
+	}
+	if q.AnonToken != "" {
+		where = append(where, "user_id IS NULL AND anon_token_hash = ?")
+		args = append(args, HashAnonToken(q.AnonToken))
+	}
+	if q.Visibility != "" {
+		where = append(where, "visibility = ?")
+		args = append(args, q.Visibility)
+	}
+	if q.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, q.Status)
+	}
+	if q.Provider != "" {
+		where = append(where, "provider = ?")
+		args = append(args, q.Provider)
+	}
+	if q.Model != "" {
+		where = append(where, "model = ?")
+		args = append(args, q.Model)
+	}
+	if q.Answered != nil {
+		if *q.Answered {
+			where = append(where, "status = 'completed'")
+		} else {
+			where = append(where, "status != 'completed'")
+		}
+	}
+	if q.From != nil {
+		where = append(where, "created_at >= ?")
+		args = append(args, db.TimeArg(*q.From))
+	}
+	if q.To != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, db.TimeArg(*q.To))
+	}
+
+	return where, args
+}
+
+// joinWhere 拼接WHERE子句
+func joinWhere(where []string) string {
+	if len(where) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(where, " AND ")
+}
+
+// encodeRecordCursor 编码游标
+func encodeRecordCursor(c recordCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeRecordCursor 解码游标
+func decodeRecordCursor(raw string) (*recordCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("无效的游标")
+	}
+
+	var c recordCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("无效的游标")
+	}
+	return &c, nil
+}
@@ -0,0 +1,472 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// rrfK 倒数排名融合（Reciprocal Rank Fusion）平滑常数
+	rrfK = 60
+	// minSemanticSimilarity 语义召回的最低余弦相似度
+	minSemanticSimilarity = 0.3
+	// snippetRadius 片段中关键词前后保留的字符数
+	snippetRadius = 40
+	// ftsMinTermLength trigram分词器要求的最短检索词长度
+	ftsMinTermLength = 3
+	// semanticCandidateLimit 语义检索每次计算相似度的最多向量数（最近的记录优先），更早的记录只能通过关键词检索命中
+	semanticCandidateLimit = 2000
+)
+
+// searchableFilter 可被搜索的记录条件（r为记录表别名）：已生成完成，且同一轮没有更新的已完成版本
+const searchableFilter = ` AND r.status = 'completed' AND NOT EXISTS (
+	SELECT 1 FROM qa_records v
+	WHERE (v.id = COALESCE(r.version_of, r.id) OR v.version_of = COALESCE(r.version_of, r.id))
+	AND v.version > r.version AND v.status = 'completed')`
+
+// initSearchIndex 初始化全文索引（向量表由迁移创建）
+func (s *QAStorage) initSearchIndex() error {
+	// FTS5需要使用 -tags sqlite_fts5 编译go-sqlite3，不可用时退化为LIKE检索
+	ftsTableQuery := `
+	CREATE VIRTUAL TABLE IF NOT EXISTS qa_records_fts USING fts5(
+		question, answer,
+		content='qa_records', content_rowid='id',
+		tokenize='trigram'
+	);`
+
+	if _, err := s.db.Exec(ftsTableQuery); err != nil {
+		log.Printf("FTS5不可用，关键词搜索将使用LIKE匹配: %v", err)
+		// 删除同步触发器，避免在不支持FTS5的构建中写入qa_records失败
+		for _, trigger := range []string{"qa_records_fts_ai", "qa_records_fts_ad", "qa_records_fts_au"} {
+			s.db.Exec("DROP TRIGGER IF EXISTS " + trigger)
+		}
+		return nil
+	}
+
+	var triggerCount int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'qa_records_fts_%'`).Scan(&triggerCount)
+	if err != nil {
+		return err
+	}
+
+	if triggerCount < 3 {
+		triggerQuery := `
+		CREATE TRIGGER IF NOT EXISTS qa_records_fts_ai AFTER INSERT ON qa_records BEGIN
+			INSERT INTO qa_records_fts(rowid, question, answer) VALUES (new.id, new.question, new.answer);
+		END;
+		CREATE TRIGGER IF NOT EXISTS qa_records_fts_ad AFTER DELETE ON qa_records BEGIN
+			INSERT INTO qa_records_fts(qa_records_fts, rowid, question, answer) VALUES ('delete', old.id, old.question, old.answer);
+		END;
+		CREATE TRIGGER IF NOT EXISTS qa_records_fts_au AFTER UPDATE ON qa_records BEGIN
+			INSERT INTO qa_records_fts(qa_records_fts, rowid, question, answer) VALUES ('delete', old.id, old.question, old.answer);
+			INSERT INTO qa_records_fts(rowid, question, answer) VALUES (new.id, new.question, new.answer);
+		END;`
+
+		if _, err := s.db.Exec(triggerQuery); err != nil {
+			log.Printf("创建全文索引触发器失败: %v", err)
+			return err
+		}
+
+		// 触发器缺失期间写入的数据需要重建索引
+		if _, err := s.db.Exec(`INSERT INTO qa_records_fts(qa_records_fts) VALUES ('rebuild')`); err != nil {
+			log.Printf("重建全文索引失败: %v", err)
+			return err
+		}
+		log.Println("全文索引已重建")
+	}
+
+	s.ftsEnabled = true
+	log.Println("FTS5全文索引初始化成功")
+	return nil
+}
+
+// SaveEmbedding 保存记录的向量
+func (s *QAStorage) SaveEmbedding(recordID int, model string, vector []float32) error {
+	query := `
+	INSERT INTO qa_embeddings (record_id, model, dimension, vector, updated_at)
+	VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(record_id) DO UPDATE SET
+		model = excluded.model,
+		dimension = excluded.dimension,
+		vector = excluded.vector,
+		updated_at = CURRENT_TIMESTAMP`
+
+	_, err := s.db.Exec(query, recordID, model, len(vector), encodeVector(vector))
+	if err != nil {
+		log.Printf("保存向量失败: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// BackfillEmbeddings 为缺少向量的历史记录分批补齐向量，返回处理的记录数
+func (s *QAStorage) BackfillEmbeddings(model string, batchSize int, embed func(question, answer string) ([]float32, error)) (int, error) {
+	processed := 0
+	for {
+		records, err := s.recordsWithoutEmbedding(model, batchSize)
+		if err != nil {
+			return processed, err
+		}
+
+		for _, record := range records {
+			vector, err := embed(record.Question, record.Answer)
+			if err != nil {
+				return processed, fmt.Errorf("生成记录%d的向量失败: %v", record.ID, err)
+			}
+			if err := s.SaveEmbedding(record.ID, model, vector); err != nil {
+				return processed, err
+			}
+			processed++
+		}
+
+		if len(records) < batchSize {
+			return processed, nil
+		}
+	}
+}
+
+// recordsWithoutEmbedding 获取尚未生成指定模型向量的已回答记录
+func (s *QAStorage) recordsWithoutEmbedding(model string, limit int) ([]QARecord, error) {
+	query := `
+	SELECT ` + recordColumns("r") + `
+	FROM qa_records r
+	LEFT JOIN qa_embeddings e ON e.record_id = r.id AND e.model = ?
+	WHERE e.record_id IS NULL AND r.status = 'completed' AND r.answer != ''
+	ORDER BY r.id
+	LIMIT ?`
+
+	rows, err := s.db.Query(query, model, limit)
+	if err != nil {
+		log.Printf("查询待生成向量记录失败: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []QARecord
+	for rows.Next() {
+		record, err := scanRecord(rows)
+		if err != nil {
+			log.Printf("扫描记录失败: %v", err)
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// SearchRecords 混合搜索已完成的问答记录（同一轮有多个版本时只搜索最新的已完成版本）：
+// 关键词检索与向量相似度通过倒数排名融合排序。userID为nil时搜索所有记录（管理员），queryVector为nil时仅使用关键词检索。
+func (s *QAStorage) SearchRecords(queryText string, queryVector []float32, model string, userID *int, limit int) ([]SearchResult, error) {
+	terms := strings.Fields(queryText)
+	if len(terms) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	candidates := make(map[int]*SearchResult)
+
+	keywordHits, err := s.searchKeyword(terms, userID, limit*2)
+	if err != nil {
+		return nil, err
+	}
+	for i, record := range keywordHits {
+		candidates[record.ID] = &SearchResult{
+			QARecord:    record,
+			KeywordRank: i + 1,
+			Score:       1.0 / float64(rrfK+i+1),
+		}
+	}
+
+	if queryVector != nil {
+		semanticHits, err := s.searchSemantic(queryVector, model, userID, limit*2)
+		if err != nil {
+			return nil, err
+		}
+		for i, hit := range semanticHits {
+			result, exists := candidates[hit.ID]
+			if !exists {
+				result = &SearchResult{QARecord: hit.QARecord}
+				candidates[hit.ID] = result
+			}
+			result.Similarity = hit.Similarity
+			result.Score += 1.0 / float64(rrfK+i+1)
+		}
+	}
+
+	results := make([]SearchResult, 0, len(candidates))
+	for _, result := range candidates {
+		result.QuestionSnippet = highlightSnippet(result.Question, terms)
+		result.AnswerSnippet = highlightSnippet(result.Answer, terms)
+		results = append(results, *result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID > results[j].ID
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+// searchKeyword 关键词检索，优先使用FTS5的bm25排序
+func (s *QAStorage) searchKeyword(terms []string, userID *int, limit int) ([]QARecord, error) {
+	useFTS := s.ftsEnabled
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) < ftsMinTermLength {
+			useFTS = false
+			break
+		}
+	}
+
+	var query string
+	var args []interface{}
+
+	if useFTS {
+		quoted := make([]string, len(terms))
+		for i, term := range terms {
+			quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+		}
+
+		query = `
+		SELECT ` + recordColumns("r") + `
+		FROM qa_records_fts
+		JOIN qa_records r ON r.id = qa_records_fts.rowid
+		WHERE qa_records_fts MATCH ?` + searchableFilter
+		args = append(args, strings.Join(quoted, " AND "))
+
+		if userID != nil {
+			query += ` AND r.user_id = ?`
+			args = append(args, *userID)
+		}
+		query += ` ORDER BY bm25(qa_records_fts) LIMIT ?`
+	} else {
+		query = `SELECT ` + recordColumns("r") + ` FROM qa_records r WHERE 1 = 1` + searchableFilter
+		for _, term := range terms {
+			pattern := "%" + escapeLike(term) + "%"
+			query += fmt.Sprintf(` AND (r.question %[1]s ? ESCAPE '\' OR r.answer %[1]s ? ESCAPE '\')`, s.db.LikeOperator())
+			args = append(args, pattern, pattern)
+		}
+
+		if userID != nil {
+			query += ` AND r.user_id = ?`
+			args = append(args, *userID)
+		}
+		query += ` ORDER BY r.created_at DESC LIMIT ?`
+	}
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		log.Printf("关键词搜索失败: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []QARecord
+	for rows.Next() {
+		record, err := scanRecord(rows)
+		if err != nil {
+			log.Printf("扫描记录失败: %v", err)
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// semanticHit 语义检索命中
+type semanticHit struct {
+	QARecord
+	Similarity float64
+}
+
+// searchSemantic 向量相似度检索（在应用层计算余弦相似度），只计算最近semanticCandidateLimit条记录的向量
+func (s *QAStorage) searchSemantic(queryVector []float32, model string, userID *int, limit int) ([]semanticHit, error) {
+	query := `
+	SELECT ` + recordColumns("r") + `, e.vector
+	FROM qa_embeddings e
+	JOIN qa_records r ON r.id = e.record_id
+	WHERE e.model = ? AND e.dimension = ?` + searchableFilter
+	args := []interface{}{model, len(queryVector)}
+
+	if userID != nil {
+		query += ` AND r.user_id = ?`
+		args = append(args, *userID)
+	}
+	query += ` ORDER BY e.record_id DESC LIMIT ?`
+	args = append(args, semanticCandidateLimit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		log.Printf("语义搜索失败: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []semanticHit
+	for rows.Next() {
+		var hit semanticHit
+		var blob []byte
+		record, err := scanRecord(rows, &blob)
+		if err != nil {
+			log.Printf("扫描向量记录失败: %v", err)
+			continue
+		}
+
+		hit.QARecord = record
+		hit.Similarity = cosineSimilarity(queryVector, decodeVector(blob))
+		if hit.Similarity >= minSemanticSimilarity {
+			hits = append(hits, hit)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		return hits[i].Similarity > hits[j].Similarity
+	})
+
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// encodeVector 将向量编码为小端float32字节序列
+func encodeVector(vector []float32) []byte {
+	buf := make([]byte, len(vector)*4)
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(v))
+	}
+	return buf
+}
+
+// decodeVector 解码小端float32字节序列
+func decodeVector(buf []byte) []float32 {
+	vector := make([]float32, len(buf)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+	}
+	return vector
+}
+
+// cosineSimilarity 计算余弦相似度
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// escapeLike 转义LIKE通配符
+func escapeLike(term string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(term)
+}
+
+// highlightSnippet 截取首个命中词附近的片段，HTML转义后用<mark>标记所有命中词
+func highlightSnippet(text string, terms []string) string {
+	runes := []rune(text)
+	lowerRunes := []rune(strings.ToLower(text))
+	if len(lowerRunes) != len(runes) {
+		// 个别字符小写后长度变化时退化为大小写敏感匹配
+		lowerRunes = runes
+	}
+
+	// 定位首个命中位置
+	first := -1
+	for _, term := range terms {
+		if idx := indexRunes(lowerRunes, []rune(strings.ToLower(term)), 0); idx >= 0 && (first < 0 || idx < first) {
+			first = idx
+		}
+	}
+
+	start, end := 0, len(runes)
+	if first >= 0 {
+		start = first - snippetRadius
+		if start < 0 {
+			start = 0
+		}
+		if end > first+snippetRadius*3 {
+			end = first + snippetRadius*3
+		}
+	} else if end > snippetRadius*3 {
+		end = snippetRadius * 3
+	}
+
+	// 标记片段内所有命中区间
+	marked := make([]bool, end-start)
+	for _, term := range terms {
+		termRunes := []rune(strings.ToLower(term))
+		if len(termRunes) == 0 {
+			continue
+		}
+		for idx := indexRunes(lowerRunes[:end], termRunes, start); idx >= 0; idx = indexRunes(lowerRunes[:end], termRunes, idx+len(termRunes)) {
+			for k := idx; k < idx+len(termRunes); k++ {
+				marked[k-start] = true
+			}
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; i++ {
+		if marked[i-start] && (i == start || !marked[i-start-1]) {
+			b.WriteString("<mark>")
+		}
+		b.WriteString(html.EscapeString(string(runes[i])))
+		if marked[i-start] && (i == end-1 || !marked[i-start+1]) {
+			b.WriteString("</mark>")
+		}
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+
+	return b.String()
+}
+
+// indexRunes 在rune切片中从from开始查找子序列
+func indexRunes(haystack, needle []rune, from int) int {
+	for i := from; i+len(needle) <= len(haystack); i++ {
+		match := true
+		for j := range needle {
+			if haystack[i+j] != needle[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
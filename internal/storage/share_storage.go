@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"log"
+	"time"
+)
+
+// CreateShare 为记录创建分享链接，scope为ShareScopeRecord或ShareScopeConversation，expiresAt为nil表示永不过期
+func (s *QAStorage) CreateShare(recordID int, scope string, userID *int, expiresAt *time.Time) (*RecordShare, error) {
+	slug, err := generateShareSlug()
+	if err != nil {
+		return nil, err
+	}
+
+	var expires interface{}
+	if expiresAt != nil {
+		expires = s.db.TimeArg(*expiresAt)
+	}
+
+	id, err := s.db.InsertID(`INSERT INTO record_shares (slug, record_id, scope, user_id, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		slug, recordID, scope, userID, expires)
+	if err != nil {
+		log.Printf("创建分享链接失败: %v", err)
+		return nil, err
+	}
+
+	log.Printf("分享链接创建成功，记录ID: %d, 分享ID: %d", recordID, id)
+	return s.getShare(`id = ?`, id)
+}
+
+// GetShareBySlug 根据slug获取分享链接
+func (s *QAStorage) GetShareBySlug(slug string) (*RecordShare, error) {
+	return s.getShare(`slug = ?`, slug)
+}
+
+// ListSharesByRecord 获取记录的所有分享链接
+func (s *QAStorage) ListSharesByRecord(recordID int) ([]RecordShare, error) {
+	rows, err := s.db.Query(`SELECT `+shareColumns+` FROM record_shares WHERE record_id = ? ORDER BY created_at DESC`, recordID)
+	if err != nil {
+		log.Printf("查询分享链接失败: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []RecordShare{}
+	for rows.Next() {
+		share, err := scanShare(rows)
+		if err != nil {
+			log.Printf("扫描分享链接失败: %v", err)
+			continue
+		}
+		shares = append(shares, *share)
+	}
+	return shares, rows.Err()
+}
+
+// RevokeShare 撤销分享链接
+func (s *QAStorage) RevokeShare(slug string) error {
+	result, err := s.db.Exec(`UPDATE record_shares SET revoked_at = CURRENT_TIMESTAMP WHERE slug = ? AND revoked_at IS NULL`, slug)
+	if err != nil {
+		log.Printf("撤销分享链接失败: %v", err)
+		return err
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// IncrementShareViews 分享链接访问次数加一
+func (s *QAStorage) IncrementShareViews(slug string) error {
+	_, err := s.db.Exec(`UPDATE record_shares SET view_count = view_count + 1 WHERE slug = ?`, slug)
+	if err != nil {
+		log.Printf("更新分享访问次数失败: %v", err)
+	}
+	return err
+}
+
+const shareColumns = `id, slug, record_id, scope, user_id, expires_at, revoked_at, view_count, created_at`
+
+// getShare 按条件查询单个分享链接
+func (s *QAStorage) getShare(condition string, arg interface{}) (*RecordShare, error) {
+	share, err := scanShare(s.db.QueryRow(`SELECT `+shareColumns+` FROM record_shares WHERE `+condition, arg))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("查询分享链接失败: %v", err)
+		}
+		return nil, err
+	}
+	return share, nil
+}
+
+// scanShare 扫描分享链接
+func scanShare(row rowScanner) (*RecordShare, error) {
+	var share RecordShare
+	var expiresAt, revokedAt sql.NullTime
+	err := row.Scan(&share.ID, &share.Slug, &share.RecordID, &share.Scope, &share.UserID, &expiresAt, &revokedAt, &share.ViewCount, &share.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		share.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		share.RevokedAt = &revokedAt.Time
+	}
+	return &share, nil
+}
+
+// generateShareSlug 生成不可猜测的分享slug（128位随机数）
+func generateShareSlug() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
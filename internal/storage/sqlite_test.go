@@ -0,0 +1,32 @@
+package storage_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go-base-web-server/internal/storage"
+	"go-base-web-server/internal/storage/storetest"
+)
+
+// TestSQLiteStore 在临时SQLite数据库上执行存储一致性检查
+func TestSQLiteStore(t *testing.T) {
+	store, err := storage.Open(filepath.Join(t.TempDir(), "storetest.db"))
+	if err != nil {
+		t.Fatalf("打开存储失败: %v", err)
+	}
+	defer store.Close()
+
+	runStoreTests(t, store)
+}
+
+// runStoreTests 执行全部一致性用例，每个用例作为一个子测试报告
+func runStoreTests(t *testing.T, store storage.Store) {
+	for _, result := range storetest.Run(store) {
+		result := result
+		t.Run(result.Name, func(t *testing.T) {
+			if result.Err != nil {
+				t.Error(result.Err)
+			}
+		})
+	}
+}
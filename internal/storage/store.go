@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"log"
+	"time"
+)
+
+// UserStore 用户数据存储接口
+type UserStore interface {
+	CreateUser(username, email, password string) (*User, error)
+	GetUserByUsername(username string) (*User, error)
+	GetUserByID(id int) (*User, error)
+	ValidateUser(username, password string) (*User, error)
+	UserExists(username, email string) (bool, error)
+	UpdateUserLastLogin(userID int) error
+	GetAllUsers() ([]User, error)
+	SetDefaultPersona(userID int, personaID *int) error
+	SetShowReasoning(userID int, show bool) error
+}
+
+// PersonaStore 角色存储接口
+type PersonaStore interface {
+	CreatePersona(p Persona) (*Persona, error)
+	UpdatePersona(p Persona) (*Persona, error)
+	DeletePersona(id int) error
+	GetPersona(id int) (*Persona, error)
+	ListPersonas() ([]Persona, error)
+}
+
+// TemplateStore 提示词模板存储接口
+type TemplateStore interface {
+	CreateTemplate(t PromptTemplate) (*PromptTemplate, error)
+	UpdateTemplate(t PromptTemplate, newVersion bool) (*PromptTemplate, error)
+	DeleteTemplate(id int) error
+	GetTemplate(id int) (*PromptTemplate, error)
+	ListTemplates(userID int) ([]PromptTemplate, error)
+	GetTemplateVersion(templateID, version int) (*TemplateVersion, error)
+	ListTemplateVersions(templateID int) ([]TemplateVersion, error)
+
+	// 共享
+	ShareTemplate(templateID, userID int) error
+	UnshareTemplate(templateID, userID int) error
+	TemplateSharedWith(templateID, userID int) (bool, error)
+	ListTemplateShares(templateID int) ([]TemplateShare, error)
+}
+
+// UploadStore 上传文件元数据存储接口（文件内容由调用方保存在磁盘上）
+type UploadStore interface {
+	CreateUpload(u Upload, owner RecordOwner, quota int64) (*Upload, error)
+	GetUpload(id int) (*Upload, error)
+	DeleteUpload(id int) error
+}
+
+// ArenaStore 模型竞技场对比、结果和投票存储接口
+type ArenaStore interface {
+	CreateComparison(c ArenaComparison, owner RecordOwner) (*ArenaComparison, error)
+	FinishArenaEntry(entry ArenaEntry) error
+	GetComparison(id int) (*ArenaComparison, error)
+	VoteComparison(comparisonID int, userID *int, winner string) error
+	ListArenaMatches() ([]ArenaMatch, error)
+	ArenaModelStats() ([]ArenaModelStats, error)
+}
+
+// MemoryStore 用户长期记忆存储接口
+type MemoryStore interface {
+	CreateMemory(m UserMemory, limit int) (*UserMemory, error)
+	UpdateMemory(id int, content, model string, vector []float32) (*UserMemory, error)
+	DeleteMemory(id int) error
+	DeleteUserMemories(userID int) (int, error)
+	GetMemory(id int) (*UserMemory, error)
+	ListMemories(userID int) ([]UserMemory, error)
+	RelevantMemories(userID int, queryText, model string, limit int, embed func(text string) ([]float32, error)) ([]UserMemory, error)
+}
+
+// RecordStore 问答记录及其关联数据（分享链接、向量）存储接口
+type RecordStore interface {
+	SaveQuestion(question string, owner RecordOwner, provider, model string) (int, error)
+	CreateQuestion(q NewQuestion) (int, error)
+	GetRecordThread(recordID int, maxTurns int) ([]QARecord, error)
+	GetThreadSinceSummary(recordID int, maxTurns int) ([]QARecord, *Conversation, error)
+	UpdateStatus(id int, status string) error
+	FinishRecord(id int, result RecordResult) error
+	UpdateVisibility(id int, visibility string) error
+	GetRecord(id int) (*QARecord, error)
+	GetAllRecords() ([]QARecord, error)
+	GetRecordsByUserID(userID int) ([]QARecord, error)
+	ListRecords(q RecordQuery) (*RecordPage, error)
+
+	// 候选答案
+	ListCandidates(recordID int) ([]Candidate, error)
+	SetPreferredCandidate(recordID, index int, owner RecordOwner) error
+	ListCandidatePreferences(q FeedbackQuery) ([]CandidatePreferenceItem, error)
+
+	// 版本与会话树
+	ListRecordVersions(recordID int) ([]QARecord, error)
+	GetConversationTree(recordID int) ([]QARecord, error)
+
+	// 会话标题与摘要
+	GetConversation(id int) (*Conversation, error)
+	GetConversationByRoot(rootRecordID int) (*Conversation, error)
+	TouchConversation(rootRecordID int) (*Conversation, error)
+	ListConversations(owner RecordOwner, limit, offset int) ([]Conversation, error)
+	SetConversationTitle(id int, title string, overwrite bool) error
+	SetConversationSummary(id int, summary string, throughRecordID int) error
+	FindThreadSummary(recordIDs []int) (*Conversation, error)
+
+	// 答案评价
+	SaveFeedback(f RecordFeedback, owner RecordOwner) (*RecordFeedback, error)
+	GetFeedback(recordID int, owner RecordOwner) (*RecordFeedback, error)
+	FeedbackCounts(recordID int) (FeedbackCounts, error)
+	FeedbackStats(q FeedbackQuery) (*FeedbackStats, error)
+	ListFeedback(q FeedbackQuery) ([]FeedbackItem, error)
+
+	// 分享链接
+	CreateShare(recordID int, scope string, userID *int, expiresAt *time.Time) (*RecordShare, error)
+	GetShareBySlug(slug string) (*RecordShare, error)
+	ListSharesByRecord(recordID int) ([]RecordShare, error)
+	RevokeShare(slug string) error
+	IncrementShareViews(slug string) error
+
+	// 搜索相关
+	SaveEmbedding(recordID int, model string, vector []float32) error
+	SearchRecords(queryText string, queryVector []float32, model string, userID *int, limit int) ([]SearchResult, error)
+	BackfillEmbeddings(model string, batchSize int, embed func(question, answer string) ([]float32, error)) (int, error)
+}
+
+// Store 统一的存储接口，新增的数据表在此扩展
+type Store interface {
+	UserStore
+	RecordStore
+	PersonaStore
+	TemplateStore
+	UploadStore
+	ArenaStore
+	MemoryStore
+
+	// Dialect 返回底层数据库方言（sqlite 或 postgres）
+	Dialect() string
+	Close() error
+}
+
+// SQLStore 基于database/sql的Store实现，SQLite和PostgreSQL共用同一套SQL，
+// 方言差异（占位符、自增ID、时间参数、全文索引）由DB处理
+type SQLStore struct {
+	*QAStorage
+	*UserStorage
+	*PersonaStorage
+	*TemplateStorage
+	*UploadStorage
+	*ArenaStorage
+	*MemoryStorage
+	db *DB
+}
+
+// Open 按DSN打开存储并应用未执行的迁移
+func Open(dsn string) (*SQLStore, error) {
+	db, err := OpenDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := migrator.Up(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	qaStorage, err := NewQAStorage(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	log.Printf("数据库初始化成功 (%s)", db.Dialect())
+	return &SQLStore{
+		QAStorage:       qaStorage,
+		UserStorage:     NewUserStorage(db),
+		PersonaStorage:  NewPersonaStorage(db),
+		TemplateStorage: NewTemplateStorage(db),
+		UploadStorage:   NewUploadStorage(db),
+		ArenaStorage:    NewArenaStorage(db),
+		MemoryStorage:   NewMemoryStorage(db),
+		db:              db,
+	}, nil
+}
+
+// Dialect 返回底层数据库方言
+func (s *SQLStore) Dialect() string {
+	return s.db.Dialect()
+}
+
+// Close 关闭数据库连接
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+var _ Store = (*SQLStore)(nil)
@@ -0,0 +1,1263 @@
+// Package storetest 存储一致性检查：所有storage.Store实现都必须通过的行为用例。
+// 用例只依赖Store接口，并使用带时间戳的唯一数据，可在非空数据库上重复执行。
+package storetest
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-base-web-server/internal/storage"
+)
+
+// Case 一个一致性检查用例
+type Case struct {
+	Name string
+	Run  func(s storage.Store, suffix string) error
+}
+
+// Result 用例执行结果，Err为nil表示通过
+type Result struct {
+	Name     string
+	Err      error
+	Duration time.Duration
+}
+
+// Cases 全部一致性检查用例
+var Cases = []Case{
+	{"users", testUsers},
+	{"records", testRecords},
+	{"record_lifecycle", testRecordLifecycle},
+	{"anonymous_records", testAnonymousRecords},
+	{"record_thread", testRecordThread},
+	{"list_pagination", testListPagination},
+	{"list_time_filter", testListTimeFilter},
+	{"shares", testShares},
+	{"search", testSearch},
+	{"personas", testPersonas},
+	{"templates", testTemplates},
+	{"uploads", testUploads},
+	{"candidates", testCandidates},
+	{"arena", testArena},
+	{"feedback", testFeedback},
+	{"record_versions", testRecordVersions},
+	{"conversations", testConversations},
+	{"memories", testMemories},
+	{"memory_limit", testMemoryLimit},
+}
+
+// Run 依次执行全部用例
+func Run(s storage.Store) []Result {
+	results := make([]Result, 0, len(Cases))
+	for i, c := range Cases {
+		suffix := fmt.Sprintf("%d_%d", time.Now().UnixNano(), i)
+		start := time.Now()
+		err := c.Run(s, suffix)
+		results = append(results, Result{Name: c.Name, Err: err, Duration: time.Since(start)})
+	}
+	return results
+}
+
+// createUser 创建测试用户并返回
+func createUser(s storage.Store, suffix string) (*storage.User, error) {
+	user, err := s.CreateUser("user_"+suffix, suffix+"@storetest.local", "password123")
+	if err != nil {
+		return nil, fmt.Errorf("CreateUser: %v", err)
+	}
+	return user, nil
+}
+
+// getRecord 查询记录，错误信息带上记录ID
+func getRecord(s storage.Store, id int) (*storage.QARecord, error) {
+	record, err := s.GetRecord(id)
+	if err != nil {
+		return nil, fmt.Errorf("GetRecord(%d): %v", id, err)
+	}
+	return record, nil
+}
+
+// listRecords 分页查询记录
+func listRecords(s storage.Store, q storage.RecordQuery) (*storage.RecordPage, error) {
+	page, err := s.ListRecords(q)
+	if err != nil {
+		return nil, fmt.Errorf("ListRecords: %v", err)
+	}
+	return page, nil
+}
+
+// completed 构造正常完成的生成结果
+func completed(answer string) storage.RecordResult {
+	return storage.RecordResult{
+		Status:       storage.RecordStatusCompleted,
+		Answer:       answer,
+		FinishReason: "stop",
+		Latency:      1500 * time.Millisecond,
+	}
+}
+
+func testUsers(s storage.Store, suffix string) error {
+	user, err := createUser(s, suffix)
+	if err != nil {
+		return err
+	}
+	if user.ID == 0 || user.Username != "user_"+suffix || user.IsAdmin || !user.IsActive {
+		return fmt.Errorf("新建用户字段不正确: %+v", user)
+	}
+
+	if _, err := s.CreateUser("user_"+suffix, "other_"+suffix+"@storetest.local", "password123"); err == nil {
+		return fmt.Errorf("重复用户名应创建失败")
+	}
+
+	byName, err := s.GetUserByUsername("user_" + suffix)
+	if err != nil || byName.ID != user.ID {
+		return fmt.Errorf("GetUserByUsername: %v, %+v", err, byName)
+	}
+
+	byID, err := s.GetUserByID(user.ID)
+	if err != nil {
+		return fmt.Errorf("GetUserByID: %v", err)
+	}
+	if byID.Email != suffix+"@storetest.local" || !byID.ShowReasoning {
+		return fmt.Errorf("GetUserByID返回不正确: %+v", byID)
+	}
+
+	if err := s.SetShowReasoning(user.ID, false); err != nil {
+		return fmt.Errorf("SetShowReasoning: %v", err)
+	}
+	byName, err = s.GetUserByUsername("user_" + suffix)
+	if err != nil || byName.ShowReasoning {
+		return fmt.Errorf("关闭思考过程显示后偏好不正确: %v, %+v", err, byName)
+	}
+
+	if _, err := s.ValidateUser("user_"+suffix, "password123"); err != nil {
+		return fmt.Errorf("ValidateUser正确密码: %v", err)
+	}
+	if _, err := s.ValidateUser("user_"+suffix, "wrong"); err == nil {
+		return fmt.Errorf("ValidateUser错误密码应失败")
+	}
+
+	exists, err := s.UserExists("nobody_"+suffix, suffix+"@storetest.local")
+	if err != nil || !exists {
+		return fmt.Errorf("UserExists按邮箱应返回true: %v, %v", exists, err)
+	}
+
+	if err := s.UpdateUserLastLogin(user.ID); err != nil {
+		return fmt.Errorf("UpdateUserLastLogin: %v", err)
+	}
+	return nil
+}
+
+func testRecords(s storage.Store, suffix string) error {
+	user, err := createUser(s, suffix)
+	if err != nil {
+		return err
+	}
+
+	id, err := s.SaveQuestion("question "+suffix, storage.RecordOwner{UserID: &user.ID}, "mock", "mock-model")
+	if err != nil {
+		return fmt.Errorf("SaveQuestion: %v", err)
+	}
+	if err := s.FinishRecord(id, completed("answer "+suffix)); err != nil {
+		return fmt.Errorf("FinishRecord: %v", err)
+	}
+	if err := s.UpdateVisibility(id, storage.VisibilityPublic); err != nil {
+		return fmt.Errorf("UpdateVisibility: %v", err)
+	}
+
+	record, err := getRecord(s, id)
+	if err != nil {
+		return err
+	}
+	if record.Answer != "answer "+suffix || record.UserID == nil || *record.UserID != user.ID ||
+		record.Provider != "mock" || record.Model != "mock-model" || record.Visibility != storage.VisibilityPublic {
+		return fmt.Errorf("记录字段不正确: %+v", record)
+	}
+	if record.Status != storage.RecordStatusCompleted || record.FinishReason != "stop" || record.LatencyMs != 1500 {
+		return fmt.Errorf("完成后的记录状态不正确: %+v", record)
+	}
+	if record.CreatedAt.IsZero() {
+		return fmt.Errorf("记录缺少创建时间")
+	}
+
+	if err := s.FinishRecord(-1, completed("x")); err != sql.ErrNoRows {
+		return fmt.Errorf("更新不存在的记录应返回sql.ErrNoRows，实际%v", err)
+	}
+	if _, err := s.GetRecord(-1); err == nil {
+		return fmt.Errorf("查询不存在的记录应失败")
+	}
+	return nil
+}
+
+func testRecordLifecycle(s storage.Store, suffix string) error {
+	id, err := s.SaveQuestion("lifecycle "+suffix, storage.RecordOwner{}, "mock", "mock-model")
+	if err != nil {
+		return fmt.Errorf("SaveQuestion: %v", err)
+	}
+
+	record, err := getRecord(s, id)
+	if err != nil {
+		return err
+	}
+	if record.Status != storage.RecordStatusPending {
+		return fmt.Errorf("新记录状态应为pending，实际为%s", record.Status)
+	}
+
+	if err := s.UpdateStatus(id, storage.RecordStatusStreaming); err != nil {
+		return fmt.Errorf("UpdateStatus: %v", err)
+	}
+	if err := s.UpdateStatus(id, storage.RecordStatusCompleted); err == nil {
+		return fmt.Errorf("UpdateStatus不应接受终止状态")
+	}
+
+	cancelled := storage.RecordResult{
+		Status:    storage.RecordStatusCancelled,
+		Answer:    "partial " + suffix,
+		Reasoning: "thinking " + suffix,
+		Error:     "客户端断开连接",
+		Latency:   300 * time.Millisecond,
+	}
+	if err := s.FinishRecord(id, cancelled); err != nil {
+		return fmt.Errorf("FinishRecord: %v", err)
+	}
+
+	record, err = getRecord(s, id)
+	if err != nil {
+		return err
+	}
+	if record.Status != storage.RecordStatusCancelled || record.Answer != "partial "+suffix || record.Reasoning != "thinking "+suffix ||
+		record.Error != "客户端断开连接" || record.LatencyMs != 300 {
+		return fmt.Errorf("取消后的记录字段不正确: %+v", record)
+	}
+
+	// 已结束的记录不能被覆盖
+	if err := s.FinishRecord(id, completed("late")); err != storage.ErrRecordFinished {
+		return fmt.Errorf("重复结束应返回ErrRecordFinished，实际%v", err)
+	}
+	if err := s.UpdateStatus(id, storage.RecordStatusStreaming); err != storage.ErrRecordFinished {
+		return fmt.Errorf("已结束记录更新状态应返回ErrRecordFinished，实际%v", err)
+	}
+
+	record, err = getRecord(s, id)
+	if err != nil {
+		return err
+	}
+	if record.FinishReason != "" || record.Answer != "partial "+suffix {
+		return fmt.Errorf("已结束的记录被覆盖: %+v", record)
+	}
+	return nil
+}
+
+func testAnonymousRecords(s storage.Store, suffix string) error {
+	token, err := storage.GenerateAnonToken()
+	if err != nil {
+		return err
+	}
+
+	id, err := s.SaveQuestion("anonymous "+suffix, storage.RecordOwner{AnonToken: token}, "mock", "mock-model")
+	if err != nil {
+		return fmt.Errorf("SaveQuestion: %v", err)
+	}
+
+	record, err := getRecord(s, id)
+	if err != nil {
+		return err
+	}
+	if record.UserID != nil || !record.IsOwnedBy(storage.RecordOwner{AnonToken: token}) {
+		return fmt.Errorf("匿名记录归属不正确: %+v", record)
+	}
+	if record.Visibility != storage.VisibilityPrivate {
+		return fmt.Errorf("默认可见性应为private，实际为%s", record.Visibility)
+	}
+
+	page, err := listRecords(s, storage.RecordQuery{AnonToken: token})
+	if err != nil {
+		return err
+	}
+	if page.Total != 1 || len(page.Records) != 1 || page.Records[0].ID != id {
+		return fmt.Errorf("按匿名令牌过滤结果不正确: total=%d", page.Total)
+	}
+	return nil
+}
+
+func testRecordThread(s storage.Store, suffix string) error {
+	owner := storage.RecordOwner{AnonToken: "thread-" + suffix}
+
+	first, err := s.SaveQuestion("thread 1 "+suffix, owner, "mock", "mock-model")
+	if err != nil {
+		return fmt.Errorf("SaveQuestion: %v", err)
+	}
+	ids := []int{first}
+	for i := 2; i <= 3; i++ {
+		id, err := s.CreateQuestion(storage.NewQuestion{
+			Question: fmt.Sprintf("thread %d %s", i, suffix),
+			Owner:    owner,
+			Provider: "mock",
+			Model:    "mock-model",
+			ParentID: &ids[len(ids)-1],
+			Params:   json.RawMessage(`{"temperature":0.5}`),
+		})
+		if err != nil {
+			return fmt.Errorf("CreateQuestion: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	record, err := getRecord(s, ids[2])
+	if err != nil {
+		return err
+	}
+	if record.ParentID == nil || *record.ParentID != ids[1] {
+		return fmt.Errorf("parent_id不正确: %v", record.ParentID)
+	}
+	if string(record.Params) != `{"temperature":0.5}` {
+		return fmt.Errorf("生成参数不正确: %s", record.Params)
+	}
+
+	thread, err := s.GetRecordThread(ids[2], 10)
+	if err != nil {
+		return fmt.Errorf("GetRecordThread: %v", err)
+	}
+	if len(thread) != 3 || thread[0].ID != ids[0] || thread[2].ID != ids[2] {
+		return fmt.Errorf("会话记录顺序不正确: %d条", len(thread))
+	}
+
+	thread, err = s.GetRecordThread(ids[2], 2)
+	if err != nil {
+		return fmt.Errorf("GetRecordThread: %v", err)
+	}
+	if len(thread) != 2 || thread[0].ID != ids[1] {
+		return fmt.Errorf("maxTurns未生效: %d条", len(thread))
+	}
+	return nil
+}
+
+func testListPagination(s storage.Store, suffix string) error {
+	user, err := createUser(s, suffix)
+	if err != nil {
+		return err
+	}
+
+	var ids []int
+	for i := 0; i < 5; i++ {
+		id, err := s.SaveQuestion(fmt.Sprintf("page %s %d", suffix, i), storage.RecordOwner{UserID: &user.ID}, "mock", "mock-model")
+		if err != nil {
+			return fmt.Errorf("SaveQuestion: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	for _, order := range []string{"asc", "desc"} {
+		for _, sortBy := range []string{"created_at", "id"} {
+			q := storage.RecordQuery{UserID: &user.ID, SortBy: sortBy, Order: order, Limit: 2}
+			var seen []int
+			for pages := 0; pages < 5; pages++ {
+				page, err := listRecords(s, q)
+				if err != nil {
+					return err
+				}
+				if page.Total != len(ids) {
+					return fmt.Errorf("%s %s: total=%d，期望%d", sortBy, order, page.Total, len(ids))
+				}
+				for _, r := range page.Records {
+					seen = append(seen, r.ID)
+				}
+				if !page.HasMore {
+					break
+				}
+				q.Cursor = page.NextCursor
+			}
+
+			if len(seen) != len(ids) {
+				return fmt.Errorf("%s %s: 翻页得到%d条记录，期望%d条", sortBy, order, len(seen), len(ids))
+			}
+			for i := range seen {
+				expected := ids[i]
+				if order == "desc" {
+					expected = ids[len(ids)-1-i]
+				}
+				if seen[i] != expected {
+					return fmt.Errorf("%s %s: 第%d条为%d，期望%d", sortBy, order, i, seen[i], expected)
+				}
+			}
+		}
+	}
+
+	answered := true
+	page, err := listRecords(s, storage.RecordQuery{UserID: &user.ID, Answered: &answered})
+	if err != nil {
+		return err
+	}
+	if page.Total != 0 {
+		return fmt.Errorf("未回答的记录不应出现在answered=true结果中")
+	}
+	return nil
+}
+
+func testListTimeFilter(s storage.Store, suffix string) error {
+	user, err := createUser(s, suffix)
+	if err != nil {
+		return err
+	}
+	if _, err := s.SaveQuestion("time "+suffix, storage.RecordOwner{UserID: &user.ID}, "mock", "mock-model"); err != nil {
+		return fmt.Errorf("SaveQuestion: %v", err)
+	}
+
+	now := time.Now()
+	from, to := now.Add(-time.Hour), now.Add(time.Hour)
+	page, err := listRecords(s, storage.RecordQuery{UserID: &user.ID, From: &from, To: &to})
+	if err != nil {
+		return err
+	}
+	if page.Total != 1 {
+		return fmt.Errorf("时间范围内应有1条记录，实际%d条", page.Total)
+	}
+
+	future := now.Add(2 * time.Hour)
+	page, err = listRecords(s, storage.RecordQuery{UserID: &user.ID, From: &to, To: &future})
+	if err != nil {
+		return err
+	}
+	if page.Total != 0 {
+		return fmt.Errorf("未来时间范围内不应有记录，实际%d条", page.Total)
+	}
+	return nil
+}
+
+func testShares(s storage.Store, suffix string) error {
+	user, err := createUser(s, suffix)
+	if err != nil {
+		return err
+	}
+	id, err := s.SaveQuestion("share "+suffix, storage.RecordOwner{UserID: &user.ID}, "mock", "mock-model")
+	if err != nil {
+		return fmt.Errorf("SaveQuestion: %v", err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	share, err := s.CreateShare(id, storage.ShareScopeRecord, &user.ID, &expiresAt)
+	if err != nil {
+		return fmt.Errorf("CreateShare: %v", err)
+	}
+	if share.Slug == "" || share.RecordID != id || share.Scope != storage.ShareScopeRecord || share.ExpiresAt == nil || !share.Active(time.Now()) {
+		return fmt.Errorf("新建分享不正确: %+v", share)
+	}
+	if diff := share.ExpiresAt.Sub(expiresAt); diff > time.Second || diff < -time.Second {
+		return fmt.Errorf("过期时间不一致: %v vs %v", share.ExpiresAt, expiresAt)
+	}
+
+	if err := s.IncrementShareViews(share.Slug); err != nil {
+		return fmt.Errorf("IncrementShareViews: %v", err)
+	}
+	got, err := s.GetShareBySlug(share.Slug)
+	if err != nil {
+		return fmt.Errorf("GetShareBySlug: %v", err)
+	}
+	if got.ViewCount != 1 {
+		return fmt.Errorf("访问次数应为1，实际%d", got.ViewCount)
+	}
+
+	if err := s.RevokeShare(share.Slug); err != nil {
+		return fmt.Errorf("RevokeShare: %v", err)
+	}
+	if err := s.RevokeShare(share.Slug); err != sql.ErrNoRows {
+		return fmt.Errorf("重复撤销应返回sql.ErrNoRows，实际%v", err)
+	}
+
+	shares, err := s.ListSharesByRecord(id)
+	if err != nil {
+		return fmt.Errorf("ListSharesByRecord: %v", err)
+	}
+	if len(shares) != 1 || shares[0].Active(time.Now()) {
+		return fmt.Errorf("撤销后的分享列表不正确: %+v", shares)
+	}
+
+	thread, err := s.CreateShare(id, storage.ShareScopeConversation, nil, nil)
+	if err != nil {
+		return fmt.Errorf("CreateShare(conversation): %v", err)
+	}
+	if thread.Scope != storage.ShareScopeConversation || thread.ExpiresAt != nil || !thread.Active(time.Now()) {
+		return fmt.Errorf("会话分享不正确: %+v", thread)
+	}
+
+	if _, err := s.GetShareBySlug("missing_" + suffix); err != sql.ErrNoRows {
+		return fmt.Errorf("不存在的分享应返回sql.ErrNoRows，实际%v", err)
+	}
+	return nil
+}
+
+func testSearch(s storage.Store, suffix string) error {
+	user, err := createUser(s, suffix)
+	if err != nil {
+		return err
+	}
+
+	keyword := "kw" + suffix
+	id, err := s.SaveQuestion("Searchable "+keyword, storage.RecordOwner{UserID: &user.ID}, "mock", "mock-model")
+	if err != nil {
+		return fmt.Errorf("SaveQuestion: %v", err)
+	}
+	if err := s.FinishRecord(id, completed("answer for "+keyword)); err != nil {
+		return fmt.Errorf("FinishRecord: %v", err)
+	}
+
+	vector := []float32{0.1, 0.2, 0.3, 0.4}
+	if err := s.SaveEmbedding(id, "storetest", vector); err != nil {
+		return fmt.Errorf("SaveEmbedding: %v", err)
+	}
+	if err := s.SaveEmbedding(id, "storetest", vector); err != nil {
+		return fmt.Errorf("重复SaveEmbedding应覆盖: %v", err)
+	}
+
+	hits, err := s.SearchRecords("KW"+suffix, vector, "storetest", &user.ID, 10)
+	if err != nil {
+		return fmt.Errorf("SearchRecords: %v", err)
+	}
+	if len(hits) != 1 || hits[0].ID != id {
+		return fmt.Errorf("搜索结果不正确: %d条", len(hits))
+	}
+	if hits[0].KeywordRank != 1 || hits[0].Similarity < 0.99 {
+		return fmt.Errorf("关键词和语义检索应同时命中: %+v", hits[0])
+	}
+
+	// 未完成的记录和被同一轮更新版本取代的旧版本不出现在搜索结果中
+	if _, err := s.SaveQuestion("Searchable pending "+keyword, storage.RecordOwner{UserID: &user.ID}, "mock", "mock-model"); err != nil {
+		return fmt.Errorf("SaveQuestion: %v", err)
+	}
+	newer, err := s.CreateQuestion(storage.NewQuestion{Question: "Searchable v2 " + keyword, Owner: storage.RecordOwner{UserID: &user.ID}, VersionOf: &id})
+	if err != nil {
+		return fmt.Errorf("CreateQuestion（新版本）: %v", err)
+	}
+	if err := s.FinishRecord(newer, completed("answer v2 for "+keyword)); err != nil {
+		return fmt.Errorf("FinishRecord: %v", err)
+	}
+	hits, err = s.SearchRecords(keyword, vector, "storetest", &user.ID, 10)
+	if err != nil {
+		return fmt.Errorf("SearchRecords: %v", err)
+	}
+	if len(hits) != 1 || hits[0].ID != newer {
+		return fmt.Errorf("应只返回最新的已完成版本: %d条", len(hits))
+	}
+	return nil
+}
+
+func testPersonas(s storage.Store, suffix string) error {
+	persona, err := s.CreatePersona(storage.Persona{
+		Name:         "persona " + suffix,
+		SystemPrompt: "你是一名严谨的编辑",
+		Model:        "mock-model",
+		Params:       json.RawMessage(`{"temperature":0.2}`),
+	})
+	if err != nil {
+		return fmt.Errorf("CreatePersona: %v", err)
+	}
+	if persona.ID == 0 || string(persona.Params) != `{"temperature":0.2}` || persona.Tools != nil {
+		return fmt.Errorf("创建的角色不正确: %+v", persona)
+	}
+	if _, err := s.CreatePersona(storage.Persona{Name: persona.Name}); err != storage.ErrPersonaNameTaken {
+		return fmt.Errorf("重复名称应返回ErrPersonaNameTaken，实际: %v", err)
+	}
+
+	persona.Description = "updated"
+	updated, err := s.UpdatePersona(*persona)
+	if err != nil {
+		return fmt.Errorf("UpdatePersona: %v", err)
+	}
+	if updated.Description != "updated" || updated.SystemPrompt != persona.SystemPrompt {
+		return fmt.Errorf("更新后的角色不正确: %+v", updated)
+	}
+
+	user, err := createUser(s, "persona_"+suffix)
+	if err != nil {
+		return err
+	}
+	if err := s.SetDefaultPersona(user.ID, &persona.ID); err != nil {
+		return fmt.Errorf("SetDefaultPersona: %v", err)
+	}
+	u, err := s.GetUserByID(user.ID)
+	if err != nil {
+		return fmt.Errorf("GetUserByID: %v", err)
+	}
+	if u.DefaultPersonaID == nil || *u.DefaultPersonaID != persona.ID {
+		return fmt.Errorf("默认角色不正确: %v", u.DefaultPersonaID)
+	}
+
+	id, err := s.CreateQuestion(storage.NewQuestion{
+		Question:  "persona " + suffix,
+		Owner:     storage.RecordOwner{UserID: &user.ID},
+		Provider:  "mock",
+		Model:     "mock-model",
+		PersonaID: &persona.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("CreateQuestion: %v", err)
+	}
+	record, err := getRecord(s, id)
+	if err != nil {
+		return err
+	}
+	if record.PersonaID == nil || *record.PersonaID != persona.ID {
+		return fmt.Errorf("记录角色不正确: %v", record.PersonaID)
+	}
+
+	if err := s.DeletePersona(persona.ID); err != nil {
+		return fmt.Errorf("DeletePersona: %v", err)
+	}
+	if _, err := s.GetPersona(persona.ID); err != sql.ErrNoRows {
+		return fmt.Errorf("删除后GetPersona应返回sql.ErrNoRows，实际: %v", err)
+	}
+	if err := s.DeletePersona(persona.ID); err != sql.ErrNoRows {
+		return fmt.Errorf("重复删除应返回sql.ErrNoRows，实际: %v", err)
+	}
+	if record, err = getRecord(s, id); err != nil {
+		return err
+	}
+	if record.PersonaID != nil {
+		return fmt.Errorf("删除角色后记录仍引用角色: %v", *record.PersonaID)
+	}
+	return nil
+}
+
+func testTemplates(s storage.Store, suffix string) error {
+	owner, err := createUser(s, "tpl_owner_"+suffix)
+	if err != nil {
+		return err
+	}
+	other, err := createUser(s, "tpl_other_"+suffix)
+	if err != nil {
+		return err
+	}
+
+	template, err := s.CreateTemplate(storage.PromptTemplate{
+		UserID:    owner.ID,
+		Name:      "summarize " + suffix,
+		Body:      "总结: {{text}}",
+		Variables: json.RawMessage(`[{"name":"text","required":true}]`),
+	})
+	if err != nil {
+		return fmt.Errorf("CreateTemplate: %v", err)
+	}
+	if template.Version != 1 || template.Body != "总结: {{text}}" || template.UserID != owner.ID {
+		return fmt.Errorf("创建的模板不正确: %+v", template)
+	}
+
+	template.Description = "renamed"
+	if template, err = s.UpdateTemplate(*template, false); err != nil {
+		return fmt.Errorf("UpdateTemplate: %v", err)
+	}
+	if template.Version != 1 || template.Description != "renamed" {
+		return fmt.Errorf("只更新名称时不应生成新版本: %+v", template)
+	}
+
+	template.Body = "用{{lang}}总结: {{text}}"
+	if template, err = s.UpdateTemplate(*template, true); err != nil {
+		return fmt.Errorf("UpdateTemplate: %v", err)
+	}
+	if template.Version != 2 || template.Body != "用{{lang}}总结: {{text}}" {
+		return fmt.Errorf("新版本不正确: %+v", template)
+	}
+	first, err := s.GetTemplateVersion(template.ID, 1)
+	if err != nil {
+		return fmt.Errorf("GetTemplateVersion: %v", err)
+	}
+	if first.Body != "总结: {{text}}" {
+		return fmt.Errorf("历史版本被修改: %s", first.Body)
+	}
+	versions, err := s.ListTemplateVersions(template.ID)
+	if err != nil {
+		return fmt.Errorf("ListTemplateVersions: %v", err)
+	}
+	if len(versions) != 2 || versions[0].Version != 2 {
+		return fmt.Errorf("版本列表不正确: %d个", len(versions))
+	}
+
+	templates, err := s.ListTemplates(other.ID)
+	if err != nil {
+		return fmt.Errorf("ListTemplates: %v", err)
+	}
+	if len(templates) != 0 {
+		return fmt.Errorf("未共享的模板不应出现在其他用户的列表中")
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.ShareTemplate(template.ID, other.ID); err != nil {
+			return fmt.Errorf("ShareTemplate: %v", err)
+		}
+	}
+	if templates, err = s.ListTemplates(other.ID); err != nil || len(templates) != 1 {
+		return fmt.Errorf("共享后的模板列表不正确: %d个, %v", len(templates), err)
+	}
+	shares, err := s.ListTemplateShares(template.ID)
+	if err != nil || len(shares) != 1 || shares[0].Username != other.Username {
+		return fmt.Errorf("共享列表不正确: %+v, %v", shares, err)
+	}
+	if err := s.UnshareTemplate(template.ID, other.ID); err != nil {
+		return fmt.Errorf("UnshareTemplate: %v", err)
+	}
+	if shared, err := s.TemplateSharedWith(template.ID, other.ID); err != nil || shared {
+		return fmt.Errorf("取消共享后仍可访问: %v", err)
+	}
+
+	if err := s.DeleteTemplate(template.ID); err != nil {
+		return fmt.Errorf("DeleteTemplate: %v", err)
+	}
+	if _, err := s.GetTemplate(template.ID); err != sql.ErrNoRows {
+		return fmt.Errorf("删除后GetTemplate应返回sql.ErrNoRows，实际: %v", err)
+	}
+	if _, err := s.GetTemplateVersion(template.ID, 1); err != sql.ErrNoRows {
+		return fmt.Errorf("删除后模板版本应一并删除，实际: %v", err)
+	}
+	return nil
+}
+
+func testUploads(s storage.Store, suffix string) error {
+	user, err := createUser(s, "upload_"+suffix)
+	if err != nil {
+		return err
+	}
+	owner := storage.RecordOwner{UserID: &user.ID}
+
+	upload, err := s.CreateUpload(storage.Upload{
+		Filename:    "cat.png",
+		MimeType:    "image/png",
+		Size:        1234,
+		StorageName: "abc" + suffix + ".png",
+	}, owner, 2000)
+	if err != nil {
+		return fmt.Errorf("CreateUpload: %v", err)
+	}
+	if upload.UserID == nil || *upload.UserID != user.ID || upload.MimeType != "image/png" || upload.Size != 1234 {
+		return fmt.Errorf("上传文件元数据不正确: %+v", upload)
+	}
+	if !upload.IsOwnedBy(owner) || upload.IsOwnedBy(storage.RecordOwner{AnonToken: "anon-" + suffix}) {
+		return fmt.Errorf("上传文件归属判断不正确")
+	}
+
+	// 配额按所有者累计已上传文件的大小
+	if _, err := s.CreateUpload(storage.Upload{MimeType: "image/png", Size: 1000, StorageName: "over" + suffix + ".png"}, owner, 2000); err != storage.ErrUploadQuota {
+		return fmt.Errorf("超出配额时应返回ErrUploadQuota，实际: %v", err)
+	}
+
+	anonOwner := storage.RecordOwner{AnonToken: "anon-upload-" + suffix}
+	anonUpload, err := s.CreateUpload(storage.Upload{MimeType: "image/jpeg", Size: 1, StorageName: "anon" + suffix + ".jpg"}, anonOwner, 2000)
+	if err != nil {
+		return fmt.Errorf("CreateUpload(匿名): %v", err)
+	}
+	if anonUpload.UserID != nil || !anonUpload.IsOwnedBy(anonOwner) || anonUpload.IsOwnedBy(owner) {
+		return fmt.Errorf("匿名上传文件归属判断不正确: %+v", anonUpload)
+	}
+
+	if err := s.DeleteUpload(upload.ID); err != nil {
+		return fmt.Errorf("DeleteUpload: %v", err)
+	}
+	if _, err := s.GetUpload(upload.ID); err != sql.ErrNoRows {
+		return fmt.Errorf("删除后GetUpload应返回sql.ErrNoRows，实际: %v", err)
+	}
+	if err := s.DeleteUpload(upload.ID); err != sql.ErrNoRows {
+		return fmt.Errorf("重复删除应返回sql.ErrNoRows，实际: %v", err)
+	}
+	return nil
+}
+
+func testCandidates(s storage.Store, suffix string) error {
+	id, err := s.SaveQuestion("candidates "+suffix, storage.RecordOwner{}, "mock", "mock-model")
+	if err != nil {
+		return fmt.Errorf("SaveQuestion: %v", err)
+	}
+
+	result := completed("first " + suffix)
+	result.Candidates = []storage.Candidate{
+		{Index: 0, Answer: "first " + suffix, FinishReason: "stop"},
+		{Index: 1, Answer: "second " + suffix, Reasoning: "thinking " + suffix, FinishReason: "length"},
+	}
+	if err := s.FinishRecord(id, result); err != nil {
+		return fmt.Errorf("FinishRecord: %v", err)
+	}
+
+	record, err := getRecord(s, id)
+	if err != nil {
+		return err
+	}
+	if record.CandidateCount != 2 || record.PreferredCandidate != nil || record.Answer != "first "+suffix {
+		return fmt.Errorf("多候选记录字段不正确: %+v", record)
+	}
+
+	candidates, err := s.ListCandidates(id)
+	if err != nil {
+		return fmt.Errorf("ListCandidates: %v", err)
+	}
+	if len(candidates) != 2 || candidates[1].Answer != "second "+suffix || candidates[1].FinishReason != "length" || candidates[0].Preferred {
+		return fmt.Errorf("候选答案不正确: %+v", candidates)
+	}
+
+	owner := storage.RecordOwner{AnonToken: "candidates-" + suffix}
+	if err := s.SetPreferredCandidate(id, 1, owner); err != nil {
+		return fmt.Errorf("SetPreferredCandidate: %v", err)
+	}
+	record, err = getRecord(s, id)
+	if err != nil {
+		return err
+	}
+	if record.PreferredCandidate == nil || *record.PreferredCandidate != 1 || record.Answer != "second "+suffix ||
+		record.Reasoning != "thinking "+suffix || record.FinishReason != "length" {
+		return fmt.Errorf("选择首选候选后记录不正确: %+v", record)
+	}
+	if candidates, err := s.ListCandidates(id); err != nil || !candidates[1].Preferred || candidates[0].Preferred {
+		return fmt.Errorf("首选标记不正确: %v, %+v", err, candidates)
+	}
+
+	if err := s.SetPreferredCandidate(id, 5, owner); err != storage.ErrCandidateNotFound {
+		return fmt.Errorf("不存在的候选应返回ErrCandidateNotFound，实际: %v", err)
+	}
+
+	// 每次选择都保留一条偏好记录，最新的在前
+	if err := s.SetPreferredCandidate(id, 0, owner); err != nil {
+		return fmt.Errorf("SetPreferredCandidate（重新选择）: %v", err)
+	}
+	preferences, err := s.ListCandidatePreferences(storage.FeedbackQuery{Model: "mock-model"})
+	if err != nil {
+		return fmt.Errorf("ListCandidatePreferences: %v", err)
+	}
+	var mine []storage.CandidatePreferenceItem
+	for _, p := range preferences {
+		if p.RecordID == id {
+			mine = append(mine, p)
+		}
+	}
+	if len(mine) != 2 || mine[0].Chosen != 0 || len(mine[0].Rejected) != 1 || mine[0].Rejected[0] != 1 ||
+		mine[1].Chosen != 1 || len(mine[1].Rejected) != 1 || mine[1].Rejected[0] != 0 ||
+		mine[0].Question != "candidates "+suffix || mine[0].AnonTokenHash != storage.HashAnonToken(owner.AnonToken) {
+		return fmt.Errorf("候选选择记录不正确: %+v", mine)
+	}
+	return nil
+}
+
+func testArena(s storage.Store, suffix string) error {
+	a, b := "mock/a-"+suffix, "mock/b-"+suffix
+	owner := storage.RecordOwner{AnonToken: "arena-" + suffix}
+	comparison, err := s.CreateComparison(storage.ArenaComparison{
+		Prompt: "arena " + suffix,
+		Entries: []storage.ArenaEntry{
+			{Contestant: a, Provider: "mock", Model: "a-" + suffix},
+			{Contestant: b, Provider: "mock", Model: "b-" + suffix},
+		},
+	}, owner)
+	if err != nil {
+		return fmt.Errorf("CreateComparison: %v", err)
+	}
+	if len(comparison.Entries) != 2 || comparison.Entries[1].Contestant != b || comparison.Entries[0].Status != storage.RecordStatusPending ||
+		comparison.Vote != nil || !comparison.IsOwnedBy(owner) || comparison.IsOwnedBy(storage.RecordOwner{AnonToken: "other"}) {
+		return fmt.Errorf("新建对比不正确: %+v", comparison)
+	}
+
+	err = s.FinishArenaEntry(storage.ArenaEntry{
+		ComparisonID: comparison.ID, Index: 0, Answer: "answer " + suffix, Status: storage.RecordStatusCompleted,
+		FinishReason: "stop", LatencyMs: 120, PromptTokens: 10, CompletionTokens: 20, Cost: 0.5,
+	})
+	if err != nil {
+		return fmt.Errorf("FinishArenaEntry: %v", err)
+	}
+	err = s.FinishArenaEntry(storage.ArenaEntry{ComparisonID: comparison.ID, Index: 1, Status: storage.RecordStatusFailed, Error: "boom"})
+	if err != nil {
+		return fmt.Errorf("FinishArenaEntry: %v", err)
+	}
+
+	if err := s.VoteComparison(comparison.ID, nil, a); err != nil {
+		return fmt.Errorf("VoteComparison: %v", err)
+	}
+	if err := s.VoteComparison(comparison.ID, nil, ""); err != nil {
+		return fmt.Errorf("VoteComparison（重新投票）: %v", err)
+	}
+	comparison, err = s.GetComparison(comparison.ID)
+	if err != nil {
+		return fmt.Errorf("GetComparison: %v", err)
+	}
+	entry := comparison.Entries[0]
+	if entry.Answer != "answer "+suffix || entry.Status != storage.RecordStatusCompleted || entry.LatencyMs != 120 ||
+		entry.CompletionTokens != 20 || entry.Cost != 0.5 || comparison.Entries[1].Error != "boom" {
+		return fmt.Errorf("对比结果不正确: %+v", comparison.Entries)
+	}
+	if comparison.Vote == nil || !comparison.Vote.Tie || comparison.Vote.Winner != "" {
+		return fmt.Errorf("重新投票应覆盖为平局: %+v", comparison.Vote)
+	}
+
+	matches, err := s.ListArenaMatches()
+	if err != nil {
+		return fmt.Errorf("ListArenaMatches: %v", err)
+	}
+	found := false
+	for _, match := range matches {
+		if match.ComparisonID == comparison.ID {
+			found = len(match.Contestants) == 2 && match.Contestants[0] == a && match.Winner == ""
+		}
+	}
+	if !found {
+		return fmt.Errorf("已投票对比未出现在ListArenaMatches中")
+	}
+
+	stats, err := s.ArenaModelStats()
+	if err != nil {
+		return fmt.Errorf("ArenaModelStats: %v", err)
+	}
+	for _, stat := range stats {
+		if stat.Contestant == b {
+			return fmt.Errorf("失败的结果不应计入统计: %+v", stat)
+		}
+		if stat.Contestant == a && (stat.Entries != 1 || stat.AvgLatencyMs != 120 || stat.CompletionTokens != 20) {
+			return fmt.Errorf("模型统计不正确: %+v", stat)
+		}
+	}
+
+	if _, err := s.GetComparison(comparison.ID + 1000000); err != sql.ErrNoRows {
+		return fmt.Errorf("不存在的对比应返回sql.ErrNoRows，实际: %v", err)
+	}
+	return nil
+}
+
+func testFeedback(s storage.Store, suffix string) error {
+	model := "feedback-model-" + suffix
+	id, err := s.SaveQuestion("feedback "+suffix, storage.RecordOwner{}, "mock", model)
+	if err != nil {
+		return fmt.Errorf("SaveQuestion: %v", err)
+	}
+	if err := s.FinishRecord(id, completed("answer "+suffix)); err != nil {
+		return fmt.Errorf("FinishRecord: %v", err)
+	}
+
+	user, err := createUser(s, suffix)
+	if err != nil {
+		return err
+	}
+	userOwner := storage.RecordOwner{UserID: &user.ID}
+	anonOwner := storage.RecordOwner{AnonToken: "feedback-" + suffix}
+
+	if _, err := s.GetFeedback(id, userOwner); err != sql.ErrNoRows {
+		return fmt.Errorf("未评价时应返回sql.ErrNoRows，实际: %v", err)
+	}
+	if _, err := s.SaveFeedback(storage.RecordFeedback{RecordID: id, Rating: storage.FeedbackUp}, userOwner); err != nil {
+		return fmt.Errorf("SaveFeedback: %v", err)
+	}
+	// 重复评价覆盖之前的结果
+	feedback, err := s.SaveFeedback(storage.RecordFeedback{
+		RecordID: id, Rating: storage.FeedbackDown, Categories: []string{"incorrect", "unhelpful"}, Comment: "wrong " + suffix,
+	}, userOwner)
+	if err != nil {
+		return fmt.Errorf("SaveFeedback（覆盖）: %v", err)
+	}
+	if feedback.Rating != storage.FeedbackDown || len(feedback.Categories) != 2 || feedback.UserID == nil || *feedback.UserID != user.ID {
+		return fmt.Errorf("覆盖后的评价不正确: %+v", feedback)
+	}
+	if _, err := s.SaveFeedback(storage.RecordFeedback{RecordID: id, Rating: storage.FeedbackUp}, anonOwner); err != nil {
+		return fmt.Errorf("SaveFeedback（匿名）: %v", err)
+	}
+
+	counts, err := s.FeedbackCounts(id)
+	if err != nil {
+		return fmt.Errorf("FeedbackCounts: %v", err)
+	}
+	if counts.Up != 1 || counts.Down != 1 {
+		return fmt.Errorf("评价数量不正确: %+v", counts)
+	}
+	if mine, err := s.GetFeedback(id, anonOwner); err != nil || mine.Rating != storage.FeedbackUp {
+		return fmt.Errorf("GetFeedback（匿名）: %v, %+v", err, mine)
+	}
+
+	stats, err := s.FeedbackStats(storage.FeedbackQuery{Model: model})
+	if err != nil {
+		return fmt.Errorf("FeedbackStats: %v", err)
+	}
+	if stats.Total != 2 || stats.Down != 1 || stats.Categories["incorrect"] != 1 || stats.Categories["harmful"] != 0 ||
+		len(stats.Models) != 1 || stats.Models[0].DownRate != 0.5 {
+		return fmt.Errorf("评价汇总不正确: %+v", stats)
+	}
+
+	items, err := s.ListFeedback(storage.FeedbackQuery{Rating: storage.FeedbackDown, Category: "unhelpful", Model: model, Limit: 10})
+	if err != nil {
+		return fmt.Errorf("ListFeedback: %v", err)
+	}
+	if len(items) != 1 || items[0].Question != "feedback "+suffix || items[0].Answer != "answer "+suffix || items[0].Comment != "wrong "+suffix {
+		return fmt.Errorf("导出的评价不正确: %+v", items)
+	}
+	if items, err := s.ListFeedback(storage.FeedbackQuery{Category: "harmful", Model: model}); err != nil || len(items) != 0 {
+		return fmt.Errorf("按问题类型过滤不正确: %v, %+v", err, items)
+	}
+	return nil
+}
+
+func testRecordVersions(s storage.Store, suffix string) error {
+	owner := storage.RecordOwner{AnonToken: "versions-" + suffix}
+	first, err := s.CreateQuestion(storage.NewQuestion{Question: "q1 " + suffix, Owner: owner, Provider: "mock", Model: "mock-model"})
+	if err != nil {
+		return fmt.Errorf("CreateQuestion: %v", err)
+	}
+	second, err := s.CreateQuestion(storage.NewQuestion{Question: "q2 " + suffix, Owner: owner, Provider: "mock", Model: "mock-model", ParentID: &first})
+	if err != nil {
+		return fmt.Errorf("CreateQuestion: %v", err)
+	}
+
+	// 重新生成第二轮，再编辑第一轮（开始新的分支）
+	regenerated, err := s.CreateQuestion(storage.NewQuestion{Question: "q2 " + suffix, Owner: owner, ParentID: &first, VersionOf: &second})
+	if err != nil {
+		return fmt.Errorf("CreateQuestion（重新生成）: %v", err)
+	}
+	edited, err := s.CreateQuestion(storage.NewQuestion{Question: "q1 edited " + suffix, Owner: owner, VersionOf: &first})
+	if err != nil {
+		return fmt.Errorf("CreateQuestion（编辑）: %v", err)
+	}
+	branch, err := s.CreateQuestion(storage.NewQuestion{Question: "q2 branch " + suffix, Owner: owner, ParentID: &edited})
+	if err != nil {
+		return fmt.Errorf("CreateQuestion: %v", err)
+	}
+
+	record, err := getRecord(s, regenerated)
+	if err != nil {
+		return err
+	}
+	if record.VersionOf == nil || *record.VersionOf != second || record.Version != 2 || record.ParentID == nil || *record.ParentID != first {
+		return fmt.Errorf("新版本记录字段不正确: %+v", record)
+	}
+	if record, err := getRecord(s, second); err != nil || record.VersionOf != nil || record.Version != 1 {
+		return fmt.Errorf("第一个版本字段不正确: %v, %+v", err, record)
+	}
+
+	versions, err := s.ListRecordVersions(regenerated)
+	if err != nil {
+		return fmt.Errorf("ListRecordVersions: %v", err)
+	}
+	if len(versions) != 2 || versions[0].ID != second || versions[1].ID != regenerated {
+		return fmt.Errorf("版本列表不正确: %+v", versions)
+	}
+
+	tree, err := s.GetConversationTree(branch)
+	if err != nil {
+		return fmt.Errorf("GetConversationTree: %v", err)
+	}
+	ids := make(map[int]bool)
+	for _, record := range tree {
+		ids[record.ID] = true
+	}
+	if len(tree) != 5 || !ids[first] || !ids[second] || !ids[regenerated] || !ids[edited] || !ids[branch] {
+		return fmt.Errorf("会话树不正确: %d 条记录", len(tree))
+	}
+	return nil
+}
+
+func testConversations(s storage.Store, suffix string) error {
+	owner := storage.RecordOwner{AnonToken: "conversations-" + suffix}
+	first, err := s.CreateQuestion(storage.NewQuestion{Question: "q1 " + suffix, Owner: owner, Provider: "mock", Model: "mock-model"})
+	if err != nil {
+		return fmt.Errorf("CreateQuestion: %v", err)
+	}
+	second, err := s.CreateQuestion(storage.NewQuestion{Question: "q2 " + suffix, Owner: owner, Provider: "mock", Model: "mock-model", ParentID: &first})
+	if err != nil {
+		return fmt.Errorf("CreateQuestion: %v", err)
+	}
+	// 第一轮的新版本属于同一会话，不创建新会话
+	if _, err := s.CreateQuestion(storage.NewQuestion{Question: "q1 edited " + suffix, Owner: owner, VersionOf: &first}); err != nil {
+		return fmt.Errorf("CreateQuestion（编辑）: %v", err)
+	}
+
+	conversation, err := s.GetConversationByRoot(first)
+	if err != nil {
+		return fmt.Errorf("GetConversationByRoot: %v", err)
+	}
+	if conversation.Question != "q1 "+suffix || conversation.Title != "" || !conversation.IsOwnedBy(owner) {
+		return fmt.Errorf("会话字段不正确: %+v", conversation)
+	}
+	if _, err := s.GetConversationByRoot(second); err != sql.ErrNoRows {
+		return fmt.Errorf("追问不应创建会话: %v", err)
+	}
+
+	// 自动生成的标题不覆盖已有标题
+	if err := s.SetConversationTitle(conversation.ID, "auto "+suffix, false); err != nil {
+		return fmt.Errorf("SetConversationTitle: %v", err)
+	}
+	if err := s.SetConversationTitle(conversation.ID, "auto again "+suffix, false); err != nil {
+		return fmt.Errorf("SetConversationTitle: %v", err)
+	}
+	if err := s.SetConversationTitle(-1, "missing", true); err != sql.ErrNoRows {
+		return fmt.Errorf("不存在的会话应返回sql.ErrNoRows: %v", err)
+	}
+	touched, err := s.TouchConversation(first)
+	if err != nil {
+		return fmt.Errorf("TouchConversation: %v", err)
+	}
+	if touched.ID != conversation.ID || touched.Title != "auto "+suffix {
+		return fmt.Errorf("会话标题不正确: %+v", touched)
+	}
+
+	if _, err := s.FindThreadSummary([]int{first, second}); err != sql.ErrNoRows {
+		return fmt.Errorf("没有摘要时应返回sql.ErrNoRows: %v", err)
+	}
+	third, err := s.CreateQuestion(storage.NewQuestion{Question: "q3 " + suffix, Owner: owner, Provider: "mock", Model: "mock-model", ParentID: &second})
+	if err != nil {
+		return fmt.Errorf("CreateQuestion: %v", err)
+	}
+	thread, summarized, err := s.GetThreadSinceSummary(third, 10)
+	if err != nil {
+		return fmt.Errorf("GetThreadSinceSummary: %v", err)
+	}
+	if summarized != nil || len(thread) != 3 || thread[0].ID != first {
+		return fmt.Errorf("没有摘要时应返回整个分支: %d条, %+v", len(thread), summarized)
+	}
+	if err := s.SetConversationSummary(conversation.ID, "summary "+suffix, first); err != nil {
+		return fmt.Errorf("SetConversationSummary: %v", err)
+	}
+	found, err := s.FindThreadSummary([]int{first, second})
+	if err != nil {
+		return fmt.Errorf("FindThreadSummary: %v", err)
+	}
+	if found.ID != conversation.ID || found.Summary != "summary "+suffix || found.SummaryRecordID == nil || *found.SummaryRecordID != first {
+		return fmt.Errorf("会话摘要不正确: %+v", found)
+	}
+	// 摘要覆盖点超出maxTurns时仍能找到摘要，只返回覆盖点之后的最近maxTurns轮
+	thread, summarized, err = s.GetThreadSinceSummary(third, 1)
+	if err != nil {
+		return fmt.Errorf("GetThreadSinceSummary: %v", err)
+	}
+	if summarized == nil || summarized.ID != conversation.ID || len(thread) != 1 || thread[0].ID != third {
+		return fmt.Errorf("摘要覆盖点之后的记录不正确: %d条, %+v", len(thread), summarized)
+	}
+	thread, _, err = s.GetThreadSinceSummary(third, 10)
+	if err != nil || len(thread) != 2 || thread[0].ID != second {
+		return fmt.Errorf("应从摘要覆盖点之后开始: %v, %d条", err, len(thread))
+	}
+
+	conversations, err := s.ListConversations(owner, 10, 0)
+	if err != nil {
+		return fmt.Errorf("ListConversations: %v", err)
+	}
+	if len(conversations) != 1 || conversations[0].ID != conversation.ID {
+		return fmt.Errorf("会话列表不正确: %+v", conversations)
+	}
+	other, err := s.ListConversations(storage.RecordOwner{AnonToken: "other-" + suffix}, 10, 0)
+	if err != nil || len(other) != 0 {
+		return fmt.Errorf("其他会话不应看到该会话: %v, %d", err, len(other))
+	}
+	return nil
+}
+
+func testMemories(s storage.Store, suffix string) error {
+	user, err := createUser(s, "memory_"+suffix)
+	if err != nil {
+		return err
+	}
+	id, err := s.SaveQuestion("memories "+suffix, storage.RecordOwner{UserID: &user.ID}, "mock", "mock-model")
+	if err != nil {
+		return fmt.Errorf("SaveQuestion: %v", err)
+	}
+
+	withVector, err := s.CreateMemory(storage.UserMemory{
+		UserID: user.ID, Content: "用户主要使用Go " + suffix, SourceRecordID: &id,
+		EmbeddingModel: "mock-embed", Embedding: []float32{1, 0},
+	}, 2)
+	if err != nil {
+		return fmt.Errorf("CreateMemory: %v", err)
+	}
+	if withVector.UserID != user.ID || withVector.SourceRecordID == nil || *withVector.SourceRecordID != id ||
+		withVector.EmbeddingModel != "mock-embed" || len(withVector.Embedding) != 2 || withVector.Embedding[0] != 1 {
+		return fmt.Errorf("新建记忆不正确: %+v", withVector)
+	}
+	plain, err := s.CreateMemory(storage.UserMemory{UserID: user.ID, Content: "用户喜欢简洁的回答 " + suffix}, 2)
+	if err != nil {
+		return fmt.Errorf("CreateMemory(无向量): %v", err)
+	}
+	if plain.SourceRecordID != nil || len(plain.Embedding) != 0 {
+		return fmt.Errorf("无向量的记忆不正确: %+v", plain)
+	}
+	if _, err := s.CreateMemory(storage.UserMemory{UserID: user.ID, Content: "超出上限 " + suffix}, 2); err != storage.ErrMemoryLimit {
+		return fmt.Errorf("达到上限时应返回ErrMemoryLimit，实际: %v", err)
+	}
+
+	// 不超过limit时全部返回，超过时按相关度排序
+	relevant, err := s.RelevantMemories(user.ID, "anything", "mock-embed", 5, nil)
+	if err != nil || len(relevant) != 2 {
+		return fmt.Errorf("RelevantMemories(全部): %v, %d", err, len(relevant))
+	}
+	relevant, err = s.RelevantMemories(user.ID, "怎样让回答更简洁", "mock-embed", 1, nil)
+	if err != nil || len(relevant) != 1 || relevant[0].ID != plain.ID {
+		return fmt.Errorf("RelevantMemories(字符匹配)不正确: %v, %+v", err, relevant)
+	}
+	relevant, err = s.RelevantMemories(user.ID, "怎样让回答更简洁", "mock-embed", 1, func(string) ([]float32, error) {
+		return []float32{0.9, 0.1}, nil
+	})
+	if err != nil || len(relevant) != 1 || relevant[0].ID != withVector.ID {
+		return fmt.Errorf("RelevantMemories(向量)不正确: %v, %+v", err, relevant)
+	}
+
+	updated, err := s.UpdateMemory(withVector.ID, "用户主要使用Rust "+suffix, "", nil)
+	if err != nil {
+		return fmt.Errorf("UpdateMemory: %v", err)
+	}
+	if updated.Content != "用户主要使用Rust "+suffix || updated.EmbeddingModel != "" || len(updated.Embedding) != 0 {
+		return fmt.Errorf("修改后的记忆不正确: %+v", updated)
+	}
+	if _, err := s.UpdateMemory(plain.ID+1000000, "x", "", nil); err != sql.ErrNoRows {
+		return fmt.Errorf("修改不存在的记忆应返回sql.ErrNoRows，实际: %v", err)
+	}
+
+	other, err := createUser(s, "memory_other_"+suffix)
+	if err != nil {
+		return err
+	}
+	if memories, err := s.ListMemories(other.ID); err != nil || len(memories) != 0 {
+		return fmt.Errorf("其他用户不应看到该记忆: %v, %d", err, len(memories))
+	}
+
+	if err := s.DeleteMemory(plain.ID); err != nil {
+		return fmt.Errorf("DeleteMemory: %v", err)
+	}
+	if err := s.DeleteMemory(plain.ID); err != sql.ErrNoRows {
+		return fmt.Errorf("重复删除应返回sql.ErrNoRows，实际: %v", err)
+	}
+	deleted, err := s.DeleteUserMemories(user.ID)
+	if err != nil || deleted != 1 {
+		return fmt.Errorf("DeleteUserMemories: %v, %d", err, deleted)
+	}
+	if memories, err := s.ListMemories(user.ID); err != nil || len(memories) != 0 {
+		return fmt.Errorf("清空后仍有记忆: %v, %d", err, len(memories))
+	}
+	return nil
+}
+
+func testMemoryLimit(s storage.Store, suffix string) error {
+	user, err := createUser(s, "memory_limit_"+suffix)
+	if err != nil {
+		return err
+	}
+
+	// 并发写入同一用户的记忆，总数不超过上限
+	const limit, writers = 3, 8
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := s.CreateMemory(storage.UserMemory{UserID: user.ID, Content: fmt.Sprintf("记忆%d %s", i, suffix)}, limit)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	created, limited := 0, 0
+	for err := range errs {
+		switch err {
+		case nil:
+			created++
+		case storage.ErrMemoryLimit:
+			limited++
+		default:
+			return fmt.Errorf("CreateMemory: %v", err)
+		}
+	}
+	memories, err := s.ListMemories(user.ID)
+	if err != nil {
+		return fmt.Errorf("ListMemories: %v", err)
+	}
+	if created != limit || limited != writers-limit || len(memories) != limit {
+		return fmt.Errorf("并发写入后记忆数量不正确: 成功%d, 超限%d, 保存%d", created, limited, len(memories))
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+)
+
+// templateColumns 模板及其当前版本的查询字段（t为模板表，v为版本表）
+const templateColumns = `t.id, t.user_id, t.name, t.description, t.current_version, v.body, v.system_prompt, v.variables, t.created_at, t.updated_at`
+
+// templateVersionColumns 模板版本查询字段
+const templateVersionColumns = `template_id, version, body, system_prompt, variables, created_at`
+
+// TemplateStorage 提示词模板数据库操作
+type TemplateStorage struct {
+	db *DB
+}
+
+// NewTemplateStorage 创建提示词模板存储实例
+func NewTemplateStorage(db *DB) *TemplateStorage {
+	return &TemplateStorage{db: db}
+}
+
+// CreateTemplate 创建模板及其第1个版本
+func (ts *TemplateStorage) CreateTemplate(t PromptTemplate) (*PromptTemplate, error) {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	id, err := tx.InsertID(`INSERT INTO prompt_templates (user_id, name, description, current_version) VALUES (?, ?, ?, 1)`,
+		t.UserID, t.Name, t.Description)
+	if err != nil {
+		log.Printf("创建模板失败: %v", err)
+		return nil, err
+	}
+	if _, err := tx.Exec(`INSERT INTO prompt_template_versions (template_id, version, body, system_prompt, variables) VALUES (?, 1, ?, ?, ?)`,
+		id, t.Body, t.SystemPrompt, string(t.Variables)); err != nil {
+		log.Printf("保存模板版本失败: %v", err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("模板创建成功: %s (ID: %d)", t.Name, id)
+	return ts.GetTemplate(id)
+}
+
+// UpdateTemplate 更新模板名称和描述；newVersion为true时以t的内容保存为新版本并设为当前版本。
+// 模板不存在时返回sql.ErrNoRows
+func (ts *TemplateStorage) UpdateTemplate(t PromptTemplate, newVersion bool) (*PromptTemplate, error) {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRow(`SELECT current_version FROM prompt_templates WHERE id = ?`, t.ID).Scan(&version); err != nil {
+		return nil, err
+	}
+	if newVersion {
+		version++
+		if _, err := tx.Exec(`INSERT INTO prompt_template_versions (template_id, version, body, system_prompt, variables) VALUES (?, ?, ?, ?, ?)`,
+			t.ID, version, t.Body, t.SystemPrompt, string(t.Variables)); err != nil {
+			log.Printf("保存模板版本失败: %v", err)
+			return nil, err
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE prompt_templates SET name = ?, description = ?, current_version = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		t.Name, t.Description, version, t.ID); err != nil {
+		log.Printf("更新模板失败: %v", err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ts.GetTemplate(t.ID)
+}
+
+// DeleteTemplate 删除模板及其全部版本和共享，模板不存在时返回sql.ErrNoRows
+func (ts *TemplateStorage) DeleteTemplate(id int) error {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM prompt_template_shares WHERE template_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM prompt_template_versions WHERE template_id = ?`, id); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`DELETE FROM prompt_templates WHERE id = ?`, id)
+	if err != nil {
+		log.Printf("删除模板失败: %v", err)
+		return err
+	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// GetTemplate 根据ID获取模板（内容为当前版本）
+func (ts *TemplateStorage) GetTemplate(id int) (*PromptTemplate, error) {
+	query := `SELECT ` + templateColumns + ` FROM prompt_templates t
+	JOIN prompt_template_versions v ON v.template_id = t.id AND v.version = t.current_version
+	WHERE t.id = ?`
+	return scanTemplate(ts.db.QueryRow(query, id))
+}
+
+// ListTemplates 获取用户拥有的和共享给用户的模板，按更新时间倒序
+func (ts *TemplateStorage) ListTemplates(userID int) ([]PromptTemplate, error) {
+	query := `SELECT ` + templateColumns + ` FROM prompt_templates t
+	JOIN prompt_template_versions v ON v.template_id = t.id AND v.version = t.current_version
+	WHERE t.user_id = ? OR t.id IN (SELECT template_id FROM prompt_template_shares WHERE user_id = ?)
+	ORDER BY t.updated_at DESC, t.id DESC`
+
+	rows, err := ts.db.Query(query, userID, userID)
+	if err != nil {
+		log.Printf("查询模板列表失败: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []PromptTemplate{}
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			log.Printf("扫描模板失败: %v", err)
+			continue
+		}
+		templates = append(templates, *template)
+	}
+	return templates, rows.Err()
+}
+
+// GetTemplateVersion 获取模板的指定版本
+func (ts *TemplateStorage) GetTemplateVersion(templateID, version int) (*TemplateVersion, error) {
+	return scanTemplateVersion(ts.db.QueryRow(`SELECT `+templateVersionColumns+` FROM prompt_template_versions WHERE template_id = ? AND version = ?`,
+		templateID, version))
+}
+
+// ListTemplateVersions 获取模板的全部版本，新版本在前
+func (ts *TemplateStorage) ListTemplateVersions(templateID int) ([]TemplateVersion, error) {
+	rows, err := ts.db.Query(`SELECT `+templateVersionColumns+` FROM prompt_template_versions WHERE template_id = ? ORDER BY version DESC`, templateID)
+	if err != nil {
+		log.Printf("查询模板版本失败: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []TemplateVersion{}
+	for rows.Next() {
+		version, err := scanTemplateVersion(rows)
+		if err != nil {
+			log.Printf("扫描模板版本失败: %v", err)
+			continue
+		}
+		versions = append(versions, *version)
+	}
+	return versions, rows.Err()
+}
+
+// ShareTemplate 将模板共享给用户（重复共享无副作用）
+func (ts *TemplateStorage) ShareTemplate(templateID, userID int) error {
+	if shared, err := ts.TemplateSharedWith(templateID, userID); err != nil || shared {
+		return err
+	}
+
+	if _, err := ts.db.Exec(`INSERT INTO prompt_template_shares (template_id, user_id) VALUES (?, ?)`, templateID, userID); err != nil {
+		log.Printf("共享模板失败: %v", err)
+		return err
+	}
+	return nil
+}
+
+// UnshareTemplate 取消对用户的共享，未共享时返回sql.ErrNoRows
+func (ts *TemplateStorage) UnshareTemplate(templateID, userID int) error {
+	result, err := ts.db.Exec(`DELETE FROM prompt_template_shares WHERE template_id = ? AND user_id = ?`, templateID, userID)
+	if err != nil {
+		log.Printf("取消共享模板失败: %v", err)
+		return err
+	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// TemplateSharedWith 模板是否已共享给用户
+func (ts *TemplateStorage) TemplateSharedWith(templateID, userID int) (bool, error) {
+	var count int
+	err := ts.db.QueryRow(`SELECT COUNT(*) FROM prompt_template_shares WHERE template_id = ? AND user_id = ?`, templateID, userID).Scan(&count)
+	if err != nil {
+		log.Printf("检查模板共享失败: %v", err)
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ListTemplateShares 获取模板共享的用户
+func (ts *TemplateStorage) ListTemplateShares(templateID int) ([]TemplateShare, error) {
+	rows, err := ts.db.Query(`SELECT s.template_id, s.user_id, u.username, s.created_at FROM prompt_template_shares s
+	JOIN users u ON u.id = s.user_id
+	WHERE s.template_id = ? ORDER BY s.created_at`, templateID)
+	if err != nil {
+		log.Printf("查询模板共享失败: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []TemplateShare{}
+	for rows.Next() {
+		var share TemplateShare
+		if err := rows.Scan(&share.TemplateID, &share.UserID, &share.Username, &share.CreatedAt); err != nil {
+			log.Printf("扫描模板共享失败: %v", err)
+			continue
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+// scanTemplate 按templateColumns的顺序扫描模板
+func scanTemplate(row rowScanner) (*PromptTemplate, error) {
+	var template PromptTemplate
+	var variables string
+	err := row.Scan(&template.ID, &template.UserID, &template.Name, &template.Description, &template.Version,
+		&template.Body, &template.SystemPrompt, &variables, &template.CreatedAt, &template.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if variables != "" {
+		template.Variables = json.RawMessage(variables)
+	}
+	return &template, nil
+}
+
+// scanTemplateVersion 按templateVersionColumns的顺序扫描模板版本
+func scanTemplateVersion(row rowScanner) (*TemplateVersion, error) {
+	var version TemplateVersion
+	var variables string
+	err := row.Scan(&version.TemplateID, &version.Version, &version.Body, &version.SystemPrompt, &variables, &version.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if variables != "" {
+		version.Variables = json.RawMessage(variables)
+	}
+	return &version, nil
+}
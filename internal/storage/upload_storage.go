@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+)
+
+// ErrUploadQuota 上传文件的总大小超出配额
+var ErrUploadQuota = errors.New("上传空间不足")
+
+// uploadColumns 上传文件查询字段
+const uploadColumns = `id, user_id, anon_token_hash, filename, mime_type, size, storage_name, created_at`
+
+// UploadStorage 上传文件数据库操作
+type UploadStorage struct {
+	db *DB
+}
+
+// NewUploadStorage 创建上传文件存储实例
+func NewUploadStorage(db *DB) *UploadStorage {
+	return &UploadStorage{db: db}
+}
+
+// CreateUpload 保存上传文件的元数据，归属于认证用户或匿名会话；所有者已上传文件的总大小加上u.Size超过quota时
+// 返回ErrUploadQuota。认证用户的统计和写入在同一事务中进行并先锁定用户行，并发上传不会超出配额
+func (us *UploadStorage) CreateUpload(u Upload, owner RecordOwner, quota int64) (*Upload, error) {
+	anonTokenHash := ""
+	if owner.UserID == nil && owner.AnonToken != "" {
+		anonTokenHash = HashAnonToken(owner.AnonToken)
+	}
+
+	tx, err := us.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var used int64
+	if owner.UserID != nil {
+		// 空更新取得用户行的写锁（SQLite为数据库写锁），同一用户的上传在此排队
+		if _, err := tx.Exec(`UPDATE users SET updated_at = updated_at WHERE id = ?`, *owner.UserID); err != nil {
+			return nil, err
+		}
+		err = tx.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM uploads WHERE user_id = ?`, *owner.UserID).Scan(&used)
+	} else {
+		err = tx.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM uploads WHERE user_id IS NULL AND anon_token_hash = ?`, anonTokenHash).Scan(&used)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if used+u.Size > quota {
+		return nil, ErrUploadQuota
+	}
+
+	id, err := tx.InsertID(`INSERT INTO uploads (user_id, anon_token_hash, filename, mime_type, size, storage_name) VALUES (?, ?, ?, ?, ?, ?)`,
+		owner.UserID, anonTokenHash, u.Filename, u.MimeType, u.Size, u.StorageName)
+	if err != nil {
+		log.Printf("保存上传文件失败: %v", err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("上传文件保存成功，ID: %d, 类型: %s, 大小: %d", id, u.MimeType, u.Size)
+	return us.GetUpload(id)
+}
+
+// GetUpload 根据ID获取上传文件，不存在时返回sql.ErrNoRows
+func (us *UploadStorage) GetUpload(id int) (*Upload, error) {
+	var upload Upload
+	var userID sql.NullInt64
+	err := us.db.QueryRow(`SELECT `+uploadColumns+` FROM uploads WHERE id = ?`, id).Scan(
+		&upload.ID, &userID, &upload.AnonTokenHash, &upload.Filename, &upload.MimeType, &upload.Size,
+		&upload.StorageName, &upload.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if userID.Valid {
+		id := int(userID.Int64)
+		upload.UserID = &id
+	}
+	return &upload, nil
+}
+
+// DeleteUpload 删除上传文件的元数据，不存在时返回sql.ErrNoRows
+func (us *UploadStorage) DeleteUpload(id int) error {
+	result, err := us.db.Exec(`DELETE FROM uploads WHERE id = ?`, id)
+	if err != nil {
+		log.Printf("删除上传文件失败: %v", err)
+		return err
+	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -12,47 +12,16 @@ import (
 
 // UserStorage 用户数据库操作
 type UserStorage struct {
-	db *sql.DB
+	db *DB
 }
 
 // NewUserStorage 创建用户存储实例
-func NewUserStorage(db *sql.DB) *UserStorage {
+func NewUserStorage(db *DB) *UserStorage {
 	return &UserStorage{db: db}
 }
 
-// InitUserTables 初始化用户相关表
-func (us *UserStorage) InitUserTables() error {
-	// 创建用户表
-	userTableQuery := `
-	CREATE TABLE IF NOT EXISTS users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		username TEXT UNIQUE NOT NULL,
-		email TEXT UNIQUE NOT NULL,
-		password_hash TEXT NOT NULL,
-		api_key TEXT UNIQUE,
-		is_active BOOLEAN DEFAULT 1,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	if _, err := us.db.Exec(userTableQuery); err != nil {
-		log.Printf("创建用户表失败: %v", err)
-		return err
-	}
-
-	// 为现有的qa_records表添加user_id字段
-	alterTableQuery := `
-	ALTER TABLE qa_records ADD COLUMN user_id INTEGER REFERENCES users(id);`
-
-	// 忽略错误，因为字段可能已经存在
-	us.db.Exec(alterTableQuery)
-
-	log.Println("用户表初始化成功")
-	return nil
-}
-
 // CreateUser 创建新用户
-func (us *UserStorage) CreateUser(username, email, password string) (interface{}, error) {
+func (us *UserStorage) CreateUser(username, email, password string) (*User, error) {
 	// 检查用户名是否已存在
 	if exists, err := us.UserExists(username, email); err != nil {
 		return nil, err
@@ -77,27 +46,17 @@ func (us *UserStorage) CreateUser(username, email, password string) (interface{}
 	INSERT INTO users (username, email, password_hash, api_key) 
 	VALUES (?, ?, ?, ?)
 	`
-	result, err := us.db.Exec(query, username, email, string(hashedPassword), apiKey)
+	userID, err := us.db.InsertID(query, username, email, string(hashedPassword), apiKey)
 	if err != nil {
 		return nil, fmt.Errorf("创建用户失败: %v", err)
 	}
 
-	userID, err := result.LastInsertId()
-	if err != nil {
-		return nil, fmt.Errorf("获取用户ID失败: %v", err)
-	}
-
 	// 返回创建的用户
-	userInterface, err := us.GetUserByID(int(userID))
+	user, err := us.GetUserByID(userID)
 	if err != nil {
 		return nil, fmt.Errorf("获取创建的用户失败: %v", err)
 	}
 
-	user, ok := userInterface.(*User)
-	if !ok {
-		return nil, fmt.Errorf("用户类型断言失败")
-	}
-
 	log.Printf("用户创建成功: %s (ID: %d)", user.Username, user.ID)
 	return user, nil
 }
@@ -105,14 +64,14 @@ func (us *UserStorage) CreateUser(username, email, password string) (interface{}
 // GetUserByUsername 根据用户名获取用户
 func (us *UserStorage) GetUserByUsername(username string) (*User, error) {
 	query := `
-	SELECT id, username, email, password_hash, api_key, is_active, created_at, updated_at 
-	FROM users WHERE username = ? AND is_active = 1
+	SELECT id, username, email, password_hash, api_key, is_active, is_admin, default_persona_id, show_reasoning, created_at, updated_at 
+	FROM users WHERE username = ? AND is_active = TRUE
 	`
 
 	var user User
 	err := us.db.QueryRow(query, username).Scan(
 		&user.ID, &user.Username, &user.Email, &user.Password,
-		&user.APIKey, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+		&user.APIKey, &user.IsActive, &user.IsAdmin, &user.DefaultPersonaID, &user.ShowReasoning, &user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err != nil {
@@ -126,16 +85,16 @@ func (us *UserStorage) GetUserByUsername(username string) (*User, error) {
 }
 
 // GetUserByID 根据ID获取用户
-func (us *UserStorage) GetUserByID(id int) (interface{}, error) {
+func (us *UserStorage) GetUserByID(id int) (*User, error) {
 	query := `
-	SELECT id, username, email, password_hash, api_key, is_active, created_at, updated_at 
-	FROM users WHERE id = ? AND is_active = 1
+	SELECT id, username, email, password_hash, api_key, is_active, is_admin, default_persona_id, show_reasoning, created_at, updated_at 
+	FROM users WHERE id = ? AND is_active = TRUE
 	`
 
 	var user User
 	err := us.db.QueryRow(query, id).Scan(
 		&user.ID, &user.Username, &user.Email, &user.Password,
-		&user.APIKey, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+		&user.APIKey, &user.IsActive, &user.IsAdmin, &user.DefaultPersonaID, &user.ShowReasoning, &user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err != nil {
@@ -149,7 +108,7 @@ func (us *UserStorage) GetUserByID(id int) (interface{}, error) {
 }
 
 // ValidateUser 验证用户登录
-func (us *UserStorage) ValidateUser(username, password string) (interface{}, error) {
+func (us *UserStorage) ValidateUser(username, password string) (*User, error) {
 	user, err := us.GetUserByUsername(username)
 	if err != nil {
 		return nil, err
@@ -190,6 +149,32 @@ func (us *UserStorage) UpdateUserLastLogin(userID int) error {
 	return nil
 }
 
+// SetDefaultPersona 设置用户的默认角色，personaID为nil时清除
+func (us *UserStorage) SetDefaultPersona(userID int, personaID *int) error {
+	query := `UPDATE users SET default_persona_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+
+	_, err := us.db.Exec(query, personaID, userID)
+	if err != nil {
+		log.Printf("设置用户默认角色失败: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// SetShowReasoning 设置用户是否显示推理模型的思考过程
+func (us *UserStorage) SetShowReasoning(userID int, show bool) error {
+	query := `UPDATE users SET show_reasoning = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+
+	_, err := us.db.Exec(query, show, userID)
+	if err != nil {
+		log.Printf("设置思考过程显示偏好失败: %v", err)
+		return err
+	}
+
+	return nil
+}
+
 // generateAPIKey 生成API密钥
 func (us *UserStorage) generateAPIKey() (string, error) {
 	bytes := make([]byte, 32)
@@ -200,9 +185,9 @@ func (us *UserStorage) generateAPIKey() (string, error) {
 }
 
 // GetAllUsers 获取所有用户（管理员功能）
-func (us *UserStorage) GetAllUsers() (interface{}, error) {
+func (us *UserStorage) GetAllUsers() ([]User, error) {
 	query := `
-	SELECT id, username, email, api_key, is_active, created_at, updated_at 
+	SELECT id, username, email, api_key, is_active, is_admin, default_persona_id, show_reasoning, created_at, updated_at 
 	FROM users ORDER BY created_at DESC
 	`
 
@@ -217,7 +202,7 @@ func (us *UserStorage) GetAllUsers() (interface{}, error) {
 		var user User
 		err := rows.Scan(
 			&user.ID, &user.Username, &user.Email,
-			&user.APIKey, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+			&user.APIKey, &user.IsActive, &user.IsAdmin, &user.DefaultPersonaID, &user.ShowReasoning, &user.CreatedAt, &user.UpdatedAt,
 		)
 		if err != nil {
 			log.Printf("扫描用户记录失败: %v", err)
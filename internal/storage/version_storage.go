@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"log"
+	"strings"
+)
+
+// ListRecordVersions 获取记录所在轮次的全部版本（第一个版本及重新生成、编辑产生的版本），按版本号排序
+func (s *QAStorage) ListRecordVersions(recordID int) ([]QARecord, error) {
+	var group int
+	if err := s.db.QueryRow(`SELECT COALESCE(version_of, id) FROM qa_records WHERE id = ?`, recordID).Scan(&group); err != nil {
+		return nil, err
+	}
+	return s.queryRecords(`SELECT `+recordColumns("")+` FROM qa_records WHERE id = ? OR version_of = ? ORDER BY version, id`, group, group)
+}
+
+// GetConversationTree 获取记录所在会话的全部记录：从会话第一轮的全部版本开始，逐层加入以其为上一轮的记录。
+// 同一parent_id下的记录互为分支（同一轮的不同版本或在同一轮之后的不同追问），按ID排序返回
+func (s *QAStorage) GetConversationTree(recordID int) ([]QARecord, error) {
+	// 沿parent_id找到会话第一轮
+	rootID := recordID
+	for {
+		var parentID *int
+		if err := s.db.QueryRow(`SELECT parent_id FROM qa_records WHERE id = ?`, rootID).Scan(&parentID); err != nil {
+			return nil, err
+		}
+		if parentID == nil {
+			break
+		}
+		rootID = *parentID
+	}
+
+	records, err := s.ListRecordVersions(rootID)
+	if err != nil {
+		return nil, err
+	}
+
+	frontier := make([]interface{}, 0, len(records))
+	for _, record := range records {
+		frontier = append(frontier, record.ID)
+	}
+	for len(frontier) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(frontier)), ", ")
+		children, err := s.queryRecords(`SELECT `+recordColumns("")+` FROM qa_records WHERE parent_id IN (`+placeholders+`) ORDER BY id`, frontier...)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, children...)
+
+		frontier = frontier[:0]
+		for _, child := range children {
+			frontier = append(frontier, child.ID)
+		}
+	}
+	return records, nil
+}
+
+// queryRecords 查询并扫描多条记录
+func (s *QAStorage) queryRecords(query string, args ...interface{}) ([]QARecord, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		log.Printf("查询记录失败: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []QARecord{}
+	for rows.Next() {
+		record, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,172 @@
+// Package templates 提示词模板：{{变量}}占位符的解析、变量定义校验和按类型渲染。
+package templates
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 变量类型
+const (
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeInteger = "integer"
+	TypeBoolean = "boolean"
+	TypeEnum    = "enum"
+)
+
+var (
+	// placeholderPattern 模板占位符 {{name}}，名称两侧允许空白
+	placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+	// variableNamePattern 变量名：字母、数字和下划线，不以数字开头
+	variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Variable 模板变量定义
+type Variable struct {
+	Name        string      `json:"name" validate:"required,max=64"`
+	Type        string      `json:"type,omitempty" validate:"omitempty,oneof=string number integer boolean enum"` // 为空时为string
+	Description string      `json:"description,omitempty" validate:"max=500"`
+	Required    bool        `json:"required,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+	Options     []string    `json:"options,omitempty" validate:"max=50"`   // enum类型的可选值
+	MaxLength   int         `json:"max_length,omitempty" validate:"min=0"` // string类型的最大长度（字符数），0表示不限制
+}
+
+// kind 变量的实际类型
+func (v Variable) kind() string {
+	if v.Type == "" {
+		return TypeString
+	}
+	return v.Type
+}
+
+// Placeholders 按出现顺序返回模板中的占位符名称（去重）
+func Placeholders(body string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range placeholderPattern.FindAllStringSubmatch(body, -1) {
+		if name := match[1]; !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Validate 校验模板定义：变量名唯一且合法，模板中的占位符都已定义，enum有可选值，默认值符合类型
+func Validate(body string, variables []Variable) error {
+	defined := make(map[string]bool, len(variables))
+	for _, variable := range variables {
+		if !variableNamePattern.MatchString(variable.Name) {
+			return fmt.Errorf("变量名 %q 无效，只能包含字母、数字和下划线且不能以数字开头", variable.Name)
+		}
+		if defined[variable.Name] {
+			return fmt.Errorf("变量 %s 重复定义", variable.Name)
+		}
+		defined[variable.Name] = true
+
+		if variable.kind() == TypeEnum && len(variable.Options) == 0 {
+			return fmt.Errorf("enum类型的变量 %s 需要指定options", variable.Name)
+		}
+		if variable.Default != nil {
+			if _, err := variable.format(variable.Default); err != nil {
+				return fmt.Errorf("变量 %s 的默认值无效: %v", variable.Name, err)
+			}
+		}
+	}
+
+	for _, name := range Placeholders(body) {
+		if !defined[name] {
+			return fmt.Errorf("占位符 {{%s}} 未定义对应的变量", name)
+		}
+	}
+	return nil
+}
+
+// Render 校验变量值并渲染模板：未提供的变量使用默认值，必填变量缺失或值类型不符时返回错误
+func Render(body string, variables []Variable, values map[string]interface{}) (string, error) {
+	byName := make(map[string]Variable, len(variables))
+	for _, variable := range variables {
+		byName[variable.Name] = variable
+	}
+	for name := range values {
+		if _, ok := byName[name]; !ok {
+			return "", fmt.Errorf("未定义的变量: %s", name)
+		}
+	}
+
+	rendered := make(map[string]string, len(variables))
+	for _, variable := range variables {
+		value, ok := values[variable.Name]
+		if !ok || value == nil {
+			if variable.Default == nil {
+				if variable.Required {
+					return "", fmt.Errorf("缺少必填变量: %s", variable.Name)
+				}
+				rendered[variable.Name] = ""
+				continue
+			}
+			value = variable.Default
+		}
+
+		text, err := variable.format(value)
+		if err != nil {
+			return "", fmt.Errorf("变量 %s 的值无效: %v", variable.Name, err)
+		}
+		rendered[variable.Name] = text
+	}
+
+	return placeholderPattern.ReplaceAllStringFunc(body, func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		return rendered[name]
+	}), nil
+}
+
+// format 按变量类型校验JSON解码后的值并转换为文本
+func (v Variable) format(value interface{}) (string, error) {
+	switch v.kind() {
+	case TypeString:
+		text, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("应为字符串")
+		}
+		if v.MaxLength > 0 && len([]rune(text)) > v.MaxLength {
+			return "", fmt.Errorf("长度不能超过 %d", v.MaxLength)
+		}
+		return text, nil
+	case TypeNumber:
+		number, ok := value.(float64)
+		if !ok {
+			return "", fmt.Errorf("应为数字")
+		}
+		return strconv.FormatFloat(number, 'f', -1, 64), nil
+	case TypeInteger:
+		number, ok := value.(float64)
+		if !ok || number != math.Trunc(number) {
+			return "", fmt.Errorf("应为整数")
+		}
+		return strconv.FormatInt(int64(number), 10), nil
+	case TypeBoolean:
+		flag, ok := value.(bool)
+		if !ok {
+			return "", fmt.Errorf("应为布尔值")
+		}
+		return strconv.FormatBool(flag), nil
+	case TypeEnum:
+		text, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("应为字符串")
+		}
+		for _, option := range v.Options {
+			if text == option {
+				return text, nil
+			}
+		}
+		return "", fmt.Errorf("应为 %s 之一", strings.Join(v.Options, "、"))
+	}
+	return "", fmt.Errorf("未知的变量类型: %s", v.Type)
+}
@@ -0,0 +1,133 @@
+// Package uploads 上传图片的本地磁盘存储：按文件内容检测类型，校验大小后以随机文件名保存。
+package uploads
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// DefaultMaxBytes 未配置时单个文件的最大字节数
+const DefaultMaxBytes = 10 << 20
+
+// DefaultQuotaBytes 未配置时每个用户上传文件的总字节数上限
+const DefaultQuotaBytes = 100 << 20
+
+var (
+	// ErrTooLarge 文件超过大小限制
+	ErrTooLarge = errors.New("文件过大")
+	// ErrUnsupportedType 文件类型不是允许的图片格式
+	ErrUnsupportedType = errors.New("不支持的文件类型")
+	// ErrEmpty 文件为空
+	ErrEmpty = errors.New("文件为空")
+)
+
+// allowedTypes 允许上传的图片类型及保存时使用的扩展名（视觉模型普遍支持的格式）
+var allowedTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// Store 上传文件的磁盘存储
+type Store struct {
+	dir        string
+	maxBytes   int64
+	quotaBytes int64
+}
+
+// File 已保存的文件
+type File struct {
+	Name     string // 目录内的文件名
+	MimeType string
+	Size     int64
+}
+
+// NewStore 创建磁盘存储，目录不存在时自动创建；maxBytes、quotaBytes<=0时使用DefaultMaxBytes、DefaultQuotaBytes
+func NewStore(dir string, maxBytes, quotaBytes int64) (*Store, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	if quotaBytes <= 0 {
+		quotaBytes = DefaultQuotaBytes
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建上传目录失败: %v", err)
+	}
+	return &Store{dir: dir, maxBytes: maxBytes, quotaBytes: quotaBytes}, nil
+}
+
+// MaxBytes 单个文件的最大字节数
+func (s *Store) MaxBytes() int64 {
+	return s.maxBytes
+}
+
+// QuotaBytes 每个用户上传文件的总字节数上限
+func (s *Store) QuotaBytes() int64 {
+	return s.quotaBytes
+}
+
+// Save 读取并校验文件内容（大小、按内容检测的图片类型），以随机文件名保存
+func (s *Store) Save(r io.Reader) (*File, error) {
+	data, err := io.ReadAll(io.LimitReader(r, s.maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrEmpty
+	}
+	if int64(len(data)) > s.maxBytes {
+		return nil, ErrTooLarge
+	}
+
+	// 按文件内容检测类型，不信任客户端声明的Content-Type和扩展名
+	mimeType := mimetype.Detect(data).String()
+	ext, ok := allowedTypes[mimeType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, mimeType)
+	}
+
+	name, err := randomName(ext)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, name), data, 0o644); err != nil {
+		return nil, fmt.Errorf("保存文件失败: %v", err)
+	}
+
+	return &File{Name: name, MimeType: mimeType, Size: int64(len(data))}, nil
+}
+
+// Read 读取已保存的文件
+func (s *Store) Read(name string) ([]byte, error) {
+	return os.ReadFile(s.path(name))
+}
+
+// Remove 删除已保存的文件，文件不存在时忽略
+func (s *Store) Remove(name string) error {
+	if err := os.Remove(s.path(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// path 文件在磁盘上的路径，只取文件名部分防止目录穿越
+func (s *Store) path(name string) string {
+	return filepath.Join(s.dir, filepath.Base(name))
+}
+
+// randomName 生成随机文件名
+func randomName(ext string) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf) + ext, nil
+}
@@ -32,17 +32,43 @@ func NewAliProvider(config ProviderConfig) *AliProvider {
 }
 
 func (p *AliProvider) AskQuestion(question string) (string, error) {
+	return p.AskQuestionWithOptions(question, QuestionOptions{})
+}
+
+// AskQuestionWithOptions 携带系统提示词和生成参数提问，参数写入DashScope的parameters（不支持frequency_penalty）
+func (p *AliProvider) AskQuestionWithOptions(question string, opts QuestionOptions) (string, error) {
+	params := opts.Params
+	parameters := map[string]interface{}{
+		"result_format": "message",
+	}
+	if params.Temperature != nil {
+		parameters["temperature"] = *params.Temperature
+	}
+	if params.TopP != nil {
+		parameters["top_p"] = *params.TopP
+	}
+	if params.MaxTokens != nil {
+		parameters["max_tokens"] = *params.MaxTokens
+	}
+	if len(params.Stop) > 0 {
+		parameters["stop"] = params.Stop
+	}
+	if params.Seed != nil {
+		parameters["seed"] = *params.Seed
+	}
+	if params.PresencePenalty != nil {
+		parameters["presence_penalty"] = *params.PresencePenalty
+	}
+
 	request := map[string]interface{}{
 		"model": p.config.Model,
 		"input": map[string]interface{}{
 			"messages": []map[string]string{
-				{"role": "system", "content": "你是一个有用的AI助手。"},
+				{"role": "system", "content": p.config.systemPrompt(opts.SystemPrompt)},
 				{"role": "user", "content": question},
 			},
 		},
-		"parameters": map[string]interface{}{
-			"result_format": "message",
-		},
+		"parameters": parameters,
 	}
 
 	jsonData, _ := json.Marshal(request)
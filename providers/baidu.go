@@ -29,6 +29,12 @@ func NewBaiduProvider(config ProviderConfig) *BaiduProvider {
 }
 
 func (p *BaiduProvider) AskQuestion(question string) (string, error) {
+	return p.AskQuestionWithOptions(question, QuestionOptions{})
+}
+
+// AskQuestionWithOptions 携带系统提示词和生成参数提问（文心API通过system字段接收系统提示词，支持temperature、top_p、max_output_tokens和stop）
+func (p *BaiduProvider) AskQuestionWithOptions(question string, opts QuestionOptions) (string, error) {
+	params := opts.Params
 	// 百度API需要先获取access_token
 	if p.accessToken == "" {
 		if err := p.getAccessToken(); err != nil {
@@ -40,6 +46,19 @@ func (p *BaiduProvider) AskQuestion(question string) (string, error) {
 		"messages": []map[string]string{
 			{"role": "user", "content": question},
 		},
+		"system": p.config.systemPrompt(opts.SystemPrompt),
+	}
+	if params.Temperature != nil {
+		request["temperature"] = *params.Temperature
+	}
+	if params.TopP != nil {
+		request["top_p"] = *params.TopP
+	}
+	if params.MaxTokens != nil {
+		request["max_output_tokens"] = *params.MaxTokens
+	}
+	if len(params.Stop) > 0 {
+		request["stop"] = params.Stop
 	}
 
 	apiURL := fmt.Sprintf("%s?access_token=%s", p.config.APIURL, p.accessToken)
@@ -41,7 +41,7 @@ func (p *BellaProvider) AskQuestion(question string) (string, error) {
 		Messages: []Message{
 			{
 				Role:    "system",
-				Content: "你是一个有用的AI助手，请用中文回答问题。",
+				Content: p.config.systemPrompt(""),
 			},
 			{
 				Role:    "user",
@@ -215,6 +215,11 @@ func (p *BellaProvider) ChatCompletionStream(ctx context.Context, req *ChatCompl
 	return responseChan, errorChan
 }
 
+// CreateEmbeddings 调用Bella向量接口（OpenAI兼容）
+func (p *BellaProvider) CreateEmbeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	return requestEmbeddings(ctx, p.client, embeddingURL(p.config.APIURL), p.config.APIKey, req)
+}
+
 // GetProviderName 获取提供商名称
 func (p *BellaProvider) GetProviderName() string {
 	return "Bella"
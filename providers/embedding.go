@@ -0,0 +1,96 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// mockEmbeddingDim Mock向量维度
+const mockEmbeddingDim = 256
+
+// embeddingURL 根据聊天接口地址推导OpenAI兼容的向量接口地址
+func embeddingURL(chatURL string) string {
+	if strings.HasSuffix(chatURL, "/chat/completions") {
+		return strings.TrimSuffix(chatURL, "/chat/completions") + "/embeddings"
+	}
+	return strings.TrimSuffix(chatURL, "/") + "/embeddings"
+}
+
+// requestEmbeddings 调用OpenAI兼容的向量接口
+func requestEmbeddings(ctx context.Context, client *http.Client, url, apiKey string, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %v", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("创建HTTP请求失败: %v", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("发送HTTP请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API请求失败，状态码: %d, 响应: %s", resp.StatusCode, string(body))
+	}
+
+	var response EmbeddingResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+
+	if len(response.Data) != len(req.Input) {
+		return nil, fmt.Errorf("向量数量不匹配: 期望%d, 实际%d", len(req.Input), len(response.Data))
+	}
+
+	return &response, nil
+}
+
+// hashEmbedding 基于字符二元组哈希生成确定性向量（演示模式使用）
+func hashEmbedding(text string) []float32 {
+	vector := make([]float32, mockEmbeddingDim)
+	runes := []rune(strings.ToLower(text))
+
+	for i := range runes {
+		end := i + 2
+		if end > len(runes) {
+			end = len(runes)
+		}
+		h := fnv.New32a()
+		h.Write([]byte(string(runes[i:end])))
+		vector[h.Sum32()%mockEmbeddingDim]++
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return vector
+	}
+
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range vector {
+		vector[i] *= scale
+	}
+	return vector
+}
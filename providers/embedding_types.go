@@ -0,0 +1,22 @@
+package providers
+
+// EmbeddingRequest 向量嵌入请求（OpenAI兼容格式）
+type EmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// EmbeddingData 单条向量数据
+type EmbeddingData struct {
+	Object    string    `json:"object"`
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// EmbeddingResponse 向量嵌入响应
+type EmbeddingResponse struct {
+	Object string          `json:"object"`
+	Model  string          `json:"model"`
+	Data   []EmbeddingData `json:"data"`
+	Usage  *Usage          `json:"usage,omitempty"`
+}
@@ -34,7 +34,20 @@ func NewGeminiProvider(config ProviderConfig) *GeminiProvider {
 
 // GeminiRequest Gemini API请求结构
 type GeminiRequest struct {
-	Contents []GeminiContent `json:"contents"`
+	Contents          []GeminiContent         `json:"contents"`
+	SystemInstruction *GeminiContent          `json:"systemInstruction,omitempty"`
+	GenerationConfig  *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+// GeminiGenerationConfig Gemini生成参数
+type GeminiGenerationConfig struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"topP,omitempty"`
+	MaxOutputTokens  *int     `json:"maxOutputTokens,omitempty"`
+	StopSequences    []string `json:"stopSequences,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	PresencePenalty  *float64 `json:"presencePenalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequencyPenalty,omitempty"`
 }
 
 // GeminiContent Gemini内容结构
@@ -42,9 +55,16 @@ type GeminiContent struct {
 	Parts []GeminiPart `json:"parts"`
 }
 
-// GeminiPart Gemini部分结构
+// GeminiPart Gemini部分结构：文本或内联数据（图片）
 type GeminiPart struct {
-	Text string `json:"text"`
+	Text       string            `json:"text,omitempty"`
+	InlineData *GeminiInlineData `json:"inlineData,omitempty"`
+}
+
+// GeminiInlineData Gemini内联数据（base64编码）
+type GeminiInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
 }
 
 // GeminiResponse Gemini API响应结构
@@ -58,18 +78,40 @@ type GeminiCandidate struct {
 }
 
 func (p *GeminiProvider) AskQuestion(question string) (string, error) {
+	return p.AskQuestionWithOptions(question, QuestionOptions{})
+}
+
+// AskQuestionWithOptions 携带系统提示词和生成参数提问，系统提示词转换为systemInstruction，参数转换为generationConfig
+func (p *GeminiProvider) AskQuestionWithOptions(question string, opts QuestionOptions) (string, error) {
+	params := opts.Params
 	// 构建请求URL
 	url := fmt.Sprintf("%s/models/%s:generateContent", p.config.APIURL, p.config.Model)
 
-	// 构建请求体
+	// 构建请求体，图片作为inlineData与问题放在同一条内容中
+	parts := []GeminiPart{{Text: question}}
+	for _, image := range opts.Images {
+		parts = append(parts, image.geminiPart())
+	}
 	request := GeminiRequest{
 		Contents: []GeminiContent{
 			{
-				Parts: []GeminiPart{
-					{Text: question},
-				},
+				Parts: parts,
 			},
 		},
+		SystemInstruction: &GeminiContent{
+			Parts: []GeminiPart{{Text: p.config.systemPrompt(opts.SystemPrompt)}},
+		},
+	}
+	if !params.IsZero() {
+		request.GenerationConfig = &GeminiGenerationConfig{
+			Temperature:      params.Temperature,
+			TopP:             params.TopP,
+			MaxOutputTokens:  params.MaxTokens,
+			StopSequences:    params.Stop,
+			Seed:             params.Seed,
+			PresencePenalty:  params.PresencePenalty,
+			FrequencyPenalty: params.FrequencyPenalty,
+		}
 	}
 
 	jsonData, err := json.Marshal(request)
@@ -0,0 +1,22 @@
+package providers
+
+import "encoding/base64"
+
+// Image 随问题发送的图片：原始内容和MIME类型，由Provider转换为自身API的格式
+type Image struct {
+	MimeType string
+	Data     []byte
+}
+
+// DataURL 转换为base64 data URL（OpenAI兼容API的image_url）
+func (img Image) DataURL() string {
+	return "data:" + img.MimeType + ";base64," + base64.StdEncoding.EncodeToString(img.Data)
+}
+
+// geminiPart 转换为Gemini的inlineData部分
+func (img Image) geminiPart() GeminiPart {
+	return GeminiPart{InlineData: &GeminiInlineData{
+		MimeType: img.MimeType,
+		Data:     base64.StdEncoding.EncodeToString(img.Data),
+	}}
+}
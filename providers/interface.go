@@ -16,10 +16,36 @@ type ChatCompletionProvider interface {
 	ChatCompletionStream(ctx context.Context, req *ChatCompletionRequest) (<-chan *ChatCompletionStreamResponse, <-chan error)
 }
 
+// OptionsProvider 支持请求级系统提示词和生成参数的提供商，由Provider将其转换为自身API的格式
+// （聊天完成接口的Provider直接通过ChatCompletionRequest接收）
+type OptionsProvider interface {
+	AskQuestionWithOptions(question string, opts QuestionOptions) (string, error)
+}
+
+// DefaultSystemPrompt 未配置系统提示词时所有Provider使用的系统提示词
+const DefaultSystemPrompt = "你是一个有用的AI助手，请用中文回答问题。"
+
 // ProviderConfig 提供商配置
 type ProviderConfig struct {
-	Name   string
-	APIKey string
-	APIURL string
-	Model  string
+	Name         string
+	APIKey       string
+	APIURL       string
+	Model        string
+	SystemPrompt string // 为空时使用DefaultSystemPrompt
+}
+
+// systemPrompt 解析实际使用的系统提示词：请求指定 > 配置 > 默认
+func (c ProviderConfig) systemPrompt(override string) string {
+	if override != "" {
+		return override
+	}
+	if c.SystemPrompt != "" {
+		return c.SystemPrompt
+	}
+	return DefaultSystemPrompt
+}
+
+// EmbeddingProvider 向量嵌入提供商接口
+type EmbeddingProvider interface {
+	CreateEmbeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error)
 }
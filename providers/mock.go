@@ -1,6 +1,7 @@
 package providers
 
 import (
+	"context"
 	"fmt"
 	"log"
 )
@@ -29,6 +30,11 @@ func (p *MockProvider) AskQuestion(question string) (string, error) {
 	return fmt.Sprintf("感谢您的问题：「%s」。这是一个模拟回答，因为当前运行在演示模式下。要获得真实的AI回答，请配置相应的LLM Provider。", question), nil
 }
 
+// AskQuestionWithOptions 模拟回答不受系统提示词和生成参数影响
+func (p *MockProvider) AskQuestionWithOptions(question string, opts QuestionOptions) (string, error) {
+	return p.AskQuestion(question)
+}
+
 func (p *MockProvider) GetProviderName() string {
 	return "Mock Provider (演示模式)"
 }
@@ -37,3 +43,21 @@ func (p *MockProvider) CheckConnection() error {
 	log.Println("Mock Provider连接检查通过")
 	return nil
 }
+
+// CreateEmbeddings 生成基于哈希的模拟向量
+func (p *MockProvider) CreateEmbeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	response := &EmbeddingResponse{
+		Object: "list",
+		Model:  req.Model,
+	}
+
+	for i, input := range req.Input {
+		response.Data = append(response.Data, EmbeddingData{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: hashEmbedding(input),
+		})
+	}
+
+	return response, nil
+}
@@ -2,6 +2,7 @@ package providers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -32,13 +33,34 @@ func NewOpenAIProvider(config ProviderConfig) *OpenAIProvider {
 }
 
 func (p *OpenAIProvider) AskQuestion(question string) (string, error) {
+	return p.AskQuestionWithOptions(question, QuestionOptions{})
+}
+
+// AskQuestionWithOptions 携带系统提示词和生成参数提问，参数名与OpenAI API一致
+func (p *OpenAIProvider) AskQuestionWithOptions(question string, opts QuestionOptions) (string, error) {
+	params := opts.Params
+
+	// 带图片时用户消息为多段内容（问题+base64 data URL图片）
+	var content interface{} = question
+	if len(opts.Images) > 0 {
+		parts := []ContentPart{{Type: "text", Text: question}}
+		for _, image := range opts.Images {
+			parts = append(parts, ContentPart{Type: "image_url", ImageURL: &ImageURL{URL: image.DataURL()}})
+		}
+		content = parts
+	}
+
 	request := map[string]interface{}{
 		"model": p.config.Model,
-		"messages": []map[string]string{
-			{"role": "system", "content": "你是一个有用的AI助手，请用中文回答问题。"},
-			{"role": "user", "content": question},
+		"messages": []map[string]interface{}{
+			{"role": "system", "content": p.config.systemPrompt(opts.SystemPrompt)},
+			{"role": "user", "content": content},
 		},
 	}
+	params.openAIParams(request)
+	if opts.ResponseFormat != nil {
+		request["response_format"] = opts.ResponseFormat
+	}
 
 	return p.makeRequest(request)
 }
@@ -94,3 +116,8 @@ func (p *OpenAIProvider) CheckConnection() error {
 	log.Printf("OpenAI API连接检查通过")
 	return nil
 }
+
+// CreateEmbeddings 调用OpenAI向量接口
+func (p *OpenAIProvider) CreateEmbeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	return requestEmbeddings(ctx, p.client, embeddingURL(p.config.APIURL), p.config.APIKey, req)
+}
@@ -0,0 +1,117 @@
+package providers
+
+// QuestionOptions 单次提问的请求级选项
+type QuestionOptions struct {
+	SystemPrompt   string // 为空时使用Provider配置的系统提示词
+	Params         GenerationParams
+	ResponseFormat map[string]interface{} // OpenAI兼容的response_format，不支持的Provider忽略
+	Images         []Image                // 随问题发送的图片（视觉模型）
+}
+
+// GenerationParams 请求级生成参数（OpenAI兼容命名），nil或空值表示使用Provider默认值
+type GenerationParams struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"top_p,omitempty"`
+	MaxTokens        *int     `json:"max_tokens,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+}
+
+// IsZero 是否未设置任何参数
+func (p GenerationParams) IsZero() bool {
+	return p.Temperature == nil && p.TopP == nil && p.MaxTokens == nil && len(p.Stop) == 0 &&
+		p.Seed == nil && p.PresencePenalty == nil && p.FrequencyPenalty == nil
+}
+
+// Names 返回已设置的参数名
+func (p GenerationParams) Names() []string {
+	var names []string
+	if p.Temperature != nil {
+		names = append(names, "temperature")
+	}
+	if p.TopP != nil {
+		names = append(names, "top_p")
+	}
+	if p.MaxTokens != nil {
+		names = append(names, "max_tokens")
+	}
+	if len(p.Stop) > 0 {
+		names = append(names, "stop")
+	}
+	if p.Seed != nil {
+		names = append(names, "seed")
+	}
+	if p.PresencePenalty != nil {
+		names = append(names, "presence_penalty")
+	}
+	if p.FrequencyPenalty != nil {
+		names = append(names, "frequency_penalty")
+	}
+	return names
+}
+
+// Merge 以override中已设置的参数覆盖p，返回合并后的参数
+func (p GenerationParams) Merge(override GenerationParams) GenerationParams {
+	if override.Temperature != nil {
+		p.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		p.TopP = override.TopP
+	}
+	if override.MaxTokens != nil {
+		p.MaxTokens = override.MaxTokens
+	}
+	if len(override.Stop) > 0 {
+		p.Stop = override.Stop
+	}
+	if override.Seed != nil {
+		p.Seed = override.Seed
+	}
+	if override.PresencePenalty != nil {
+		p.PresencePenalty = override.PresencePenalty
+	}
+	if override.FrequencyPenalty != nil {
+		p.FrequencyPenalty = override.FrequencyPenalty
+	}
+	return p
+}
+
+// ApplyTo 将生成参数写入聊天完成请求
+func (p GenerationParams) ApplyTo(req *ChatCompletionRequest) {
+	req.Temperature = p.Temperature
+	req.TopP = p.TopP
+	req.MaxTokens = p.MaxTokens
+	if len(p.Stop) > 0 {
+		req.Stop = p.Stop
+	}
+	req.Seed = p.Seed
+	req.PresencePenalty = p.PresencePenalty
+	req.FrequencyPenalty = p.FrequencyPenalty
+}
+
+// openAIParams 转换为OpenAI兼容API的请求字段
+func (p GenerationParams) openAIParams(request map[string]interface{}) {
+	if p.Temperature != nil {
+		request["temperature"] = *p.Temperature
+	}
+	if p.TopP != nil {
+		request["top_p"] = *p.TopP
+	}
+	if p.MaxTokens != nil {
+		request["max_tokens"] = *p.MaxTokens
+	}
+	if len(p.Stop) > 0 {
+		request["stop"] = p.Stop
+	}
+	if p.Seed != nil {
+		request["seed"] = *p.Seed
+	}
+	if p.PresencePenalty != nil {
+		request["presence_penalty"] = *p.PresencePenalty
+	}
+	if p.FrequencyPenalty != nil {
+		request["frequency_penalty"] = *p.FrequencyPenalty
+	}
+}